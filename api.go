@@ -0,0 +1,668 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// remixVideoRequest changes a previous video. Model, Size, and Seconds are
+// only sent when overridden; otherwise the server inherits them.
+type remixVideoRequest struct {
+	Prompt  string `json:"prompt"`
+	Model   string `json:"model,omitempty"`
+	Size    string `json:"size,omitempty"`
+	Seconds string `json:"seconds,omitempty"`
+	Seed    *int64 `json:"seed,omitempty"`
+}
+
+type apiError struct {
+	Message string `json:"message"`
+	Type    string `json:"type,omitempty"`
+	Code    string `json:"code,omitempty"`
+}
+
+// statusError is returned for non-2xx API responses. Its text keeps the raw
+// body so nothing the server said is lost; detail is the decoded error
+// object when the body has one.
+type statusError struct {
+	Status     string
+	StatusCode int
+	Body       string
+	RequestID  string // the provider's ID for the request, for support tickets
+	detail     apiError
+	retryAfter time.Duration // how long a 429 asked the client to wait, if it said
+}
+
+func (e *statusError) Error() string {
+	if e.RequestID != "" {
+		return fmt.Sprintf("API %s: %s (request ID %s)", e.Status, e.Body, e.RequestID)
+	}
+	return fmt.Sprintf("API %s: %s", e.Status, e.Body)
+}
+
+// requestIDHeader is where OpenAI returns the ID of each request, which
+// support asks for when investigating one
+const requestIDHeader = "X-Request-Id"
+
+// requestID returns the provider's ID for the request resp answers, or ""
+func requestID(resp *http.Response) string {
+	return resp.Header.Get(requestIDHeader)
+}
+
+// newStatusError reads a failed response into a statusError
+func newStatusError(resp *http.Response) *statusError {
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	e := &statusError{Status: resp.Status, StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(b)), RequestID: requestID(resp)}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		e.retryAfter = rateLimitWait(resp)
+	}
+	var wrapped struct {
+		Error *apiError `json:"error"`
+	}
+	if json.Unmarshal(b, &wrapped) == nil && wrapped.Error != nil {
+		e.detail = *wrapped.Error
+	}
+	return e
+}
+
+// pollBackoff returns how long to wait before polling again after a poll
+// that waited last failed with err, and whether err was a rate limit.
+// Without a Retry-After, the wait doubles each time.
+func pollBackoff(err error, last time.Duration) (time.Duration, bool) {
+	var se *statusError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusTooManyRequests || se.detail.Code == "insufficient_quota" {
+		return 0, false
+	}
+	return min(max(se.retryAfter, 2*last), rateLimitMaxDelay), true
+}
+
+// isModelUnavailable reports whether err means the account can't use the
+// requested model right now (no quota or no access), as opposed to a
+// problem with the request itself or a transient failure
+func isModelUnavailable(err error) bool {
+	var se *statusError
+	if !errors.As(err, &se) {
+		return false
+	}
+	if se.detail.Code == "insufficient_quota" || se.detail.Type == "insufficient_quota" {
+		return true
+	}
+	switch se.StatusCode {
+	case http.StatusForbidden:
+		return true
+	case http.StatusNotFound:
+		return se.detail.Code == "model_not_found"
+	}
+	return false
+}
+
+type videoStatusResponse struct {
+	ID       string    `json:"id"`
+	Status   string    `json:"status"`
+	Error    *apiError `json:"error,omitempty"`
+	Progress int       `json:"progress,omitempty"` // 0-100 percentage
+	// Optional provider-reported stage/detail strings (e.g. "rendering", "post-processing")
+	Stage        string `json:"stage,omitempty"`
+	StatusDetail string `json:"status_detail,omitempty"`
+	Detail       string `json:"detail,omitempty"`
+	Model        string `json:"model,omitempty"`
+	Size         string `json:"size,omitempty"`
+	Seconds      string `json:"seconds,omitempty"`
+	Prompt       string `json:"prompt,omitempty"`
+	Seed         *int64 `json:"seed,omitempty"` // when the model reports the seed it used
+	// Set when the job is a remix
+	RemixedFromVideoID string `json:"remixed_from_video_id,omitempty"`
+	// Optional queue information, when the provider exposes it
+	QueuePosition int   `json:"queue_position,omitempty"`
+	CreatedAt     int64 `json:"created_at,omitempty"`
+	StartedAt     int64 `json:"started_at,omitempty"`
+	CompletedAt   int64 `json:"completed_at,omitempty"`
+	ExpiresAt     int64 `json:"expires_at,omitempty"`
+}
+
+// detail returns the first stage or detail string the provider reported
+func (st *videoStatusResponse) detail() string {
+	for _, d := range []string{st.Stage, st.StatusDetail, st.Detail} {
+		if d = strings.TrimSpace(d); d != "" {
+			return d
+		}
+	}
+	return ""
+}
+
+// describe returns a short human-readable description of the job's current stage
+func (st *videoStatusResponse) describe() string {
+	status := strings.ReplaceAll(strings.ToLower(st.Status), "_", " ")
+	detail := st.detail()
+	if isQueuedStatus(st.Status) && st.StartedAt == 0 {
+		if st.QueuePosition > 0 {
+			return fmt.Sprintf("Queued (position ~%d)", st.QueuePosition)
+		}
+		if detail == "" {
+			return "Queued"
+		}
+	}
+	switch {
+	case status == "" && detail == "":
+		return "Generating video"
+	case detail == "" || strings.EqualFold(detail, status):
+		return capitalize(status)
+	case status == "":
+		return capitalize(detail)
+	}
+	return capitalize(status) + ": " + detail
+}
+
+// videoObject is a video as returned by the remote listing endpoint
+type videoObject struct {
+	ID                 string    `json:"id"`
+	Status             string    `json:"status"`
+	Model              string    `json:"model"`
+	Prompt             string    `json:"prompt,omitempty"`
+	Size               string    `json:"size,omitempty"`
+	Seconds            string    `json:"seconds,omitempty"`
+	Progress           int       `json:"progress,omitempty"`
+	Seed               *int64    `json:"seed,omitempty"`
+	CreatedAt          int64     `json:"created_at"`
+	CompletedAt        int64     `json:"completed_at,omitempty"`
+	ExpiresAt          int64     `json:"expires_at,omitempty"`
+	RemixedFromVideoID string    `json:"remixed_from_video_id,omitempty"`
+	Error              *apiError `json:"error,omitempty"`
+}
+
+type listVideosResponse struct {
+	Data    []videoObject `json:"data"`
+	HasMore bool          `json:"has_more"`
+	FirstID string        `json:"first_id,omitempty"`
+	LastID  string        `json:"last_id,omitempty"`
+}
+
+// idempotencyKeyHeader lets the server recognize a retried create, so a
+// request whose response was lost doesn't start (and bill) a second job
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// newIdempotencyKey returns a key for one submission of body. It is derived
+// from the request plus a random part: retries of this submission share it,
+// but running the same prompt again is a new job, as the user expects.
+func newIdempotencyKey(body []byte) string {
+	nonce := make([]byte, 16)
+	_, _ = rand.Read(nonce)
+	h := sha256.New()
+	h.Write(body)
+	h.Write(nonce)
+	return "sora-cli-" + hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+// maxIdempotencyKey is the longest key accepted from --idempotency-key
+const maxIdempotencyKey = 255
+
+// checkIdempotencyKey validates a user-supplied --idempotency-key
+func checkIdempotencyKey(key string) error {
+	if len(key) > maxIdempotencyKey {
+		return fmt.Errorf("--idempotency-key is longer than %d characters", maxIdempotencyKey)
+	}
+	for _, r := range key {
+		if r <= ' ' || r > '~' {
+			return fmt.Errorf("--idempotency-key may only contain printable ASCII without spaces")
+		}
+	}
+	return nil
+}
+
+// createVideoJob submits a new video job and returns its ID and the
+// ID of the request. A nil seed lets the server pick one. An empty idemKey
+// gets a fresh one (see newIdempotencyKey).
+func createVideoJob(ctx context.Context, c *http.Client, baseURL, apiKey, model, prompt string, ref *inputReference, size, seconds string, seed *int64, idemKey string) (jobID, reqID string, err error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	// Add text fields
+	_ = writer.WriteField("model", model)
+	_ = writer.WriteField("prompt", prompt)
+	if size != "" {
+		_ = writer.WriteField("size", size)
+	}
+	if seconds != "" {
+		_ = writer.WriteField("seconds", seconds)
+	}
+	if seed != nil {
+		_ = writer.WriteField("seed", strconv.FormatInt(*seed, 10))
+	}
+
+	// Add the reference file if provided (already resized by loadInputReference)
+	if ref != nil {
+		// Create form part with proper Content-Type header
+		h := make(map[string][]string)
+		h["Content-Disposition"] = []string{fmt.Sprintf(`form-data; name="input_reference"; filename="%s"`, ref.filename)}
+		h["Content-Type"] = []string{ref.mimeType}
+
+		part, err := writer.CreatePart(h)
+		if err != nil {
+			return "", "", fmt.Errorf("creating form part: %w", err)
+		}
+		if _, err := io.Copy(part, bytes.NewReader(ref.data)); err != nil {
+			return "", "", fmt.Errorf("copying file data: %w", err)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return "", "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(baseURL, "/")+"/videos", &buf)
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if idemKey == "" {
+		idemKey = newIdempotencyKey(buf.Bytes())
+	}
+	req.Header.Set(idempotencyKeyHeader, idemKey)
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer closeBody(resp)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", "", newStatusError(resp)
+	}
+	var out videoStatusResponse
+	if err := decodeResponse(resp, &out); err != nil {
+		return "", "", err
+	}
+	if out.Error != nil && out.Error.Message != "" {
+		return "", requestID(resp), errors.New(out.Error.Message)
+	}
+	if out.ID == "" {
+		return "", requestID(resp), errors.New("missing job id in response")
+	}
+	return out.ID, requestID(resp), nil
+}
+
+// remixVideo submits a remix of videoID and returns the new job's ID and
+// the ID of the request. An empty idemKey gets a fresh one.
+func remixVideo(ctx context.Context, c *http.Client, baseURL, apiKey, videoID string, body remixVideoRequest, idemKey string) (jobID, reqID string, err error) {
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return "", "", err
+	}
+	url := strings.TrimRight(baseURL, "/") + "/videos/" + videoID + "/remix"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(string(buf)))
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("Content-Type", "application/json")
+	if idemKey == "" {
+		idemKey = newIdempotencyKey(append([]byte(videoID), buf...))
+	}
+	req.Header.Set(idempotencyKeyHeader, idemKey)
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer closeBody(resp)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", "", newStatusError(resp)
+	}
+	var out videoStatusResponse
+	if err := decodeResponse(resp, &out); err != nil {
+		return "", "", err
+	}
+	if out.Error != nil && out.Error.Message != "" {
+		return "", requestID(resp), errors.New(out.Error.Message)
+	}
+	if out.ID == "" {
+		return "", requestID(resp), errors.New("missing job id in response")
+	}
+	return out.ID, requestID(resp), nil
+}
+
+// isQueuedStatus reports whether a job status means it hasn't started rendering
+func isQueuedStatus(status string) bool {
+	switch strings.ToLower(status) {
+	case "", "queued", "pending", "submitted":
+		return true
+	}
+	return false
+}
+
+// endedStatuses are statuses in which a job has stopped without a video
+var endedStatuses = []string{"failed", "error", "cancelled", "canceled", "expired", "rejected"}
+
+// endedJobError returns the error for a job that has stopped without a
+// video, or nil while it may still finish. Besides the known end states, a
+// status the CLI doesn't know counts as ended once the server reports a
+// completion time, so it isn't polled until a timeout.
+func endedJobError(st *videoStatusResponse) error {
+	status := strings.ToLower(st.Status)
+	if !slices.Contains(endedStatuses, status) && (st.CompletedAt == 0 || slices.Contains(knownStatuses, status)) {
+		return nil
+	}
+	e := &jobError{status: status}
+	if st.Error != nil {
+		e.detail = *st.Error
+	}
+	return e
+}
+
+func fetchVideoStatus(ctx context.Context, c *http.Client, baseURL, apiKey, id string) (*videoStatusResponse, error) {
+	url := strings.TrimRight(baseURL, "/") + "/videos/" + id
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, newStatusError(resp)
+	}
+	var out videoStatusResponse
+	if err := decodeResponse(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// deleteVideo removes a video and its content from the remote account
+func deleteVideo(ctx context.Context, c *http.Client, baseURL, apiKey, id string) error {
+	url := strings.TrimRight(baseURL, "/") + "/videos/" + id
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer closeBody(resp)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return newStatusError(resp)
+	}
+	return nil
+}
+
+// listVideos fetches every video visible to the API key, following pagination
+func listVideos(ctx context.Context, c *http.Client, baseURL, apiKey string) ([]videoObject, error) {
+	return listRecentVideos(ctx, c, baseURL, apiKey, 0)
+}
+
+// listRecentVideos fetches up to limit videos, newest first (0 = all)
+func listRecentVideos(ctx context.Context, c *http.Client, baseURL, apiKey string, limit int) ([]videoObject, error) {
+	var all []videoObject
+	after := ""
+	for {
+		pageSize := 100
+		if limit > 0 && limit-len(all) < pageSize {
+			pageSize = limit - len(all)
+		}
+		q := url.Values{}
+		q.Set("limit", strconv.Itoa(pageSize))
+		q.Set("order", "desc")
+		if after != "" {
+			q.Set("after", after)
+		}
+		u := strings.TrimRight(baseURL, "/") + "/videos?" + q.Encode()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		req.Header.Set("Accept", "application/json")
+		resp, err := c.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			err := newStatusError(resp)
+			closeBody(resp)
+			return nil, err
+		}
+		var page listVideosResponse
+		err = decodeResponse(resp, &page)
+		closeBody(resp)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, page.Data...)
+
+		if !page.HasMore || len(page.Data) == 0 || (limit > 0 && len(all) >= limit) {
+			if limit > 0 && len(all) > limit {
+				all = all[:limit]
+			}
+			return all, nil
+		}
+		after = page.LastID
+		if after == "" {
+			after = page.Data[len(page.Data)-1].ID
+		}
+	}
+}
+
+// downloadFile saves downloadURL to outPath ("-" for stdout), reporting
+// progress on stderr unless quiet
+func downloadFile(ctx context.Context, c *http.Client, apiKey, downloadURL, outPath string, quiet bool) error {
+	resp, err := openDownload(ctx, c, apiKey, downloadURL)
+	if err != nil {
+		return err
+	}
+	defer closeBody(resp)
+	if kind := manifestKind(resp); kind != "" {
+		return downloadSegmented(ctx, c, apiKey, resp, kind, outPath, quiet)
+	}
+
+	var total int64 = resp.ContentLength
+	var written int64
+	pr := &progressWriter{total: total, written: &written, quiet: quiet}
+
+	if outPath == "-" {
+		// Stream to stdout; only progress to stderr
+		err = resumeCopy(ctx, c, resp, io.MultiWriter(os.Stdout, pr), func(offset int64) (*http.Response, error) {
+			return openDownloadAt(ctx, c, apiKey, downloadURL, offset)
+		})
+		if err != nil {
+			return err
+		}
+		pr.done()
+		return nil
+	}
+
+	// Ensure directory exists
+	if dir := filepath.Dir(outPath); dir != "." && dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+
+	// Create temp file then rename for atomicity
+	tmp := outPath + ".part"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		f.Close()
+		// best-effort cleanup on error
+		if err != nil {
+			_ = os.Remove(tmp)
+		}
+	}()
+
+	err = resumeCopy(ctx, c, resp, io.MultiWriter(f, pr), func(offset int64) (*http.Response, error) {
+		return openDownloadAt(ctx, c, apiKey, downloadURL, offset)
+	})
+	if err != nil {
+		return err
+	}
+	pr.done()
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, outPath)
+}
+
+// resumeCopy copies resp's body to w. When the connection fails partway,
+// it asks for the rest with reopen, as many times and with the same backoff
+// as a failed API request (--max-attempts). reopen should send a Range
+// header from offset; if the server ignores it and sends the whole body
+// again, the part already written is skipped.
+func resumeCopy(ctx context.Context, c *http.Client, resp *http.Response, w io.Writer, reopen func(offset int64) (*http.Response, error)) error {
+	attempts := clientAttempts(c)
+	var offset int64
+	for attempt := 1; ; attempt++ {
+		body := &errReader{r: resp.Body}
+		n, err := io.Copy(w, body)
+		offset += n
+		closeBody(resp)
+		if err == nil {
+			return nil
+		}
+		// Only a failed read is worth retrying; a failed write isn't
+		if body.err == nil || attempt >= attempts || ctx.Err() != nil {
+			return err
+		}
+		wait := retryDelay(attempt)
+		infof("\nDownload interrupted after %s: %v; resuming in %s (attempt %d of %d)\n", humanBytes(offset), err, wait.Round(100*time.Millisecond), attempt+1, attempts)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		if resp, err = reopen(offset); err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusPartialContent {
+			if !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+				closeBody(resp)
+				return fmt.Errorf("resuming download: unexpected Content-Range %q", resp.Header.Get("Content-Range"))
+			}
+		} else if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil {
+			closeBody(resp)
+			return fmt.Errorf("resuming download: %w", err)
+		}
+	}
+}
+
+// errReader remembers the error its reader returned, to tell a dropped
+// connection from a failed write
+type errReader struct {
+	r   io.Reader
+	err error
+}
+
+func (e *errReader) Read(p []byte) (int, error) {
+	n, err := e.r.Read(p)
+	if err != nil && err != io.EOF {
+		e.err = err
+	}
+	return n, err
+}
+
+// openDownload requests a video's content; the caller reads and closes the
+// body
+func openDownload(ctx context.Context, c *http.Client, apiKey, downloadURL string) (*http.Response, error) {
+	return openDownloadAt(ctx, c, apiKey, downloadURL, 0)
+}
+
+// openDownloadAt is openDownload from a byte offset, to resume a download
+// that was cut off
+func openDownloadAt(ctx context.Context, c *http.Client, apiKey, downloadURL string, offset int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, downloadURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Always include Authorization header for /videos/{id}/content endpoint
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	// Resume offsets count the bytes as stored, so they have to be the
+	// bytes as sent; a gzip body would be decoded and its offsets lost
+	req.Header.Set("Accept-Encoding", "identity")
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+		closeBody(resp)
+		if id := requestID(resp); id != "" {
+			return nil, fmt.Errorf("download %s: %s (request ID %s)", resp.Status, strings.TrimSpace(string(b)), id)
+		}
+		return nil, fmt.Errorf("download %s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+	return resp, nil
+}
+
+type progressWriter struct {
+	total   int64
+	written *int64
+	quiet   bool
+}
+
+// done prints the final size once the copy has finished
+func (p *progressWriter) done() {
+	if !p.quiet {
+		infof("\rDownloaded %s\n", humanBytes(atomic.LoadInt64(p.written)))
+	}
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n := len(b)
+	nw := atomic.AddInt64(p.written, int64(n))
+	if p.quiet {
+		return n, nil
+	}
+	if p.total > 0 {
+		pct := float64(nw) / float64(p.total) * 100
+		infof("\rDownloading: %s / %s (%.1f%%)", humanBytes(nw), humanBytes(p.total), pct)
+	} else {
+		infof("\rDownloading: %s", humanBytes(nw))
+	}
+	return n, nil
+}
+
+func humanBytes(n int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	size := float64(n)
+	for _, unit := range units {
+		if size < 1024 {
+			return fmt.Sprintf("%.1f %s", size, unit)
+		}
+		size /= 1024
+	}
+	return fmt.Sprintf("%.1f TiB", size)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+)
+
+// reply is one scripted response to a download request: status, the
+// Content-Range header, and a body that fails after its data if cut is set
+type reply struct {
+	status       int
+	contentRange string
+	data         string
+	cut          bool
+}
+
+func (r reply) response() *http.Response {
+	var body io.Reader = strings.NewReader(r.data)
+	if r.cut {
+		body = io.MultiReader(body, iotest.ErrReader(io.ErrUnexpectedEOF))
+	}
+	resp := &http.Response{StatusCode: r.status, Header: http.Header{}, Body: io.NopCloser(body)}
+	if r.contentRange != "" {
+		resp.Header.Set("Content-Range", r.contentRange)
+	}
+	return resp
+}
+
+// failingWriter fails every write
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestResumeCopy(t *testing.T) {
+	const video = "0123456789abcdefghij"
+	tests := []struct {
+		name     string
+		attempts int
+		first    reply
+		reopens  []reply // answers to reopen, in order
+		offsets  []int64 // offsets reopen should be asked for
+		failW    bool
+		wantErr  string
+	}{
+		{name: "whole body", attempts: 3, first: reply{status: 200, data: video}},
+		{
+			name: "resumed with a range", attempts: 3,
+			first:   reply{status: 200, data: video[:7], cut: true},
+			reopens: []reply{{status: 206, contentRange: "bytes 7-19/20", data: video[7:]}},
+			offsets: []int64{7},
+		},
+		{
+			name: "server ignores the range", attempts: 3,
+			first:   reply{status: 200, data: video[:7], cut: true},
+			reopens: []reply{{status: 200, data: video}},
+			offsets: []int64{7},
+		},
+		{
+			name: "cut twice", attempts: 3,
+			first: reply{status: 200, data: video[:5], cut: true},
+			reopens: []reply{
+				{status: 206, contentRange: "bytes 5-19/20", data: video[5:12], cut: true},
+				{status: 206, contentRange: "bytes 12-19/20", data: video[12:]},
+			},
+			offsets: []int64{5, 12},
+		},
+		{
+			name: "out of attempts", attempts: 2,
+			first:   reply{status: 200, data: video[:5], cut: true},
+			reopens: []reply{{status: 206, contentRange: "bytes 5-19/20", data: video[5:9], cut: true}},
+			offsets: []int64{5},
+			wantErr: "unexpected EOF",
+		},
+		{
+			name: "retries off", attempts: 1,
+			first:   reply{status: 200, data: video[:5], cut: true},
+			wantErr: "unexpected EOF",
+		},
+		{
+			name: "wrong Content-Range", attempts: 3,
+			first:   reply{status: 200, data: video[:5], cut: true},
+			reopens: []reply{{status: 206, contentRange: "bytes 0-19/20", data: video}},
+			offsets: []int64{5},
+			wantErr: "unexpected Content-Range",
+		},
+		{
+			name: "restarted body shorter than what was saved", attempts: 3,
+			first:   reply{status: 200, data: video[:7], cut: true},
+			reopens: []reply{{status: 200, data: video[:3]}},
+			offsets: []int64{7},
+			wantErr: "resuming download",
+		},
+		{
+			name: "failed write isn't retried", attempts: 3,
+			first:   reply{status: 200, data: video},
+			failW:   true,
+			wantErr: "disk full",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			c := &http.Client{Transport: &retryTransport{base: http.DefaultTransport, attempts: tt.attempts}}
+			var offsets []int64
+			reopen := func(offset int64) (*http.Response, error) {
+				offsets = append(offsets, offset)
+				if len(offsets) > len(tt.reopens) {
+					return nil, errors.New("reopened too often")
+				}
+				return tt.reopens[len(offsets)-1].response(), nil
+			}
+			var got bytes.Buffer
+			var w io.Writer = &got
+			if tt.failW {
+				w = failingWriter{}
+			}
+
+			err := resumeCopy(context.Background(), c, tt.first.response(), w, reopen)
+			if fmt.Sprint(offsets) != fmt.Sprint(tt.offsets) {
+				t.Errorf("reopened at %v, want %v", offsets, tt.offsets)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("got error %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != video {
+				t.Errorf("wrote %q, want %q", got.String(), video)
+			}
+		})
+	}
+}
+
+// TestDownloadResumeFromGzipServer resumes a download from a server that
+// gzips whatever it can, and cuts the first response off halfway
+func TestDownloadResumeFromGzipServer(t *testing.T) {
+	video := make([]byte, 256<<10)
+	rand.New(rand.NewSource(1)).Read(video)
+
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		body := video
+		if r.Header.Get("Accept-Encoding") != "identity" {
+			var buf bytes.Buffer
+			zw := gzip.NewWriter(&buf)
+			zw.Write(video)
+			zw.Close()
+			body = buf.Bytes()
+			w.Header().Set("Content-Encoding", "gzip")
+		}
+		status := http.StatusOK
+		if rng := r.Header.Get("Range"); rng != "" {
+			start, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rng, "bytes="), "-"))
+			if err != nil || start >= len(body) {
+				http.Error(w, "bad range", http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(body)-1, len(body)))
+			body, status = body[start:], http.StatusPartialContent
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(status)
+		if n == 1 {
+			w.Write(body[:len(body)/2])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	c, err := newHTTPClient(netOptions{maxAttempts: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	resp, err := openDownload(ctx, c, "key", srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got bytes.Buffer
+	err = resumeCopy(ctx, c, resp, &got, func(offset int64) (*http.Response, error) {
+		return openDownloadAt(ctx, c, "key", srv.URL, offset)
+	})
+	if err != nil {
+		t.Fatalf("resumeCopy: %v", err)
+	}
+	if requests.Load() != 2 {
+		t.Errorf("made %d requests, want 2", requests.Load())
+	}
+	if !bytes.Equal(got.Bytes(), video) {
+		t.Errorf("downloaded %d bytes that don't match the %d-byte video", got.Len(), len(video))
+	}
+}
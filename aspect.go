@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chai2010/webp"
+	flag "github.com/spf13/pflag"
+)
+
+// aspectTolerance is how much of a reference may be cropped or stretched
+// before sora-cli warns about it
+const aspectTolerance = 0.05
+
+// Size of the --first-frame crop diagram, in terminal cells
+const (
+	aspectDiagramWidth   = 24
+	aspectDiagramMaxRows = 10
+)
+
+// aspectMismatch is a reference whose shape differs from the video's
+type aspectMismatch struct {
+	path                  string
+	width, height         int // of the reference
+	targetW, targetH      int
+	video                 bool    // videos are stretched to fit; images are cropped
+	lostWidth, lostHeight float64 // fractions cropped, for images
+	stretchX, stretchY    float64 // scale factors, for videos
+
+	better     string  // the other size, if it fits the reference much better
+	betterLoss float64 // what it would crop
+}
+
+// addPadFlag registers --pad
+func addPadFlag(fs *flag.FlagSet, pad *bool) {
+	fs.BoolVar(pad, "pad", false, "Fit a reference of another shape inside the video with black bars, instead of cropping an image or stretching a video")
+}
+
+// checkReferenceAspect reports whether the reference at path would lose
+// much of its composition being fit to size: an image is cropped around
+// its center, and a video is stretched. It returns nil if the shapes are
+// close enough, if pad keeps the whole frame, or if the reference can't be
+// read (loading it reports that).
+func checkReferenceAspect(path, size string, pad bool) *aspectMismatch {
+	if pad {
+		return nil
+	}
+	w, h, err := referenceDimensions(path)
+	if err != nil || w <= 0 || h <= 0 {
+		return nil
+	}
+	tw, th := parseDimensions(size)
+	loss := cropLoss(w, h, tw, th)
+	if loss <= aspectTolerance {
+		return nil
+	}
+	m := &aspectMismatch{path: path, width: w, height: h, targetW: tw, targetH: th, video: !isImageFile(path)}
+	src, dst := float64(w)/float64(h), float64(tw)/float64(th)
+	if src > dst {
+		m.lostWidth = 1 - dst/src
+	} else {
+		m.lostHeight = 1 - src/dst
+	}
+	m.stretchX, m.stretchY = float64(tw)/float64(w), float64(th)/float64(h)
+	if other := otherOrientation(size); other != "" {
+		ow, oh := parseDimensions(other)
+		if l := cropLoss(w, h, ow, oh); l < loss/2 {
+			m.better, m.betterLoss = other, l
+		}
+	}
+	return m
+}
+
+// cropLoss returns the fraction of a w x h frame that filling tw x th
+// crops away
+func cropLoss(w, h, tw, th int) float64 {
+	src, dst := float64(w)/float64(h), float64(tw)/float64(th)
+	return 1 - math.Min(src, dst)/math.Max(src, dst)
+}
+
+// otherOrientation returns the other supported size, or "" for an
+// unknown one
+func otherOrientation(size string) string {
+	switch size {
+	case "1280x720":
+		return "720x1280"
+	case "720x1280":
+		return "1280x720"
+	}
+	return ""
+}
+
+// orientationName returns "portrait" or "landscape" for a supported size
+func orientationName(size string) string {
+	if size == "720x1280" {
+		return "portrait"
+	}
+	return "landscape"
+}
+
+// referenceDimensions returns the size of an image or MP4 reference
+func referenceDimensions(path string) (int, int, error) {
+	if !isImageFile(path) {
+		return getVideoDimensions(path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	var cfg image.Config
+	if strings.ToLower(filepath.Ext(path)) == ".webp" {
+		cfg, err = webp.DecodeConfig(f)
+	} else {
+		cfg, _, err = image.DecodeConfig(f)
+	}
+	return cfg.Width, cfg.Height, err
+}
+
+// warn prints the advisory to stderr, followed by hints: the flags or
+// settings that would fit the reference better
+func (m *aspectMismatch) warn(hints ...string) {
+	var b strings.Builder
+	ratio := fmt.Sprintf("%dx%d", m.width, m.height)
+	target := fmt.Sprintf("%dx%d", m.targetW, m.targetH)
+	if m.video {
+		fmt.Fprintf(&b, "WARNING: %s is %s but the video is %s; it will be stretched to fit (%s)\n", m.path, ratio, target, m.stretchDescription())
+	} else {
+		what, where := "width", "left and right"
+		lost := m.lostWidth
+		if m.lostHeight > 0 {
+			what, where, lost = "height", "top and bottom", m.lostHeight
+		}
+		fmt.Fprintf(&b, "WARNING: %s is %s but the video is %s; %.0f%% of its %s will be cropped (%s)\n", m.path, ratio, target, lost*100, what, where)
+		for _, line := range m.diagram() {
+			fmt.Fprintf(&b, "  %s\n", line)
+		}
+	}
+	switch {
+	case m.better == "":
+	case m.betterLoss <= aspectTolerance:
+		fmt.Fprintf(&b, "  It matches a %s video.\n", orientationName(m.better))
+	default:
+		fmt.Fprintf(&b, "  A %s video would crop only %.0f%% of it.\n", orientationName(m.better), m.betterLoss*100)
+	}
+	for _, h := range hints {
+		fmt.Fprintf(&b, "  %s\n", h)
+	}
+	warnf("%s", b.String())
+}
+
+// stretchDescription says how much a video reference is squeezed or
+// widened, e.g. "squeezed to 56% of its width"
+func (m *aspectMismatch) stretchDescription() string {
+	rel := m.stretchX / m.stretchY
+	if rel < 1 {
+		return fmt.Sprintf("squeezed to %.0f%% of its width", rel*100)
+	}
+	return fmt.Sprintf("squeezed to %.0f%% of its height", 100/rel)
+}
+
+// diagram draws the reference as a box with the cropped parts shaded
+func (m *aspectMismatch) diagram() []string {
+	cols := aspectDiagramWidth
+	// Terminal cells are about twice as tall as they are wide
+	rows := int(math.Round(float64(cols) * float64(m.height) / float64(m.width) / 2))
+	if rows > aspectDiagramMaxRows {
+		rows = aspectDiagramMaxRows
+		cols = int(math.Round(float64(rows) * 2 * float64(m.width) / float64(m.height)))
+	}
+	rows, cols = max(rows, 3), max(cols, 4)
+	cutCols := int(math.Round(float64(cols) * m.lostWidth / 2))
+	cutRows := int(math.Round(float64(rows) * m.lostHeight / 2))
+	if m.lostWidth > 0 {
+		cutCols = max(cutCols, 1)
+	}
+	if m.lostHeight > 0 {
+		cutRows = max(cutRows, 1)
+	}
+
+	lines := []string{"┌" + strings.Repeat("─", cols) + "┐"}
+	for r := 0; r < rows; r++ {
+		var row strings.Builder
+		for c := 0; c < cols; c++ {
+			if r < cutRows || r >= rows-cutRows || c < cutCols || c >= cols-cutCols {
+				row.WriteString("░")
+			} else {
+				row.WriteString(" ")
+			}
+		}
+		lines = append(lines, "│"+row.String()+"│")
+	}
+	lines = append(lines, "└"+strings.Repeat("─", cols)+"┘", "░ = cropped")
+	return lines
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// runAttach implements `sora-cli attach <ref>`: resume waiting for a job
+// submitted with --no-wait (or interrupted), then download it. A job that
+// isn't in history, such as one made in the web app, is added to it.
+func runAttach(args []string) {
+	fs := newFlagSet("attach", "<@last|@N|video_id> [flags]")
+	var (
+		strict bool
+		post   postOptions
+		opts   jobOptions
+		common commonOptions
+	)
+	fs.BoolVar(&strict, "strict", false, "Fail if the downloaded video's size or duration doesn't match the job")
+	addJobFlags(fs, &opts)
+	addSessionFlag(fs, &opts.session)
+	addPostFlags(fs, &post)
+	addCommonFlags(fs, &common)
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err := post.validate(opts.output); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	if opts.encrypted() && post.enabled() {
+		fmt.Fprintln(os.Stderr, "Error: post-processing can't be combined with --encrypt-to; the video is never decrypted on disk")
+		os.Exit(2)
+	}
+	if err := validateNotify(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	id, err := resolveRemoteRef(fs.Arg(0))
+	if err != nil {
+		fail("", "failed to resolve video reference", err)
+	}
+
+	// Without -o, save where the job was originally asked to go
+	e := findHistoryEntry(id)
+	if !fs.Changed("output") && e != nil && e.Pending {
+		opts.output = e.OutputFile
+	}
+	if e != nil {
+		notifier.track(id, e.Prompt, e.Model)
+	} else {
+		notifier.track(id, "", "")
+	}
+	if err := opts.validateBudgets(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	opts.prepareOutput()
+
+	apiKey := common.mustAPIKey()
+	ctx, cancel := commandContext()
+	defer cancel()
+	client := mustHTTPClient(common.net)
+	timings := newPhaseTimings()
+
+	infof("Attaching to job: %s\n", id)
+	st, err := waitForJob(ctx, client, common.baseURL, apiKey, id, opts, time.Now(), timings)
+	if err != nil {
+		fail(id, "\nError", err)
+	}
+
+	output, err := saveJobOutput(ctx, client, common.baseURL, apiKey, id, opts, timings)
+	if err != nil {
+		fail(id, "\nError", err)
+	}
+
+	// Record the video before checking it, so a failed check or
+	// post-processing step below doesn't lose it
+	found, err := updateHistoryEntry(id, func(e *videoHistoryEntry) {
+		e.OutputFile = output
+		e.Pending = false
+		if e.Model == "" {
+			e.Model = st.Model
+		}
+		e.recordResult(st)
+	})
+	if err != nil {
+		infof("Warning: failed to update history: %v\n", err)
+	} else if !found {
+		if err := addToHistory(remoteHistoryEntry(st, output, opts.session)); err != nil {
+			infof("Warning: failed to save history: %v\n", err)
+		} else {
+			infof("Added %s to history\n", id)
+		}
+	}
+
+	// Everything done to the video after the download counts as
+	// post-processing
+	stopPost := timings.start("post-processing")
+	if output != "-" && !opts.encrypted() {
+		if problems, err := verifyOutput(output, st.Size, st.Seconds); err != nil {
+			infof("Warning: could not verify output: %v\n", err)
+		} else if len(problems) > 0 {
+			for _, p := range problems {
+				warnf("WARNING: %s\n", p)
+			}
+			if strict {
+				fail(id, "Error", fmt.Errorf("%w the job (--strict)", errMismatch))
+			}
+		}
+	}
+
+	postProcess(ctx, &post, output)
+	opts.saveThumbnail(ctx, client, common.baseURL, apiKey, id, output)
+	stopPost()
+
+	reportJob(id, output, timings)
+	notifier.completed(output, st)
+	opts.openOutput(output)
+}
+
+// remoteHistoryEntry records a job this machine didn't submit, from what
+// the API reports about it
+func remoteHistoryEntry(st *videoStatusResponse, output, session string) videoHistoryEntry {
+	created := time.Now()
+	if st.CreatedAt > 0 {
+		created = time.Unix(st.CreatedAt, 0)
+	}
+	e := videoHistoryEntry{
+		ID:         st.ID,
+		Prompt:     st.Prompt,
+		CreatedAt:  created.UTC().Format(time.RFC3339),
+		OutputFile: output,
+		Model:      st.Model,
+		Session:    session,
+		Source:     "remote",
+	}
+	e.recordResult(st)
+	if st.RemixedFromVideoID != "" {
+		e.RemixedFrom = &st.RemixedFromVideoID
+	}
+	return e
+}
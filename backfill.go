@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// backfillReport is what history backfill filled in
+type backfillReport struct {
+	Checked int      `json:"checked"` // entries that were missing details
+	Filled  []string `json:"filled"`  // entries given details from the API
+	Gone    []string `json:"gone"`    // entries whose video the API no longer has
+	Failed  []string `json:"failed"`  // entries whose lookup failed; a later run tries again
+	DryRun  bool     `json:"dry_run,omitempty"`
+}
+
+// runHistoryBackfill implements `sora-cli history backfill`: look up each
+// entry recorded before size, length, and cost were kept, and fill them in
+func runHistoryBackfill(args []string) {
+	fs := newFlagSet("history backfill", "[flags]")
+	var (
+		dryRun  bool
+		session string
+		common  commonOptions
+	)
+	fs.BoolVar(&dryRun, "dry-run", false, "Only show what would be filled in")
+	fs.StringVar(&session, "session", "", "Only backfill entries in this session")
+	addCommonFlags(fs, &common)
+	fs.Parse(args)
+
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	h, err := loadHistory()
+	if err != nil {
+		fail("", "failed to load history", err)
+	}
+	var ids []string
+	for _, v := range h.Videos {
+		if (session == "" || v.Session == session) && needsBackfill(v) {
+			ids = append(ids, v.ID)
+		}
+	}
+	report := backfillReport{Checked: len(ids), Filled: []string{}, Gone: []string{}, Failed: []string{}, DryRun: dryRun}
+	if len(ids) == 0 {
+		if jsonOutput {
+			printJSON(report)
+			return
+		}
+		infof("Every entry is up to date\n")
+		return
+	}
+
+	apiKey := common.mustAPIKey()
+	ctx, cancel := commandContext()
+	defer cancel()
+	infof("Looking up %d entries...\n", len(ids))
+	found := lookupVideos(ctx, mustHTTPClient(common.net), common.baseURL, apiKey, ids)
+	if ctx.Err() != nil {
+		fail("", "backfill interrupted", ctx.Err())
+	}
+	for _, id := range ids {
+		if _, ok := found[id]; !ok {
+			report.Failed = append(report.Failed, id)
+		}
+	}
+
+	now := time.Now()
+	apply := func(h *history) bool {
+		changed := false
+		for i := range h.Videos {
+			e := &h.Videos[i]
+			o, ok := found[e.ID]
+			if !ok {
+				continue
+			}
+			if o == nil {
+				if e.Remote != remoteDeleted {
+					e.Remote = remoteDeleted
+					report.Gone = append(report.Gone, e.ID)
+					changed = true
+				}
+				continue
+			}
+			filled := fillFromRemote(e, *o)
+			if o.ExpiresAt > 0 && time.Unix(o.ExpiresAt, 0).Before(now) && e.Remote != remoteExpired {
+				e.Remote = remoteExpired
+				filled = true
+			}
+			if filled {
+				report.Filled = append(report.Filled, e.ID)
+				changed = true
+			}
+		}
+		return changed
+	}
+	if dryRun {
+		apply(h)
+	} else if err := editHistory(apply); err != nil {
+		fail("", "failed to update history", err)
+	}
+
+	if jsonOutput {
+		printJSON(report)
+		return
+	}
+	printBackfillReport(report)
+}
+
+// needsBackfill reports whether e lacks details the API may still have.
+// Imported and pending entries, and videos known to be deleted, are left
+// alone.
+func needsBackfill(e videoHistoryEntry) bool {
+	if strings.HasPrefix(e.ID, importedIDPrefix) || e.Pending || e.Remote == remoteDeleted {
+		return false
+	}
+	if e.Size == "" || e.Seconds == "" || e.Model == "" || e.Prompt == "" {
+		return true
+	}
+	_, priced := videoCost(e.Model, e.Seconds)
+	return e.Cost == 0 && priced
+}
+
+// printBackfillReport summarizes what backfill filled in
+func printBackfillReport(r backfillReport) {
+	if r.DryRun {
+		infof("Dry run; history was not changed\n")
+	}
+	for _, line := range []struct {
+		what string
+		ids  []string
+	}{
+		{"Filled in details from the API for", r.Filled},
+		{"Marked as deleted remotely", r.Gone},
+		{"Could not look up, so left for a later run", r.Failed},
+	} {
+		if len(line.ids) > 0 {
+			fmt.Printf("%s %d: %s\n", line.what, len(line.ids), strings.Join(line.ids, ", "))
+		}
+	}
+	if left := r.Checked - len(r.Filled) - len(r.Gone) - len(r.Failed); left > 0 {
+		infof("%d entries are missing details the API doesn't report either\n", left)
+	}
+}
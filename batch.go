@@ -0,0 +1,705 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// batchRow is one line of a batch manifest. Empty fields use the same
+// defaults as `create` (config file, then built-ins).
+type batchRow struct {
+	Prompt     string      `json:"prompt"`
+	Model      string      `json:"model"`
+	Size       string      `json:"size"`
+	Seconds    json.Number `json:"seconds"`
+	Output     string      `json:"output"`
+	FirstFrame string      `json:"first_frame"`
+	Variation  string      `json:"variation"` // label recorded with the result, e.g. from --explore
+}
+
+// numberedRow is a manifest row and the line it came from
+type numberedRow struct {
+	line int
+	row  batchRow
+}
+
+// batchJob tracks one manifest row through submission, polling, and download
+type batchJob struct {
+	line  int
+	label string // identifies the job in progress output, e.g. "line 3"
+	row   batchRow
+	group string // recorded in history (create --count)
+	seed  *int64 // sent with the job (create --explore --seed)
+	remix string // video the job remixes, if any (repl)
+	ref   *inputReference
+
+	id        string
+	requestID string    // of the request that submitted it
+	started   time.Time // when the job was submitted
+	status    string    // last reported remote status
+	stage     string    // last stage description, from describe
+	progress  int
+	result    string // succeeded, failed, skipped, or pending
+	output    string
+	err       error
+}
+
+// batchReport is the per-row result written to the report file
+type batchReport struct {
+	Line      int    `json:"line"`
+	Prompt    string `json:"prompt"`
+	Variation string `json:"variation,omitempty"`
+	ID        string `json:"id,omitempty"`
+	Result    string `json:"result"`
+	Output    string `json:"output,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// runBatch implements `sora-cli batch <manifest>`: submit every row of a
+// JSONL or CSV manifest, wait for all of them, download the results, and
+// write a per-row report
+func runBatch(args []string) {
+	fs := newFlagSet("batch", "<manifest.jsonl|manifest.csv> [flags]")
+	var (
+		reportPath  string
+		concurrency int
+		tonemap     bool
+		pad         bool
+		lint        bool
+		yes         bool
+		opts        jobOptions
+		common      commonOptions
+	)
+	fs.StringVar(&reportPath, "report", "", "Write the per-row JSONL report here (default: <manifest>.report.jsonl)")
+	fs.IntVarP(&concurrency, "concurrency", "j", 4, "Maximum number of jobs in flight at once")
+	fs.BoolVar(&tonemap, "tonemap", false, "Convert HDR first_frame references to SDR BT.709 (needs ffmpeg with zscale)")
+	addPadFlag(fs, &pad)
+	fs.BoolVar(&lint, "lint", false, "Run the lint-prompt checks on every row and submit nothing if any fail")
+	addSaveFlags(fs, &opts)
+	addBudgetFlags(fs, &opts)
+	addSessionFlag(fs, &opts.session)
+	addYesFlag(fs, &yes)
+	addNotifyFlags(fs)
+	addCommonFlags(fs, &common)
+	fs.Parse(args)
+	common.requireWritable("run batches")
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	manifest := fs.Arg(0)
+	if reportPath == "" {
+		reportPath = strings.TrimSuffix(manifest, filepath.Ext(manifest)) + ".report.jsonl"
+	}
+	if concurrency < 1 {
+		fmt.Fprintln(os.Stderr, "Error: --concurrency must be at least 1")
+		os.Exit(2)
+	}
+	if tonemap {
+		if err := checkTonemap(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	if err := validateNotify(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	if err := opts.validateBudgets(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	policy, err := opts.checkSaveFlags()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	rows, err := readBatchManifest(manifest)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	if len(rows) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: %s has no jobs\n", manifest)
+		os.Exit(2)
+	}
+	if lint {
+		if findings := lintRows(rows); len(findings) > 0 {
+			printFindings(os.Stderr, findings)
+			fmt.Fprintf(os.Stderr, "Error: %s: %d prompt problems (--lint); nothing was submitted\n", manifest, len(findings))
+			os.Exit(1)
+		}
+	}
+
+	// Validate every row before anything is submitted, so a typo on the
+	// last line doesn't surface after the first rows have been paid for
+	for i := range rows {
+		if rows[i].row.Output != "" {
+			rows[i].row.Output = opts.encryptedName(rows[i].row.Output)
+		}
+	}
+	jobs, err := prepareBatchJobs(rows, policy, tonemap, pad)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s: %v\n", manifest, err)
+		var be *blockedError
+		if errors.As(err, &be) {
+			os.Exit(exitPolicy)
+		}
+		os.Exit(2)
+	}
+	for _, j := range jobs {
+		if j.row.FirstFrame == "" || j.result != "" {
+			continue
+		}
+		if m := checkReferenceAspect(j.row.FirstFrame, j.row.Size, pad); m != nil {
+			var hints []string
+			if m.better != "" {
+				hints = append(hints, fmt.Sprintf("Set line %d's size to %s to render it that way.", j.line, orientationName(m.better)))
+			}
+			m.warn(append(hints, "Pass --pad to keep the whole frame between black bars.")...)
+		}
+	}
+	if !confirmBatchCost(jobs, yes) {
+		fmt.Fprintln(os.Stderr, "Aborted")
+		os.Exit(exitCanceled)
+	}
+
+	apiKey := common.mustAPIKey()
+	ctx, cancel := commandContext()
+	defer cancel()
+	client := mustHTTPClient(common.net)
+
+	runJobPool(ctx, client, common.baseURL, apiKey, jobs, opts, concurrency)
+	if ctx.Err() != nil {
+		infof("Interrupted; submitted jobs may still finish remotely (see 'sora-cli attach')\n")
+	}
+
+	failed := writeBatchReport(reportPath, jobs)
+	infof("%d of %d job(s) succeeded; report written to %s\n", len(jobs)-failed, len(jobs), reportPath)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// confirmBatchCost estimates the whole manifest's cost and confirms it as
+// one submission. Rows on models without a known price aren't counted.
+func confirmBatchCost(jobs []*batchJob, yes bool) bool {
+	rows := make([]batchRow, len(jobs))
+	for i, j := range jobs {
+		rows[i] = j.row
+	}
+	return confirmRowsCost(rows, "jobs", yes)
+}
+
+// confirmRowsCost is confirmCost for the total of several rows, described
+// as e.g. "12 jobs"
+func confirmRowsCost(rows []batchRow, noun string, yes bool) bool {
+	var total float64
+	unpriced := 0
+	for _, r := range rows {
+		if cost, ok := videoCost(r.Model, r.Seconds.String()); ok {
+			total += cost
+		} else {
+			unpriced++
+		}
+	}
+	what := fmt.Sprintf("%d %s", len(rows), noun)
+	if unpriced > 0 {
+		what += fmt.Sprintf(", not counting %d on models without a known price", unpriced)
+	}
+	return confirmCost(total, what, yes)
+}
+
+// runJobPool runs jobs on a fixed pool of workers, each taking a job from
+// submission to download, so at most concurrency jobs are in flight at once.
+// Jobs that already have a result (e.g. skipped) are not run.
+func runJobPool(ctx context.Context, c *http.Client, baseURL, apiKey string, jobs []*batchJob, opts jobOptions, concurrency int) {
+	progress := newBatchProgress(jobs)
+	queue := make(chan *batchJob)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range queue {
+				runBatchJob(ctx, c, baseURL, apiKey, j, opts, progress)
+			}
+		}()
+	}
+	for _, j := range jobs {
+		if j.result == "" {
+			queue <- j
+		}
+	}
+	close(queue)
+	wg.Wait()
+	progress.finish()
+}
+
+// runBatchJob submits one job, polls it until it finishes or exceeds its
+// time budgets, and downloads the result. Interrupted jobs are left pending.
+func runBatchJob(ctx context.Context, c *http.Client, baseURL, apiKey string, j *batchJob, opts jobOptions, p *batchProgress) {
+	if ctx.Err() != nil {
+		p.update(j, "pending", nil)
+		return
+	}
+	var id, reqID string
+	var err error
+	if j.remix != "" {
+		// A remix inherits the source's model, size, and duration
+		id, reqID, err = remixVideo(ctx, c, baseURL, apiKey, j.remix, remixVideoRequest{Prompt: j.row.Prompt, Seed: j.seed}, "")
+	} else {
+		id, reqID, err = createVideoJob(ctx, c, baseURL, apiKey, j.row.Model, j.row.Prompt, j.ref, j.row.Size, j.row.Seconds.String(), j.seed, "")
+	}
+	if err != nil {
+		p.update(j, "failed", fmt.Errorf("submit failed: %w", err))
+		return
+	}
+	p.submitted(j, id, reqID)
+	submitted := time.Now()
+	var renderStart time.Time
+	delay := opts.poll()
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.update(j, "pending", nil)
+			return
+		case <-time.After(delay):
+		}
+
+		if opts.maxWait > 0 && time.Since(submitted) > opts.maxWait {
+			p.update(j, "failed", fmt.Errorf("%w: not finished %s after it was submitted (--max-wait)", errTimedOut, formatDuration(time.Since(submitted))))
+			return
+		}
+		if renderStart.IsZero() {
+			if opts.maxQueueWait > 0 && time.Since(submitted) > opts.maxQueueWait {
+				p.update(j, "failed", fmt.Errorf("%w: still queued after %s (--max-queue-wait)", errTimedOut, formatDuration(time.Since(submitted))))
+				return
+			}
+		} else if opts.maxRenderTime > 0 && time.Since(renderStart) > opts.maxRenderTime {
+			p.update(j, "failed", fmt.Errorf("%w: still rendering after %s (--max-render-time)", errTimedOut, formatDuration(time.Since(renderStart))))
+			return
+		}
+
+		st, err := fetchVideoStatus(ctx, c, baseURL, apiKey, id)
+		var se *schemaError
+		if errors.As(err, &se) {
+			p.update(j, "failed", err)
+			return
+		} else if err != nil {
+			if d, ok := pollBackoff(err, delay); ok {
+				delay = d
+				p.logf("[%s] rate limited; checking again in %s\n", j.label, formatDuration(delay))
+			} else if ctx.Err() == nil {
+				p.logf("[%s] poll error: %v\n", j.label, err)
+			}
+			continue
+		}
+		delay = opts.poll()
+		if renderStart.IsZero() && (st.StartedAt > 0 || !isQueuedStatus(st.Status)) {
+			renderStart = time.Now()
+		}
+		if st.Error != nil && st.Error.Message != "" {
+			p.update(j, "failed", &jobError{detail: *st.Error})
+			return
+		}
+		p.setStatus(j, st)
+
+		switch strings.ToLower(st.Status) {
+		case "succeeded", "completed", "complete", "done", "ready":
+			o := opts
+			o.output, o.quiet = j.row.Output, true
+			output, err := saveJobOutput(ctx, c, baseURL, apiKey, id, o, newPhaseTimings())
+			if err != nil {
+				p.update(j, "failed", err)
+				return
+			}
+			j.output = output
+			if o.thumbnail {
+				if _, err := saveThumbnail(ctx, c, baseURL, apiKey, id, output, o.thumbnailAt); err != nil {
+					p.logf("Warning: no thumbnail for %s: %v\n", id, err)
+				}
+			}
+			p.update(j, "succeeded", nil)
+
+			entry := videoHistoryEntry{
+				ID:         id,
+				Prompt:     j.row.Prompt,
+				CreatedAt:  time.Now().UTC().Format(time.RFC3339),
+				OutputFile: output,
+				Model:      cmp.Or(j.row.Model, st.Model),
+				Variation:  j.row.Variation,
+				Group:      j.group,
+				Session:    opts.session,
+				RequestID:  j.requestID,
+				Seed:       j.seed,
+			}
+			if j.row.FirstFrame != "" {
+				entry.ImageInput = &j.row.FirstFrame
+			}
+			if j.remix != "" {
+				entry.RemixedFrom = &j.remix
+			}
+			entry.recordResult(st)
+			if err := addToHistory(entry); err != nil {
+				p.logf("Warning: failed to save to history: %v\n", err)
+			}
+			return
+		default:
+			if err := endedJobError(st); err != nil {
+				p.update(j, "failed", err)
+				return
+			}
+		}
+	}
+}
+
+// readBatchManifest parses a manifest: CSV (with a header row) if the file
+// ends in .csv, otherwise JSON Lines. Blank lines and # comments are skipped
+// in JSONL.
+func readBatchManifest(path string) ([]numberedRow, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		rows, err := readBatchCSV(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return rows, nil
+	}
+
+	var rows []numberedRow
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		dec := json.NewDecoder(strings.NewReader(line))
+		dec.DisallowUnknownFields()
+		var r batchRow
+		if err := dec.Decode(&r); err != nil {
+			return nil, fmt.Errorf("%s: line %d: %w", path, n, err)
+		}
+		rows = append(rows, numberedRow{n, r})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func readBatchCSV(r io.Reader) ([]numberedRow, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading CSV header: %w", err)
+	}
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(h))
+		switch h {
+		case "prompt", "model", "size", "seconds", "output", "first_frame", "variation":
+		default:
+			return nil, fmt.Errorf("unknown CSV column %q", header[i])
+		}
+		header[i] = h
+	}
+
+	var rows []numberedRow
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		var row batchRow
+		for i, v := range rec {
+			switch header[i] {
+			case "prompt":
+				row.Prompt = v
+			case "model":
+				row.Model = v
+			case "size":
+				row.Size = v
+			case "seconds":
+				row.Seconds = json.Number(v)
+			case "output":
+				row.Output = v
+			case "first_frame":
+				row.FirstFrame = v
+			case "variation":
+				row.Variation = v
+			}
+		}
+		rows = append(rows, numberedRow{line, row})
+	}
+	return rows, nil
+}
+
+// prepareBatchJobs fills in defaults and validates every row, loading any
+// first-frame images (tone mapped with tonemap, letterboxed with pad). Rows
+// whose output exists under --skip-existing are marked skipped.
+func prepareBatchJobs(rows []numberedRow, policy existingPolicy, tonemap, pad bool) ([]*batchJob, error) {
+	outputs := make(map[string]int)
+	jobs := make([]*batchJob, 0, len(rows))
+	for _, nr := range rows {
+		r := nr.row
+		if strings.TrimSpace(r.Prompt) == "" {
+			return nil, fmt.Errorf("line %d: prompt is empty", nr.line)
+		}
+		if err := screenText(fmt.Sprintf("line %d: prompt", nr.line), r.Prompt); err != nil {
+			return nil, err
+		}
+		if r.Model == "" {
+			r.Model = cfg.model()
+		}
+		r.Model = cfg.resolveModel(r.Model)
+		switch strings.ToLower(r.Size) {
+		case "":
+			r.Size = cfg.size()
+		case "landscape", "1280x720":
+			r.Size = "1280x720"
+		case "portrait", "720x1280":
+			r.Size = "720x1280"
+		default:
+			return nil, fmt.Errorf("line %d: size must be 1280x720, 720x1280, portrait, or landscape, got %q", nr.line, r.Size)
+		}
+		switch r.Seconds {
+		case "":
+			r.Seconds = json.Number(cfg.seconds())
+		case "4", "8", "12":
+		default:
+			return nil, fmt.Errorf("line %d: seconds must be 4, 8, or 12, got %s", nr.line, r.Seconds)
+		}
+
+		j := &batchJob{line: nr.line, label: fmt.Sprintf("line %d", nr.line), row: r}
+		if r.Output != "" {
+			if prev, ok := outputs[r.Output]; ok {
+				return nil, fmt.Errorf("line %d: output %s is also used on line %d", nr.line, r.Output, prev)
+			}
+			outputs[r.Output] = nr.line
+			resolved, skip, err := resolveOutputPath(r.Output, policy)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", nr.line, err)
+			}
+			if skip {
+				j.result, j.output = "skipped", r.Output
+				infof("[line %d] skipping: %s already exists\n", nr.line, r.Output)
+			}
+			j.row.Output = resolved
+		}
+		if r.FirstFrame != "" && j.result == "" {
+			checkReferenceLength(r.FirstFrame, r.Seconds.String())
+			ref, err := loadInputReference(r.FirstFrame, r.Size, tonemap, pad)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", nr.line, err)
+			}
+			j.ref = ref
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, nil
+}
+
+// writeBatchReport writes one JSON object per row and returns how many
+// rows did not succeed (skipped rows count as done)
+func writeBatchReport(path string, jobs []*batchJob) int {
+	var sb strings.Builder
+	failed := 0
+	for _, j := range jobs {
+		rep := batchReport{Line: j.line, Prompt: j.row.Prompt, Variation: j.row.Variation, ID: j.id, Result: j.result, Output: j.output}
+		if j.err != nil {
+			rep.Error = j.err.Error()
+		}
+		if j.result != "succeeded" && j.result != "skipped" {
+			failed++
+		}
+		b, _ := json.Marshal(rep)
+		sb.Write(b)
+		sb.WriteString("\n")
+	}
+	if err := os.WriteFile(path, []byte(sb.String()), 0o644); err != nil {
+		infof("Warning: failed to write report: %v\n", err)
+		fmt.Print(sb.String())
+	}
+	return failed
+}
+
+// batchProgress is the display shared by concurrent batch jobs: event lines
+// scroll past while a single status line at the bottom summarizes all jobs.
+// Every change to a job's state goes through it so the summary stays
+// consistent across goroutines.
+type batchProgress struct {
+	mu    sync.Mutex
+	jobs  []*batchJob
+	live  bool         // stderr is a terminal, so the status line is redrawn in place
+	shown bool         // the status line is currently on screen
+	print func(string) // where event lines go, if not stderr (repl)
+}
+
+func newBatchProgress(jobs []*batchJob) *batchProgress {
+	return &batchProgress{jobs: jobs, live: term.IsTerminal(int(os.Stderr.Fd()))}
+}
+
+// logf prints an event line above the status line
+func (p *batchProgress) logf(format string, args ...any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+	p.printf(format, args...)
+	p.draw()
+}
+
+// submitted records a job's ID once it has been created
+func (p *batchProgress) submitted(j *batchJob, id, reqID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	j.id, j.requestID, j.started = id, reqID, time.Now()
+	p.clear()
+	p.printf("[%s] submitted %s\n", j.label, id)
+	emitEvent(jsonEvent{Event: "submitted", Label: j.label, ID: id, RequestID: reqID})
+	p.draw()
+}
+
+// setStatus records the latest polled status, logging stage changes
+func (p *batchProgress) setStatus(j *batchJob, st *videoStatusResponse) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+	changed := st.Progress != j.progress
+	j.progress = st.Progress
+	if status, stage := strings.ToLower(st.Status), st.describe(); status != j.status || stage != j.stage {
+		j.status, j.stage = status, stage
+		p.printf("[%s] %s: %s\n", j.label, j.id, stage)
+		emitEvent(jsonEvent{Event: "status", Label: j.label, ID: j.id, Status: status, Stage: st.detail(), QueuePosition: st.QueuePosition, Progress: st.Progress})
+	}
+	if changed {
+		emitProgress(j.label, j.id, j.status, st.Progress)
+	}
+	p.draw()
+}
+
+// update records a job's final result
+func (p *batchProgress) update(j *batchJob, result string, err error) {
+	p.mu.Lock()
+	p.clear()
+	j.result, j.err = result, err
+	switch result {
+	case "succeeded":
+		p.printf("[%s] saved %s\n", j.label, j.output)
+		emitEvent(jsonEvent{Event: "done", Label: j.label, ID: j.id, Output: j.output, Variation: j.row.Variation})
+	case "failed":
+		p.printf("[%s] %s failed: %v\n", j.label, j.id, err)
+		emitEvent(jsonEvent{Event: "error", Label: j.label, ID: j.id, Variation: j.row.Variation, Error: newJSONError(err)})
+	}
+	p.draw()
+	p.mu.Unlock()
+
+	// Notify outside the lock; a slow webhook shouldn't stall other jobs
+	n := jobNotification{ID: j.id, Label: j.label, Prompt: j.row.Prompt, Model: j.row.Model, Seconds: j.row.Seconds.String(), Output: j.output}
+	if !j.started.IsZero() {
+		n.Duration = time.Since(j.started).Seconds()
+	}
+	switch result {
+	case "succeeded":
+		n.Cost, _ = videoCost(n.Model, n.Seconds)
+		notifier.send("completed", n)
+	case "failed":
+		n.Error = newJSONError(err)
+		notifier.send("failed", n)
+	}
+}
+
+// finish removes the status line
+func (p *batchProgress) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+}
+
+// printf writes an event line
+func (p *batchProgress) printf(format string, args ...any) {
+	if p.print != nil {
+		p.print(fmt.Sprintf(format, args...))
+		return
+	}
+	infof(format, args...)
+}
+
+func (p *batchProgress) clear() {
+	if p.shown {
+		fmt.Fprint(os.Stderr, "\r\033[2K")
+		p.shown = false
+	}
+}
+
+func (p *batchProgress) draw() {
+	if !p.live {
+		return
+	}
+	var waiting, queued, rendering, done, failed, pct int
+	for _, j := range p.jobs {
+		switch {
+		case j.result == "succeeded" || j.result == "skipped":
+			done++
+		case j.result != "":
+			failed++
+		case j.id == "":
+			waiting++
+		case isQueuedStatus(j.status):
+			queued++
+		default:
+			rendering++
+			pct += j.progress
+		}
+	}
+
+	var parts []string
+	if rendering > 0 {
+		parts = append(parts, fmt.Sprintf("%d rendering (avg %d%%)", rendering, pct/rendering))
+	}
+	if queued > 0 {
+		parts = append(parts, fmt.Sprintf("%d queued", queued))
+	}
+	if waiting > 0 {
+		parts = append(parts, fmt.Sprintf("%d waiting", waiting))
+	}
+	line := fmt.Sprintf("Batch %d/%d done", done, len(p.jobs))
+	if failed > 0 {
+		line += fmt.Sprintf(", %d failed", failed)
+	}
+	if len(parts) > 0 {
+		line += " · " + strings.Join(parts, ", ")
+	}
+	if w := terminalWidth(os.Stderr); w > 1 {
+		line = truncate(line, w-1)
+	}
+	fmt.Fprint(os.Stderr, line)
+	p.shown = true
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// blocklist is the [blocklist] config section: terms that must never be
+// sent to the API, such as client names or compliance-restricted words
+type blocklist struct {
+	Terms  []string `toml:"terms"`
+	Action string   `toml:"action"` // "refuse" (default) or "warn"
+
+	patterns []*regexp.Regexp
+}
+
+// validate compiles the terms. A term matches case-insensitively and only
+// as a whole word or phrase, so "Acme" doesn't match "acmeology".
+func (b *blocklist) validate() error {
+	switch b.Action {
+	case "":
+		b.Action = "refuse"
+	case "refuse", "warn":
+	default:
+		return fmt.Errorf("action must be refuse or warn, got %q", b.Action)
+	}
+	b.patterns = b.patterns[:0]
+	for _, t := range b.Terms {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			return fmt.Errorf("terms cannot contain an empty term")
+		}
+		words := strings.Fields(regexp.QuoteMeta(t))
+		b.patterns = append(b.patterns, regexp.MustCompile(`(?i)(?:^|[^\pL\pN])(`+strings.Join(words, `\s+`)+`)(?:$|[^\pL\pN])`))
+	}
+	return nil
+}
+
+// match returns the blocked terms found in text, as they appear in it
+func (b *blocklist) match(text string) []string {
+	var found []string
+	for _, p := range b.patterns {
+		if m := p.FindStringSubmatch(text); m != nil {
+			found = append(found, m[1])
+		}
+	}
+	return found
+}
+
+// blockedError is a prompt refused because it contains blocked terms
+type blockedError struct {
+	terms []string
+}
+
+func (e *blockedError) Error() string {
+	return fmt.Sprintf("contains blocked terms: %s (see [blocklist] in the config file)", strings.Join(quoteAll(e.terms), ", "))
+}
+
+// screenText checks text about to be sent to the API against the
+// blocklist. what names the text in messages, e.g. "prompt". With action
+// "warn" it only prints a warning.
+func screenText(what, text string) error {
+	terms := cfg.Blocklist.match(text)
+	if len(terms) == 0 {
+		return nil
+	}
+	if cfg.Blocklist.Action == "warn" {
+		warnf("WARNING: %s contains blocked terms: %s\n", what, strings.Join(quoteAll(terms), ", "))
+		return nil
+	}
+	return fmt.Errorf("%s %w", what, &blockedError{terms: terms})
+}
+
+// mustScreen is screenText for command entry points; it exits before
+// anything is sent
+func mustScreen(what, text string) {
+	if err := screenText(what, text); err != nil {
+		fail("", "Error", err)
+	}
+}
+
+// quoteAll returns each string in double quotes
+func quoteAll(ss []string) []string {
+	out := make([]string, len(ss))
+	for i, s := range ss {
+		out[i] = fmt.Sprintf("%q", s)
+	}
+	return out
+}
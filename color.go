@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Sora renders SDR BT.709, but files without color tags leave players and
+// editors to guess, and many guess BT.601 or full range, which looks washed
+// out. Everything the CLI writes is tagged explicitly.
+
+// bt709Bitstream rewrites the color description in the H.264 stream itself,
+// for players that ignore the container's colr box
+const bt709Bitstream = "h264_metadata=colour_primaries=1:transfer_characteristics=1:matrix_coefficients=1"
+
+// addColorTags marks an encode's output as limited-range BT.709
+func addColorTags(b *ffmpegBuilder) {
+	b.Option("-colorspace", "bt709").
+		Option("-color_primaries", "bt709").
+		Option("-color_trc", "bt709").
+		Option("-color_range", "tv")
+}
+
+// untaggedNote is printed once when outputs can't be tagged without ffmpeg
+var untaggedNote sync.Once
+
+// tagBT709 adds BT.709 color tags to a downloaded H.264 video that doesn't
+// carry them. The streams are copied, so this only takes a moment.
+func tagBT709(ctx context.Context, path string) error {
+	c, err := getVideoColor(path)
+	if err != nil {
+		return err
+	}
+	if c.codec != "avc1" || c.isBT709() {
+		return nil
+	}
+	if !isFFmpegAvailable() {
+		untaggedNote.Do(func() {
+			infof("Note: %s has no color tags and may look washed out in some players; install ffmpeg to tag downloads as BT.709\n", path)
+		})
+		return nil
+	}
+	b := newFFmpeg().
+		Input(path).
+		Option("-map", "0").
+		Option("-c", "copy").
+		Option("-bsf:v", bt709Bitstream)
+	addColorTags(b)
+	return b.Option("-movflags", "+faststart+write_colr").RunReplacing(ctx, path)
+}
+
+// addTonemap converts HDR video with the given transfer (PQ or HLG) to SDR
+// BT.709: linearize, tone map with Hable's curve, then re-apply the BT.709
+// transfer. rgb ends in 8-bit RGB for still images instead of 4:2:0 video.
+func addTonemap(b *ffmpegBuilder, transfer uint16, rgb bool) {
+	tin := "smpte2084"
+	if transfer == transferHLG {
+		tin = "arib-std-b67"
+	}
+	b.Filter(newFilter("zscale").String("tin", tin).String("pin", "bt2020").String("min", "2020_ncl").String("t", "linear").Int("npl", 100)).
+		Filter(newFilter("format").String("pix_fmts", "gbrpf32le")).
+		Filter(newFilter("zscale").String("p", "bt709")).
+		Filter(newFilter("tonemap").String("tonemap", "hable").Int("desat", 0))
+	if rgb {
+		b.Filter(newFilter("zscale").String("t", "bt709")).
+			Filter(newFilter("format").String("pix_fmts", "rgb24"))
+	} else {
+		b.Filter(newFilter("zscale").String("t", "bt709").String("m", "bt709").String("r", "tv")).
+			Filter(newFilter("format").String("pix_fmts", "yuv420p"))
+	}
+}
+
+// checkTonemap reports why --tonemap can't be used with this ffmpeg
+func checkTonemap() error {
+	if !isFFmpegAvailable() {
+		return errors.New(ffmpegInstallMsg)
+	}
+	if !ffmpegHasFilter("zscale") {
+		return errors.New("--tonemap needs an ffmpeg built with libzimg (--enable-libzimg); this one doesn't have the zscale filter")
+	}
+	return nil
+}
+
+// tonemapImage writes an SDR PNG of an HDR still image and returns its
+// path; the caller removes it. Images rarely say which HDR transfer they
+// use, so PQ is assumed.
+func tonemapImage(path string) (string, error) {
+	tmp, err := os.CreateTemp("", "sora-tonemap-*.png")
+	if err != nil {
+		return "", fmt.Errorf("creating temp file: %w", err)
+	}
+	out := tmp.Name()
+	tmp.Close()
+
+	b := newFFmpeg().Input(path)
+	addTonemap(b, transferPQ, true)
+	if err := b.Option("-frames:v", "1").Output(out).Run(context.Background()); err != nil {
+		os.Remove(out)
+		return "", err
+	}
+	return out, nil
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// compareModes are the --mode values of compare and what they render
+var compareModes = map[string]string{
+	"side": "the two videos side by side",
+	"diff": "the difference between the two videos, black where they match",
+}
+
+// compareMetrics are the similarity scores of two videos; nil means the
+// metric wasn't measured
+type compareMetrics struct {
+	SSIM *float64 `json:"ssim,omitempty"`
+	PSNR *float64 `json:"psnr_db,omitempty"` // unset when Identical, since it is infinite
+	VMAF *float64 `json:"vmaf,omitempty"`
+
+	Identical bool `json:"identical,omitempty"`
+
+	noVMAF bool // ffmpeg was built without libvmaf
+}
+
+// runCompare implements `sora-cli compare <a> <b>`: render two videos side
+// by side or as a difference, and measure how similar they are
+func runCompare(args []string) {
+	fs := newFlagSet("compare", "<a> <b> [flags]")
+	var (
+		output    string
+		mode      string
+		noMetrics bool
+		overwrite bool
+	)
+	fs.StringVarP(&output, "output", "o", "", "Write a comparison video here")
+	fs.StringVar(&output, "out", "", "")
+	fs.MarkHidden("out")
+	fs.StringVar(&mode, "mode", "side", "What the comparison video shows: side (side by side) or diff (the difference, black where they match)")
+	fs.BoolVar(&noMetrics, "no-metrics", false, "Skip measuring SSIM, PSNR, and VMAF")
+	fs.BoolVar(&overwrite, "overwrite", false, "Overwrite the output file if it already exists")
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if _, ok := compareModes[mode]; !ok {
+		fmt.Fprintf(os.Stderr, "Error: --mode must be side or diff, got %q\n", mode)
+		os.Exit(2)
+	}
+	switch {
+	case output == "-":
+		fmt.Fprintln(os.Stderr, "Error: compare can't write to stdout; give -o a file name")
+		os.Exit(2)
+	case output == "" && noMetrics:
+		fmt.Fprintln(os.Stderr, "Error: nothing to do; give -o for a comparison video or leave out --no-metrics")
+		os.Exit(2)
+	}
+	if !isFFmpegAvailable() {
+		fmt.Fprintln(os.Stderr, ffmpegInstallMsg)
+		os.Exit(1)
+	}
+
+	paths := make([]string, 2)
+	for i, ref := range fs.Args() {
+		p, err := compareInput(ref)
+		if err != nil {
+			fail("", "compare error", err)
+		}
+		paths[i] = p
+	}
+	a, b := paths[0], paths[1]
+	checkComparable(a, b)
+
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	result := map[string]any{"a": a, "b": b}
+	if output != "" {
+		var err error
+		if output, _, err = resolveOutputPath(output, rewritePolicy(overwrite)); err != nil {
+			fail("", "failed to choose the output file", err)
+		}
+		infof("Rendering %s...\n", compareModes[mode])
+		if err := renderComparison(ctx, a, b, mode, output); err != nil {
+			fail("", "compare error", err)
+		}
+		infof("Comparison saved to: %s\n", output)
+		result["output"] = output
+	}
+	if noMetrics {
+		if jsonOutput {
+			printJSON(result)
+		}
+		return
+	}
+
+	infof("Measuring similarity...\n")
+	m, err := measureSimilarity(ctx, a, b)
+	if err != nil {
+		fail("", "compare error", err)
+	}
+	if jsonOutput {
+		result["metrics"] = m
+		printJSON(result)
+		return
+	}
+	m.print()
+}
+
+// compareInput returns the file for a compare argument: a video in history
+// (@last, @N, or an ID) or a path to an MP4
+func compareInput(ref string) (string, error) {
+	if !strings.HasPrefix(ref, "@") {
+		if st, err := os.Stat(ref); err == nil && !st.IsDir() {
+			return ref, nil
+		}
+	}
+	paths, err := refFiles([]string{ref})
+	if err != nil {
+		return "", err
+	}
+	return paths[0], nil
+}
+
+// checkComparable warns about differences that skew the comparison: b is
+// fitted to a's frame, and only as much as the shorter video is compared
+func checkComparable(a, b string) {
+	aw, ah, errA := getVideoDimensions(a)
+	bw, bh, errB := getVideoDimensions(b)
+	if errA == nil && errB == nil && (aw != bw || ah != bh) {
+		warnf("WARNING: %s is %dx%d but %s is %dx%d; it is fitted to the first video's frame, which lowers the scores\n", b, bw, bh, a, aw, ah)
+	}
+	da, errA := getVideoDuration(a)
+	db, errB := getVideoDuration(b)
+	if errA == nil && errB == nil && da.Round(100*time.Millisecond) != db.Round(100*time.Millisecond) {
+		infof("The videos last %s and %s; only the first %s of each is compared\n", formatDuration(da), formatDuration(db), formatDuration(min(da, db)))
+	}
+}
+
+// addComparePair adds a and b as inputs and labels their video "a" and
+// "b": b fitted to a's size and frame rate, both in the same pixel format
+func addComparePair(b *ffmpegBuilder, a, bPath string) error {
+	w, h, err := getVideoDimensions(a)
+	if err != nil {
+		return err
+	}
+	fps, err := getVideoFrameRate(a)
+	if err != nil {
+		return err
+	}
+	b.Input(a).Input(bPath)
+	b.Filter(newFilter("fps").From("0:v").Float("fps", fps))
+	b.Filter(newFilter("setsar").String("sar", "1"))
+	b.Filter(newFilter("format").String("pix_fmts", "yuv420p").To("a"))
+	b.Filter(newFilter("scale").From("1:v").Int("w", w).Int("h", h).String("force_original_aspect_ratio", "decrease"))
+	b.Filter(newFilter("pad").Int("w", w).Int("h", h).String("x", "(ow-iw)/2").String("y", "(oh-ih)/2"))
+	b.Filter(newFilter("setsar").String("sar", "1"))
+	b.Filter(newFilter("fps").Float("fps", fps))
+	b.Filter(newFilter("format").String("pix_fmts", "yuv420p").To("b"))
+	return nil
+}
+
+// renderComparison writes a video of a and b in mode to out, without
+// sound, as long as the shorter of the two
+func renderComparison(ctx context.Context, a, bPath, mode, out string) error {
+	b := newFFmpeg()
+	if err := addComparePair(b, a, bPath); err != nil {
+		return err
+	}
+	switch mode {
+	case "side":
+		b.Filter(newFilter("hstack").From("a", "b").Int("inputs", 2).Int("shortest", 1))
+	case "diff":
+		b.Filter(newFilter("blend").From("a", "b").String("all_mode", "difference").Int("shortest", 1))
+	}
+	var enc encodeOptions
+	enc.addVideoCodec(b, 0, "")
+	enc.addAudioCodec(b, false)
+	b.Option("-movflags", "+faststart+write_colr")
+	return b.RunReplacing(ctx, out)
+}
+
+// measureSimilarity compares b with a frame by frame. SSIM and PSNR come
+// with every ffmpeg; VMAF only with one built with libvmaf.
+func measureSimilarity(ctx context.Context, a, b string) (*compareMetrics, error) {
+	dir, err := os.MkdirTemp("", "sora-compare-*")
+	if err != nil {
+		return nil, fmt.Errorf("creating temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := &compareMetrics{}
+	ssimLog := filepath.Join(dir, "ssim.log")
+	if err := runMetric(ctx, a, b, newFilter("ssim").String("stats_file", ssimLog)); err != nil {
+		return nil, fmt.Errorf("measuring SSIM: %w", err)
+	}
+	if m.SSIM, err = parseSSIMLog(ssimLog); err != nil {
+		return nil, err
+	}
+
+	psnrLog := filepath.Join(dir, "psnr.log")
+	if err := runMetric(ctx, a, b, newFilter("psnr").String("stats_file", psnrLog)); err != nil {
+		return nil, fmt.Errorf("measuring PSNR: %w", err)
+	}
+	psnr, err := parsePSNRLog(psnrLog)
+	if err != nil {
+		return nil, err
+	}
+	if math.IsInf(psnr, 1) {
+		m.Identical = true
+	} else {
+		m.PSNR = &psnr
+	}
+
+	m.noVMAF = !ffmpegHasFilter("libvmaf")
+	if !m.noVMAF {
+		vmafLog := filepath.Join(dir, "vmaf.json")
+		// libvmaf takes the distorted video first and the reference second
+		f := newFilter("libvmaf").String("log_path", vmafLog).String("log_fmt", "json")
+		if err := runMetric(ctx, a, b, f); err != nil {
+			warnf("Warning: could not measure VMAF: %v\n", err)
+		} else if m.VMAF, err = parseVMAFLog(vmafLog); err != nil {
+			warnf("Warning: could not read VMAF results: %v\n", err)
+		}
+	}
+	return m, nil
+}
+
+// runMetric runs a two-input metric filter over b (first) and a (second),
+// discarding the frames
+func runMetric(ctx context.Context, a, bPath string, metric *ffmpegFilter) error {
+	b := newFFmpeg()
+	if err := addComparePair(b, a, bPath); err != nil {
+		return err
+	}
+	return b.Filter(metric.From("b", "a")).
+		Option("-an").
+		Option("-f", "null").
+		Output(os.DevNull).
+		Run(ctx)
+}
+
+// parseSSIMLog averages the All column of an ssim stats file, whose lines
+// look like "n:1 Y:0.97 U:0.98 V:0.98 All:0.975 (16.0)"
+func parseSSIMLog(path string) (*float64, error) {
+	var sum float64
+	n := 0
+	err := scanStats(path, func(fields map[string]string) error {
+		v, err := strconv.ParseFloat(fields["All"], 64)
+		if err != nil {
+			return fmt.Errorf("bad SSIM value %q", fields["All"])
+		}
+		sum += v
+		n++
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading SSIM results: %w", err)
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("reading SSIM results: no frames were compared")
+	}
+	avg := sum / float64(n)
+	return &avg, nil
+}
+
+// parsePSNRLog returns the PSNR of the whole video, in dB, from the mean
+// squared error of a psnr stats file's frames: +Inf if they all match
+func parsePSNRLog(path string) (float64, error) {
+	var sum float64
+	n := 0
+	err := scanStats(path, func(fields map[string]string) error {
+		v, err := strconv.ParseFloat(fields["mse_avg"], 64)
+		if err != nil {
+			return fmt.Errorf("bad PSNR value %q", fields["mse_avg"])
+		}
+		sum += v
+		n++
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("reading PSNR results: %w", err)
+	}
+	if n == 0 {
+		return 0, fmt.Errorf("reading PSNR results: no frames were compared")
+	}
+	mse := sum / float64(n)
+	if mse == 0 {
+		return math.Inf(1), nil
+	}
+	return 10 * math.Log10(255*255/mse), nil
+}
+
+// scanStats calls fn with the key:value fields of each line of an ffmpeg
+// metric stats file
+func scanStats(path string, fn func(map[string]string) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := map[string]string{}
+		for _, kv := range strings.Fields(sc.Text()) {
+			if k, v, ok := strings.Cut(kv, ":"); ok {
+				fields[k] = v
+			}
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		if err := fn(fields); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+// parseVMAFLog returns the mean VMAF score from a libvmaf JSON log
+func parseVMAFLog(path string) (*float64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var log struct {
+		Pooled struct {
+			VMAF struct {
+				Mean *float64 `json:"mean"`
+			} `json:"vmaf"`
+		} `json:"pooled_metrics"`
+	}
+	if err := json.Unmarshal(data, &log); err != nil {
+		return nil, err
+	}
+	if log.Pooled.VMAF.Mean == nil {
+		return nil, fmt.Errorf("no pooled VMAF score in %s", path)
+	}
+	return log.Pooled.VMAF.Mean, nil
+}
+
+// print writes the scores to stdout with what they mean
+func (m *compareMetrics) print() {
+	if m.SSIM != nil {
+		fmt.Printf("SSIM:\t%.4f\t(1 = identical)\n", *m.SSIM)
+	}
+	switch {
+	case m.Identical:
+		fmt.Println("PSNR:\tinf\t(every frame matches)")
+	case m.PSNR != nil:
+		fmt.Printf("PSNR:\t%.2f dB\t(higher = more alike; above 40 is hard to tell apart)\n", *m.PSNR)
+	}
+	switch {
+	case m.VMAF != nil:
+		fmt.Printf("VMAF:\t%.1f\t(0-100; 100 = indistinguishable)\n", *m.VMAF)
+	case m.noVMAF:
+		fmt.Println("VMAF:\t-\t(needs ffmpeg built with libvmaf)")
+	}
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// completionScripts are the scripts `completion` prints, by shell. Each
+// calls the hidden __complete command with the words typed so far; {{prog}}
+// is the name sora-cli was run as.
+var completionScripts = map[string]string{
+	"bash":       bashCompletion,
+	"zsh":        zshCompletion,
+	"fish":       fishCompletion,
+	"powershell": powershellCompletion,
+}
+
+const bashCompletion = `# bash completion for {{prog}}
+_sora_cli_complete() {
+    local cur words cword
+    if declare -F _get_comp_words_by_ref >/dev/null; then
+        _get_comp_words_by_ref -n =: cur words cword
+    else
+        cur=${COMP_WORDS[COMP_CWORD]} words=("${COMP_WORDS[@]}") cword=$COMP_CWORD
+    fi
+    local IFS=$'\n'
+    COMPREPLY=($("${words[0]}" __complete "${words[@]:1:cword}" 2>/dev/null | cut -f1))
+    # bash replaces only the part of --flag=value after the =
+    if [[ $cur == --*=* ]]; then
+        COMPREPLY=("${COMPREPLY[@]#"${cur%%=*}="}")
+    fi
+}
+complete -o default -F _sora_cli_complete {{prog}}
+`
+
+const zshCompletion = `#compdef {{prog}}
+_sora_cli_complete() {
+    local -a lines completions
+    local line
+    lines=("${(@f)$("${words[1]}" __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+    for line in $lines; do
+        [[ -n $line ]] || continue
+        if [[ $line == *$'\t'* ]]; then
+            completions+=("${${line%%$'\t'*}//:/\\:}:${line#*$'\t'}")
+        else
+            completions+=("${line//:/\\:}")
+        fi
+    done
+    if (( ${#completions} )); then
+        _describe '{{prog}}' completions
+    else
+        _files
+    fi
+}
+compdef _sora_cli_complete {{prog}}
+`
+
+const fishCompletion = `# fish completion for {{prog}}
+function __sora_cli_candidates
+    set -l words (commandline -opc)
+    set -l cur (commandline -ct)
+    set -g __sora_cli_last ($words[1] __complete $words[2..-1] "$cur" 2>/dev/null)
+    test (count $__sora_cli_last) -gt 0
+end
+complete -c {{prog}} -e
+complete -c {{prog}} -f -n __sora_cli_candidates -a '(printf "%s\n" $__sora_cli_last)'
+`
+
+const powershellCompletion = `# PowerShell completion for {{prog}}
+Register-ArgumentCompleter -Native -CommandName '{{prog}}', '{{prog}}.exe' -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+    $words = @($commandAst.CommandElements |
+        Where-Object { $_.Extent.StartOffset -lt $cursorPosition } |
+        ForEach-Object { $_.ToString() })
+    # Before PowerShell 7.3 an empty argument isn't passed at all
+    if ($wordToComplete -eq '') { $words += '""' }
+    $rest = @($words | Select-Object -Skip 1)
+    & $words[0] __complete @rest 2>$null | ForEach-Object {
+        $value, $description = $_ -split "` + "`" + `t", 2
+        if (-not $description) { $description = $value }
+        [System.Management.Automation.CompletionResult]::new($value, $value, 'ParameterValue', $description)
+    }
+}
+`
+
+// runCompletion implements `sora-cli completion <shell>`: print the script
+// that completes commands, flags, and history references in that shell
+func runCompletion(args []string) {
+	fs := newFlagSet("completion", "<bash|zsh|fish|powershell>")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	script, ok := completionScripts[fs.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown shell %q (want bash, zsh, fish, or powershell)\n", fs.Arg(0))
+		os.Exit(2)
+	}
+	prog := strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe")
+	fmt.Print(strings.ReplaceAll(script, "{{prog}}", prog))
+}
+
+// completeFlags is set while __complete runs a command for its flags. The
+// flag set's usage calls it in place of printing help.
+var completeFlags func(fs *flag.FlagSet)
+
+// maxRefCandidates caps how many @N references are offered before any
+// digits are typed
+const maxRefCandidates = 20
+
+// refCommands take history references as arguments. Those that also take
+// plain files are offered references only once one is started.
+var refCommands = map[string]struct {
+	args  int // how many references (0 = any number)
+	files bool
+}{
+	"remix": {1, false}, "extend": {1, false}, "attach": {1, false},
+	"status": {1, false}, "download": {1, false}, "note": {1, false},
+	"tag": {1, false}, "export-job": {1, false}, "mark": {0, false},
+	"delete": {0, false}, "concat": {0, true}, "compare": {2, true},
+	"score": {0, true},
+}
+
+// runComplete implements the hidden `__complete` command the completion
+// scripts call. args are the words after the program name, the last one
+// being completed. It prints the candidates one per line, each with a tab
+// and a description when there is one. Printing nothing leaves the shell to
+// complete file names.
+func runComplete(args []string) {
+	if len(args) == 0 {
+		args = []string{""}
+	}
+	cur, words := args[len(args)-1], args[:len(args)-1]
+	if cur == `""` {
+		cur = ""
+	}
+	// Without bash-completion, bash splits --flag=value at the = and
+	// replaces only the value
+	if n := len(words); n > 1 && words[n-1] == "=" {
+		words = words[:n-1]
+	}
+
+	if len(words) == 0 && !strings.HasPrefix(cur, "-") {
+		for _, c := range commands {
+			printCandidate(cur, c.name, c.summary)
+		}
+		return
+	}
+	name, rest := "create", words
+	if len(words) > 0 && !strings.HasPrefix(words[0], "-") {
+		name, rest = words[0], words[1:]
+	}
+	cmds := commands
+	switch name {
+	case "remote":
+		cmds = remoteCommands
+	case "history":
+		cmds = historyCommands
+	case "workspace":
+		cmds = workspaceCommands
+	}
+	if name == "remote" || name == "history" || name == "workspace" {
+		if len(rest) == 0 {
+			for _, c := range cmds {
+				printCandidate(cur, c.name, c.summary)
+			}
+			return
+		}
+		name, rest = name+" "+rest[0], rest[1:]
+	}
+	i := slices.IndexFunc(cmds, func(c command) bool { return c.name == name[strings.LastIndex(name, " ")+1:] })
+	if i < 0 {
+		return
+	}
+
+	// The command registers its flags and parses --help, which lands here
+	completeFlags = func(fs *flag.FlagSet) {
+		completeWord(fs, name, rest, cur)
+		os.Exit(0)
+	}
+	cmds[i].run([]string{"--help"})
+}
+
+// completeWord prints the candidates for cur, the word after rest in a
+// command line of the named command with the flags in fs
+func completeWord(fs *flag.FlagSet, name string, rest []string, cur string) {
+	if n := len(rest); n > 0 {
+		if f := flagForWord(fs, rest[n-1]); f != nil && f.NoOptDefVal == "" && !strings.Contains(rest[n-1], "=") {
+			completeFlagValue(name, f.Name, cur, "")
+			return
+		}
+	}
+	if strings.HasPrefix(cur, "--") {
+		if flagName, value, ok := strings.Cut(cur[2:], "="); ok {
+			if f := fs.Lookup(flagName); f != nil {
+				completeFlagValue(name, f.Name, value, "--"+flagName+"=")
+			}
+			return
+		}
+	}
+	if strings.HasPrefix(cur, "-") {
+		fs.VisitAll(func(f *flag.Flag) {
+			if !f.Hidden && f.Deprecated == "" && f.Name != "help" {
+				printCandidate(cur, "--"+f.Name, f.Usage)
+			}
+		})
+		return
+	}
+
+	// Count the arguments before cur, skipping flags and their values
+	args := 0
+	for i := 0; i < len(rest); i++ {
+		w := rest[i]
+		if !strings.HasPrefix(w, "-") || w == "-" {
+			args++
+			continue
+		}
+		if f := flagForWord(fs, w); f != nil && f.NoOptDefVal == "" && !strings.Contains(w, "=") {
+			i++
+		}
+	}
+	switch name {
+	case "completion":
+		if args == 0 {
+			for _, shell := range []string{"bash", "zsh", "fish", "powershell"} {
+				printCandidate(cur, shell, "")
+			}
+		}
+		return
+	case "mark":
+		if args > 0 {
+			for _, st := range reviewStates {
+				printCandidate(cur, st, "")
+			}
+		}
+	}
+	if rc, ok := refCommands[name]; ok && (rc.args == 0 || args < rc.args) {
+		if !rc.files || cur != "" {
+			completeRefs(cur)
+		}
+	}
+}
+
+// flagForWord returns the flag a word such as --model, --model=pro, or -o
+// names, or nil
+func flagForWord(fs *flag.FlagSet, w string) *flag.Flag {
+	switch {
+	case strings.HasPrefix(w, "--"):
+		name, _, _ := strings.Cut(w[2:], "=")
+		return fs.Lookup(name)
+	case len(w) == 2 && w[0] == '-':
+		return fs.ShorthandLookup(w[1:])
+	}
+	return nil
+}
+
+// completeFlagValue prints the candidates for the value of a flag. prefix
+// is the --flag= part when the value is in the same word.
+func completeFlagValue(command, flagName, cur, prefix string) {
+	add := func(value, desc string) { printCandidate(prefix+cur, prefix+value, desc) }
+	switch flagName {
+	case "model":
+		aliases := map[string]string{}
+		for alias, id := range builtinModelAliases {
+			aliases[alias], aliases[id] = id, ""
+		}
+		for alias, id := range cfg.ModelAliases {
+			aliases[alias] = id
+		}
+		for _, alias := range sortedKeys(aliases) {
+			add(alias, aliases[alias])
+		}
+	case "seconds":
+		for _, s := range []string{"4", "8", "12"} {
+			add(s, "")
+		}
+	case "profile":
+		for _, name := range sortedKeys(cfg.Profiles) {
+			add(name, "")
+		}
+	case "mode":
+		if command == "compare" {
+			for _, mode := range sortedKeys(compareModes) {
+				add(mode, compareModes[mode])
+			}
+		}
+	case "workspace":
+		list, _ := listWorkspaces()
+		for _, w := range list {
+			add(w.Name, "")
+		}
+	case "seed", "reference":
+		if cur != "" {
+			completeRefs(prefix + cur)
+		}
+	case "session":
+		h, err := loadHistory()
+		if err != nil {
+			return
+		}
+		seen := map[string]bool{}
+		for _, v := range h.Videos {
+			if v.Session != "" && !seen[v.Session] {
+				seen[v.Session] = true
+				add(v.Session, "")
+			}
+		}
+	}
+}
+
+// completeRefs prints the history references starting with cur: @last and
+// @N with the video's prompt, or video IDs once one is started
+func completeRefs(cur string) {
+	prefix := ""
+	if i := strings.LastIndex(cur, "="); i >= 0 {
+		prefix, cur = cur[:i+1], cur[i+1:]
+	}
+	h, err := loadHistory()
+	if err != nil || len(h.Videos) == 0 {
+		return
+	}
+	if cur == "" || strings.HasPrefix(cur, "@") {
+		printCandidate(prefix+cur, prefix+"@last", h.Videos[0].Prompt)
+		n := len(h.Videos)
+		if cur == "" || cur == "@" {
+			n = min(n, maxRefCandidates)
+		}
+		for i, v := range h.Videos[:n] {
+			printCandidate(prefix+cur, fmt.Sprintf("%s@%d", prefix, i), v.Prompt)
+		}
+		return
+	}
+	seen := map[string]bool{}
+	for _, v := range h.Videos {
+		if !seen[v.ID] {
+			seen[v.ID] = true
+			printCandidate(prefix+cur, prefix+v.ID, v.Prompt)
+		}
+	}
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// printCandidate prints value if it starts with cur, with desc after a tab
+func printCandidate(cur, value, desc string) {
+	if !strings.HasPrefix(value, cur) {
+		return
+	}
+	if desc = truncate(singleLine(desc), 60); desc != "" {
+		fmt.Printf("%s\t%s\n", value, desc)
+		return
+	}
+	fmt.Println(value)
+}
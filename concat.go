@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// concatSampleRate is the audio rate every clip is resampled to before
+// joining, since concat needs matching streams
+const concatSampleRate = 48000
+
+// unsafeFileChars are replaced when a session name becomes a file name
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// runConcat implements `sora-cli concat`: join videos from history, given
+// as refs or as a whole --session, into one file
+func runConcat(args []string) {
+	fs := newFlagSet("concat", "[<ref>...] [flags]")
+	var (
+		output    string
+		session   string
+		overwrite bool
+		trans     string
+		transLen  time.Duration
+		enc       encodeOptions
+	)
+	fs.StringVarP(&output, "output", "o", "", "Write the joined video here (default <session>.mp4 with --session)")
+	fs.StringVar(&session, "session", "", "Join every saved video in this session, oldest first")
+	fs.BoolVar(&overwrite, "overwrite", false, "Overwrite the output file if it already exists")
+	addTransitionFlags(fs, &trans, &transLen)
+	addEncodeFlags(fs, &enc)
+	fs.Parse(args)
+
+	if (session == "") == (fs.NArg() == 0) {
+		fmt.Fprintln(os.Stderr, "Error: give either video refs or --session")
+		fs.Usage()
+		os.Exit(2)
+	}
+	if output == "" {
+		if session == "" {
+			fmt.Fprintln(os.Stderr, "Error: -o is required when joining refs")
+			os.Exit(2)
+		}
+		output = strings.Trim(unsafeFileChars.ReplaceAllString(session, "-"), "-") + ".mp4"
+	}
+	if output == "-" {
+		fmt.Fprintln(os.Stderr, "Error: concat can't write to stdout; give -o a file name")
+		os.Exit(2)
+	}
+	if err := enc.resolve(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	joint, err := newTransition(trans, transLen)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --transition: %v\n", err)
+		os.Exit(2)
+	}
+	if !isFFmpegAvailable() {
+		fmt.Fprintln(os.Stderr, ffmpegInstallMsg)
+		os.Exit(1)
+	}
+	if err := checkTransitions([]transition{joint}); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var paths []string
+	if session != "" {
+		paths, err = sessionFiles(session)
+	} else {
+		paths, err = refFiles(fs.Args())
+	}
+	if err != nil {
+		fail("", "concat error", err)
+	}
+	if len(paths) < 2 {
+		fmt.Fprintf(os.Stderr, "Error: need at least two saved videos to join, found %d\n", len(paths))
+		os.Exit(1)
+	}
+
+	output, _, err = resolveOutputPath(output, rewritePolicy(overwrite))
+	if err != nil {
+		fail("", "failed to choose the output file", err)
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+	infof("Joining %d videos...\n", len(paths))
+	if err := concatVideos(ctx, paths, uniformJoints(len(paths), joint), output, &enc); err != nil {
+		fail("", "concat error", err)
+	}
+	if jsonOutput {
+		printJSON(map[string]any{"output": output, "inputs": paths})
+		return
+	}
+	infof("Video saved to: %s\n", output)
+}
+
+// sessionFiles returns the saved videos in session, oldest first
+func sessionFiles(session string) ([]string, error) {
+	h, err := loadHistory()
+	if err != nil {
+		return nil, fmt.Errorf("loading history: %w", err)
+	}
+	var paths []string
+	found := false
+	for i := len(h.Videos) - 1; i >= 0; i-- {
+		v := h.Videos[i]
+		if v.Session != session {
+			continue
+		}
+		found = true
+		if status, _ := entryStatus(v); status != "saved" {
+			infof("Skipping %s: no local file (%s)\n", v.ID, status)
+			continue
+		}
+		paths = append(paths, v.OutputFile)
+	}
+	if !found {
+		return nil, fmt.Errorf("no videos in session %q", session)
+	}
+	return paths, nil
+}
+
+// refFiles returns the saved videos for refs, in the order given
+func refFiles(refs []string) ([]string, error) {
+	paths := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		id, err := resolveVideoRef(ref)
+		if err != nil {
+			return nil, err
+		}
+		e := findHistoryEntry(id)
+		if e == nil {
+			return nil, fmt.Errorf("%s is not in history", id)
+		}
+		if status, _ := entryStatus(*e); status != "saved" {
+			return nil, fmt.Errorf("%s has no local file (%s); download it first", id, status)
+		}
+		paths = append(paths, e.OutputFile)
+	}
+	return paths, nil
+}
+
+// concatVideos joins paths end to end into out. Every clip is fitted to the
+// first one's size and frame rate, and clips without audio get silence, so
+// videos of different shapes can be joined. joints[i] is the transition
+// from clip i to clip i+1; nil joins them all with cuts.
+func concatVideos(ctx context.Context, paths []string, joints []transition, out string, enc *encodeOptions) error {
+	if joints == nil {
+		joints = uniformJoints(len(paths), transition{kind: "cut"})
+	}
+	w, h, err := getVideoDimensions(paths[0])
+	if err != nil {
+		return err
+	}
+	fps, err := getVideoFrameRate(paths[0])
+	if err != nil {
+		return err
+	}
+	audio := make([]bool, len(paths))
+	durations := make([]time.Duration, len(paths))
+	anyAudio := false
+	for i, p := range paths {
+		if audio[i], err = hasAudioTrack(p); err != nil {
+			return err
+		}
+		anyAudio = anyAudio || audio[i]
+		if durations[i], err = getVideoDuration(p); err != nil {
+			return err
+		}
+	}
+	// A transition overlaps the end of one clip with the start of the next,
+	// so it can't be longer than either
+	for i, t := range joints {
+		if d := min(durations[i], durations[i+1]); t.duration >= d {
+			return fmt.Errorf("the %s between clips %d and %d is longer than a clip (%s)", t, i+1, i+2, d.Round(time.Millisecond))
+		}
+	}
+
+	cutsOnly := allCuts(joints)
+
+	// The first pass of a two-pass encode leaves the audio out
+	addInputs := func(b *ffmpegBuilder, withAudio bool) error {
+		var vs, as []string
+		for i, p := range paths {
+			b.Input(p)
+			v := fmt.Sprintf("v%d", i)
+			b.Filter(newFilter("scale").From(fmt.Sprintf("%d:v", i)).Int("w", w).Int("h", h).String("force_original_aspect_ratio", "decrease"))
+			b.Filter(newFilter("pad").Int("w", w).Int("h", h).String("x", "(ow-iw)/2").String("y", "(oh-ih)/2"))
+			b.Filter(newFilter("setsar").String("sar", "1"))
+			b.Filter(newFilter("fps").Float("fps", fps))
+			if !cutsOnly {
+				// xfade needs both inputs in the same time base, and a
+				// concat's output is in AVTB whatever its inputs were
+				b.Filter(newFilter("settb").String("expr", "AVTB"))
+			}
+			b.Filter(newFilter("format").String("pix_fmts", "yuv420p").To(v))
+			vs = append(vs, v)
+			if !withAudio {
+				continue
+			}
+			a := fmt.Sprintf("a%d", i)
+			if audio[i] {
+				b.Filter(newFilter("aresample").From(fmt.Sprintf("%d:a", i)).Int("osr", concatSampleRate))
+			} else {
+				b.Filter(newFilter("anullsrc").Int("r", concatSampleRate).String("cl", "stereo"))
+				b.Filter(newFilter("atrim").Float("duration", durations[i].Seconds()))
+			}
+			b.Filter(newFilter("aformat").String("channel_layouts", "stereo").To(a))
+			as = append(as, a)
+		}
+		joinClips(b, vs, as, durations, joints)
+		return nil
+	}
+
+	// A target bitrate is met with a two-pass encode, as for post-processing
+	var passLog string
+	if enc.bitrate != "" {
+		b := newFFmpeg()
+		if err := addInputs(b, false); err != nil {
+			return err
+		}
+		if passLog, err = enc.firstPass(ctx, b); err != nil {
+			return err
+		}
+		defer os.RemoveAll(filepath.Dir(passLog))
+	}
+
+	b := newFFmpeg()
+	if err := addInputs(b, anyAudio); err != nil {
+		return err
+	}
+	enc.addVideoCodec(b, 2, passLog)
+	enc.addAudioCodec(b, anyAudio)
+	b.Option("-movflags", "+faststart+write_colr")
+	return b.RunReplacing(ctx, out)
+}
+
+// joinClips joins the prepared video streams vs (and audio streams as, if
+// any) of clips lasting durations. Cuts join the streams as they are; other
+// transitions overlap them with xfade and acrossfade.
+func joinClips(b *ffmpegBuilder, vs, as []string, durations []time.Duration, joints []transition) {
+	a := 0
+	if len(as) > 0 {
+		a = 1
+	}
+	if allCuts(joints) {
+		var segments []string
+		for i := range vs {
+			segments = append(segments, vs[i])
+			if a == 1 {
+				segments = append(segments, as[i])
+			}
+		}
+		b.Filter(newFilter("concat").From(segments...).Int("n", len(vs)).Int("v", 1).Int("a", a))
+		return
+	}
+
+	// Join one clip at a time onto what has been joined so far, keeping
+	// track of its length so each transition starts where it should
+	v, au := vs[0], ""
+	if a == 1 {
+		au = as[0]
+	}
+	length := durations[0]
+	for i, t := range joints {
+		nv, na := fmt.Sprintf("vj%d", i), fmt.Sprintf("aj%d", i)
+		if t.cut() {
+			ins, outs := []string{v, vs[i+1]}, []string{nv}
+			if a == 1 {
+				ins, outs = []string{v, au, vs[i+1], as[i+1]}, []string{nv, na}
+			}
+			b.Filter(newFilter("concat").From(ins...).Int("n", 2).Int("v", 1).Int("a", a).To(outs...))
+			length += durations[i+1]
+		} else {
+			b.Filter(newFilter("xfade").From(v, vs[i+1]).
+				String("transition", transitionKinds[t.kind]).
+				Float("duration", t.duration.Seconds()).
+				Float("offset", (length - t.duration).Seconds()).
+				To(nv))
+			if a == 1 {
+				b.Filter(newFilter("acrossfade").From(au, as[i+1]).Float("d", t.duration.Seconds()).To(na))
+			}
+			length += durations[i+1] - t.duration
+		}
+		v, au = nv, na
+	}
+
+	// A single-input concat passes the joined streams through unlabeled, so
+	// they become the output
+	final := []string{v}
+	if a == 1 {
+		final = append(final, au)
+	}
+	b.Filter(newFilter("concat").From(final...).Int("n", 1).Int("v", 1).Int("a", a))
+}
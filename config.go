@@ -0,0 +1,437 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// config holds user defaults from ~/.sora-cli/config.toml. Flags override
+// the config, and the config overrides the built-in defaults. Zero values
+// mean "not set".
+type config struct {
+	// Version is the config format the file was written for; see
+	// configVersion. Unset means 1.
+	Version int `toml:"version"`
+
+	Model        string `toml:"model"`         // model ID or alias
+	Size         string `toml:"size"`          // WxH, or "portrait"/"landscape"
+	Seconds      int    `toml:"seconds"`       // 4, 8, or 12
+	OutputDir    string `toml:"output_dir"`    // where default-named videos are saved
+	OnExisting   string `toml:"on_existing"`   // "suffix" (default), "overwrite", or "skip"
+	BaseURL      string `toml:"base_url"`      // OpenAI API base URL
+	PollInterval string `toml:"poll_interval"` // e.g. "5s"
+	MaxWait      string `toml:"max_wait"`      // e.g. "45m"; default no overall limit
+	MaxAttempts  int    `toml:"max_attempts"`  // tries per API request, including the first
+	// ConfirmAbove is the estimated cost in USD above which a submission
+	// must be confirmed; negative never asks
+	ConfirmAbove *float64 `toml:"confirm_above"`
+	// Open plays each downloaded video (--open), with Player if set, e.g.
+	// "mpv --loop"; otherwise the platform's default player
+	Open   bool   `toml:"open"`
+	Player string `toml:"player"`
+	// EncryptTo are age or GPG recipients every download is encrypted to
+	// (--encrypt-to)
+	EncryptTo []string `toml:"encrypt_to"`
+	// ReadOnly refuses create, remix, extend, batch, and delete (--read-only); it
+	// can't be turned off from the command line
+	ReadOnly bool `toml:"read_only"`
+	// Thumbnail saves a poster frame next to each download (--thumbnail),
+	// taken ThumbnailAt into the video, e.g. "2.5s"
+	Thumbnail   bool   `toml:"thumbnail"`
+	ThumbnailAt string `toml:"thumbnail_at"`
+
+	Profile  string              `toml:"profile"` // profile used when --profile isn't given
+	Profiles map[string]*profile `toml:"profiles"`
+
+	// ModelAliases maps short names to model IDs, e.g. best = "sora-2-pro"
+	ModelAliases map[string]string `toml:"model_aliases"`
+
+	Notifications notifications `toml:"notifications"`
+
+	// Blocklist lists terms prompts must not contain
+	Blocklist blocklist `toml:"blocklist"`
+
+	// Lint tunes the lint-prompt checks
+	Lint lintConfig `toml:"lint"`
+
+	pollInterval time.Duration
+	maxWait      time.Duration
+	thumbAt      time.Duration
+	onExisting   existingPolicy
+}
+
+// profile is a named account: where its API key comes from, which endpoint
+// it talks to, and the organization/project it bills to. Empty fields fall
+// back to the top-level settings and OPENAI_API_KEY.
+type profile struct {
+	BaseURL       string `toml:"base_url"`
+	APIKeyEnv     string `toml:"api_key_env"`     // environment variable holding the key
+	APIKeyFile    string `toml:"api_key_file"`    // file whose contents are the key
+	APIKeyCommand string `toml:"api_key_command"` // shell command that prints the key
+	Organization  string `toml:"organization"`    // sent as OpenAI-Organization
+	Project       string `toml:"project"`         // sent as OpenAI-Project
+	ReadOnly      bool   `toml:"read_only"`       // refuse create, remix, extend, batch, and delete
+}
+
+// notifications are chat pings sent when a job finishes, in addition to
+// any --notify-url. Message templates use text/template; see notifyMessage
+// for the fields.
+type notifications struct {
+	SlackWebhook   string `toml:"slack_webhook"`   // Slack incoming webhook URL
+	DiscordWebhook string `toml:"discord_webhook"` // Discord channel webhook URL
+	NtfyTopic      string `toml:"ntfy_topic"`      // topic name, or a full topic URL
+	NtfyServer     string `toml:"ntfy_server"`     // default https://ntfy.sh
+	NtfyToken      string `toml:"ntfy_token"`      // access token for protected topics
+	Message        string `toml:"message"`         // template for completed jobs
+	FailureMessage string `toml:"failure_message"` // template for failed jobs
+
+	message, failureMessage *template.Template
+}
+
+// configVersion is the newest config format this build understands. The
+// file is never rewritten, so a format change must keep reading older
+// files as they are; the version only lets an older build refuse a newer
+// file instead of misreading it.
+const configVersion = 1
+
+// cfg is the loaded configuration, set once in main before dispatching
+var cfg = &config{}
+
+// soraDir returns the directory holding history, config, and other state:
+// ~/.sora-cli, or the active workspace's directory
+func soraDir() (string, error) {
+	if workspace != "" {
+		dir, err := workspacesDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(dir, workspace), nil
+	}
+	return baseDir()
+}
+
+// baseDir returns ~/.sora-cli, whatever the workspace
+func baseDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("getting home directory: %w", err)
+	}
+	return filepath.Join(home, ".sora-cli"), nil
+}
+
+// getConfigPath returns the path to the config file
+func getConfigPath() (string, error) {
+	dir, err := soraDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.toml"), nil
+}
+
+// loadConfig reads and validates the config file. A missing file is not an error.
+func loadConfig() (*config, error) {
+	path, err := getConfigPath()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &config{}
+	md, err := toml.DecodeFile(path, c)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	default:
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return nil, fmt.Errorf("%s: unknown setting %q", path, undecoded[0].String())
+		}
+		if err := c.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	// A workspace's own config can't turn off read-only mode
+	if workspace != "" && !c.ReadOnly {
+		if c.ReadOnly, err = baseReadOnly(); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// baseReadOnly reports whether ~/.sora-cli/config.toml turns on read-only
+// mode, at the top or in its default profile. It applies in every
+// workspace, so a kiosk can't be unlocked by creating one.
+func baseReadOnly() (bool, error) {
+	dir, err := baseDir()
+	if err != nil {
+		return false, err
+	}
+	path := filepath.Join(dir, "config.toml")
+	var base struct {
+		ReadOnly bool   `toml:"read_only"`
+		Profile  string `toml:"profile"`
+		Profiles map[string]struct {
+			ReadOnly bool `toml:"read_only"`
+		} `toml:"profiles"`
+	}
+	if _, err := toml.DecodeFile(path, &base); os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return base.ReadOnly || base.Profiles[base.Profile].ReadOnly, nil
+}
+
+// validate normalizes values and rejects anything the CLI would reject as a flag
+func (c *config) validate() error {
+	if c.Version > configVersion {
+		return fmt.Errorf("version %d is for a newer sora-cli (this one reads version %d); upgrade sora-cli", c.Version, configVersion)
+	}
+	for alias, id := range c.ModelAliases {
+		if strings.TrimSpace(id) == "" {
+			return fmt.Errorf("model alias %q has no model ID", alias)
+		}
+	}
+	c.Model = c.resolveModel(c.Model)
+
+	switch strings.ToLower(c.Size) {
+	case "":
+	case "landscape":
+		c.Size = "1280x720"
+	case "portrait":
+		c.Size = "720x1280"
+	case "1280x720", "720x1280":
+	default:
+		return fmt.Errorf("size must be 1280x720, 720x1280, portrait, or landscape, got %q", c.Size)
+	}
+
+	switch c.Seconds {
+	case 0, 4, 8, 12:
+	default:
+		return fmt.Errorf("seconds must be 4, 8, or 12, got %d", c.Seconds)
+	}
+
+	if c.PollInterval != "" {
+		d, err := time.ParseDuration(c.PollInterval)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid poll_interval %q", c.PollInterval)
+		}
+		c.pollInterval = d
+	}
+
+	if c.MaxWait != "" {
+		d, err := time.ParseDuration(c.MaxWait)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid max_wait %q", c.MaxWait)
+		}
+		c.maxWait = d
+	}
+
+	if c.ThumbnailAt != "" {
+		d, err := time.ParseDuration(c.ThumbnailAt)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid thumbnail_at %q", c.ThumbnailAt)
+		}
+		c.thumbAt = d
+	}
+
+	if c.MaxAttempts < 0 {
+		return fmt.Errorf("max_attempts must be at least 1, got %d", c.MaxAttempts)
+	}
+
+	c.OutputDir = expandHome(c.OutputDir)
+
+	switch strings.ToLower(c.OnExisting) {
+	case "", "suffix":
+		c.onExisting = existingSuffix
+	case "overwrite":
+		c.onExisting = existingOverwrite
+	case "skip":
+		c.onExisting = existingSkip
+	default:
+		return fmt.Errorf("on_existing must be suffix, overwrite, or skip, got %q", c.OnExisting)
+	}
+
+	for name, p := range c.Profiles {
+		sources := 0
+		for _, s := range []string{p.APIKeyEnv, p.APIKeyFile, p.APIKeyCommand} {
+			if s != "" {
+				sources++
+			}
+		}
+		if sources > 1 {
+			return fmt.Errorf("profile %q: set only one of api_key_env, api_key_file, and api_key_command", name)
+		}
+		p.APIKeyFile = expandHome(p.APIKeyFile)
+	}
+	if c.Profile != "" && c.Profiles[c.Profile] == nil {
+		return fmt.Errorf("default profile %q is not defined", c.Profile)
+	}
+	if err := c.Notifications.validate(); err != nil {
+		return fmt.Errorf("notifications: %w", err)
+	}
+	if err := c.Blocklist.validate(); err != nil {
+		return fmt.Errorf("blocklist: %w", err)
+	}
+	if err := c.Lint.validate(); err != nil {
+		return fmt.Errorf("lint: %w", err)
+	}
+	return nil
+}
+
+// expandHome replaces a leading ~/ with the home directory
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[2:])
+		}
+	}
+	return path
+}
+
+// lookupProfile returns the named profile, or nil for name ""
+func (c *config) lookupProfile(name string) (*profile, error) {
+	if name == "" {
+		return nil, nil
+	}
+	p, ok := c.Profiles[name]
+	if !ok {
+		names := make([]string, 0, len(c.Profiles))
+		for n := range c.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return nil, fmt.Errorf("unknown profile %q (no profiles are defined in the config file)", name)
+		}
+		return nil, fmt.Errorf("unknown profile %q (defined: %s)", name, strings.Join(names, ", "))
+	}
+	return p, nil
+}
+
+// apiKey reads the profile's key from its configured source. An empty key
+// with a nil error means the profile has no key source of its own.
+func (p *profile) apiKey() (string, error) {
+	switch {
+	case p.APIKeyEnv != "":
+		key := strings.TrimSpace(os.Getenv(p.APIKeyEnv))
+		if key == "" {
+			return "", fmt.Errorf("%s is not set", p.APIKeyEnv)
+		}
+		return key, nil
+	case p.APIKeyFile != "":
+		data, err := os.ReadFile(p.APIKeyFile)
+		if err != nil {
+			return "", fmt.Errorf("reading API key: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	case p.APIKeyCommand != "":
+		cmd := exec.Command("sh", "-c", p.APIKeyCommand)
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("running api_key_command: %w", err)
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+	return "", nil
+}
+
+// headers returns the organization and project headers for the profile
+func (p *profile) headers() http.Header {
+	h := http.Header{}
+	if p.Organization != "" {
+		h.Set("OpenAI-Organization", p.Organization)
+	}
+	if p.Project != "" {
+		h.Set("OpenAI-Project", p.Project)
+	}
+	return h
+}
+
+// builtinModelAliases are always available; config aliases override them
+var builtinModelAliases = map[string]string{
+	"std": "sora-2",
+	"pro": "sora-2-pro",
+}
+
+// resolveModel maps an alias to its model ID. Anything that isn't an alias
+// is taken as a raw model ID, so new models work without a CLI update.
+func (c *config) resolveModel(name string) string {
+	if id, ok := c.ModelAliases[name]; ok {
+		return id
+	}
+	if id, ok := builtinModelAliases[name]; ok {
+		return id
+	}
+	return name
+}
+
+// The accessors below return the configured value or the built-in default.
+
+func (c *config) baseURL() string {
+	if c.BaseURL != "" {
+		return c.BaseURL
+	}
+	return defaultBaseURL
+}
+
+func (c *config) model() string {
+	if c.Model != "" {
+		return c.Model
+	}
+	return "sora-2"
+}
+
+func (c *config) size() string {
+	if c.Size != "" {
+		return c.Size
+	}
+	return "1280x720"
+}
+
+func (c *config) confirmAbove() float64 {
+	if c.ConfirmAbove != nil {
+		return *c.ConfirmAbove
+	}
+	return 2.00
+}
+
+func (c *config) seconds() string {
+	if c.Seconds != 0 {
+		return fmt.Sprint(c.Seconds)
+	}
+	return "8"
+}
+
+func (c *config) maxAttempts() int {
+	if c.MaxAttempts > 0 {
+		return c.MaxAttempts
+	}
+	return 5
+}
+
+func (c *config) poll() time.Duration {
+	if c.pollInterval > 0 {
+		return c.pollInterval
+	}
+	return 3 * time.Second
+}
+
+// thumbnailAt returns where --thumbnail takes its frame by default
+func (c *config) thumbnailAt() time.Duration {
+	if c.ThumbnailAt != "" {
+		return c.thumbAt
+	}
+	return defaultThumbnailAt
+}
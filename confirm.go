@@ -0,0 +1,238 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	flag "github.com/spf13/pflag"
+	"golang.org/x/term"
+)
+
+// pricePerSecond is the published USD price per second of 720p output
+var pricePerSecond = map[string]float64{
+	"sora-2":     0.10,
+	"sora-2-pro": 0.30,
+}
+
+// createRequest holds everything that decides what a generation costs and
+// where it ends up, so it can be reviewed before submission
+type createRequest struct {
+	prompt     string
+	model      string
+	size       string
+	seconds    string
+	firstFrame string
+	output     string
+	runs       int // number of --explore variations or --count takes; 0 for a single video
+}
+
+// videoCost returns the USD price of one video of the given length, and
+// false for models without a known price
+func videoCost(model, seconds string) (float64, bool) {
+	price, ok := pricePerSecond[model]
+	secs, err := strconv.Atoi(seconds)
+	if !ok || err != nil {
+		return 0, false
+	}
+	return price * float64(secs), true
+}
+
+// estimatedCost returns the expected price of the request, or "" for models
+// without a known price
+func (r *createRequest) estimatedCost() string {
+	cost, ok := videoCost(r.model, r.seconds)
+	if !ok {
+		return ""
+	}
+	if r.runs > 1 {
+		return fmt.Sprintf("$%.2f × %d = $%.2f", cost, r.runs, cost*float64(r.runs))
+	}
+	return fmt.Sprintf("$%.2f", cost)
+}
+
+// addYesFlag registers --yes, which skips the cost confirmation
+func addYesFlag(fs *flag.FlagSet, yes *bool) {
+	fs.BoolVarP(yes, "yes", "y", false, "Submit without asking, even if the estimated cost is above confirm_above")
+}
+
+// confirmCost prints the estimated cost of a submission and, when it is
+// above confirm_above, asks before spending it. Without a terminal it
+// refuses, so a script can't overspend by accident without --yes. It
+// returns false if the user declines.
+func confirmCost(cost float64, what string, yes bool) bool {
+	infof("Estimated cost: $%.2f (%s)\n", cost, what)
+	limit := cfg.confirmAbove()
+	if yes || limit < 0 || cost <= limit {
+		return true
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Fprintf(os.Stderr, "Refusing to spend more than $%.2f (confirm_above) without confirmation; pass --yes\n", limit)
+		os.Exit(2)
+	}
+	answer, err := newLineEditor(nil).readLine(fmt.Sprintf("That is more than $%.2f. Submit? [y/N]: ", limit))
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// outputLabel describes where the video will be written
+func (r *createRequest) outputLabel() string {
+	switch r.output {
+	case "":
+		return filepath.Join(cfg.OutputDir, "<job id>.mp4")
+	case "-":
+		return "stdout"
+	}
+	return r.output
+}
+
+// summaryField is one editable row of the request summary
+type summaryField struct {
+	label string
+	value func(r *createRequest) string
+	set   func(r *createRequest, v string) error
+}
+
+var summaryFields = []summaryField{
+	{"Prompt", func(r *createRequest) string { return singleLine(r.prompt) }, func(r *createRequest, v string) error {
+		if strings.TrimSpace(v) == "" {
+			return errors.New("prompt cannot be empty")
+		}
+		r.prompt = v
+		return nil
+	}},
+	{"Model", func(r *createRequest) string { return r.model }, func(r *createRequest, v string) error {
+		if v == "" {
+			return errors.New("model cannot be empty")
+		}
+		r.model = cfg.resolveModel(v)
+		return nil
+	}},
+	{"Size", func(r *createRequest) string { return r.size }, func(r *createRequest, v string) error {
+		switch strings.ToLower(v) {
+		case "landscape", "1280x720":
+			r.size = "1280x720"
+		case "portrait", "720x1280":
+			r.size = "720x1280"
+		default:
+			return fmt.Errorf("size must be 1280x720, 720x1280, portrait, or landscape, got %q", v)
+		}
+		return nil
+	}},
+	{"Seconds", func(r *createRequest) string { return r.seconds }, func(r *createRequest, v string) error {
+		if v != "4" && v != "8" && v != "12" {
+			return fmt.Errorf("seconds must be 4, 8, or 12, got %q", v)
+		}
+		r.seconds = v
+		return nil
+	}},
+	{"Reference", func(r *createRequest) string { return r.firstFrame }, func(r *createRequest, v string) error {
+		if v != "" {
+			if _, err := os.Stat(v); err != nil {
+				return err
+			}
+		}
+		r.firstFrame = v
+		return nil
+	}},
+	{"Output", func(r *createRequest) string { return r.output }, func(r *createRequest, v string) error {
+		r.output = v
+		return nil
+	}},
+}
+
+// printRequestSummary draws the numbered request summary in a box
+func printRequestSummary(w *os.File, r *createRequest) {
+	rows := make([]string, 0, len(summaryFields)+1)
+	for i, f := range summaryFields {
+		v := f.value(r)
+		switch {
+		case f.label == "Output":
+			v = r.outputLabel()
+		case v == "":
+			v = "(none)"
+		}
+		rows = append(rows, fmt.Sprintf("%d  %-10s %s", i+1, f.label, v))
+	}
+	if cost := r.estimatedCost(); cost != "" {
+		rows = append(rows, fmt.Sprintf("   %-10s %s", "Est. cost", cost))
+	}
+
+	// Keep the box inside the terminal; long prompts are truncated
+	maxWidth := 76
+	if tw := terminalWidth(w); tw > 0 {
+		maxWidth = tw - 4
+	}
+	width := 0
+	for i, row := range rows {
+		rows[i] = truncate(row, maxWidth)
+		if n := utf8.RuneCountInString(rows[i]); n > width {
+			width = n
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("┌" + strings.Repeat("─", width+2) + "┐\n")
+	for _, row := range rows {
+		sb.WriteString("│ " + row + strings.Repeat(" ", width-utf8.RuneCountInString(row)) + " │\n")
+	}
+	sb.WriteString("└" + strings.Repeat("─", width+2) + "┘\n")
+	fmt.Fprint(w, sb.String())
+}
+
+// confirmRequest shows the request summary and lets the user edit fields
+// until they proceed. It returns false if the user aborts.
+func confirmRequest(r *createRequest) bool {
+	ed := newLineEditor(nil)
+	for {
+		printRequestSummary(os.Stderr, r)
+		answer, err := ed.readLine(fmt.Sprintf("Proceed? [Y/n, or 1-%d to edit]: ", len(summaryFields)))
+		if err != nil {
+			return false
+		}
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		switch answer {
+		case "", "y", "yes":
+			return true
+		case "n", "no", "q":
+			return false
+		}
+
+		n, err := strconv.Atoi(answer)
+		if err != nil || n < 1 || n > len(summaryFields) {
+			infof("Enter y, n, or a field number\n")
+			continue
+		}
+		f := summaryFields[n-1]
+		current := f.value(r)
+		if f.label == "Prompt" && strings.Contains(r.prompt, "\n") {
+			infof("The prompt is edited on one line; leave it unchanged to keep its line breaks\n")
+		}
+		for {
+			v, err := ed.editLine(f.label+": ", current)
+			if errors.Is(err, errInterrupted) || errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return false
+			}
+			// An unchanged value keeps the original, which for the prompt
+			// may span several lines the editor showed as one
+			if strings.TrimSpace(v) == strings.TrimSpace(current) {
+				break
+			}
+			if err := f.set(r, strings.TrimSpace(v)); err != nil {
+				infof("%s\n", capitalize(err.Error()))
+				continue
+			}
+			break
+		}
+	}
+}
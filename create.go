@@ -0,0 +1,404 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// runCreate implements `sora-cli create`: submit a new generation, wait for
+// it, download the result, and record it in history.
+func runCreate(args []string) {
+	fs := newFlagSet("create", "[flags]")
+	var (
+		promptFile string
+		edit       editOptions
+		prompt     string
+		firstFrame string
+		videoFile  string
+		seconds    string
+		model      string
+		usePro     bool
+		portrait   bool
+		landscape  bool
+		strict     bool
+		noWait     bool
+		tonemap    bool
+		pad        bool
+		fallback   string
+		idemKey    string
+		yes        bool
+		seedRef    string
+		count      int
+		matrixPath string
+		parallel   int
+		translate  translateOptions
+		explore    exploreOptions
+		post       postOptions
+		opts       jobOptions
+		common     commonOptions
+	)
+	fs.StringVarP(&prompt, "prompt", "p", "", "Text prompt for the video (- reads it from stdin). If empty, reads interactively.")
+	addPromptFileFlag(fs, &promptFile)
+	addEditFlags(fs, &edit)
+	fs.StringVar(&firstFrame, "first-frame", "", "Path to input image (JPEG, PNG, WebP) to use as the first frame of the video")
+	fs.BoolVar(&tonemap, "tonemap", false, "Convert an HDR --first-frame reference to SDR BT.709 (needs ffmpeg with zscale)")
+	addPadFlag(fs, &pad)
+	fs.StringVar(&videoFile, "video", "", "Path to input video file (NOT CURRENTLY AVAILABLE - use remix instead)")
+	fs.StringVar(&model, "model", cfg.model(), "Model ID or alias (std, pro, or one from model_aliases in the config file)")
+	fs.BoolVar(&usePro, "pro", false, "Use sora-2-pro model (better quality at same 720p resolution, 3x cost); same as --model pro")
+	fs.StringVar(&seconds, "seconds", cfg.seconds(), "Video duration in seconds: 4, 8, or 12")
+	fs.BoolVar(&portrait, "portrait", false, "Generate portrait video (720x1280)")
+	fs.BoolVar(&landscape, "landscape", false, "Generate landscape video (1280x720)")
+	fs.StringVar(&fallback, "fallback-model", "", "Retry on this model (e.g. sora-2) if the requested one is refused for quota or access reasons")
+	fs.BoolVar(&strict, "strict", false, "Fail if the downloaded video's size or duration doesn't match the request")
+	fs.BoolVar(&noWait, "no-wait", false, "Print the job ID and exit without waiting; resume later with 'sora-cli attach'")
+	fs.StringVar(&idemKey, "idempotency-key", "", "Submit with this Idempotency-Key, so rerunning the same command returns the job it already created")
+	addSeedFlag(fs, &seedRef)
+	fs.IntVarP(&count, "count", "n", 1, fmt.Sprintf("Render this many takes of the same prompt (up to %d), saved as name-v1.mp4, name-v2.mp4, ...", maxTakes))
+	fs.StringVar(&matrixPath, "matrix", "", "Render every combination of the prompts, models, durations, and sizes listed in this YAML file")
+	fs.IntVarP(&parallel, "concurrency", "j", 4, "Maximum number of --count takes or matrix combinations rendering at once")
+	fs.IntVar(&explore.runs, "explore", 0, fmt.Sprintf("Generate this many variations of the prompt (up to %d) and render each", maxExplore))
+	fs.StringVar(&explore.jitter, "jitter", "", "What --explore should vary, e.g. \"the camera angle and time of day\"")
+	fs.StringVar(&explore.model, "jitter-model", defaultJitterModel, "Chat model that writes the --explore variations")
+	addTranslateFlags(fs, &translate)
+	addJobFlags(fs, &opts)
+	addSessionFlag(fs, &opts.session)
+	addYesFlag(fs, &yes)
+	addPostFlags(fs, &post)
+	addCommonFlags(fs, &common)
+	fs.Parse(args)
+	common.requireWritable("create videos")
+
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "Error: unexpected arguments: %v (quote the prompt and pass it with -p)\n", fs.Args())
+		os.Exit(2)
+	}
+	prompt = mustReadPrompt(prompt, promptFile)
+	edit.exitIfInvalid(prompt, promptFile)
+
+	// Validate --video flag (not currently supported)
+	if videoFile != "" {
+		fmt.Fprintln(os.Stderr, "Error: Video-to-video is not currently available through the Sora API.")
+		fmt.Fprintln(os.Stderr, "To modify existing Sora-generated videos, use 'sora-cli remix' instead.")
+		fmt.Fprintln(os.Stderr, "See README section 6 for details on remixing.")
+		os.Exit(2)
+	}
+
+	// Validate seconds
+	if seconds != "4" && seconds != "8" && seconds != "12" {
+		fmt.Fprintf(os.Stderr, "Invalid --seconds value: %s (must be 4, 8, or 12)\n", seconds)
+		os.Exit(2)
+	}
+
+	// Determine model: --pro is shorthand for --model sora-2-pro
+	if usePro && fs.Changed("model") {
+		fmt.Fprintln(os.Stderr, "Cannot use both --pro and --model")
+		os.Exit(2)
+	}
+	model = cfg.resolveModel(model)
+	if usePro {
+		model = "sora-2-pro"
+	}
+	if model == "" {
+		fmt.Fprintln(os.Stderr, "--model cannot be empty")
+		os.Exit(2)
+	}
+
+	// Determine video size
+	if portrait && landscape {
+		fmt.Fprintln(os.Stderr, "Cannot use both --portrait and --landscape")
+		os.Exit(2)
+	}
+	if noWait && opts.output == "-" {
+		fmt.Fprintln(os.Stderr, "Cannot use --no-wait with -o - (there is nothing to pipe yet)")
+		os.Exit(2)
+	}
+	if err := post.validate(opts.output); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	if opts.encrypted() && post.enabled() {
+		fmt.Fprintln(os.Stderr, "Error: post-processing can't be combined with --encrypt-to; the video is never decrypted on disk")
+		os.Exit(2)
+	}
+	if noWait && post.enabled() {
+		fmt.Fprintln(os.Stderr, "Cannot use post-processing options with --no-wait; pass them to 'sora-cli attach' instead")
+		os.Exit(2)
+	}
+	if tonemap {
+		if err := checkTonemap(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	if err := validateNotify(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	if noWait && notifier.requested() {
+		fmt.Fprintln(os.Stderr, "Cannot use --notify or --notify-url with --no-wait; pass them to 'sora-cli attach' instead")
+		os.Exit(2)
+	}
+	if noWait && opts.livePreview {
+		fmt.Fprintln(os.Stderr, "Cannot use --live-preview with --no-wait; pass it to 'sora-cli attach' instead")
+		os.Exit(2)
+	}
+	if err := checkIdempotencyKey(idemKey); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	if explore.runs != 0 {
+		switch {
+		case explore.runs < 0 || explore.runs > maxExplore:
+			fmt.Fprintf(os.Stderr, "--explore must be between 1 and %d\n", maxExplore)
+			os.Exit(2)
+		case explore.jitter == "":
+			fmt.Fprintln(os.Stderr, "--explore needs --jitter to say what to vary")
+			os.Exit(2)
+		case noWait || opts.output == "-" || fallback != "" || idemKey != "":
+			fmt.Fprintln(os.Stderr, "--explore cannot be combined with --no-wait, -o -, --fallback-model, or --idempotency-key")
+			os.Exit(2)
+		}
+	}
+	switch {
+	case count < 1 || count > maxTakes:
+		fmt.Fprintf(os.Stderr, "--count must be between 1 and %d\n", maxTakes)
+		os.Exit(2)
+	case parallel < 1:
+		fmt.Fprintln(os.Stderr, "--concurrency must be at least 1")
+		os.Exit(2)
+	case count > 1 && (explore.runs != 0 || noWait || opts.output == "-" || fallback != "" || idemKey != ""):
+		fmt.Fprintln(os.Stderr, "--count cannot be combined with --explore, --no-wait, -o -, --fallback-model, or --idempotency-key")
+		os.Exit(2)
+	case (count > 1 || explore.runs != 0) && opts.livePreview:
+		fmt.Fprintln(os.Stderr, "--live-preview follows a single job; it can't be combined with --count or --explore")
+		os.Exit(2)
+	case count > 1 && seedRef != "":
+		fmt.Fprintln(os.Stderr, "--count cannot be combined with --seed; takes with the same seed would all look alike")
+		os.Exit(2)
+	}
+	// A prompt with {a,b} groups is a matrix too
+	matrix := matrixPath != "" || len(braceGroups(prompt)) > 0
+	if matrix && (explore.runs != 0 || count > 1 || noWait || opts.output == "-" || fallback != "" || idemKey != "" || opts.livePreview || translate.lang != "") {
+		fmt.Fprintln(os.Stderr, "A matrix cannot be combined with --explore, --count, --no-wait, -o -, --fallback-model, --idempotency-key, --live-preview, or --translate-prompt")
+		os.Exit(2)
+	}
+	seed, err := resolveSeed(seedRef)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --seed: %v\n", err)
+		os.Exit(2)
+	}
+	explore.seed = seed
+	videoSize := cfg.size()
+	if portrait {
+		videoSize = "720x1280"
+	} else if landscape {
+		videoSize = "1280x720"
+	}
+	if post.safeArea != "" && videoSize == "1280x720" {
+		fmt.Fprintln(os.Stderr, "Error: --safe-area previews are for portrait video; add --portrait")
+		os.Exit(2)
+	}
+
+	if err := opts.validateBudgets(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	// Resolve output collisions before spending money on a generation.
+	// Each --explore run, --count take, or matrix combination gets its own
+	// path, resolved when it is prepared.
+	multi := explore.runs > 0 || count > 1 || matrix
+	if !multi {
+		opts.prepareOutput()
+	}
+	translate.exitIfInvalid()
+
+	apiKey := common.mustAPIKey()
+	if matrix {
+		base := batchRow{Prompt: prompt, Model: model, Size: videoSize, Seconds: json.Number(seconds), Output: opts.output, FirstFrame: firstFrame}
+		if !runMatrix(&common, apiKey, matrixPath, base, seed, parallel, tonemap, pad, yes, &post, opts) {
+			os.Exit(1)
+		}
+		return
+	}
+	interactive := (prompt == "" || edit.enabled) && term.IsTerminal(int(os.Stdin.Fd()))
+	if edit.enabled {
+		prompt = edit.mustCompose("")
+	}
+	prompt = mustPrompt(prompt)
+	mustScreen("prompt", prompt)
+	mustScreen("--jitter", explore.jitter)
+	prompt, original := translate.mustTranslate(&common, apiKey, prompt)
+	if original != "" {
+		mustScreen("translated prompt", prompt)
+	}
+
+	if firstFrame != "" {
+		checkReferenceLength(firstFrame, seconds)
+		if m := checkReferenceAspect(firstFrame, videoSize, pad); m != nil {
+			var hints []string
+			switch m.better {
+			case "720x1280":
+				hints = append(hints, "Add --portrait to render a portrait video instead.")
+			case "1280x720":
+				hints = append(hints, "Add --landscape to render a landscape video instead.")
+			}
+			m.warn(append(hints, "Add --pad to keep the whole frame between black bars.")...)
+		}
+	}
+
+	// In interactive mode, review the request before any money is spent
+	if interactive {
+		req := createRequest{prompt: prompt, model: model, size: videoSize, seconds: seconds, firstFrame: firstFrame, output: opts.output, runs: max(explore.runs, count)}
+		if !confirmRequest(&req) {
+			fmt.Fprintln(os.Stderr, "Aborted")
+			os.Exit(exitCanceled)
+		}
+		if req.prompt != prompt {
+			mustScreen("prompt", req.prompt)
+		}
+		prompt, model, videoSize, seconds, firstFrame = req.prompt, req.model, req.size, req.seconds, req.firstFrame
+		if req.output != opts.output && !multi {
+			opts.output = req.output
+			opts.prepareOutput()
+		}
+	} else if cost, ok := videoCost(model, seconds); ok {
+		// The interactive summary already showed the cost
+		what := fmt.Sprintf("%s, %ss", model, seconds)
+		switch {
+		case explore.runs > 1:
+			what += fmt.Sprintf(", × %d variations", explore.runs)
+			cost *= float64(explore.runs)
+		case count > 1:
+			what += fmt.Sprintf(", × %d takes", count)
+			cost *= float64(count)
+		}
+		if !confirmCost(cost, what, yes) {
+			fmt.Fprintln(os.Stderr, "Aborted")
+			os.Exit(exitCanceled)
+		}
+	}
+
+	// Each phase (queue, render, download) has its own time budget; the
+	// context itself is only canceled by Ctrl-C.
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	client := mustHTTPClient(common.net)
+	timings := newPhaseTimings()
+
+	if multi {
+		base := batchRow{Prompt: prompt, Model: model, Size: videoSize, Seconds: json.Number(seconds), Output: opts.output, FirstFrame: firstFrame}
+		var ok bool
+		if explore.runs > 0 {
+			ok = runExplore(ctx, client, common.baseURL, apiKey, base, explore, tonemap, pad, &post, opts)
+		} else {
+			ok = runTakes(ctx, client, common.baseURL, apiKey, base, count, parallel, tonemap, pad, &post, opts)
+		}
+		if !ok {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Prepare the reference file (if any) before submitting
+	notifier.track("", prompt, model)
+	var ref *inputReference
+	if firstFrame != "" {
+		var err error
+		stop := timings.start("preprocessing")
+		ref, err = loadInputReference(firstFrame, videoSize, tonemap, pad)
+		stop()
+		if err != nil {
+			fail("", "input file error", err)
+		}
+	}
+
+	stop := timings.start("upload")
+	jobID, reqID, err := createVideoJob(ctx, client, common.baseURL, apiKey, model, prompt, ref, videoSize, seconds, seed, idemKey)
+	if err != nil && fallback != "" && fallback != model && isModelUnavailable(err) {
+		warnf("NOTICE: %s is unavailable (%v); retrying with %s (--fallback-model)\n", model, err, fallback)
+		model = fallback
+		// The fallback is a different request, so it can't reuse the key
+		if idemKey != "" {
+			idemKey += "-" + fallback
+		}
+		jobID, reqID, err = createVideoJob(ctx, client, common.baseURL, apiKey, model, prompt, ref, videoSize, seconds, seed, idemKey)
+	}
+	stop()
+	if err != nil {
+		if seed != nil && seedRejected(err) {
+			fmt.Fprintln(os.Stderr, "The model may not accept --seed; retry without it.")
+		}
+		fail("", "create job error", err)
+	}
+	infof("Created job: %s\n", jobID)
+	notifier.track(jobID, prompt, model)
+	emitEvent(jsonEvent{Event: "submitted", ID: jobID, RequestID: reqID})
+
+	entry := videoHistoryEntry{
+		ID:             jobID,
+		Prompt:         prompt,
+		OriginalPrompt: original,
+		CreatedAt:      time.Now().UTC().Format(time.RFC3339),
+		OutputFile:     opts.output,
+		Model:          model,
+		Session:        opts.session,
+		RequestID:      reqID,
+		Seed:           seed,
+	}
+	if firstFrame != "" {
+		entry.ImageInput = &firstFrame
+	}
+	if noWait {
+		detachJob(entry)
+		return
+	}
+
+	st, err := waitForJob(ctx, client, common.baseURL, apiKey, jobID, opts, time.Now(), timings)
+	if err != nil {
+		fail(jobID, "\nError", err)
+	}
+
+	output, err := saveJobOutput(ctx, client, common.baseURL, apiKey, jobID, opts, timings)
+	if err != nil {
+		fail(jobID, "\nError", err)
+	}
+
+	// Save to history as soon as the video is here, so a failed check or
+	// post-processing step below doesn't lose a job that was paid for
+	entry.OutputFile = output
+	entry.recordResult(st)
+	if err := addToHistory(entry); err != nil {
+		// Non-fatal: just warn
+		infof("Warning: failed to save to history: %v\n", err)
+	}
+
+	// Everything done to the video after the download counts as
+	// post-processing. Verify the result matches what was asked for.
+	stopPost := timings.start("post-processing")
+	if output != "-" && !opts.encrypted() {
+		if problems, err := verifyOutput(output, videoSize, seconds); err != nil {
+			infof("Warning: could not verify output: %v\n", err)
+		} else if len(problems) > 0 {
+			for _, p := range problems {
+				warnf("WARNING: %s\n", p)
+			}
+			if strict {
+				fail(jobID, "Error", fmt.Errorf("%w the request (--strict)", errMismatch))
+			}
+		}
+	}
+	postProcess(ctx, &post, output)
+	opts.saveThumbnail(ctx, client, common.baseURL, apiKey, jobID, output)
+	stopPost()
+
+	reportJob(jobID, output, timings)
+	notifier.completed(output, st)
+	opts.openOutput(output)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// runDelete implements `sora-cli delete <ref>...`: remove videos from the
+// remote account. Local files and history are left alone.
+func runDelete(args []string) {
+	fs := newFlagSet("delete", "<@last|@N|video_id>... | --all-older-than <age> [flags]")
+	var (
+		olderThan string
+		yes       bool
+		dryRun    bool
+		common    commonOptions
+	)
+	fs.StringVar(&olderThan, "all-older-than", "", "Delete every remote video created longer ago than this (e.g. 72h, 30d)")
+	fs.BoolVarP(&yes, "yes", "y", false, "Don't ask for confirmation")
+	fs.BoolVar(&dryRun, "dry-run", false, "Only show what would be deleted")
+	addCommonFlags(fs, &common)
+	fs.Parse(args)
+
+	if (fs.NArg() == 0) == (olderThan == "") {
+		fmt.Fprintln(os.Stderr, "Give either video references or --all-older-than, not both")
+		fs.Usage()
+		os.Exit(2)
+	}
+	var age time.Duration
+	if olderThan != "" {
+		var err error
+		if age, err = parseAge(olderThan); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	if !dryRun {
+		common.requireWritable("delete videos")
+	}
+
+	var ids []string
+	for _, ref := range fs.Args() {
+		id, err := resolveRemoteRef(ref)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to resolve video reference %s: %v\n", ref, err)
+			os.Exit(1)
+		}
+		ids = append(ids, id)
+	}
+
+	apiKey := common.mustAPIKey()
+	ctx, cancel := commandContext()
+	defer cancel()
+	client := mustHTTPClient(common.net)
+
+	if olderThan != "" {
+		remote, err := listVideos(ctx, client, common.baseURL, apiKey)
+		if err != nil {
+			fail("", "failed to list remote videos", err)
+		}
+		cutoff := time.Now().Add(-age)
+		sort.Slice(remote, func(i, j int) bool { return remote[i].CreatedAt < remote[j].CreatedAt })
+		for _, v := range remote {
+			if v.CreatedAt > 0 && time.Unix(v.CreatedAt, 0).Before(cutoff) {
+				ids = append(ids, v.ID)
+				infof("  %s  %s  %s\n", v.ID, time.Unix(v.CreatedAt, 0).Local().Format("2006-01-02 15:04"), truncate(singleLine(v.Prompt), 50))
+			}
+		}
+		if len(ids) == 0 {
+			infof("No remote videos older than %s\n", olderThan)
+			return
+		}
+	}
+
+	if dryRun {
+		infof("Would delete %d video(s) (--dry-run)\n", len(ids))
+		return
+	}
+	if !yes && !confirmDelete(len(ids)) {
+		fmt.Fprintln(os.Stderr, "Aborted")
+		os.Exit(exitCanceled)
+	}
+
+	failed := 0
+	for _, id := range ids {
+		if err := deleteVideo(ctx, client, common.baseURL, apiKey, id); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to delete %s: %v\n", id, err)
+			emitEvent(jsonEvent{Event: "error", ID: id, Error: newJSONError(err)})
+			failed++
+			continue
+		}
+		infof("Deleted %s\n", id)
+		emitEvent(jsonEvent{Event: "deleted", ID: id})
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// confirmDelete asks before deleting; without a terminal it refuses so a
+// script can't delete by accident without --yes
+func confirmDelete(n int) bool {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Fprintln(os.Stderr, "Refusing to delete without confirmation; pass --yes")
+		os.Exit(2)
+	}
+	answer, err := newLineEditor(nil).readLine(fmt.Sprintf("Permanently delete %d remote video(s)? [y/N]: ", n))
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// parseAge parses a Go duration, also accepting whole days such as "30d"
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q (use e.g. 72h or 30d)", s)
+	}
+	return d, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// windowsToastScript shows a toast from PowerShell, which is registered as
+// a notification source on every Windows install. The text comes in through
+// the environment so it never has to be quoted into the script.
+const windowsToastScript = `
+[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$t = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$x = $t.GetElementsByTagName('text')
+$x.Item(0).AppendChild($t.CreateTextNode($env:SORA_NOTIFY_TITLE)) > $null
+$x.Item(1).AppendChild($t.CreateTextNode($env:SORA_NOTIFY_BODY)) > $null
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\WindowsPowerShell\v1.0\powershell.exe').Show([Windows.UI.Notifications.ToastNotification]::new($t))
+`
+
+// desktopNotifier returns the command that shows a desktop notification on
+// this platform
+func desktopNotifier(title, body string) (*exec.Cmd, error) {
+	switch runtime.GOOS {
+	case "darwin":
+		// Passing the text as arguments avoids AppleScript string escaping
+		return exec.Command("osascript",
+			"-e", "on run argv",
+			"-e", "display notification (item 2 of argv) with title (item 1 of argv)",
+			"-e", "end run",
+			title, body), nil
+	case "windows":
+		cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", windowsToastScript)
+		cmd.Env = append(os.Environ(), "SORA_NOTIFY_TITLE="+title, "SORA_NOTIFY_BODY="+body)
+		return cmd, nil
+	case "linux", "freebsd", "openbsd", "netbsd":
+		return exec.Command("notify-send", "--app-name=sora-cli", "--", title, body), nil
+	}
+	return nil, fmt.Errorf("desktop notifications aren't supported on %s", runtime.GOOS)
+}
+
+// checkDesktopNotifier reports why --notify can't work here, before a job
+// is submitted rather than after it finishes
+func checkDesktopNotifier() error {
+	cmd, err := desktopNotifier("", "")
+	if err != nil {
+		return err
+	}
+	if _, err := exec.LookPath(cmd.Args[0]); err != nil {
+		if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+			return fmt.Errorf("--notify needs %s, which was not found in PATH", cmd.Args[0])
+		}
+		return errors.New("--notify needs notify-send (usually in the libnotify-bin or libnotify package)")
+	}
+	return nil
+}
+
+// showDesktopNotification shows title and body, warning if it can't
+func showDesktopNotification(title, body string) {
+	cmd, err := desktopNotifier(title, body)
+	if err == nil {
+		err = cmd.Run()
+	}
+	if err != nil {
+		infof("Warning: desktop notification failed: %v\n", err)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// runDownload implements `sora-cli download <ref>`: fetch a finished video's
+// content without creating a job
+func runDownload(args []string) {
+	fs := newFlagSet("download", "<@last|@N|video_id> [flags]")
+	var (
+		opts   jobOptions
+		common commonOptions
+	)
+	addOutputFlags(fs, &opts)
+	addCommonFlags(fs, &common)
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	id, err := resolveRemoteRef(fs.Arg(0))
+	if err != nil {
+		fail("", "failed to resolve video reference", err)
+	}
+
+	opts.prepareOutput()
+
+	apiKey := common.mustAPIKey()
+	ctx, cancel := commandContext()
+	defer cancel()
+	client := mustHTTPClient(common.net)
+
+	// Check first so a missing or unfinished video gets a clear explanation
+	// instead of a failed download
+	if err := checkDownloadable(ctx, client, common.baseURL, apiKey, id); err != nil {
+		fail(id, "Error", err)
+	}
+
+	timings := newPhaseTimings()
+	output, err := saveJobOutput(ctx, client, common.baseURL, apiKey, id, opts, timings)
+	if err != nil {
+		fail(id, "Error", err)
+	}
+	stop := timings.start("post-processing")
+	opts.saveThumbnail(ctx, client, common.baseURL, apiKey, id, output)
+	stop()
+	emitEvent(jsonEvent{Event: "done", ID: id, Output: output, Seconds: timings.total().Seconds(), Timings: timings.seconds()})
+	if output != "-" {
+		infof("Video saved to: %s\n", output)
+
+		// Point the history entry (if any) at the new copy
+		if _, err := updateHistoryEntry(id, func(e *videoHistoryEntry) { e.OutputFile = output }); err != nil {
+			infof("Warning: failed to update history: %v\n", err)
+		}
+		opts.openOutput(output)
+	}
+}
+
+// checkDownloadable confirms that id still exists remotely, has finished,
+// and that its content hasn't expired
+func checkDownloadable(ctx context.Context, c *http.Client, baseURL, apiKey, id string) error {
+	st, err := fetchVideoStatus(ctx, c, baseURL, apiKey, id)
+	var se *statusError
+	if errors.As(err, &se) && se.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%s no longer exists on the API account (it was deleted, or belongs to another account)", id)
+	} else if err != nil {
+		return fmt.Errorf("checking %s: %w", id, err)
+	}
+
+	switch strings.ToLower(st.Status) {
+	case "completed", "succeeded":
+	default:
+		if err := endedJobError(st); err != nil {
+			return fmt.Errorf("%s has no video: %w", id, err)
+		}
+		return fmt.Errorf("%s is not finished yet (%s); use 'sora-cli attach %s' to wait for it", id, st.describe(), id)
+	}
+	if st.ExpiresAt > 0 && time.Now().Unix() >= st.ExpiresAt {
+		return fmt.Errorf("the content of %s expired at %s and can no longer be downloaded", id, time.Unix(st.ExpiresAt, 0).Local().Format("2006-01-02 15:04"))
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+	"golang.org/x/term"
+)
+
+// editorHelp is appended to the file the prompt is composed in; lines
+// starting with # are dropped when it is read back
+const editorHelp = `
+# Write the video prompt above. Lines starting with # are ignored, and
+# line breaks are kept. Save an empty prompt to cancel.
+`
+
+// editOptions configure composing the prompt in a text editor (--edit)
+type editOptions struct {
+	enabled  bool
+	template string // file the prompt starts from
+}
+
+// addEditFlags registers --edit and --template
+func addEditFlags(fs *flag.FlagSet, e *editOptions) {
+	fs.BoolVar(&e.enabled, "edit", false, "Write the prompt in $VISUAL or $EDITOR instead of on one line")
+	fs.StringVar(&e.template, "template", "", "Start the --edit prompt from this file (implies --edit)")
+}
+
+// exitIfInvalid checks the edit flags against the other ways of giving a
+// prompt, exiting on a conflict
+func (e *editOptions) exitIfInvalid(prompt, promptFile string) {
+	if e.template != "" {
+		e.enabled = true
+	}
+	if !e.enabled {
+		return
+	}
+	if prompt != "" || promptFile != "" {
+		fmt.Fprintln(os.Stderr, "Cannot use --edit with -p or --prompt-file")
+		os.Exit(2)
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Fprintln(os.Stderr, "--edit needs a terminal to run the editor in")
+		os.Exit(2)
+	}
+}
+
+// mustCompose opens the editor on the template, or else on prefill (such
+// as the prompt of the video being remixed), and returns what was saved.
+// It exits if the editor fails or the prompt is left empty.
+func (e *editOptions) mustCompose(prefill string) string {
+	if e.template != "" {
+		data, err := os.ReadFile(e.template)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --template: %v\n", err)
+			os.Exit(2)
+		}
+		prefill = string(data)
+	}
+	prompt, err := editText(strings.TrimRight(prefill, "\n") + "\n" + editorHelp)
+	if err != nil {
+		fail("", "failed to edit prompt", err)
+	}
+	if prompt == "" {
+		fmt.Fprintln(os.Stderr, "Aborted: the prompt is empty")
+		os.Exit(exitCanceled)
+	}
+	return prompt
+}
+
+// editText runs the editor on a temporary file holding text and returns
+// the saved contents, without # comment lines and surrounding whitespace
+func editText(text string) (string, error) {
+	f, err := os.CreateTemp("", "sora-prompt-*.txt")
+	if err != nil {
+		return "", fmt.Errorf("creating temp file: %w", err)
+	}
+	path := f.Name()
+	defer os.Remove(path)
+	_, err = f.WriteString(text)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", fmt.Errorf("writing temp file: %w", err)
+	}
+
+	cmd := editorCommand(path)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		var ee *exec.ExitError
+		if errors.As(err, &ee) {
+			return "", fmt.Errorf("%s exited with status %d", cmd.Args[0], ee.ExitCode())
+		}
+		return "", fmt.Errorf("running %s: %w (set VISUAL or EDITOR)", cmd.Args[0], err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	var lines []string
+	for _, line := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n")), nil
+}
+
+// editorCommand returns the command that edits path: $VISUAL, $EDITOR, or
+// the platform's basic editor
+func editorCommand(path string) *exec.Cmd {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if args := strings.Fields(os.Getenv(env)); len(args) > 0 {
+			return exec.Command(args[0], append(args[1:], path)...)
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return exec.Command("notepad", path)
+	}
+	return exec.Command("vi", path)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// encodeOptions control the final H.264 encode of post-processed output.
+// Empty fields use the defaults of the chosen --delivery preset, if any.
+type encodeOptions struct {
+	delivery     string
+	bitrate      string // target video bitrate; enables a two-pass encode
+	profile      string
+	level        string
+	audioBitrate string
+}
+
+// deliveryPresets are encode settings that meet common platform specs
+var deliveryPresets = map[string]encodeOptions{
+	// Instagram Reels/feed: H.264 High 4.1, modest bitrate, 128k AAC
+	"instagram": {bitrate: "5M", profile: "high", level: "4.1", audioBitrate: "128k"},
+	// Broadcast/agency masters: high bitrate, 320k AAC
+	"broadcast": {bitrate: "20M", profile: "high", level: "4.2", audioBitrate: "320k"},
+}
+
+var (
+	bitrateRe = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?[kKmM]?$`)
+
+	h264Profiles = []string{"baseline", "main", "high"}
+	h264Levels   = []string{"3.0", "3.1", "3.2", "4.0", "4.1", "4.2", "5.0", "5.1", "5.2"}
+)
+
+// addEncodeFlags registers the delivery encode flags. The H.264 profile flag
+// is --h264-profile because --profile selects a config profile.
+func addEncodeFlags(fs *flag.FlagSet, e *encodeOptions) {
+	fs.StringVar(&e.delivery, "delivery", "", "Encode for a platform spec: "+strings.Join(deliveryNames(), ", "))
+	fs.StringVar(&e.bitrate, "target-bitrate", "", "Re-encode at this video bitrate with a two-pass encode, e.g. 8M")
+	fs.StringVar(&e.profile, "h264-profile", "", "H.264 profile: "+strings.Join(h264Profiles, ", "))
+	fs.StringVar(&e.level, "level", "", "H.264 level, e.g. 4.1")
+}
+
+func deliveryNames() []string {
+	names := make([]string, 0, len(deliveryPresets))
+	for name := range deliveryPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// enabled reports whether a specific encode was requested
+func (e *encodeOptions) enabled() bool {
+	return e.delivery != "" || e.bitrate != "" || e.profile != "" || e.level != ""
+}
+
+// resolve fills unset fields from the --delivery preset and checks the values
+func (e *encodeOptions) resolve() error {
+	if e.delivery != "" {
+		preset, ok := deliveryPresets[strings.ToLower(e.delivery)]
+		if !ok {
+			return fmt.Errorf("unknown --delivery %q (available: %s)", e.delivery, strings.Join(deliveryNames(), ", "))
+		}
+		if e.bitrate == "" {
+			e.bitrate = preset.bitrate
+		}
+		if e.profile == "" {
+			e.profile = preset.profile
+		}
+		if e.level == "" {
+			e.level = preset.level
+		}
+		e.audioBitrate = preset.audioBitrate
+	}
+	if e.bitrate != "" && !bitrateRe.MatchString(e.bitrate) {
+		return fmt.Errorf("invalid --target-bitrate %q (use e.g. 8M or 5000k)", e.bitrate)
+	}
+	if e.profile != "" {
+		e.profile = strings.ToLower(e.profile)
+		if !slices.Contains(h264Profiles, e.profile) {
+			return fmt.Errorf("invalid --h264-profile %q (use %s)", e.profile, strings.Join(h264Profiles, ", "))
+		}
+	}
+	if e.level != "" {
+		if !strings.Contains(e.level, ".") {
+			e.level += ".0"
+		}
+		if !slices.Contains(h264Levels, e.level) {
+			return fmt.Errorf("invalid --level %q (use one of %s)", e.level, strings.Join(h264Levels, ", "))
+		}
+	}
+	return nil
+}
+
+// addVideoCodec adds the H.264 encoder options: constant quality by
+// default, or the target bitrate for the given pass of a two-pass encode
+func (e *encodeOptions) addVideoCodec(b *ffmpegBuilder, pass int, passLog string) {
+	b.Option("-c:v", "libx264").
+		Option("-preset", "fast").
+		Option("-pix_fmt", "yuv420p")
+	if e.bitrate != "" {
+		b.Option("-b:v", e.bitrate).
+			Option("-pass", fmt.Sprint(pass)).
+			Option("-passlogfile", passLog)
+	} else {
+		b.Option("-crf", "18")
+	}
+	if e.profile != "" {
+		b.Option("-profile:v", e.profile)
+	}
+	if e.level != "" {
+		b.Option("-level:v", e.level)
+	}
+	addColorTags(b)
+}
+
+// addAudioCodec adds the audio encoder options, or drops audio
+func (e *encodeOptions) addAudioCodec(b *ffmpegBuilder, audio bool) {
+	if !audio {
+		b.Option("-an")
+		return
+	}
+	b.Option("-c:a", "aac")
+	if e.audioBitrate != "" {
+		b.Option("-b:a", e.audioBitrate)
+	}
+}
+
+// firstPass runs the analysis pass of a two-pass encode, returning the
+// directory holding the pass log; the caller removes it
+func (e *encodeOptions) firstPass(ctx context.Context, b *ffmpegBuilder) (string, error) {
+	dir, err := os.MkdirTemp("", "sora-2pass-*")
+	if err != nil {
+		return "", fmt.Errorf("creating temp dir: %w", err)
+	}
+	passLog := filepath.Join(dir, "pass")
+	e.addVideoCodec(b, 1, passLog)
+	err = b.Option("-an").
+		Option("-f", "null").
+		Output(os.DevNull).
+		Run(ctx)
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("first encoding pass: %w", err)
+	}
+	return passLog, nil
+}
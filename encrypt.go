@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// encryptor is an external tool that encrypts a stream to recipients
+type encryptor struct {
+	tool string // "age" or "gpg"
+	ext  string // added to the output file name
+}
+
+var (
+	ageEncryptor = encryptor{tool: "age", ext: ".age"}
+	gpgEncryptor = encryptor{tool: "gpg", ext: ".gpg"}
+)
+
+// isAgeRecipient reports whether r is an age or SSH public key rather than
+// a GPG key ID, fingerprint, or email address
+func isAgeRecipient(r string) bool {
+	return strings.HasPrefix(r, "age1") || strings.HasPrefix(r, "ssh-")
+}
+
+// chooseEncryptor picks age or gpg from the recipients, which must all be
+// for the same tool, and checks that the tool is installed
+func chooseEncryptor(recipients []string) (encryptor, error) {
+	age := 0
+	for _, r := range recipients {
+		if isAgeRecipient(r) {
+			age++
+		}
+	}
+	var e encryptor
+	switch age {
+	case len(recipients):
+		e = ageEncryptor
+	case 0:
+		e = gpgEncryptor
+	default:
+		return encryptor{}, errors.New("--encrypt-to recipients mix age and GPG keys; use one kind")
+	}
+	if _, err := exec.LookPath(e.tool); err != nil {
+		return encryptor{}, fmt.Errorf("--encrypt-to needs %s, which was not found in PATH", e.tool)
+	}
+	return e, nil
+}
+
+// command returns the command that encrypts stdin to recipients and
+// writes the result to out
+func (e encryptor) command(ctx context.Context, recipients []string, out string) *exec.Cmd {
+	args := []string{"--encrypt", "--output", out}
+	if e.tool == "gpg" {
+		args = append([]string{"--batch", "--yes"}, args...)
+	}
+	for _, r := range recipients {
+		args = append(args, "--recipient", r)
+	}
+	return exec.CommandContext(ctx, e.tool, args...)
+}
+
+// downloadEncrypted streams a video download through the encryptor into
+// outPath, so the plaintext never touches disk
+func downloadEncrypted(ctx context.Context, c *http.Client, apiKey, downloadURL, outPath string, e encryptor, recipients []string, quiet bool) (err error) {
+	resp, err := openDownload(ctx, c, apiKey, downloadURL)
+	if err != nil {
+		return err
+	}
+	defer closeBody(resp)
+	if manifestKind(resp) != "" {
+		return fmt.Errorf("%w: the output is segmented, and assembling it would write the unencrypted segments to disk; download it without --encrypt-to", errDownload)
+	}
+
+	if dir := filepath.Dir(outPath); dir != "." && dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	tmp := outPath + ".part"
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmp)
+		}
+	}()
+
+	cmd := e.command(ctx, recipients, tmp)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("starting %s: %w", e.tool, err)
+	}
+
+	var written int64
+	pr := &progressWriter{total: resp.ContentLength, written: &written, quiet: quiet}
+	copyErr := resumeCopy(ctx, c, resp, io.MultiWriter(stdin, pr), func(offset int64) (*http.Response, error) {
+		return openDownloadAt(ctx, c, apiKey, downloadURL, offset)
+	})
+	stdin.Close()
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("%s: %w: %s", e.tool, err, strings.TrimSpace(stderr.String()))
+	}
+	if copyErr != nil {
+		return copyErr
+	}
+	pr.done()
+	return os.Rename(tmp, outPath)
+}
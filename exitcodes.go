@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Exit codes, so scripts can branch on the kind of failure. They are part
+// of the CLI's interface: don't renumber them.
+const (
+	exitOK        = 0
+	exitError     = 1 // anything not covered below
+	exitUsage     = 2 // invalid flags or arguments
+	exitNoAPIKey  = 3
+	exitAuth      = 4 // the API rejected the key
+	exitPolicy    = 5 // the prompt or reference was rejected by moderation or the blocklist
+	exitJobFailed = 6 // the job was accepted but failed to render
+	exitDownload  = 7
+	exitTimeout   = 8
+	exitReadOnly  = 9   // refused in read-only mode
+	exitMismatch  = 10  // --strict: the video doesn't match what was asked for
+	exitCanceled  = 130 // Ctrl-C or declining a confirmation, as shells report SIGINT
+)
+
+// Sentinel errors for the failure classes above. Their text matches the
+// message prefixes they replace, so wrapping them doesn't change any output.
+var (
+	errTimedOut = errors.New("timed out")
+	errCanceled = errors.New("canceled")
+	errDownload = errors.New("download error")
+	errMismatch = errors.New("output does not match")
+)
+
+// jobError is a job that the API accepted but reported as failed, or that
+// ended in another state without a video (status)
+type jobError struct {
+	detail apiError
+	status string
+}
+
+func (e *jobError) Error() string {
+	var msg string
+	switch e.status {
+	case "", "failed", "error":
+		if e.detail.Message == "" {
+			return "job failed"
+		}
+		return "job error: " + e.detail.Message
+	case "cancelled", "canceled":
+		msg = "job was cancelled"
+	case "expired":
+		msg = "job expired before it finished"
+	case "rejected":
+		msg = "job was rejected"
+	default:
+		msg = fmt.Sprintf("job ended with status %q", e.status)
+	}
+	if e.detail.Message != "" {
+		msg += ": " + e.detail.Message
+	}
+	return msg
+}
+
+// isPolicyRejection reports whether an API error object is a moderation or
+// content policy refusal
+func isPolicyRejection(e apiError) bool {
+	for _, s := range []string{e.Code, e.Type} {
+		s = strings.ToLower(s)
+		if strings.Contains(s, "moderation") || strings.Contains(s, "content_policy") || strings.Contains(s, "safety") {
+			return true
+		}
+	}
+	return false
+}
+
+// exitCode maps an error to the exit code for its failure class
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	if errors.Is(err, errCanceled) || errors.Is(err, errInterrupted) || errors.Is(err, context.Canceled) {
+		return exitCanceled
+	}
+	if errors.Is(err, errTimedOut) || errors.Is(err, context.DeadlineExceeded) {
+		return exitTimeout
+	}
+	var be *blockedError
+	if errors.As(err, &be) {
+		return exitPolicy
+	}
+	var je *jobError
+	if errors.As(err, &je) {
+		if je.status == "rejected" || isPolicyRejection(je.detail) {
+			return exitPolicy
+		}
+		return exitJobFailed
+	}
+	var se *statusError
+	if errors.As(err, &se) {
+		if isPolicyRejection(se.detail) {
+			return exitPolicy
+		}
+		if se.StatusCode == http.StatusUnauthorized || se.StatusCode == http.StatusForbidden {
+			return exitAuth
+		}
+	}
+	if errors.Is(err, errDownload) {
+		return exitDownload
+	}
+	if errors.Is(err, errMismatch) {
+		return exitMismatch
+	}
+	return exitError
+}
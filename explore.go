@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxExplore caps --explore so a typo can't submit hundreds of jobs
+const maxExplore = 20
+
+// defaultJitterModel is the chat model that writes --explore variations
+const defaultJitterModel = "gpt-4o-mini"
+
+// exploreInstructions is the system prompt for generating variations
+const exploreInstructions = `You write variations of a prompt for a text-to-video model.
+Keep the subject, style, and intent of the original prompt. Change only what the
+user's variation instructions ask for, and make each variation clearly different
+from the others. Respond with a JSON object of the form
+{"variations": [{"variation": "<a few words naming what changed>", "prompt": "<the full rewritten prompt>"}]}`
+
+// promptVariation is one rewrite of the base prompt produced for --explore
+type promptVariation struct {
+	Label  string `json:"variation"`
+	Prompt string `json:"prompt"`
+}
+
+// generateVariations asks a chat model for n controlled variations of prompt
+func generateVariations(ctx context.Context, c *http.Client, baseURL, apiKey, model, prompt, jitter string, n int) ([]promptVariation, error) {
+	body := chatRequest{
+		Model: model,
+		Messages: []chatMessage{
+			{Role: "system", Content: exploreInstructions},
+			{Role: "user", Content: fmt.Sprintf("Original prompt:\n%s\n\nVariation instructions: %s\n\nWrite exactly %d variations.", prompt, jitter, n)},
+		},
+		ResponseFormat: map[string]string{"type": "json_object"},
+	}
+	content, err := chatCompletion(ctx, c, baseURL, apiKey, body)
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed struct {
+		Variations []promptVariation `json:"variations"`
+	}
+	if err := json.Unmarshal([]byte(content), &parsed); err != nil {
+		return nil, fmt.Errorf("parsing variations: %w", err)
+	}
+	var vars []promptVariation
+	for _, v := range parsed.Variations {
+		if strings.TrimSpace(v.Prompt) != "" {
+			vars = append(vars, v)
+		}
+	}
+	if len(vars) == 0 {
+		return nil, errors.New("chat model returned no variations")
+	}
+	if len(vars) > n {
+		vars = vars[:n]
+	}
+	return vars, nil
+}
+
+// variantPath returns the output path for the i-th variation, e.g.
+// clip.mp4 -> clip-v2.mp4
+func variantPath(path string, i int) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s-v%d%s", strings.TrimSuffix(path, ext), i, ext)
+}
+
+// exploreOptions configure a --explore run
+type exploreOptions struct {
+	runs   int
+	jitter string
+	model  string // chat model that writes the variations
+	seed   *int64 // shared by every variation, so only the prompt differs
+}
+
+// runExplore generates variations of base.Prompt and renders one video per
+// variation concurrently, each tagged with its variation text. It returns
+// false if any run failed.
+func runExplore(ctx context.Context, c *http.Client, baseURL, apiKey string, base batchRow, eo exploreOptions, tonemap, pad bool, post *postOptions, opts jobOptions) bool {
+	policy, err := opts.existingPolicy()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	infof("Writing %d prompt variations with %s...\n", eo.runs, eo.model)
+	vars, err := generateVariations(ctx, c, baseURL, apiKey, eo.model, base.Prompt, eo.jitter, eo.runs)
+	if err != nil {
+		fail("", "variation error", err)
+	}
+	if len(vars) < eo.runs {
+		infof("Warning: only %d variation(s) were returned\n", len(vars))
+	}
+
+	rows := make([]numberedRow, len(vars))
+	for i, v := range vars {
+		row := base
+		row.Prompt, row.Variation = v.Prompt, v.Label
+		if base.Output != "" {
+			row.Output = variantPath(base.Output, i+1)
+		}
+		rows[i] = numberedRow{i + 1, row}
+		infof("  v%d: %s\n", i+1, v.Label)
+	}
+	jobs, err := prepareBatchJobs(rows, policy, tonemap, pad)
+	if err != nil {
+		fail("", "Error", err)
+	}
+	for i, j := range jobs {
+		j.label = fmt.Sprintf("v%d", i+1)
+		j.seed = eo.seed
+	}
+
+	runJobPool(ctx, c, baseURL, apiKey, jobs, opts, len(jobs))
+	return finishVariants(ctx, jobs, post)
+}
+
+// finishVariants post-processes the videos of an --explore or --count run
+// and lists them side by side. It returns false if any of them failed.
+func finishVariants(ctx context.Context, jobs []*batchJob, post *postOptions) bool {
+	// Post-process sequentially; ffmpeg already uses every core
+	if post.enabled() {
+		for _, j := range jobs {
+			if j.result != "succeeded" {
+				continue
+			}
+			infof("Post-processing %s...\n", j.output)
+			if err := post.apply(ctx, j.output); err != nil {
+				infof("%s: post-processing error: %v\n", j.label, err)
+				j.result = "post-processing failed"
+				emitEvent(jsonEvent{Event: "error", Label: j.label, ID: j.id, Output: j.output, Error: newJSONError(err)})
+			}
+		}
+	}
+
+	// Summarize on stdout so the variations can be compared side by side;
+	// with --json each job's done or error event already says the same
+	ok := true
+	for _, j := range jobs {
+		result := j.output
+		if j.result != "succeeded" {
+			result = j.result
+			ok = false
+		}
+		if !jsonOutput {
+			fmt.Printf("%s\t%s\t%s\t%s\n", j.label, j.id, result, j.row.Variation)
+		}
+	}
+	return ok
+}
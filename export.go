@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// exportColumns are the CSV header, one column per history field
+var exportColumns = []string{
+	"index", "id", "created_at", "model", "seconds", "cost_usd", "status",
+	"state", "favorite", "tags", "session", "prompt", "original_prompt",
+	"note", "variation", "output_file", "remixed_from", "image_input", "source",
+}
+
+// runExport implements `sora-cli export`: write history as CSV or JSON for
+// spreadsheets and scripts, or as an HTML page for browsing
+func runExport(args []string) {
+	fs := newFlagSet("export", "[flags]")
+	var (
+		format string
+		out    string
+		title  string
+		filter historyFilter
+	)
+	fs.StringVar(&format, "format", "csv", "Export format: csv, json, or html")
+	fs.StringVarP(&out, "output", "o", "", "File to write (default stdout), or the directory for html (default export)")
+	fs.StringVar(&title, "title", "Sora videos", "Page title, for html")
+	addFilterFlags(fs, &filter)
+	fs.Parse(args)
+
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	format = strings.ToLower(format)
+	switch format {
+	case "csv", "json":
+	case "html":
+		if out == "-" {
+			fmt.Fprintln(os.Stderr, "Error: html export writes a directory; give -o a directory name")
+			os.Exit(2)
+		}
+		if out == "" {
+			out = "export"
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Error: invalid --format %q (use csv, json, or html)\n", format)
+		os.Exit(2)
+	}
+	if err := filter.resolve(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	h, err := loadHistory()
+	if err != nil {
+		fail("", "failed to load history", err)
+	}
+	var rows []int
+	for i, v := range h.Videos {
+		if filter.match(v) {
+			rows = append(rows, i)
+		}
+	}
+
+	if format == "html" {
+		exportHTML(out, title, h.Videos, rows)
+		return
+	}
+
+	write := writeHistoryCSV
+	if format == "json" {
+		write = writeHistoryJSON
+	}
+	if out == "" || out == "-" {
+		if err := write(os.Stdout, h.Videos, rows); err != nil {
+			fail("", "export error", err)
+		}
+		return
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		fail("", "export error", err)
+	}
+	err = write(f, h.Videos, rows)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fail("", "export error", err)
+	}
+	infof("Exported %d entries to %s\n", len(rows), out)
+}
+
+// writeHistoryCSV writes the entries at the given indices as CSV with a
+// header row
+func writeHistoryCSV(w io.Writer, videos []videoHistoryEntry, rows []int) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(exportColumns); err != nil {
+		return err
+	}
+	deref := func(p *string) string {
+		if p == nil {
+			return ""
+		}
+		return *p
+	}
+	for _, i := range rows {
+		v := videos[i]
+		status, _ := entryStatus(v)
+		cost := ""
+		if v.Cost > 0 {
+			cost = strconv.FormatFloat(v.Cost, 'f', 2, 64)
+		}
+		record := []string{
+			strconv.Itoa(i), v.ID, v.CreatedAt, v.Model, v.Seconds, cost, status,
+			entryState(v), strconv.FormatBool(v.Favorite), strings.Join(v.Tags, " "), v.Session, v.Prompt, v.OriginalPrompt,
+			v.Note, v.Variation, v.OutputFile, deref(v.RemixedFrom), deref(v.ImageInput), v.Source,
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeHistoryJSON writes the entries at the given indices as a JSON array,
+// each with its @N index, as list --json prints them
+func writeHistoryJSON(w io.Writer, videos []videoHistoryEntry, rows []int) error {
+	data, err := json.MarshalIndent(indexedEntries(videos, rows), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// exportHTML writes a gallery page into dir that links to the saved videos
+// where they are, like `gallery --link`
+func exportHTML(dir, title string, videos []videoHistoryEntry, rows []int) {
+	var entries []videoHistoryEntry
+	skipped := 0
+	for _, i := range rows {
+		if status, _ := entryStatus(videos[i]); status != "saved" {
+			skipped++
+			continue
+		}
+		entries = append(entries, videos[i])
+	}
+	if len(entries) == 0 {
+		fmt.Fprintln(os.Stderr, "No saved videos to export")
+		os.Exit(1)
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+	index, err := writeGallery(ctx, dir, title, "", entries, false)
+	if err != nil {
+		fail("", "export error", err)
+	}
+	if skipped > 0 {
+		infof("Skipped %d history entries without a local file\n", skipped)
+	}
+	if jsonOutput {
+		printJSON(map[string]any{"index": index, "videos": len(entries)})
+		return
+	}
+	infof("Exported %d video(s) to %s\n", len(entries), index)
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// runExtend implements `sora-cli extend <ref> [prompt]`: continue a saved
+// video by generating a new one that starts from its last frame, and
+// optionally join the whole chain into one file
+func runExtend(args []string) {
+	fs := newFlagSet("extend", "<@last|@N|video_id> [prompt] [flags]")
+	var (
+		promptFile string
+		edit       editOptions
+		prompt     string
+		model      string
+		usePro     bool
+		seconds    string
+		join       bool
+		noWait     bool
+		yes        bool
+		opts       jobOptions
+		common     commonOptions
+		joinPath   string
+		trans      string
+		transLen   time.Duration
+	)
+	fs.StringVarP(&prompt, "prompt", "p", "", "What happens next (- reads it from stdin). May also be given after the reference; if empty, reads interactively.")
+	addPromptFileFlag(fs, &promptFile)
+	addEditFlags(fs, &edit)
+	fs.StringVar(&model, "model", "", "Model ID or alias (default: the source video's)")
+	fs.BoolVar(&usePro, "pro", false, "Use sora-2-pro; same as --model pro")
+	fs.StringVar(&seconds, "seconds", "", "Duration of the new segment: 4, 8, or 12 (default: the source video's)")
+	fs.BoolVar(&join, "join", false, "Also join the source chain and the new segment into one video (name.joined.mp4)")
+	addTransitionFlags(fs, &trans, &transLen)
+	fs.BoolVar(&noWait, "no-wait", false, "Print the job ID and exit without waiting; resume later with 'sora-cli attach'")
+	addJobFlags(fs, &opts)
+	addSessionFlag(fs, &opts.session)
+	addYesFlag(fs, &yes)
+	addCommonFlags(fs, &common)
+	fs.Parse(args)
+	common.requireWritable("extend videos")
+
+	switch {
+	case fs.NArg() == 2 && prompt == "" && promptFile == "":
+		prompt = fs.Arg(1)
+	case fs.NArg() != 1:
+		fs.Usage()
+		os.Exit(2)
+	}
+	prompt = mustReadPrompt(prompt, promptFile)
+	edit.exitIfInvalid(prompt, promptFile)
+	if usePro && model != "" {
+		fmt.Fprintln(os.Stderr, "Cannot use both --pro and --model")
+		os.Exit(2)
+	}
+	if usePro {
+		model = "sora-2-pro"
+	}
+	if seconds != "" && seconds != "4" && seconds != "8" && seconds != "12" {
+		fmt.Fprintf(os.Stderr, "Invalid --seconds value: %s (must be 4, 8, or 12)\n", seconds)
+		os.Exit(2)
+	}
+	switch {
+	case noWait && opts.output == "-":
+		fmt.Fprintln(os.Stderr, "Cannot use --no-wait with -o - (there is nothing to pipe yet)")
+		os.Exit(2)
+	case join && (noWait || opts.output == "-" || opts.encrypted()):
+		fmt.Fprintln(os.Stderr, "Cannot use --join with --no-wait, -o -, or --encrypt-to")
+		os.Exit(2)
+	}
+	if err := validateNotify(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	if noWait && notifier.requested() {
+		fmt.Fprintln(os.Stderr, "Cannot use --notify or --notify-url with --no-wait; pass them to 'sora-cli attach' instead")
+		os.Exit(2)
+	}
+	if noWait && opts.livePreview {
+		fmt.Fprintln(os.Stderr, "Cannot use --live-preview with --no-wait; pass it to 'sora-cli attach' instead")
+		os.Exit(2)
+	}
+	joint, err := newTransition(trans, transLen)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --transition: %v\n", err)
+		os.Exit(2)
+	}
+	if !joint.cut() && !join {
+		fmt.Fprintln(os.Stderr, "Error: --transition only applies with --join")
+		os.Exit(2)
+	}
+	if !isFFmpegAvailable() {
+		fmt.Fprintln(os.Stderr, ffmpegInstallMsg)
+		os.Exit(1)
+	}
+	if err := checkTransitions([]transition{joint}); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	sourceID, err := resolveVideoRef(fs.Arg(0))
+	if err != nil {
+		fail("", "failed to resolve video reference", err)
+	}
+	source := findHistoryEntry(sourceID)
+	if source == nil {
+		fmt.Fprintf(os.Stderr, "%s is not in history; download it first with 'sora-cli download %s'\n", sourceID, sourceID)
+		os.Exit(1)
+	}
+	if status, _ := localStatus(*source); status != "saved" {
+		fmt.Fprintf(os.Stderr, "Error: the video file for %s is %s; extend needs it locally (try 'sora-cli download %s')\n", sourceID, status, sourceID)
+		os.Exit(1)
+	}
+	var chain []string
+	if join {
+		if chain, err = extensionChain(*source); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: can't --join: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// The new segment matches the source unless told otherwise, so the
+	// cut between them is invisible
+	w, h, err := getVideoDimensions(source.OutputFile)
+	if err != nil {
+		fail(sourceID, "failed to read the source video", err)
+	}
+	videoSize := fmt.Sprintf("%dx%d", w, h)
+	model = cfg.resolveModel(cmp.Or(model, source.Model, cfg.model()))
+	if seconds == "" {
+		seconds = cfg.seconds()
+		switch source.Seconds {
+		case "4", "8", "12":
+			seconds = source.Seconds
+		}
+	}
+
+	if err := opts.validateBudgets(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	// An extension stays in its source's session unless moved with --session
+	if opts.session == "" {
+		opts.session = source.Session
+	}
+	opts.prepareOutput()
+
+	apiKey := common.mustAPIKey()
+	if edit.enabled {
+		prompt = edit.mustCompose(source.Prompt)
+	}
+	prompt = mustPrompt(prompt)
+	mustScreen("prompt", prompt)
+	if cost, ok := videoCost(model, seconds); ok && !confirmCost(cost, fmt.Sprintf("%s, %ss", model, seconds), yes) {
+		fmt.Fprintln(os.Stderr, "Aborted")
+		os.Exit(exitCanceled)
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+	client := mustHTTPClient(common.net)
+	timings := newPhaseTimings()
+
+	// The last frame of the source becomes the first frame of the new video
+	stop := timings.start("preprocessing")
+	tmpDir, err := os.MkdirTemp("", "sora-extend-*")
+	if err != nil {
+		fail("", "failed to create temp dir", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	frame := filepath.Join(tmpDir, "last-frame.png")
+	if err := extractLastFrame(ctx, source.OutputFile, frame); err != nil {
+		fail(sourceID, "failed to extract the last frame", err)
+	}
+	ref, err := loadInputReference(frame, videoSize, false, false)
+	stop()
+	if err != nil {
+		fail(sourceID, "input file error", err)
+	}
+
+	infof("Extending video: %s\n", sourceID)
+	notifier.track("", prompt, model)
+	stop = timings.start("upload")
+	jobID, reqID, err := createVideoJob(ctx, client, common.baseURL, apiKey, model, prompt, ref, videoSize, seconds, nil, "")
+	stop()
+	if err != nil {
+		fail("", "create job error", err)
+	}
+	infof("Created job: %s\n", jobID)
+	notifier.track(jobID, prompt, model)
+	emitEvent(jsonEvent{Event: "submitted", ID: jobID, RequestID: reqID})
+
+	entry := videoHistoryEntry{
+		ID:           jobID,
+		Prompt:       prompt,
+		CreatedAt:    time.Now().UTC().Format(time.RFC3339),
+		OutputFile:   opts.output,
+		Model:        model,
+		ExtendedFrom: &sourceID,
+		Session:      opts.session,
+		RequestID:    reqID,
+	}
+	if noWait {
+		detachJob(entry)
+		return
+	}
+
+	st, err := waitForJob(ctx, client, common.baseURL, apiKey, jobID, opts, time.Now(), timings)
+	if err != nil {
+		fail(jobID, "\nError", err)
+	}
+	output, err := saveJobOutput(ctx, client, common.baseURL, apiKey, jobID, opts, timings)
+	if err != nil {
+		fail(jobID, "\nError", err)
+	}
+
+	entry.OutputFile = output
+	entry.recordResult(st)
+	if err := addToHistory(entry); err != nil {
+		infof("Warning: failed to save to history: %v\n", err)
+	}
+
+	if join {
+		joinPath = joinedPath(output)
+		infof("Joining %d segments...\n", len(chain)+1)
+		stop := timings.start("join")
+		err := concatVideos(ctx, append(chain, output), uniformJoints(len(chain)+1, joint), joinPath, &encodeOptions{})
+		stop()
+		if err != nil {
+			fail(jobID, "join error", fmt.Errorf("%w (the new segment is still at %s)", err, output))
+		}
+	}
+
+	stopPost := timings.start("post-processing")
+	opts.saveThumbnail(ctx, client, common.baseURL, apiKey, jobID, output)
+	stopPost()
+
+	reportJob(jobID, output, timings)
+	if joinPath != "" {
+		infof("Joined video saved to: %s\n", joinPath)
+	}
+	notifier.completed(output, st)
+	opts.openOutput(cmp.Or(joinPath, output))
+}
+
+// extensionChain returns the saved files of e and every video it extends,
+// oldest first
+func extensionChain(e videoHistoryEntry) ([]string, error) {
+	var chain []string
+	seen := map[string]bool{}
+	for {
+		if seen[e.ID] {
+			return nil, fmt.Errorf("%s extends itself", e.ID)
+		}
+		seen[e.ID] = true
+		if status, _ := localStatus(e); status != "saved" {
+			return nil, fmt.Errorf("the video file for %s is %s", e.ID, status)
+		}
+		chain = append(chain, e.OutputFile)
+		if e.ExtendedFrom == nil {
+			break
+		}
+		prev := findHistoryEntry(*e.ExtendedFrom)
+		if prev == nil {
+			return nil, fmt.Errorf("%s, which %s extends, is not in history", *e.ExtendedFrom, e.ID)
+		}
+		e = *prev
+	}
+	slices.Reverse(chain)
+	return chain, nil
+}
+
+// joinedPath returns where --join writes the joined chain, e.g.
+// clip.mp4 -> clip.joined.mp4
+func joinedPath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".joined.mp4"
+}
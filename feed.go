@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// feedTitleLength caps item titles; the full prompt is in the description
+const feedTitleLength = 100
+
+// rssFeed is an RSS 2.0 document
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Generator     string    `xml:"generator"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string       `xml:"title"`
+	Link        string       `xml:"link"`
+	Description string       `xml:"description"`
+	GUID        rssGUID      `xml:"guid"`
+	PubDate     string       `xml:"pubDate,omitempty"`
+	Enclosure   rssEnclosure `xml:"enclosure"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// jsonFeed is a JSON Feed 1.1 document (https://jsonfeed.org/version/1.1)
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string               `json:"id"`
+	URL           string               `json:"url"`
+	Title         string               `json:"title"`
+	ContentText   string               `json:"content_text"`
+	Image         string               `json:"image,omitempty"`
+	DatePublished string               `json:"date_published,omitempty"`
+	Attachments   []jsonFeedAttachment `json:"attachments"`
+}
+
+type jsonFeedAttachment struct {
+	URL         string `json:"url"`
+	MimeType    string `json:"mime_type"`
+	SizeInBytes int64  `json:"size_in_bytes,omitempty"`
+}
+
+// writeFeeds writes feed.xml (RSS) and feed.json (JSON Feed) for a gallery
+// page into dir. Feed readers need absolute links, so every link is
+// resolved against siteURL, where dir is served from.
+func writeFeeds(dir, siteURL string, page galleryPage) error {
+	base, err := url.Parse(strings.TrimSuffix(siteURL, "/") + "/")
+	if err != nil {
+		return fmt.Errorf("invalid site URL: %w", err)
+	}
+	abs := func(rel string) string {
+		u := &url.URL{Path: rel}
+		return base.ResolveReference(u).String()
+	}
+	home := abs("index.html")
+
+	rss := rssFeed{Version: "2.0", Channel: rssChannel{
+		Title:         page.Title,
+		Link:          home,
+		Description:   "Videos generated with sora-cli",
+		LastBuildDate: time.Now().Format(time.RFC1123Z),
+		Generator:     "sora-cli " + currentBuild().tag(),
+	}}
+	jf := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       page.Title,
+		HomePageURL: home,
+		FeedURL:     abs("feed.json"),
+		Items:       []jsonFeedItem{},
+	}
+	for _, it := range page.Items {
+		link := home + "#" + url.PathEscape(it.ID)
+		video := abs(it.Video)
+		mimeType := mime.TypeByExtension(path.Ext(it.Video))
+		if mimeType == "" {
+			mimeType = "video/mp4"
+		}
+		title := truncate(strings.Join(strings.Fields(it.Prompt), " "), feedTitleLength)
+		desc := feedDescription(it)
+
+		ri := rssItem{
+			Title:       title,
+			Link:        link,
+			Description: desc,
+			GUID:        rssGUID{Value: it.ID},
+			Enclosure:   rssEnclosure{URL: video, Length: it.bytes, Type: mimeType},
+		}
+		ji := jsonFeedItem{
+			ID:          it.ID,
+			URL:         link,
+			Title:       title,
+			ContentText: desc,
+			Attachments: []jsonFeedAttachment{{URL: video, MimeType: mimeType, SizeInBytes: it.bytes}},
+		}
+		if !it.published.IsZero() {
+			ri.PubDate = it.published.Format(time.RFC1123Z)
+			ji.DatePublished = it.published.Format(time.RFC3339)
+		}
+		if it.Thumbnail != "" {
+			ji.Image = abs(it.Thumbnail)
+		}
+		rss.Channel.Items = append(rss.Channel.Items, ri)
+		jf.Items = append(jf.Items, ji)
+	}
+
+	x, err := xml.MarshalIndent(rss, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "feed.xml"), append([]byte(xml.Header), append(x, '\n')...), 0o644); err != nil {
+		return fmt.Errorf("writing feed.xml: %w", err)
+	}
+	j, err := json.MarshalIndent(jf, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "feed.json"), append(j, '\n'), 0o644); err != nil {
+		return fmt.Errorf("writing feed.json: %w", err)
+	}
+	return nil
+}
+
+// feedDescription is the prompt followed by the video's details
+func feedDescription(it galleryItem) string {
+	details := []string{it.Model}
+	for _, d := range []string{it.Size, it.Duration, it.State} {
+		if d != "" {
+			details = append(details, d)
+		}
+	}
+	desc := it.Prompt + "\n\n" + strings.Join(details, " · ")
+	if it.Note != "" {
+		desc += "\nNote: " + it.Note
+	}
+	return desc
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// All ffmpeg invocations go through ffmpegBuilder so that user-supplied values
+// (paths, filter parameters from flags) are validated and escaped in one place
+// instead of being spliced into argument strings ad hoc.
+
+var (
+	ffmpegNameRe   = regexp.MustCompile(`^[a-z0-9_]+$`)
+	ffmpegOptionRe = regexp.MustCompile(`^-[a-z0-9_:]+$`)
+	ffmpegNumberRe = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?[kKmMgG]?$`)
+	ffmpegStreamRe = regexp.MustCompile(`^[0-9]+:[va]$`) // an input's stream, e.g. 1:v
+)
+
+// ffmpegFilter is a single filter in a filter chain, e.g. scale=w=1280:h=720.
+// Filters with labeled pads ([a]reverse[b]) let a chain branch and rejoin.
+type ffmpegFilter struct {
+	name string
+	opts []string
+	ins  []string
+	outs []string
+	err  error
+}
+
+// newFilter starts a filter with the given name
+func newFilter(name string) *ffmpegFilter {
+	f := &ffmpegFilter{name: name}
+	if !ffmpegNameRe.MatchString(name) {
+		f.err = fmt.Errorf("invalid ffmpeg filter name %q", name)
+	}
+	return f
+}
+
+func (f *ffmpegFilter) set(key, value string) *ffmpegFilter {
+	if f.err == nil && !ffmpegNameRe.MatchString(key) {
+		f.err = fmt.Errorf("invalid option %q for ffmpeg filter %s", key, f.name)
+	}
+	f.opts = append(f.opts, key+"="+value)
+	return f
+}
+
+// Int sets an integer option
+func (f *ffmpegFilter) Int(key string, v int) *ffmpegFilter {
+	return f.set(key, strconv.Itoa(v))
+}
+
+// Float sets a floating point option
+func (f *ffmpegFilter) Float(key string, v float64) *ffmpegFilter {
+	return f.set(key, strconv.FormatFloat(v, 'f', -1, 64))
+}
+
+// From names the filter's input pads, e.g. [a][b]concat. An input file's
+// stream such as "1:v" may be named too.
+func (f *ffmpegFilter) From(labels ...string) *ffmpegFilter {
+	f.ins = append(f.ins, f.labels(labels)...)
+	return f
+}
+
+// To names the filter's output pads, e.g. split[a][b]
+func (f *ffmpegFilter) To(labels ...string) *ffmpegFilter {
+	f.outs = append(f.outs, f.labels(labels)...)
+	return f
+}
+
+func (f *ffmpegFilter) labels(labels []string) []string {
+	out := make([]string, len(labels))
+	for i, l := range labels {
+		if f.err == nil && !ffmpegNameRe.MatchString(l) && !ffmpegStreamRe.MatchString(l) {
+			f.err = fmt.Errorf("invalid pad label %q for ffmpeg filter %s", l, f.name)
+		}
+		out[i] = "[" + l + "]"
+	}
+	return out
+}
+
+// String sets an option to an arbitrary (escaped) string value
+func (f *ffmpegFilter) String(key, v string) *ffmpegFilter {
+	return f.set(key, escapeFilterValue(v))
+}
+
+func (f *ffmpegFilter) render() (string, error) {
+	if f.err != nil {
+		return "", f.err
+	}
+	s := strings.Join(f.ins, "") + f.name
+	if len(f.opts) > 0 {
+		s += "=" + strings.Join(f.opts, ":")
+	}
+	return s + strings.Join(f.outs, ""), nil
+}
+
+// escapeFilterValue escapes v for use as a filter option value inside a
+// filtergraph. ffmpeg applies two levels of unescaping: one for the option
+// value and one for the filtergraph description, so both are applied here.
+func escapeFilterValue(v string) string {
+	v = strings.NewReplacer(`\`, `\\`, `'`, `\'`, `:`, `\:`).Replace(v)
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`, `[`, `\[`, `]`, `\]`, `,`, `\,`, `;`, `\;`).Replace(v)
+}
+
+// ffmpegPath forces a local file path to be read as a file, so paths that
+// start with '-' or look like URLs ("http:", "concat:") can't be reinterpreted
+func ffmpegPath(p string) string {
+	return "file:" + p
+}
+
+// filterChain is a rendered filtergraph built one filter at a time
+type filterChain struct {
+	graph    strings.Builder
+	labeled  bool // the last filter ended in labeled pads
+	nonEmpty bool
+}
+
+// add appends a filter, linking it to the previous one unless that one's
+// outputs were labeled, in which case a new chain starts
+func (c *filterChain) add(f *ffmpegFilter) error {
+	s, err := f.render()
+	if err != nil {
+		return err
+	}
+	if c.nonEmpty {
+		if c.labeled {
+			c.graph.WriteString(";")
+		} else {
+			c.graph.WriteString(",")
+		}
+	}
+	c.graph.WriteString(s)
+	c.labeled = len(f.outs) > 0
+	c.nonEmpty = true
+	return nil
+}
+
+// ffmpegBuilder assembles an ffmpeg command line
+type ffmpegBuilder struct {
+	inputs   []string
+	ninputs  int
+	filters  filterChain
+	afilters filterChain
+	options  []string
+	output   string
+	err      error
+}
+
+// newFFmpeg returns a builder that overwrites its output and only logs errors
+func newFFmpeg() *ffmpegBuilder {
+	return &ffmpegBuilder{}
+}
+
+func (b *ffmpegBuilder) fail(err error) *ffmpegBuilder {
+	if b.err == nil {
+		b.err = err
+	}
+	return b
+}
+
+// Input adds an input file
+func (b *ffmpegBuilder) Input(path string) *ffmpegBuilder {
+	if path == "" {
+		return b.fail(fmt.Errorf("empty ffmpeg input path"))
+	}
+	b.inputs = append(b.inputs, "-i", ffmpegPath(path))
+	b.ninputs++
+	return b
+}
+
+// StillInput adds an image input that repeats for d, e.g. a title card
+func (b *ffmpegBuilder) StillInput(path string, d time.Duration) *ffmpegBuilder {
+	if path == "" {
+		return b.fail(fmt.Errorf("empty ffmpeg input path"))
+	}
+	b.inputs = append(b.inputs, "-loop", "1", "-t", strconv.FormatFloat(d.Seconds(), 'f', -1, 64), "-i", ffmpegPath(path))
+	b.ninputs++
+	return b
+}
+
+// Filter appends a filter to the video filter chain (-vf, or
+// -filter_complex once there are several inputs)
+func (b *ffmpegBuilder) Filter(f *ffmpegFilter) *ffmpegBuilder {
+	if err := b.filters.add(f); err != nil {
+		return b.fail(err)
+	}
+	return b
+}
+
+// AudioFilter appends a filter to the audio filter chain (-af)
+func (b *ffmpegBuilder) AudioFilter(f *ffmpegFilter) *ffmpegBuilder {
+	if err := b.afilters.add(f); err != nil {
+		return b.fail(err)
+	}
+	return b
+}
+
+// Option adds an output option such as -c:v libx264. Values may not look
+// like options themselves, so a flag value can't smuggle in extra arguments.
+func (b *ffmpegBuilder) Option(name string, value ...string) *ffmpegBuilder {
+	if !ffmpegOptionRe.MatchString(name) {
+		return b.fail(fmt.Errorf("invalid ffmpeg option %q", name))
+	}
+	if len(value) > 1 {
+		return b.fail(fmt.Errorf("ffmpeg option %s takes at most one value", name))
+	}
+	b.options = append(b.options, name)
+	if len(value) == 1 {
+		v := value[0]
+		if strings.HasPrefix(v, "-") && !ffmpegNumberRe.MatchString(v) {
+			return b.fail(fmt.Errorf("invalid value %q for ffmpeg option %s", v, name))
+		}
+		b.options = append(b.options, v)
+	}
+	return b
+}
+
+// Output sets the output file
+func (b *ffmpegBuilder) Output(path string) *ffmpegBuilder {
+	if path == "" {
+		return b.fail(fmt.Errorf("empty ffmpeg output path"))
+	}
+	b.output = path
+	return b
+}
+
+// Args returns the validated argument list (without the ffmpeg binary)
+func (b *ffmpegBuilder) Args() ([]string, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if len(b.inputs) == 0 {
+		return nil, fmt.Errorf("ffmpeg command has no inputs")
+	}
+	if b.output == "" {
+		return nil, fmt.Errorf("ffmpeg command has no output")
+	}
+
+	args := []string{"-hide_banner", "-loglevel", "error"}
+	args = append(args, b.inputs...)
+	if b.filters.labeled || b.afilters.labeled {
+		return nil, fmt.Errorf("ffmpeg filter chain ends in labeled pads")
+	}
+	if b.filters.nonEmpty {
+		if b.ninputs > 1 {
+			args = append(args, "-filter_complex", b.filters.graph.String())
+		} else {
+			args = append(args, "-vf", b.filters.graph.String())
+		}
+	}
+	if b.afilters.nonEmpty {
+		args = append(args, "-af", b.afilters.graph.String())
+	}
+	args = append(args, b.options...)
+	args = append(args, "-y", ffmpegPath(b.output))
+	return args, nil
+}
+
+// Run executes ffmpeg, including its stderr in the error on failure
+func (b *ffmpegBuilder) Run(ctx context.Context) error {
+	args, err := b.Args()
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+
+	// Capture output for debugging
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg failed: %w\nOutput: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// RunReplacing runs ffmpeg with a temporary output next to path, then
+// renames it over path, keeping the permissions path had. The original is
+// only replaced once ffmpeg has succeeded, and the rename doesn't cross
+// filesystems.
+func (b *ffmpegBuilder) RunReplacing(ctx context.Context, path string) error {
+	fi, err := os.Stat(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	tmpPath, err := createOutputTemp(filepath.Dir(path))
+	if err != nil {
+		return fmt.Errorf("creating temp file: %w", err)
+	}
+
+	if err := b.Output(tmpPath).Run(ctx); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if fi != nil {
+		if err := os.Chmod(tmpPath, fi.Mode().Perm()); err != nil {
+			os.Remove(tmpPath)
+			return fmt.Errorf("replacing output: %w", err)
+		}
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("replacing output: %w", err)
+	}
+	return nil
+}
+
+// createOutputTemp creates an empty temporary file in dir for RunReplacing.
+// Unlike os.CreateTemp, which makes it private, it gets the permissions of
+// any new file (0666 less the umask).
+func createOutputTemp(dir string) (string, error) {
+	for {
+		path := filepath.Join(dir, fmt.Sprintf(".sora-post-%08x.mp4", rand.Uint32()))
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o666)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		f.Close()
+		return path, nil
+	}
+}
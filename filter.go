@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+// historyFilter selects history entries for list, gallery, and export
+type historyFilter struct {
+	states    []string
+	session   string
+	group     string
+	search    string
+	model     string
+	since     string
+	until     string
+	tags      []string
+	favorites bool
+
+	// Parsed by resolve
+	want     map[string]bool
+	words    []string
+	from, to time.Time
+}
+
+// addFilterFlags registers the history filter flags
+func addFilterFlags(fs *flag.FlagSet, f *historyFilter) {
+	fs.StringSliceVar(&f.states, "state", nil, "Only entries in these review states (draft, review, approved, rejected)")
+	fs.StringVar(&f.session, "session", "", "Only entries in this session")
+	fs.StringVar(&f.group, "group", "", "Only the takes of one create --count run")
+	fs.StringVarP(&f.search, "search", "s", "", "Only entries whose prompt contains all of these words, in any order")
+	fs.StringVar(&f.model, "model", "", "Only entries made with this model ID or alias")
+	fs.StringVar(&f.since, "since", "", "Only entries created on or after this date (2025-10-01) or within this age (7d, 12h)")
+	fs.StringVar(&f.until, "until", "", "Only entries created on or before this date, or longer ago than this age")
+	fs.StringSliceVar(&f.tags, "tag", nil, "Only entries with all of these tags")
+	fs.BoolVar(&f.favorites, "favorites", false, "Only favorites")
+}
+
+// resolve validates and parses the flag values
+func (f *historyFilter) resolve() error {
+	f.want = make(map[string]bool)
+	for _, s := range f.states {
+		st, err := parseReviewState(s)
+		if err != nil {
+			return err
+		}
+		f.want[st] = true
+	}
+	var err error
+	if f.from, err = parseTimeBound(f.since, false); err != nil {
+		return fmt.Errorf("--since: %w", err)
+	}
+	if f.to, err = parseTimeBound(f.until, true); err != nil {
+		return fmt.Errorf("--until: %w", err)
+	}
+	if f.model != "" {
+		f.model = cfg.resolveModel(f.model)
+	}
+	f.words = strings.Fields(strings.ToLower(f.search))
+	for i, t := range f.tags {
+		if f.tags[i], err = parseTag(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// match reports whether v passes every filter
+func (f *historyFilter) match(v videoHistoryEntry) bool {
+	if (len(f.want) > 0 && !f.want[entryState(v)]) ||
+		(f.session != "" && v.Session != f.session) ||
+		(f.group != "" && v.Group != f.group) ||
+		(f.model != "" && v.Model != f.model) ||
+		(f.favorites && !v.Favorite) ||
+		!hasTags(v, f.tags) ||
+		!matchesWords(v, f.words) {
+		return false
+	}
+	if !f.from.IsZero() || !f.to.IsZero() {
+		created, err := time.Parse(time.RFC3339, v.CreatedAt)
+		if err != nil || created.Before(f.from) || (!f.to.IsZero() && created.After(f.to)) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesWords reports whether every word appears in the entry's prompt,
+// or in the prompt as written before --translate-prompt
+func matchesWords(v videoHistoryEntry, words []string) bool {
+	text := strings.ToLower(v.Prompt + "\n" + v.OriginalPrompt)
+	for _, w := range words {
+		if !strings.Contains(text, w) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseTimeBound parses a --since or --until value: a date (the start of
+// the day, or its end if endOfDay), an RFC 3339 time, or an age such as 7d
+// meaning that long ago. "" is the zero time.
+func parseTimeBound(s string, endOfDay bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		if endOfDay {
+			t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		}
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	age, err := parseAge(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q (use a date like 2025-10-01 or an age like 7d)", s)
+	}
+	return time.Now().Add(-age), nil
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// findResult merges what is known locally and remotely about a single video
+type findResult struct {
+	ID        string
+	Prompt    string
+	Model     string
+	CreatedAt time.Time
+	Local     *videoHistoryEntry
+	Remote    *videoObject
+}
+
+// runFind implements `sora-cli find <query>`: search local history and the
+// remote library together, deduplicated by video ID.
+func runFind(args []string) {
+	fs := newFlagSet("find", "<query> [flags]")
+	var (
+		localOnly bool
+		full      bool
+		common    commonOptions
+	)
+	fs.BoolVar(&localOnly, "local", false, "Only search local history (skip the remote listing)")
+	fs.BoolVar(&full, "full", false, "Don't truncate prompts to the terminal width")
+	addCommonFlags(fs, &common)
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	query := strings.ToLower(strings.Join(fs.Args(), " "))
+
+	h, err := loadHistory()
+	if err != nil {
+		fail("", "failed to load history", err)
+	}
+
+	var remote []videoObject
+	remoteOK := false
+	if !localOnly {
+		apiKey := common.mustAPIKey()
+		ctx, cancel := commandContext()
+		defer cancel()
+		client := mustHTTPClient(common.net)
+		remote, err = listVideos(ctx, client, common.baseURL, apiKey)
+		if err != nil {
+			// Still show local matches; remote availability is just unknown
+			infof("Warning: failed to list remote videos: %v\n", err)
+		} else {
+			remoteOK = true
+		}
+	}
+
+	results := mergeFindResults(h.Videos, remote)
+
+	var matches []findResult
+	for _, r := range results {
+		// A translated prompt is also found by the words it was written in
+		original := ""
+		if r.Local != nil {
+			original = r.Local.OriginalPrompt
+		}
+		if strings.Contains(strings.ToLower(r.Prompt), query) || strings.Contains(strings.ToLower(original), query) || strings.Contains(strings.ToLower(r.ID), query) {
+			matches = append(matches, r)
+		}
+	}
+	if jsonOutput {
+		printFindJSON(matches, remoteOK)
+		if len(matches) == 0 {
+			os.Exit(1)
+		}
+		return
+	}
+	if len(matches) == 0 {
+		fmt.Fprintf(os.Stderr, "No videos matching %q\n", query)
+		os.Exit(1)
+	}
+
+	printFindResults(os.Stdout, matches, remoteOK, full)
+}
+
+// mergeFindResults joins local and remote videos by ID, most recent first
+func mergeFindResults(local []videoHistoryEntry, remote []videoObject) []findResult {
+	byID := make(map[string]*findResult)
+	var order []string
+
+	for i := range local {
+		v := &local[i]
+		if _, ok := byID[v.ID]; ok {
+			continue
+		}
+		created, _ := time.Parse(time.RFC3339, v.CreatedAt)
+		byID[v.ID] = &findResult{ID: v.ID, Prompt: v.Prompt, Model: v.Model, CreatedAt: created, Local: v}
+		order = append(order, v.ID)
+	}
+	for i := range remote {
+		v := &remote[i]
+		if r, ok := byID[v.ID]; ok {
+			r.Remote = v
+			if r.Prompt == "" {
+				r.Prompt = v.Prompt
+			}
+			continue
+		}
+		byID[v.ID] = &findResult{ID: v.ID, Prompt: v.Prompt, Model: v.Model, CreatedAt: time.Unix(v.CreatedAt, 0), Remote: v}
+		order = append(order, v.ID)
+	}
+
+	results := make([]findResult, 0, len(order))
+	for _, id := range order {
+		results = append(results, *byID[id])
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].CreatedAt.After(results[j].CreatedAt)
+	})
+	return results
+}
+
+// localOrigin describes whether a video is in history and whether its file still exists
+func localOrigin(r findResult) (string, string) {
+	if r.Local == nil {
+		return "-", colorDim
+	}
+	return entryStatus(*r.Local)
+}
+
+// remoteOrigin describes whether a video can still be fetched from the API
+func remoteOrigin(r findResult, remoteOK bool) (string, string) {
+	if !remoteOK {
+		return "unknown", colorDim
+	}
+	if r.Remote == nil {
+		return "gone", colorRed
+	}
+	if r.Remote.ExpiresAt > 0 && time.Now().Unix() >= r.Remote.ExpiresAt {
+		return "expired", colorYellow
+	}
+	switch s := strings.ToLower(r.Remote.Status); {
+	case s == "completed" || s == "succeeded":
+		return "available", colorGreen
+	case slices.Contains(endedStatuses, s):
+		return s, colorRed
+	}
+	return strings.ToLower(r.Remote.Status), colorCyan
+}
+
+// printFindJSON prints merged results as a JSON array, with the same
+// LOCAL and REMOTE summaries as the table
+func printFindJSON(results []findResult, remoteOK bool) {
+	type jsonResult struct {
+		ID           string             `json:"id"`
+		Prompt       string             `json:"prompt"`
+		Model        string             `json:"model,omitempty"`
+		CreatedAt    string             `json:"created_at,omitempty"`
+		LocalStatus  string             `json:"local_status"`
+		RemoteStatus string             `json:"remote_status"`
+		Local        *videoHistoryEntry `json:"local,omitempty"`
+		Remote       *videoObject       `json:"remote,omitempty"`
+	}
+	out := make([]jsonResult, 0, len(results))
+	for _, r := range results {
+		jr := jsonResult{ID: r.ID, Prompt: r.Prompt, Model: r.Model, Local: r.Local, Remote: r.Remote}
+		if !r.CreatedAt.IsZero() {
+			jr.CreatedAt = r.CreatedAt.UTC().Format(time.RFC3339)
+		}
+		jr.LocalStatus, _ = localOrigin(r)
+		jr.RemoteStatus, _ = remoteOrigin(r, remoteOK)
+		out = append(out, jr)
+	}
+	printJSON(out)
+}
+
+// printFindResults renders merged results using the same table layout as --list
+func printFindResults(w *os.File, results []findResult, remoteOK, full bool) {
+	id := listColumn{header: "ID"}
+	created := listColumn{header: "CREATED"}
+	model := listColumn{header: "MODEL"}
+	local := listColumn{header: "LOCAL"}
+	remote := listColumn{header: "REMOTE"}
+	prompt := listColumn{header: "PROMPT", flex: true}
+
+	for _, r := range results {
+		id.cells = append(id.cells, r.ID)
+		id.colors = append(id.colors, colorYellow)
+
+		ts := ""
+		if !r.CreatedAt.IsZero() {
+			ts = r.CreatedAt.Local().Format("2006-01-02 15:04")
+		}
+		created.cells = append(created.cells, ts)
+		created.colors = append(created.colors, "")
+
+		badge, badgeColor := modelBadge(r.Model)
+		model.cells = append(model.cells, badge)
+		model.colors = append(model.colors, badgeColor)
+
+		l, lColor := localOrigin(r)
+		local.cells = append(local.cells, l)
+		local.colors = append(local.colors, lColor)
+
+		rm, rmColor := remoteOrigin(r, remoteOK)
+		remote.cells = append(remote.cells, rm)
+		remote.colors = append(remote.colors, rmColor)
+
+		prompt.cells = append(prompt.cells, singleLine(r.Prompt))
+		prompt.colors = append(prompt.colors, "")
+	}
+
+	renderColumns(w, []*listColumn{&id, &created, &model, &local, &remote, &prompt}, useColor(w), full)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// exportFormat is an extra format a finished video can be transcoded to
+// (--export)
+type exportFormat struct {
+	suffix  string // replaces the video's extension, e.g. clip.mp4 -> clip.webm
+	encoder string // ffmpeg video encoder, checked before any job is submitted
+	codec   func(b *ffmpegBuilder, audio bool)
+}
+
+// exportFormats use quality-targeted encodes that look like the original
+// at well under its size
+var exportFormats = map[string]exportFormat{
+	// VP9 in constant-quality mode (-b:v 0 lets -crf alone set quality),
+	// with Opus audio, as browsers expect in WebM
+	"webm": {suffix: ".webm", encoder: "libvpx-vp9", codec: func(b *ffmpegBuilder, audio bool) {
+		b.Option("-c:v", "libvpx-vp9").
+			Option("-crf", "32").
+			Option("-b:v", "0").
+			Option("-pix_fmt", "yuv420p")
+		if audio {
+			b.Option("-c:a", "libopus").Option("-b:a", "128k")
+		}
+	}},
+	// H.265 at about half the H.264 bitrate, tagged hvc1 so Apple players
+	// and QuickTime accept it
+	"hevc": {suffix: ".hevc.mp4", encoder: "libx265", codec: func(b *ffmpegBuilder, audio bool) {
+		b.Option("-c:v", "libx265").
+			Option("-crf", "26").
+			Option("-preset", "medium").
+			Option("-tag:v", "hvc1").
+			Option("-pix_fmt", "yuv420p")
+		if audio {
+			b.Option("-c:a", "copy")
+		}
+		b.Option("-movflags", "+faststart+write_colr")
+	}},
+}
+
+func exportFormatNames() []string {
+	names := make([]string, 0, len(exportFormats))
+	for name := range exportFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateExports normalizes the --export formats, dropping repeats, and
+// checks that ffmpeg has an encoder for each
+func validateExports(formats []string) ([]string, error) {
+	var out []string
+	for _, f := range formats {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if _, ok := exportFormats[f]; !ok {
+			return nil, fmt.Errorf("unknown --export format %q (available: %s)", f, strings.Join(exportFormatNames(), ", "))
+		}
+		if !slices.Contains(out, f) {
+			out = append(out, f)
+		}
+	}
+	for _, f := range out {
+		if enc := exportFormats[f].encoder; isFFmpegAvailable() && !ffmpegHasEncoder(enc) {
+			return nil, fmt.Errorf("--export %s needs an ffmpeg built with %s; this one doesn't have it", f, enc)
+		}
+	}
+	return out, nil
+}
+
+// exportPath returns where the format copy of video path is written
+func exportPath(path, format string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + exportFormats[format].suffix
+}
+
+// renderExport transcodes path into format next to it and returns the new
+// file's path. The video itself isn't changed.
+func renderExport(ctx context.Context, path, format string) (string, error) {
+	audio, err := hasAudioTrack(path)
+	if err != nil {
+		return "", err
+	}
+	b := newFFmpeg().Input(path)
+	exportFormats[format].codec(b, audio)
+	if !audio {
+		b.Option("-an")
+	}
+	addColorTags(b)
+	out := exportPath(path, format)
+	if err := b.Output(out).Run(ctx); err != nil {
+		return "", fmt.Errorf("exporting %s: %w", format, err)
+	}
+	return out, nil
+}
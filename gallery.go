@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// galleryThumbWidth is the width of gallery poster frames, in pixels
+const galleryThumbWidth = 480
+
+// galleryItem is one video on the gallery page
+type galleryItem struct {
+	ID          string
+	Prompt      string
+	Model       string
+	Created     string
+	Variation   string
+	Note        string
+	State       string
+	RemixedFrom string
+	Video       string // relative to the page
+	Thumbnail   string // relative to the page; "" without ffmpeg
+	Size        string // e.g. 1280x720
+	Duration    string // e.g. 8.0s
+
+	published time.Time // for the feeds
+	bytes     int64
+}
+
+// galleryPage is the data behind index.html
+type galleryPage struct {
+	Title     string
+	Generated string
+	Feeds     bool // feed.xml and feed.json are written alongside
+	Items     []galleryItem
+}
+
+// runGallery implements `sora-cli gallery`: write a static HTML page of the
+// videos in history, for sharing from a file share or static web host
+func runGallery(args []string) {
+	fs := newFlagSet("gallery", "[flags]")
+	var (
+		out     string
+		title   string
+		siteURL string
+		link    bool
+		filter  historyFilter
+	)
+	fs.StringVarP(&out, "out", "o", "gallery", "Directory to write the gallery to")
+	fs.StringVar(&title, "title", "Sora videos", "Page title")
+	fs.StringVar(&siteURL, "site-url", "", "URL the gallery will be served from; also writes RSS and JSON feeds of the videos")
+	fs.BoolVar(&link, "link", false, "Link to the videos where they are instead of copying them into the gallery")
+	addFilterFlags(fs, &filter)
+	fs.Parse(args)
+
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err := filter.resolve(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	if siteURL != "" {
+		u, err := url.Parse(siteURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fmt.Fprintf(os.Stderr, "Error: invalid --site-url %q (want an http or https URL)\n", siteURL)
+			os.Exit(2)
+		}
+	}
+
+	h, err := loadHistory()
+	if err != nil {
+		fail("", "failed to load history", err)
+	}
+	var entries []videoHistoryEntry
+	skipped := 0
+	for _, v := range h.Videos {
+		if !filter.match(v) {
+			continue
+		}
+		if status, _ := entryStatus(v); status != "saved" {
+			skipped++
+			continue
+		}
+		entries = append(entries, v)
+	}
+	if len(entries) == 0 {
+		fmt.Fprintln(os.Stderr, "No saved videos to put in the gallery")
+		os.Exit(1)
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+	index, err := writeGallery(ctx, out, title, siteURL, entries, !link)
+	if err != nil {
+		fail("", "gallery error", err)
+	}
+	if skipped > 0 {
+		infof("Skipped %d history entries without a local file\n", skipped)
+	}
+	if jsonOutput {
+		printJSON(map[string]any{"index": index, "videos": len(entries)})
+		return
+	}
+	infof("Wrote %d video(s) to %s\n", len(entries), index)
+}
+
+// writeGallery writes index.html for entries into dir, newest first, with
+// poster frames in dir/thumbs. With copyVideos, the videos go into
+// dir/videos so the directory can be shared on its own; otherwise the page
+// links to them where they are. Files from an earlier run are reused, so
+// regenerating a gallery only processes new videos. It returns the path of
+// index.html. With a siteURL, RSS and JSON feeds are written alongside.
+func writeGallery(ctx context.Context, dir, title, siteURL string, entries []videoHistoryEntry, copyVideos bool) (string, error) {
+	subdirs := []string{"thumbs"}
+	if copyVideos {
+		subdirs = append(subdirs, "videos")
+	}
+	for _, sub := range subdirs {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return "", fmt.Errorf("creating gallery directory: %w", err)
+		}
+	}
+	thumbs := isFFmpegAvailable()
+	if !thumbs {
+		infof("Note: ffmpeg not found; the gallery will show videos without poster frames\n")
+	}
+
+	page := galleryPage{Title: title, Generated: time.Now().Format("2006-01-02 15:04"), Feeds: siteURL != ""}
+	for i := len(entries) - 1; i >= 0; i-- {
+		v := entries[i]
+		item := galleryItem{
+			ID:        v.ID,
+			Prompt:    v.Prompt,
+			Model:     v.Model,
+			Created:   formatCreatedAt(v.CreatedAt),
+			Variation: v.Variation,
+			Note:      v.Note,
+			State:     entryState(v),
+		}
+		if v.RemixedFrom != nil {
+			item.RemixedFrom = *v.RemixedFrom
+		}
+		item.published, _ = time.Parse(time.RFC3339, v.CreatedAt)
+		if fi, err := os.Stat(v.OutputFile); err == nil {
+			item.bytes = fi.Size()
+		}
+		if w, h, err := getVideoDimensions(v.OutputFile); err == nil {
+			item.Size = fmt.Sprintf("%dx%d", w, h)
+		}
+		d, err := getVideoDuration(v.OutputFile)
+		if err == nil {
+			item.Duration = fmt.Sprintf("%.1fs", d.Seconds())
+		}
+
+		if copyVideos {
+			item.Video = "videos/" + v.ID + filepath.Ext(v.OutputFile)
+			if err := copyIfChanged(v.OutputFile, filepath.Join(dir, filepath.FromSlash(item.Video))); err != nil {
+				return "", fmt.Errorf("copying %s: %w", v.OutputFile, err)
+			}
+		} else {
+			item.Video, err = relativeLink(dir, v.OutputFile)
+			if err != nil {
+				return "", err
+			}
+		}
+
+		if thumbs {
+			thumb := "thumbs/" + v.ID + ".jpg"
+			path := filepath.Join(dir, filepath.FromSlash(thumb))
+			if _, err := os.Stat(path); err == nil {
+				item.Thumbnail = thumb
+			} else if err := extractThumbnail(ctx, v.OutputFile, path, min(time.Second, d/2), galleryThumbWidth); err != nil {
+				infof("Warning: no poster frame for %s: %v\n", v.ID, err)
+			} else {
+				item.Thumbnail = thumb
+			}
+		}
+		page.Items = append(page.Items, item)
+	}
+
+	index := filepath.Join(dir, "index.html")
+	f, err := os.Create(index)
+	if err != nil {
+		return "", fmt.Errorf("creating index.html: %w", err)
+	}
+	if err := galleryTemplate.Execute(f, page); err != nil {
+		f.Close()
+		return "", fmt.Errorf("writing index.html: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("writing index.html: %w", err)
+	}
+	if siteURL != "" {
+		if err := writeFeeds(dir, siteURL, page); err != nil {
+			return "", err
+		}
+	}
+	return index, nil
+}
+
+// copyIfChanged copies src to dst unless dst already has the same size,
+// hard-linking when both are on the same filesystem
+func copyIfChanged(src, dst string) error {
+	si, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if di, err := os.Stat(dst); err == nil && di.Size() == si.Size() {
+		return nil
+	}
+	os.Remove(dst)
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
+
+// relativeLink returns target as a URL path relative to dir
+func relativeLink(dir, target string) (string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(absDir, absTarget)
+	if err != nil {
+		return "", fmt.Errorf("linking %s: %w", target, err)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+var galleryTemplate = template.Must(template.New("gallery").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+{{- if .Feeds}}
+<link rel="alternate" type="application/rss+xml" title="{{.Title}}" href="feed.xml">
+<link rel="alternate" type="application/feed+json" title="{{.Title}}" href="feed.json">
+{{- end}}
+<style>
+body { margin: 0; padding: 24px; font: 14px/1.45 system-ui, sans-serif; background: #111; color: #ddd; }
+header { margin-bottom: 24px; }
+h1 { margin: 0 0 4px; font-size: 22px; color: #fff; }
+.sub { color: #888; }
+.grid { display: grid; grid-template-columns: repeat(auto-fill, minmax(320px, 1fr)); gap: 20px; }
+figure { margin: 0; background: #1c1c1c; border-radius: 8px; overflow: hidden; }
+video { display: block; width: 100%; max-height: 480px; background: #000; }
+figcaption { padding: 12px 14px 14px; }
+.prompt { color: #fff; white-space: pre-wrap; }
+.meta { margin-top: 8px; color: #888; font-size: 12px; }
+.meta span + span::before { content: " · "; }
+.note { margin-top: 8px; color: #cba; }
+.state { text-transform: uppercase; letter-spacing: .04em; }
+.state-approved { color: #6c6; }
+.state-rejected { color: #d66; }
+a { color: #8ab4f8; }
+</style>
+</head>
+<body>
+<header>
+<h1>{{.Title}}</h1>
+<div class="sub">{{len .Items}} videos · generated {{.Generated}}</div>
+</header>
+<div class="grid">
+{{- range .Items}}
+<figure id="{{.ID}}">
+<video controls preload="metadata" src="{{.Video}}"{{with .Thumbnail}} poster="{{.}}"{{end}}></video>
+<figcaption>
+<div class="prompt">{{.Prompt}}</div>
+{{- with .Variation}}
+<div class="meta">Variation: {{.}}</div>
+{{- end}}
+<div class="meta">
+<span>{{.Model}}</span>
+{{- with .Size}}<span>{{.}}</span>{{end}}
+{{- with .Duration}}<span>{{.}}</span>{{end}}
+<span>{{.Created}}</span>
+<span class="state state-{{.State}}">{{.State}}</span>
+</div>
+<div class="meta"><span>{{.ID}}</span>{{with .RemixedFrom}}<span>remix of {{.}}</span>{{end}}<span><a href="{{.Video}}" download>Download</a></span></div>
+{{- with .Note}}
+<div class="note">{{.}}</div>
+{{- end}}
+</figcaption>
+</figure>
+{{- end}}
+</div>
+</body>
+</html>
+`))
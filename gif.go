@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// Limits for the GIF flags; GIFs beyond these are too large to post anywhere
+const (
+	maxGIFFPS   = 30
+	maxGIFWidth = 1280
+)
+
+// gifOptions control the GIF written alongside a video (--export-gif)
+type gifOptions struct {
+	export bool
+	fps    int
+	width  int // 0 keeps the video's width
+	loop   int // times to repeat after the first play; -1 forever
+}
+
+// addGIFFlags registers the GIF export flags
+func addGIFFlags(fs *flag.FlagSet, g *gifOptions) {
+	fs.BoolVar(&g.export, "export-gif", false, "Also write an optimized GIF of the video (name.gif)")
+	fs.IntVar(&g.fps, "gif-fps", 12, fmt.Sprintf("Frame rate of the --export-gif GIF; up to %d", maxGIFFPS))
+	fs.IntVar(&g.width, "gif-width", 480, fmt.Sprintf("Width of the --export-gif GIF in pixels, up to %d; 0 keeps the video's width", maxGIFWidth))
+	fs.IntVar(&g.loop, "gif-loop", -1, "Times the --export-gif GIF repeats after playing once; -1 loops forever")
+}
+
+// validate checks the GIF flag values
+func (g *gifOptions) validate() error {
+	if g.fps < 1 || g.fps > maxGIFFPS {
+		return fmt.Errorf("--gif-fps must be between 1 and %d", maxGIFFPS)
+	}
+	if g.width < 0 || g.width > maxGIFWidth {
+		return fmt.Errorf("--gif-width must be between 0 and %d", maxGIFWidth)
+	}
+	if g.loop < -1 || g.loop > 65535 {
+		return fmt.Errorf("--gif-loop must be -1 (forever) or between 0 and 65535")
+	}
+	return nil
+}
+
+// gifPath returns where the GIF of video path is written, e.g.
+// clip.mp4 -> clip.gif
+func gifPath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".gif"
+}
+
+// renderGIF writes a GIF of path with a palette computed from the video
+// itself, and returns its path. The video isn't changed.
+func renderGIF(ctx context.Context, path string, g gifOptions) (string, error) {
+	b := newFFmpeg().Input(path)
+	b.Filter(newFilter("fps").Int("fps", g.fps))
+	if g.width > 0 {
+		b.Filter(newFilter("scale").Int("w", g.width).Int("h", -1).String("flags", "lanczos"))
+	}
+	// One pass over the frames builds a 256-color palette, the other maps
+	// onto it; diff stats and rectangle diffs keep static areas from
+	// dithering differently every frame, which bloats the file
+	b.Filter(newFilter("split").To("frames", "forpalette"))
+	b.Filter(newFilter("palettegen").From("forpalette").String("stats_mode", "diff").To("palette"))
+	b.Filter(newFilter("paletteuse").From("frames", "palette").String("dither", "bayer").Int("bayer_scale", 5).String("diff_mode", "rectangle"))
+
+	// The GIF muxer counts loops the other way round: 0 is forever, -1 once
+	loop := g.loop
+	switch loop {
+	case -1:
+		loop = 0
+	case 0:
+		loop = -1
+	}
+	b.Option("-loop", strconv.Itoa(loop))
+
+	out := gifPath(path)
+	if err := b.Output(out).Run(ctx); err != nil {
+		return "", fmt.Errorf("rendering GIF: %w", err)
+	}
+	return out, nil
+}
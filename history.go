@@ -0,0 +1,299 @@
+package main
+
+import (
+	"cmp"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	flag "github.com/spf13/pflag"
+)
+
+type videoHistoryEntry struct {
+	ID     string `json:"id"`
+	Prompt string `json:"prompt"`
+	// OriginalPrompt is the prompt as written when --translate-prompt
+	// submitted a translation; Prompt is what was sent
+	OriginalPrompt string  `json:"original_prompt,omitempty"`
+	CreatedAt      string  `json:"created_at"`
+	OutputFile     string  `json:"output_file,omitempty"`
+	Model          string  `json:"model"`
+	ImageInput     *string `json:"image_input,omitempty"`
+	RemixedFrom    *string `json:"remixed_from,omitempty"`
+	// ExtendedFrom is the video whose last frame started this one
+	// (`sora-cli extend`)
+	ExtendedFrom *string `json:"extended_from,omitempty"`
+	// Pending is set for jobs submitted with --no-wait until `attach`
+	// downloads them; OutputFile is then the requested path, if any
+	Pending bool `json:"pending,omitempty"`
+	// Note is free-form text set with `sora-cli note`
+	Note string `json:"note,omitempty"`
+	// State is the review workflow state set with `sora-cli mark`; empty
+	// means draft
+	State string `json:"state,omitempty"`
+	// Tags and Favorite are set with `sora-cli tag`
+	Tags     []string `json:"tags,omitempty"`
+	Favorite bool     `json:"favorite,omitempty"`
+	// Variation describes how the prompt was varied (--explore)
+	Variation string `json:"variation,omitempty"`
+	// Group ties together the takes of one prompt made by a single
+	// `create --count` run
+	Group string `json:"group,omitempty"`
+	// Session groups related jobs, e.g. one campaign (--session)
+	Session string `json:"session,omitempty"`
+	// Source is where a video made outside the CLI came from: set by
+	// `history add`, or "remote" when `attach` downloads a job this machine
+	// didn't submit. Empty for jobs this CLI submitted.
+	Source string `json:"source,omitempty"`
+	// RequestID is the provider's ID for the request that submitted the
+	// job, to quote in support tickets
+	RequestID string `json:"request_id,omitempty"`
+	// Size, Seconds, and Cost are the rendered resolution, the billed
+	// length, and its estimated price in USD, recorded when the job
+	// finishes; Cost is 0 for unknown prices
+	Size    string  `json:"size,omitempty"`
+	Seconds string  `json:"seconds,omitempty"`
+	Cost    float64 `json:"cost_usd,omitempty"`
+	// Seed is the seed the video was rendered with: the one the API
+	// reports, or else the one --seed asked for
+	Seed *int64 `json:"seed,omitempty"`
+	// Quality is the latest `sora-cli score` of the video against a
+	// reference
+	Quality *qualityScore `json:"quality,omitempty"`
+	// ToolVersion is the sora-cli build that submitted the job, e.g.
+	// "1.4.0+3f2a9c1"; empty for videos made outside the CLI
+	ToolVersion string `json:"tool_version,omitempty"`
+	// Remote is set by `sora-cli sync` or `history backfill` when the video
+	// was deleted from the API account or its content expired; empty while
+	// it is available
+	Remote string `json:"remote,omitempty"`
+}
+
+// recordResult stores the size, length, seed, and estimated price of a
+// finished job, from what the API reports about it
+func (e *videoHistoryEntry) recordResult(st *videoStatusResponse) {
+	if st.Seed != nil {
+		e.Seed = st.Seed
+	}
+	e.Size = cmp.Or(st.Size, e.Size)
+	e.Seconds = cmp.Or(st.Seconds, e.Seconds)
+	e.Cost, _ = videoCost(cmp.Or(st.Model, e.Model), e.Seconds)
+}
+
+// importedIDPrefix starts the IDs given to imported videos that have no
+// Sora video ID, which the API knows nothing about
+const importedIDPrefix = "import_"
+
+type history struct {
+	Version int                 `json:"version"` // format; see historyVersion
+	Videos  []videoHistoryEntry `json:"videos"`
+
+	upgradedFrom int    // format of the file as read, if it was older
+	original     []byte // the file as read, if it was upgraded
+}
+
+// getHistoryPath returns the path to the history database
+func getHistoryPath() (string, error) {
+	dir, err := soraDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "history.db"), nil
+}
+
+// loadHistory loads the whole history, newest first
+func loadHistory() (*history, error) {
+	db, err := openHistoryDB(false)
+	if err != nil {
+		return nil, err
+	}
+	if db == nil {
+		return &history{Version: historyVersion, Videos: []videoHistoryEntry{}}, nil
+	}
+	h, err := readHistory(db)
+	if err != nil {
+		return nil, fmt.Errorf("reading history: %w", err)
+	}
+	return h, nil
+}
+
+// readHistory reads the whole history in q
+func readHistory(q querier) (*history, error) {
+	version, err := historyFormat(q, false)
+	if err != nil {
+		return nil, err
+	}
+	videos, err := readHistoryRows(q)
+	if err != nil {
+		return nil, err
+	}
+	return &history{Version: version, Videos: videos}, nil
+}
+
+// saveHistory replaces the whole history with h, in one transaction, so
+// readers see either the old history or the new one
+func saveHistory(h *history) error {
+	if h.Version > historyVersion {
+		return fmt.Errorf("history is in format %d, from a newer sora-cli; this one only writes format %d, so upgrade sora-cli to change it", h.Version, historyVersion)
+	}
+	return writeHistory(func(tx *sql.Tx) error {
+		return writeHistoryRows(tx, h.Videos)
+	})
+}
+
+// writeHistory runs fn in a transaction that holds the history write lock,
+// after checking that this build can write the history's format
+func writeHistory(fn func(tx *sql.Tx) error) error {
+	db, err := openHistoryDB(true)
+	if err != nil {
+		return err
+	}
+	err = historyTx(db, func(tx *sql.Tx) error {
+		if _, err := historyFormat(tx, true); err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+	if err != nil {
+		return fmt.Errorf("writing history: %w", err)
+	}
+	return nil
+}
+
+// addSessionFlag registers --session, which defaults to $SORA_SESSION so a
+// whole working session can be grouped without repeating the flag
+func addSessionFlag(fs *flag.FlagSet, session *string) {
+	fs.StringVar(session, "session", os.Getenv("SORA_SESSION"), "Group the job in history under this session name (default $SORA_SESSION)")
+}
+
+// cleanSession trims a session name and rejects ones that wouldn't print
+// on one line
+func cleanSession(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if strings.ContainsFunc(name, unicode.IsControl) {
+		return "", fmt.Errorf("invalid session name %q", name)
+	}
+	return name, nil
+}
+
+// addToHistory adds a new entry to the history
+func addToHistory(entry videoHistoryEntry) error {
+	if entry.Source == "" && entry.ToolVersion == "" {
+		entry.ToolVersion = currentBuild().tag()
+	}
+	return writeHistory(func(tx *sql.Tx) error {
+		return insertHistoryRow(tx, entry)
+	})
+}
+
+// updateHistoryEntry applies fn to the history entry with the given ID and
+// saves. It reports whether an entry was found.
+func updateHistoryEntry(id string, fn func(*videoHistoryEntry)) (bool, error) {
+	found := false
+	err := writeHistory(func(tx *sql.Tx) error {
+		var seq int64
+		var v videoHistoryEntry
+		row := tx.QueryRow("SELECT seq, entry FROM videos WHERE id = ? ORDER BY seq DESC LIMIT 1", id)
+		if err := scanHistoryEntry(row, []any{&seq}, &v); errors.Is(err, sql.ErrNoRows) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		found = true
+		fn(&v)
+		entry, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("encoding history: %w", err)
+		}
+		_, err = tx.Exec("UPDATE videos SET id = ?, entry = ? WHERE seq = ?", v.ID, string(entry), seq)
+		return err
+	})
+	return found, err
+}
+
+// editHistory applies fn to the whole history under the write lock, and
+// saves it if fn reports a change
+func editHistory(fn func(*history) bool) error {
+	return writeHistory(func(tx *sql.Tx) error {
+		h, err := readHistory(tx)
+		if err != nil {
+			return err
+		}
+		if !fn(h) {
+			return nil
+		}
+		return writeHistoryRows(tx, h.Videos)
+	})
+}
+
+// findHistoryEntry returns the history entry for id, or nil if there is none
+func findHistoryEntry(id string) *videoHistoryEntry {
+	db, err := openHistoryDB(false)
+	if err != nil || db == nil {
+		return nil
+	}
+	var v videoHistoryEntry
+	row := db.QueryRow("SELECT entry FROM videos WHERE id = ? ORDER BY seq DESC LIMIT 1", id)
+	if err := scanHistoryEntry(row, nil, &v); err != nil {
+		return nil
+	}
+	return &v
+}
+
+// resolveRemoteRef is resolveVideoRef for commands that send the ID to the
+// API, which rejects imported videos that only exist locally
+func resolveRemoteRef(ref string) (string, error) {
+	id, err := resolveVideoRef(ref)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(id, importedIDPrefix) {
+		return "", fmt.Errorf("%s was imported with 'history add' without --id, so the API has no video by that ID", id)
+	}
+	return id, nil
+}
+
+// resolveVideoRef resolves a video reference to a video ID
+// Supports: @last, @0, @1, or direct video_id
+func resolveVideoRef(ref string) (string, error) {
+	// Direct video IDs don't need history
+	if !strings.HasPrefix(ref, "@") {
+		return ref, nil
+	}
+
+	// Handle @last (@0) and @N shortcuts (e.g., @1, @2)
+	idx := 0
+	if ref != "@last" {
+		if _, err := fmt.Sscanf(strings.TrimPrefix(ref, "@"), "%d", &idx); err != nil {
+			return "", fmt.Errorf("invalid index: %s", ref)
+		}
+	}
+
+	db, err := openHistoryDB(false)
+	if err != nil {
+		return "", fmt.Errorf("loading history: %w", err)
+	}
+	if db == nil {
+		return "", errors.New("no videos in history")
+	}
+	var count int
+	if err := db.QueryRow("SELECT count(*) FROM videos").Scan(&count); err != nil {
+		return "", fmt.Errorf("loading history: %w", err)
+	}
+	if count == 0 {
+		return "", errors.New("no videos in history")
+	}
+	if idx < 0 || idx >= count {
+		return "", fmt.Errorf("index out of range: %d (have %d videos)", idx, count)
+	}
+	var id string
+	if err := db.QueryRow("SELECT id FROM videos ORDER BY seq DESC LIMIT 1 OFFSET ?", idx).Scan(&id); err != nil {
+		return "", fmt.Errorf("loading history: %w", err)
+	}
+	return id, nil
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// useTestHistory points history at an empty ~/.sora-cli in a temporary
+// home directory, returning that directory
+func useTestHistory(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	closeHistoryDB()
+	t.Cleanup(closeHistoryDB)
+	dir := filepath.Join(home, ".sora-cli")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// historyIDs returns the IDs in history, newest first
+func historyIDs(t *testing.T) []string {
+	t.Helper()
+	h, err := loadHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, v := range h.Videos {
+		ids = append(ids, v.ID)
+	}
+	return ids
+}
+
+func TestHistoryImportsJSON(t *testing.T) {
+	dir := useTestHistory(t)
+	legacy := filepath.Join(dir, "history.json")
+	data := `{"videos":[{"id":"video_2","prompt":"b","tags":["x"]},{"id":"video_1","prompt":"a"}]}`
+	if err := os.WriteFile(legacy, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := historyIDs(t), []string{"video_2", "video_1"}; !slices.Equal(got, want) {
+		t.Errorf("imported %v, want %v", got, want)
+	}
+	if e := findHistoryEntry("video_2"); e == nil || e.Prompt != "b" || !slices.Equal(e.Tags, []string{"x"}) {
+		t.Errorf("video_2 = %+v", e)
+	}
+	if _, err := os.Stat(legacy + ".imported"); err != nil {
+		t.Errorf("history.json wasn't kept as history.json.imported: %v", err)
+	}
+
+	// A later history.json is not imported again
+	closeHistoryDB()
+	if err := os.WriteFile(legacy, []byte(`{"videos":[{"id":"video_9"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := historyIDs(t); len(got) != 2 {
+		t.Errorf("history.json was imported twice: %v", got)
+	}
+}
+
+func TestHistoryRefusesNewerJSON(t *testing.T) {
+	dir := useTestHistory(t)
+	if err := os.WriteFile(filepath.Join(dir, "history.json"), []byte(`{"version":99,"videos":[]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadHistory(); err == nil {
+		t.Error("imported history from a newer sora-cli")
+	}
+}
+
+func TestHistoryStore(t *testing.T) {
+	dir := useTestHistory(t)
+
+	// Reading an empty history doesn't create the database
+	if got := historyIDs(t); len(got) != 0 {
+		t.Fatalf("new history has %v", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "history.db")); err == nil {
+		t.Error("reading history created history.db")
+	}
+	if _, err := resolveVideoRef("@last"); err == nil {
+		t.Error("@last resolved in an empty history")
+	}
+
+	for _, id := range []string{"video_1", "video_2", "video_3"} {
+		if err := addToHistory(videoHistoryEntry{ID: id, Prompt: "p " + id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := historyIDs(t), []string{"video_3", "video_2", "video_1"}; !slices.Equal(got, want) {
+		t.Errorf("history is %v, want %v", got, want)
+	}
+
+	refs := []struct {
+		ref, want string
+		wantErr   bool
+	}{
+		{"@last", "video_3", false},
+		{"@0", "video_3", false},
+		{"@2", "video_1", false},
+		{"@3", "", true},
+		{"@-1", "", true},
+		{"@x", "", true},
+		{"video_42", "video_42", false},
+	}
+	for _, tt := range refs {
+		got, err := resolveVideoRef(tt.ref)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("resolveVideoRef(%q) = %q, %v; want %q", tt.ref, got, err, tt.want)
+		}
+	}
+
+	found, err := updateHistoryEntry("video_2", func(e *videoHistoryEntry) { e.Note = "keep" })
+	if err != nil || !found {
+		t.Fatalf("updateHistoryEntry = %v, %v", found, err)
+	}
+	if found, _ := updateHistoryEntry("video_9", func(e *videoHistoryEntry) {}); found {
+		t.Error("updated a video that isn't in history")
+	}
+	if e := findHistoryEntry("video_2"); e == nil || e.Note != "keep" || e.ToolVersion == "" {
+		t.Errorf("video_2 = %+v", e)
+	}
+	if got := historyIDs(t); got[1] != "video_2" {
+		t.Errorf("updating video_2 moved it: %v", got)
+	}
+
+	// An edit that reports no change saves nothing
+	err = editHistory(func(h *history) bool {
+		h.Videos = nil
+		return false
+	})
+	if err != nil || len(historyIDs(t)) != 3 {
+		t.Fatalf("unchanged edit: %v, history %v", err, historyIDs(t))
+	}
+	err = editHistory(func(h *history) bool {
+		h.Videos = slices.DeleteFunc(h.Videos, func(v videoHistoryEntry) bool { return v.ID == "video_3" })
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := historyIDs(t), []string{"video_2", "video_1"}; !slices.Equal(got, want) {
+		t.Errorf("after the edit, history is %v, want %v", got, want)
+	}
+}
+
+func TestHistoryConcurrentWrites(t *testing.T) {
+	useTestHistory(t)
+	if err := addToHistory(videoHistoryEntry{ID: "video_shared"}); err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*n)
+	for i := 0; i < n; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			errs <- addToHistory(videoHistoryEntry{ID: fmt.Sprintf("video_%d", i)})
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := updateHistoryEntry("video_shared", func(e *videoHistoryEntry) {
+				e.Tags = append(e.Tags, fmt.Sprint(i))
+			})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := historyIDs(t); len(got) != n+1 {
+		t.Errorf("history has %d videos, want %d", len(got), n+1)
+	}
+	if e := findHistoryEntry("video_shared"); e == nil {
+		t.Error("video_shared is gone")
+	} else if len(e.Tags) != n {
+		t.Errorf("concurrent updates kept %d of %d tags", len(e.Tags), n)
+	}
+}
+
+func TestHistoryNewerDatabaseIsReadOnly(t *testing.T) {
+	useTestHistory(t)
+	if err := addToHistory(videoHistoryEntry{ID: "video_1"}); err != nil {
+		t.Fatal(err)
+	}
+	db, err := openHistoryDB(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(fmt.Sprintf("PRAGMA user_version = %d", historyVersion+1)); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := historyIDs(t); len(got) != 1 {
+		t.Errorf("couldn't read history from a newer sora-cli: %v", got)
+	}
+	if err := addToHistory(videoHistoryEntry{ID: "video_2"}); err == nil {
+		t.Error("added to history from a newer sora-cli")
+	}
+	if _, err := updateHistoryEntry("video_1", func(e *videoHistoryEntry) {}); err == nil {
+		t.Error("updated history from a newer sora-cli")
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// History lives in a SQLite database, history.db. Each video is a row
+// holding its videoHistoryEntry as JSON, so new fields don't need a schema
+// change and the stepwise migrations in migrate.go still apply; the row's
+// seq gives the newest-first order and id is indexed for lookups. The
+// database's user_version is the history format (historyVersion).
+//
+// SQLite's own locking keeps parallel sora-cli runs from overwriting each
+// other: every transaction takes the write lock when it begins, and a run
+// that finds it held waits up to historyBusyTimeout. The lock belongs to
+// the open file, so a run that crashes can't leave it behind.
+const historySchema = `
+CREATE TABLE IF NOT EXISTS videos (
+	seq   INTEGER PRIMARY KEY,
+	id    TEXT NOT NULL,
+	entry TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS videos_id ON videos (id);
+`
+
+// historyBusyTimeout is how long to wait for another sora-cli process to
+// finish updating history
+const historyBusyTimeout = 30 * time.Second
+
+var historyDB struct {
+	sync.Mutex
+	db *sql.DB
+}
+
+// openHistoryDB returns the history database, opening it (and creating or
+// upgrading it) on first use. Unless create is set, a missing database with
+// no history.json to import is reported as a nil *sql.DB, so read-only
+// commands don't leave an empty database behind.
+func openHistoryDB(create bool) (*sql.DB, error) {
+	historyDB.Lock()
+	defer historyDB.Unlock()
+	if historyDB.db != nil {
+		return historyDB.db, nil
+	}
+
+	path, err := getHistoryPath()
+	if err != nil {
+		return nil, err
+	}
+	legacy := filepath.Join(filepath.Dir(path), "history.json")
+	if !create {
+		if !fileExists(path) && !fileExists(legacy) {
+			return nil, nil
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("creating history directory: %w", err)
+	}
+
+	q := url.Values{}
+	q.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", historyBusyTimeout.Milliseconds()))
+	q.Add("_pragma", "journal_mode(WAL)")
+	q.Set("_txlock", "immediate")
+	dsn := (&url.URL{Scheme: "file", Path: uriPath(path), RawQuery: q.Encode()}).String()
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("opening history: %w", err)
+	}
+	imported, err := setUpHistoryDB(db, legacy)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("opening history: %w", err)
+	}
+	if imported {
+		// Keep the old file, out of the way of the next import check
+		if err := os.Rename(legacy, legacy+".imported"); err != nil {
+			infof("Warning: history.json was imported into %s but could not be renamed: %v\n", path, err)
+		}
+	}
+	historyDB.db = db
+	return db, nil
+}
+
+// closeHistoryDB closes the history database, so its file can be moved
+func closeHistoryDB() {
+	historyDB.Lock()
+	defer historyDB.Unlock()
+	if historyDB.db != nil {
+		historyDB.db.Close()
+		historyDB.db = nil
+	}
+}
+
+// uriPath turns a file path into the path of a file: URI
+func uriPath(path string) string {
+	path = filepath.ToSlash(path)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path // C:/Users/... on Windows
+	}
+	return path
+}
+
+// fileExists reports whether path exists
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// setUpHistoryDB creates the schema of a new history database and imports
+// legacy, the history.json of older releases, if there is one; or upgrades
+// the videos of an older format. It reports whether legacy was imported.
+func setUpHistoryDB(db *sql.DB, legacy string) (bool, error) {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return false, err
+	}
+	if version >= historyVersion {
+		return false, nil
+	}
+
+	imported := false
+	err := historyTx(db, func(tx *sql.Tx) error {
+		// Another run may have set it up while this one waited for the lock
+		if err := tx.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+			return err
+		}
+		switch {
+		case version >= historyVersion:
+			return nil
+		case version == 0:
+			if _, err := tx.Exec(historySchema); err != nil {
+				return err
+			}
+			data, err := os.ReadFile(legacy)
+			if errors.Is(err, os.ErrNotExist) {
+				break
+			} else if err != nil {
+				return fmt.Errorf("reading %s: %w", legacy, err)
+			}
+			h, err := decodeHistory(data)
+			if err != nil {
+				return fmt.Errorf("importing %s: %w", legacy, err)
+			}
+			if h.Version > historyVersion {
+				return fmt.Errorf("%s is in format %d, from a newer sora-cli; upgrade sora-cli to import it", legacy, h.Version)
+			}
+			if err := writeHistoryRows(tx, h.Videos); err != nil {
+				return err
+			}
+			imported = true
+		default:
+			if err := upgradeHistoryRows(tx, version, legacy); err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", historyVersion))
+		return err
+	})
+	return imported, err
+}
+
+// upgradeHistoryRows runs the migrations in migrate.go over the videos of
+// a database in an older format, keeping the videos as they were in
+// history.json.v<version> next to it
+func upgradeHistoryRows(tx *sql.Tx, version int, legacy string) error {
+	rows, err := tx.Query("SELECT entry FROM videos ORDER BY seq DESC")
+	if err != nil {
+		return err
+	}
+	doc := struct {
+		Version int               `json:"version"`
+		Videos  []json.RawMessage `json:"videos"`
+	}{Version: version, Videos: []json.RawMessage{}}
+	for rows.Next() {
+		var entry string
+		if err := rows.Scan(&entry); err != nil {
+			rows.Close()
+			return err
+		}
+		doc.Videos = append(doc.Videos, json.RawMessage(entry))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	h, err := decodeHistory(data)
+	if err != nil {
+		return err
+	}
+	if err := backupHistory(legacy, h); err != nil {
+		return err
+	}
+	return writeHistoryRows(tx, h.Videos)
+}
+
+// historyTx runs fn in a transaction holding the history write lock,
+// committing it if fn succeeds
+func historyTx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// historyFormat returns the history format of the database, refusing to
+// change one from a newer sora-cli, which would drop what this build
+// doesn't know
+func historyFormat(q querier, write bool) (int, error) {
+	var version int
+	if err := q.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return 0, err
+	}
+	if write && version > historyVersion {
+		return 0, fmt.Errorf("history is in format %d, from a newer sora-cli; this one only writes format %d, so upgrade sora-cli to change it", version, historyVersion)
+	}
+	return version, nil
+}
+
+// querier is what *sql.DB and *sql.Tx have in common
+type querier interface {
+	QueryRow(query string, args ...any) *sql.Row
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// readHistoryRows returns every video, newest first
+func readHistoryRows(q querier) ([]videoHistoryEntry, error) {
+	rows, err := q.Query("SELECT entry FROM videos ORDER BY seq DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	videos := []videoHistoryEntry{}
+	for rows.Next() {
+		var v videoHistoryEntry
+		if err := scanHistoryEntry(rows, nil, &v); err != nil {
+			return nil, err
+		}
+		videos = append(videos, v)
+	}
+	return videos, rows.Err()
+}
+
+// scanHistoryEntry decodes the entry column of a row into v, after any
+// columns in dest
+func scanHistoryEntry(row interface{ Scan(...any) error }, dest []any, v *videoHistoryEntry) error {
+	var entry string
+	if err := row.Scan(append(dest, &entry)...); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(entry), v)
+}
+
+// writeHistoryRows replaces every video with videos, given newest first
+func writeHistoryRows(tx *sql.Tx, videos []videoHistoryEntry) error {
+	if _, err := tx.Exec("DELETE FROM videos"); err != nil {
+		return err
+	}
+	for i := len(videos) - 1; i >= 0; i-- {
+		if err := insertHistoryRow(tx, videos[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertHistoryRow adds v as the newest video
+func insertHistoryRow(tx *sql.Tx, v videoHistoryEntry) error {
+	entry, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encoding history: %w", err)
+	}
+	_, err = tx.Exec("INSERT INTO videos (id, entry) VALUES (?, ?)", v.ID, string(entry))
+	return err
+}
+
+// historyCorrupt reports whether err means the history database can't be
+// read at all: it isn't a SQLite database, it is damaged, or a video in it
+// isn't valid JSON
+func historyCorrupt(err error) bool {
+	var dbErr *sqlite.Error
+	if errors.As(err, &dbErr) {
+		code := dbErr.Code() & 0xff
+		return code == sqlite3.SQLITE_CORRUPT || code == sqlite3.SQLITE_NOTADB
+	}
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	return errors.As(err, &syntaxErr) || errors.As(err, &typeErr)
+}
+
+// moveHistoryAside renames the history database, with its write-ahead log,
+// to backup, so history starts over empty
+func moveHistoryAside(backup string) error {
+	closeHistoryDB()
+	path, err := getHistoryPath()
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(path, backup); err != nil {
+		return err
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Rename(path+suffix, backup+suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	flag "github.com/spf13/pflag"
+)
+
+// netOptions are connection-level overrides shared by every command
+type netOptions struct {
+	resolve []string // host:ip pairs, like curl --resolve
+	ipv4    bool
+	ipv6    bool
+	headers http.Header // sent with every request; set from the --profile
+
+	maxAttempts int  // tries per request for transient failures; 1 disables retries
+	verbose     bool // log each request with the server's rate-limit headers
+}
+
+// addNetworkFlags registers the connection flags on fs
+func addNetworkFlags(fs *flag.FlagSet, o *netOptions) {
+	fs.StringArrayVar(&o.resolve, "resolve", nil, "Resolve host to a fixed address, as host:ip or host:port:ip (repeatable)")
+	fs.BoolVarP(&o.ipv4, "ipv4", "4", false, "Only connect over IPv4")
+	fs.BoolVarP(&o.ipv6, "ipv6", "6", false, "Only connect over IPv6")
+	fs.IntVar(&o.maxAttempts, "max-attempts", cfg.maxAttempts(), "Tries per API request or download when the server returns 5xx or the network fails (1 disables retries)")
+	fs.BoolVar(&o.verbose, "verbose", false, "Log each API request with the remaining rate limit reported by the server")
+}
+
+// parseResolve turns host:ip entries, or curl's host:port:ip, into a lookup
+// table keyed by host, or by host:port when a port is given. Whatever follows
+// the host is tried as a bare address first, so an unbracketed IPv6 address
+// is never split into a port; in the host:port:ip form an IPv6 address has
+// to be bracketed, as curl requires.
+func parseResolve(entries []string) (map[string]string, error) {
+	m := make(map[string]string, len(entries))
+	for _, e := range entries {
+		host, rest, ok := strings.Cut(e, ":")
+		if !ok || host == "" {
+			return nil, fmt.Errorf("invalid --resolve %q (want host:ip or host:port:ip)", e)
+		}
+		key := strings.ToLower(host)
+		if ip := net.ParseIP(trimBrackets(rest)); ip != nil {
+			m[key] = ip.String()
+			continue
+		}
+		port, addr, found := strings.Cut(rest, ":")
+		ip := net.ParseIP(trimBrackets(addr))
+		if !found || !isPort(port) || ip == nil || (strings.Contains(addr, ":") && !isBracketed(addr)) {
+			return nil, fmt.Errorf("invalid --resolve %q (want host:ip or host:port:ip, with an IPv6 address in brackets after a port)", e)
+		}
+		m[net.JoinHostPort(key, port)] = ip.String()
+	}
+	return m, nil
+}
+
+// isPort reports whether s is a TCP port number
+func isPort(s string) bool {
+	n, err := strconv.Atoi(s)
+	return err == nil && n > 0 && n < 65536
+}
+
+// isBracketed reports whether s is wrapped in [ and ]
+func isBracketed(s string) bool {
+	return strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]")
+}
+
+// trimBrackets removes the brackets around an IPv6 address
+func trimBrackets(s string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+}
+
+// newHTTPClient returns the client shared by every API call in a run.
+// There is deliberately no overall client Timeout: it would also cap video
+// downloads, which are bounded by the caller's context instead. Individual
+// phases of a request (dial, TLS, waiting for headers) get their own limits.
+func newHTTPClient(o netOptions) (*http.Client, error) {
+	if o.ipv4 && o.ipv6 {
+		return nil, fmt.Errorf("cannot use both --ipv4 and --ipv6")
+	}
+	if o.maxAttempts < 1 {
+		return nil, fmt.Errorf("--max-attempts must be at least 1")
+	}
+	overrides, err := parseResolve(o.resolve)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		switch {
+		case o.ipv4:
+			network = "tcp4"
+		case o.ipv6:
+			network = "tcp6"
+		}
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		host = strings.ToLower(host)
+		if ip, ok := overrides[net.JoinHostPort(host, port)]; ok {
+			address = net.JoinHostPort(ip, port)
+		} else if ip, ok := overrides[host]; ok {
+			address = net.JoinHostPort(ip, port)
+		}
+		conn, err := dialer.DialContext(ctx, network, address)
+		if err != nil {
+			// Name the address actually dialed so DNS/dual-stack problems are diagnosable
+			return nil, fmt.Errorf("connecting to %s (%s): %w", address, network, err)
+		}
+		return conn, nil
+	}
+
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dial,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          32,
+		MaxIdleConnsPerHost:   8,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 60 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		// Compression is negotiated by decompressingTransport so brotli is
+		// supported alongside gzip
+		DisableCompression: true,
+	}
+	headers := o.headers.Clone()
+	if headers == nil {
+		headers = http.Header{}
+	}
+	headers.Set("User-Agent", userAgent())
+	var rt http.RoundTripper = &decompressingTransport{base: transport}
+	rt = &headerTransport{base: rt, headers: headers}
+	if o.verbose {
+		rt = &verboseTransport{base: rt}
+	}
+	if o.maxAttempts > 1 {
+		rt = &retryTransport{base: rt, attempts: o.maxAttempts}
+	}
+	return &http.Client{Transport: rt}, nil
+}
+
+// mustHTTPClient is newHTTPClient for command entry points: invalid
+// connection flags are a usage error
+func mustHTTPClient(o netOptions) *http.Client {
+	c, err := newHTTPClient(o)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	return c
+}
+
+// headerTransport adds fixed headers (e.g. User-Agent, OpenAI-Organization)
+// to requests
+type headerTransport struct {
+	base    http.RoundTripper
+	headers http.Header
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for k, v := range t.headers {
+		req.Header[k] = v
+	}
+	return t.base.RoundTrip(req)
+}
+
+// Retry backoff: the wait before retry n is drawn from the upper half of
+// retryBaseDelay * 2^(n-1), capped at retryMaxDelay. A rate-limited request
+// waits as long as the server asks, up to rateLimitMaxDelay.
+const (
+	retryBaseDelay    = time.Second
+	retryMaxDelay     = 30 * time.Second
+	rateLimitMaxDelay = 2 * time.Minute
+)
+
+// retryTransport retries requests that failed for reasons likely to pass:
+// 5xx responses, rate limiting, and network errors. A POST whose request
+// may have reached the server is only retried on an error status unless it
+// carries an Idempotency-Key, since a lost response to a create could
+// otherwise submit (and bill) a second job.
+type retryTransport struct {
+	base     http.RoundTripper
+	attempts int
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if attempt >= t.attempts || !retryable(req, resp, err) {
+			return resp, err
+		}
+		if req.Body != nil && req.GetBody == nil {
+			return resp, err
+		}
+
+		wait := retryDelay(attempt)
+		var reason string
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = resp.Status
+			if resp.StatusCode == http.StatusTooManyRequests {
+				if d := rateLimitWait(resp); d > 0 {
+					wait = min(d, rateLimitMaxDelay)
+				}
+			} else if d := retryAfter(resp); d > 0 {
+				wait = min(d, retryMaxDelay)
+			}
+			closeBody(resp)
+		}
+		infof("%s %s: %s; retrying in %s (attempt %d of %d)\n", req.Method, req.URL.Path, reason, wait.Round(100*time.Millisecond), attempt+1, t.attempts)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// clientAttempts returns how many times c tries a request (--max-attempts)
+func clientAttempts(c *http.Client) int {
+	if t, ok := c.Transport.(*retryTransport); ok {
+		return t.attempts
+	}
+	return 1
+}
+
+// retryable reports whether a request that got resp or err should be tried again
+func retryable(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		if req.Context().Err() != nil {
+			return false
+		}
+		switch req.Method {
+		case http.MethodGet, http.MethodHead, http.MethodDelete, http.MethodOptions:
+			return true
+		}
+		if req.Header.Get(idempotencyKeyHeader) != "" {
+			return true
+		}
+		// Otherwise only retry when the connection was never made
+		var opErr *net.OpError
+		return errors.As(err, &opErr) && opErr.Op == "dial"
+	}
+	switch resp.StatusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	case http.StatusTooManyRequests:
+		// An exhausted quota won't come back by waiting
+		return !isQuotaExhausted(resp)
+	}
+	return false
+}
+
+// isQuotaExhausted reports whether a 429 response is for an exhausted
+// quota rather than a rate limit. The body is read and put back.
+func isQuotaExhausted(resp *http.Response) bool {
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	resp.Body = &decodedBody{Reader: io.MultiReader(bytes.NewReader(b), resp.Body), closers: []io.Closer{resp.Body}}
+	return bytes.Contains(b, []byte("insufficient_quota"))
+}
+
+// retryDelay returns the jittered wait before retry n
+func retryDelay(n int) time.Duration {
+	d := retryMaxDelay
+	if n < 6 {
+		d = min(retryBaseDelay<<(n-1), retryMaxDelay)
+	}
+	return d/2 + rand.N(d/2)
+}
+
+// retryAfter returns the wait requested by a Retry-After header given in
+// seconds, or 0
+func retryAfter(resp *http.Response) time.Duration {
+	secs, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || secs <= 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
+
+// rateLimitWait returns how long a rate-limited response asks the client to
+// wait: Retry-After if present, otherwise the longest of the
+// x-ratelimit-reset-* headers, or 0 if the server didn't say
+func rateLimitWait(resp *http.Response) time.Duration {
+	if d := retryAfter(resp); d > 0 {
+		return d
+	}
+	var wait time.Duration
+	for _, kind := range []string{"requests", "tokens"} {
+		if d, err := time.ParseDuration(resp.Header.Get("X-Ratelimit-Reset-" + kind)); err == nil {
+			wait = max(wait, d)
+		}
+	}
+	return wait
+}
+
+// rateLimitSummary describes the x-ratelimit-* headers of resp, e.g.
+// "requests 48/50 left, resets in 1.2s", or "" if there are none
+func rateLimitSummary(resp *http.Response) string {
+	var parts []string
+	for _, kind := range []string{"requests", "tokens"} {
+		remaining := resp.Header.Get("X-Ratelimit-Remaining-" + kind)
+		if remaining == "" {
+			continue
+		}
+		part := kind + " " + remaining
+		if limit := resp.Header.Get("X-Ratelimit-Limit-" + kind); limit != "" {
+			part += "/" + limit
+		}
+		part += " left"
+		if reset := resp.Header.Get("X-Ratelimit-Reset-" + kind); reset != "" {
+			part += ", resets in " + reset
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// verboseTransport logs each response's status and rate-limit headers
+type verboseTransport struct {
+	base http.RoundTripper
+}
+
+func (t *verboseTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	msg := fmt.Sprintf("%s %s: %s", req.Method, req.URL.Path, resp.Status)
+	if rl := rateLimitSummary(resp); rl != "" {
+		msg += " (" + rl + ")"
+	}
+	infof("%s\n", msg)
+	return resp, nil
+}
+
+// decompressingTransport advertises gzip and brotli support and transparently
+// decodes compressed responses. Requests that set their own Accept-Encoding
+// are passed through untouched.
+type decompressingTransport struct {
+	base http.RoundTripper
+}
+
+func (t *decompressingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Accept-Encoding") != "" {
+		return t.base.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Accept-Encoding", "br, gzip")
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var body io.ReadCloser
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "gzip":
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		body = &decodedBody{Reader: zr, closers: []io.Closer{zr, resp.Body}}
+	case "br":
+		body = &decodedBody{Reader: brotli.NewReader(resp.Body), closers: []io.Closer{resp.Body}}
+	default:
+		return resp, nil
+	}
+
+	resp.Body = body
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return resp, nil
+}
+
+// decodedBody reads decompressed data and closes both the decoder and the
+// underlying response body
+type decodedBody struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (b *decodedBody) Close() error {
+	var first error
+	for _, c := range b.closers {
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// closeBody drains a bounded amount of any unread response body before
+// closing it, so the underlying connection can go back to the idle pool
+func closeBody(resp *http.Response) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestParseResolve(t *testing.T) {
+	tests := []struct {
+		entry string
+		want  map[string]string // nil when the entry is invalid
+	}{
+		{"api.openai.com:162.159.140.245", map[string]string{"api.openai.com": "162.159.140.245"}},
+		{"API.OpenAI.com:1.2.3.4", map[string]string{"api.openai.com": "1.2.3.4"}},
+		{"api.openai.com:443:162.159.140.245", map[string]string{"api.openai.com:443": "162.159.140.245"}},
+		{"h:::1", map[string]string{"h": "::1"}},
+		{"h:[::1]", map[string]string{"h": "::1"}},
+		{"h:2001:db8::1", map[string]string{"h": "2001:db8::1"}},
+		// Looks like a port, but the whole remainder is an IPv6 address
+		{"h:443:1::2", map[string]string{"h": "443:1::2"}},
+		{"h:443:2001:db8::1", map[string]string{"h": "443:2001:db8::1"}},
+		{"h:443:[2001:db8::1]", map[string]string{"h:443": "2001:db8::1"}},
+
+		{"h:443:::1", nil}, // IPv6 after a port needs brackets
+		{"h:443:::ffff:1.2.3.4", nil},
+		{"h:1.2.3.4.5", nil},
+		{"h:example.com", nil},
+		{"h:99999:1.2.3.4", nil},
+		{"h:0:1.2.3.4", nil},
+		{"h:443:", nil},
+		{":1.2.3.4", nil},
+		{"h", nil},
+	}
+	for _, tt := range tests {
+		got, err := parseResolve([]string{tt.entry})
+		switch {
+		case tt.want == nil && err == nil:
+			t.Errorf("parseResolve(%q) = %v, want an error", tt.entry, got)
+		case tt.want != nil && err != nil:
+			t.Errorf("parseResolve(%q): %v", tt.entry, err)
+		case tt.want != nil && !maps.Equal(got, tt.want):
+			t.Errorf("parseResolve(%q) = %v, want %v", tt.entry, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// historyCommands are the subcommands of `sora-cli history`
+var historyCommands = []command{
+	{"add", "Add a video made outside the CLI to local history", runHistoryAdd},
+	{"prune", "Drop entries whose files are missing or that are older than a cutoff", runHistoryPrune},
+	{"repair", "Fix a damaged history, rebuilding it from the API account where possible", runHistoryRepair},
+	{"backfill", "Fill in size, length, cost, and remote state the API still has for older entries", runHistoryBackfill},
+}
+
+// runHistory implements `sora-cli history <subcommand>`
+func runHistory(args []string) {
+	runSubcommand("history", historyCommands, args)
+}
+
+// runHistoryAdd implements `sora-cli history add <file>`: record a video
+// from the web UI, a teammate, or another tool so it can be listed,
+// reviewed, joined, and put in galleries like generated ones
+func runHistoryAdd(args []string) {
+	fs := newFlagSet("history add", "<file.mp4> [flags]")
+	var (
+		prompt  string
+		source  string
+		id      string
+		model   string
+		note    string
+		session string
+	)
+	fs.StringVarP(&prompt, "prompt", "p", "", "The prompt the video was made from, if known")
+	fs.StringVar(&source, "source", "external", "Where the video came from, e.g. web or a teammate's name")
+	fs.StringVar(&id, "id", "", "The video's Sora ID, if it is on this API account; lets it be remixed")
+	fs.StringVar(&model, "model", "", "The model that made the video, if known")
+	fs.StringVar(&note, "note", "", "A note to attach, as with 'sora-cli note'")
+	addSessionFlag(fs, &session)
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if source == "" {
+		fmt.Fprintln(os.Stderr, "Error: --source cannot be empty")
+		os.Exit(2)
+	}
+	session, err := cleanSession(session)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	path, err := filepath.Abs(fs.Arg(0))
+	if err != nil {
+		fail("", "import error", err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		fail("", "import error", err)
+	}
+	if _, err := getVideoDuration(path); err != nil {
+		fail("", "import error", fmt.Errorf("%s is not a readable MP4 video: %w", fs.Arg(0), err))
+	}
+
+	h, err := loadHistory()
+	if err != nil {
+		fail("", "failed to load history", err)
+	}
+	for i, v := range h.Videos {
+		if (id != "" && v.ID == id) || v.OutputFile == path {
+			fmt.Fprintf(os.Stderr, "Error: already in history as @%d (%s)\n", i, v.ID)
+			os.Exit(1)
+		}
+	}
+	if id == "" {
+		id = newImportedID()
+	}
+
+	entry := videoHistoryEntry{
+		ID:         id,
+		Prompt:     prompt,
+		CreatedAt:  fi.ModTime().UTC().Format(time.RFC3339),
+		OutputFile: path,
+		Model:      model,
+		Note:       note,
+		Session:    session,
+		Source:     source,
+	}
+	if err := addToHistory(entry); err != nil {
+		fail(id, "failed to save history", err)
+	}
+	if jsonOutput {
+		printJSON(entry)
+		return
+	}
+	fmt.Println(id)
+	infof("Added %s to history as @0\n", fs.Arg(0))
+}
+
+// newImportedID returns a local ID for an imported video
+func newImportedID() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return importedIDPrefix + hex.EncodeToString(b)
+}
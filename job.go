@@ -0,0 +1,485 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+	flag "github.com/spf13/pflag"
+)
+
+// jobOptions control how a submitted job is waited on and saved
+type jobOptions struct {
+	output    string
+	overwrite bool
+	skipExist bool
+
+	pollInterval    time.Duration
+	maxWait         time.Duration // submission to finished render, across both phases
+	maxQueueWait    time.Duration
+	maxRenderTime   time.Duration
+	downloadTimeout time.Duration
+
+	session string // recorded in history (--session)
+
+	quiet bool // no per-download progress (batch draws its own display)
+	open  bool // play the saved video (--open)
+
+	encryptTo []string  // recipients (--encrypt-to)
+	enc       encryptor // chosen by prepareEncryption
+
+	thumbnail   bool          // save a poster frame next to the video (--thumbnail)
+	thumbnailAt time.Duration // where in the video it is taken
+
+	livePreview bool // fetch preview frames while the job renders (--live-preview)
+}
+
+// addJobFlags registers the output and time budget flags shared by commands
+// that wait for a job and download its result
+func addJobFlags(fs *flag.FlagSet, o *jobOptions) {
+	addOutputFlags(fs, o)
+	addBudgetFlags(fs, o)
+	fs.BoolVar(&o.livePreview, "live-preview", false, "While the job renders, save the API's preview frames as name.preview.jpg and show them in terminals that display images")
+	addNotifyFlags(fs)
+}
+
+// addBudgetFlags registers the polling interval and the time budgets
+func addBudgetFlags(fs *flag.FlagSet, o *jobOptions) {
+	fs.DurationVar(&o.pollInterval, "poll-interval", cfg.poll(), "How often to check the job's status")
+	fs.DurationVar(&o.maxWait, "max-wait", cfg.maxWait, "Give up if the job hasn't finished rendering this long after it was submitted (0 = no limit)")
+	fs.DurationVar(&o.maxQueueWait, "max-queue-wait", 15*time.Minute, "Give up if the job is still queued after this long (0 = no limit)")
+	fs.DurationVar(&o.maxRenderTime, "max-render-time", 20*time.Minute, "Give up if rendering takes longer than this (0 = no limit)")
+}
+
+// addOutputFlags registers only the flags that control saving a video
+func addOutputFlags(fs *flag.FlagSet, o *jobOptions) {
+	fs.StringVarP(&o.output, "output", "o", "", "Write output to <file>. Use '-' for stdout-only (no save). Default saves to {video_id}.mp4")
+	fs.BoolVar(&o.open, "open", cfg.Open, "Play the video once it is saved, with the player from the config file or the system default")
+	addSaveFlags(fs, o)
+}
+
+// addSaveFlags registers the collision and download flags, for commands
+// that choose output paths some other way than -o
+func addSaveFlags(fs *flag.FlagSet, o *jobOptions) {
+	fs.BoolVar(&o.overwrite, "overwrite", false, "Overwrite the output file if it already exists")
+	fs.BoolVar(&o.skipExist, "skip-existing", false, "Exit without downloading if the output file already exists")
+	fs.DurationVar(&o.downloadTimeout, "download-timeout", 10*time.Minute, "Give up if downloading the finished video takes longer than this (0 = no limit)")
+	fs.StringArrayVar(&o.encryptTo, "encrypt-to", cfg.EncryptTo, "Encrypt the video to this age or GPG recipient as it downloads, so it is never on disk unencrypted (repeatable)")
+	fs.BoolVar(&o.thumbnail, "thumbnail", cfg.Thumbnail, "Save a JPEG poster frame next to the video (name.jpg)")
+	fs.DurationVar(&o.thumbnailAt, "thumbnail-at", cfg.thumbnailAt(), "How far into the video --thumbnail takes its frame (needs ffmpeg)")
+}
+
+// validateBudgets checks the flags registered by addBudgetFlags, and
+// normalizes --session
+func (o *jobOptions) validateBudgets() error {
+	session, err := cleanSession(o.session)
+	if err != nil {
+		return err
+	}
+	o.session = session
+	if o.pollInterval <= 0 {
+		return fmt.Errorf("--poll-interval must be positive, got %s", o.pollInterval)
+	}
+	if o.maxWait < 0 || o.maxQueueWait < 0 || o.maxRenderTime < 0 {
+		return errors.New("time budgets can't be negative (use 0 for no limit)")
+	}
+	return nil
+}
+
+// poll returns the interval between status checks
+func (o *jobOptions) poll() time.Duration {
+	if o.pollInterval > 0 {
+		return o.pollInterval
+	}
+	return cfg.poll()
+}
+
+// existingPolicy returns the collision policy selected by the flags, or
+// else by on_existing in the config file
+func (o *jobOptions) existingPolicy() (existingPolicy, error) {
+	switch {
+	case o.overwrite && o.skipExist:
+		return 0, errors.New("cannot use both --overwrite and --skip-existing")
+	case o.overwrite:
+		return existingOverwrite, nil
+	case o.skipExist:
+		return existingSkip, nil
+	}
+	return cfg.onExisting, nil
+}
+
+// rewritePolicy is the collision policy for outputs made from videos that
+// are already saved (concat, compare): --overwrite, or else on_existing,
+// where skip would have nothing to skip and means suffix
+func rewritePolicy(overwrite bool) existingPolicy {
+	switch {
+	case overwrite:
+		return existingOverwrite
+	case cfg.onExisting == existingSkip:
+		return existingSuffix
+	}
+	return cfg.onExisting
+}
+
+// prepareOutput resolves output collisions before any money is spent. It
+// exits successfully if --skip-existing applies.
+func (o *jobOptions) prepareOutput() {
+	policy, err := o.checkSaveFlags()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	if o.output == "-" && jsonOutput {
+		fmt.Fprintln(os.Stderr, "Cannot use --json with -o - (stdout can carry either the video or JSON)")
+		os.Exit(2)
+	}
+	if o.output == "-" {
+		o.open = false // nothing saved to open
+		o.thumbnail = false
+	}
+	if o.output == "" || o.output == "-" {
+		return
+	}
+	o.output = o.encryptedName(o.output)
+	resolved, skip, err := resolveOutputPath(o.output, policy)
+	if err != nil {
+		fail("", "failed to choose the output file", err)
+	}
+	if skip {
+		infof("Skipping: %s already exists\n", o.output)
+		os.Exit(0)
+	}
+	o.output = resolved
+}
+
+// checkSaveFlags checks the flags registered by addSaveFlags and returns
+// the collision policy
+func (o *jobOptions) checkSaveFlags() (existingPolicy, error) {
+	policy, err := o.existingPolicy()
+	if err != nil {
+		return 0, err
+	}
+	if o.thumbnailAt < 0 {
+		return 0, fmt.Errorf("--thumbnail-at can't be negative, got %s", o.thumbnailAt)
+	}
+	return policy, o.prepareEncryption()
+}
+
+// prepareEncryption checks --encrypt-to and picks the tool for it
+func (o *jobOptions) prepareEncryption() error {
+	if !o.encrypted() {
+		return nil
+	}
+	if o.output == "-" {
+		return errors.New("--encrypt-to can't be used with -o - (the video goes to stdout, not disk)")
+	}
+	if o.thumbnail {
+		return errors.New("--thumbnail can't be used with --encrypt-to (the poster frame would be saved unencrypted)")
+	}
+	if o.livePreview {
+		return errors.New("--live-preview can't be used with --encrypt-to (preview frames would be saved unencrypted)")
+	}
+	enc, err := chooseEncryptor(o.encryptTo)
+	if err != nil {
+		return err
+	}
+	o.enc = enc
+	o.open = false // players can't read the encrypted file
+	return nil
+}
+
+// encrypted reports whether downloads are encrypted (--encrypt-to)
+func (o *jobOptions) encrypted() bool {
+	return len(o.encryptTo) > 0
+}
+
+// encryptedName adds the encryption tool's extension to path, if
+// downloads are encrypted and it doesn't have it yet
+func (o *jobOptions) encryptedName(path string) string {
+	if o.enc.ext == "" || strings.HasSuffix(path, o.enc.ext) {
+		return path
+	}
+	return path + o.enc.ext
+}
+
+// saveThumbnail saves the poster frame of output if --thumbnail was given,
+// warning if it can't
+func (o *jobOptions) saveThumbnail(ctx context.Context, c *http.Client, baseURL, apiKey, id, output string) {
+	if !o.thumbnail || output == "-" {
+		return
+	}
+	if path, err := saveThumbnail(ctx, c, baseURL, apiKey, id, output, o.thumbnailAt); err != nil {
+		infof("Warning: could not save a thumbnail: %v\n", err)
+	} else {
+		infof("Thumbnail saved to: %s\n", path)
+	}
+}
+
+// openOutput plays the saved video if --open was given
+func (o *jobOptions) openOutput(output string) {
+	if o.open && output != "-" {
+		openVideo(output)
+	}
+}
+
+// newJobProgressBar returns the progress bar shown while a job renders
+func newJobProgressBar() *progressbar.ProgressBar {
+	return progressbar.NewOptions(100,
+		progressbar.OptionSetDescription("Generating video"),
+		progressbar.OptionSetWriter(os.Stderr),
+		progressbar.OptionShowBytes(false),
+		progressbar.OptionSetWidth(40),
+		progressbar.OptionThrottle(100*time.Millisecond),
+		progressbar.OptionShowCount(),
+		progressbar.OptionOnCompletion(func() {
+			fmt.Fprint(os.Stderr, "\n")
+		}),
+		progressbar.OptionSpinnerType(14),
+		progressbar.OptionFullWidth(),
+		progressbar.OptionSetRenderBlankState(true),
+	)
+}
+
+// waitForJob polls a job until it completes, fails, or exceeds its queue or
+// render budget. startTime is when the job was submitted.
+func waitForJob(ctx context.Context, c *http.Client, baseURL, apiKey, jobID string, opts jobOptions, startTime time.Time, timings *phaseTimings) (*videoStatusResponse, error) {
+	bar := newJobProgressBar()
+
+	var preview *livePreview
+	if opts.livePreview {
+		preview = newLivePreview(c, baseURL, apiKey, jobID, opts.output)
+	}
+	completed := false
+	defer func() {
+		if preview != nil {
+			preview.finish(completed)
+		}
+	}()
+
+	var lastStage, lastStatus string
+	lastProgress := -1
+	var renderStart time.Time // zero while the job is still queued
+	delay := opts.poll()
+	for {
+		select {
+		case <-ctx.Done():
+			if preview != nil && !renderStart.IsZero() {
+				infof("\nTo stop the render rather than leave it running, delete it: sora-cli delete %s\n", jobID)
+			}
+			return nil, fmt.Errorf("%w before completion (job %s may still finish remotely)", errCanceled, jobID)
+		case <-time.After(delay):
+		}
+
+		if opts.maxWait > 0 && time.Since(startTime) > opts.maxWait {
+			return nil, fmt.Errorf("%w: job %s hadn't finished %s after it was submitted (--max-wait)", errTimedOut, jobID, formatDuration(time.Since(startTime)))
+		}
+		if renderStart.IsZero() {
+			if opts.maxQueueWait > 0 && time.Since(startTime) > opts.maxQueueWait {
+				return nil, fmt.Errorf("%w: job %s was still queued after %s (--max-queue-wait)", errTimedOut, jobID, formatDuration(time.Since(startTime)))
+			}
+		} else if opts.maxRenderTime > 0 && time.Since(renderStart) > opts.maxRenderTime {
+			return nil, fmt.Errorf("%w: job %s was still rendering after %s (--max-render-time)", errTimedOut, jobID, formatDuration(time.Since(renderStart)))
+		}
+
+		st, err := fetchVideoStatus(ctx, c, baseURL, apiKey, jobID)
+		var se *schemaError
+		if errors.As(err, &se) {
+			return nil, err
+		} else if err != nil {
+			if d, ok := pollBackoff(err, delay); ok {
+				delay = d
+				infof("Rate limited while polling; checking again in %s\n", formatDuration(delay))
+			} else {
+				fmt.Fprintf(os.Stderr, "poll error: %v\n", err)
+			}
+			continue
+		}
+		delay = opts.poll()
+		if renderStart.IsZero() && (st.StartedAt > 0 || !isQueuedStatus(st.Status)) {
+			renderStart = time.Now()
+			timings.add("queue wait", renderStart.Sub(startTime))
+		}
+
+		if st.Error != nil && st.Error.Message != "" {
+			return nil, &jobError{detail: *st.Error}
+		}
+
+		// Surface status and provider-reported stage changes in the bar
+		// description and as a status event
+		status, stage := strings.ToLower(st.Status), st.describe()
+		if status != lastStatus || stage != lastStage {
+			emitEvent(jsonEvent{Event: "status", ID: jobID, Status: status, Stage: st.detail(), QueuePosition: st.QueuePosition, Progress: st.Progress})
+			lastStatus = status
+		}
+		if stage != lastStage {
+			bar.Describe(stage)
+			lastStage = stage
+		}
+		if st.Progress != lastProgress {
+			emitProgress("", jobID, lastStatus, st.Progress)
+			lastProgress = st.Progress
+		}
+
+		// Update progress bar
+		if st.Progress > 0 {
+			bar.Set(st.Progress)
+		}
+
+		switch strings.ToLower(st.Status) {
+		case "succeeded", "completed", "complete", "done", "ready":
+			bar.Set(100)
+			bar.Finish()
+			if renderStart.IsZero() {
+				// Finished between polls without ever being seen rendering
+				timings.add("queue wait", time.Since(startTime))
+			} else {
+				timings.add("render", time.Since(renderStart))
+			}
+			completed = true
+			return st, nil
+		default:
+			if err := endedJobError(st); err != nil {
+				return nil, err
+			}
+			// otherwise keep polling
+			if preview != nil && !renderStart.IsZero() {
+				preview.poll(ctx)
+			}
+		}
+	}
+}
+
+// saveJobOutput downloads a finished job to opts.output (or {id}.mp4) and
+// returns the path written. Files the server left untagged are tagged BT.709.
+func saveJobOutput(ctx context.Context, c *http.Client, baseURL, apiKey, jobID string, opts jobOptions, timings *phaseTimings) (string, error) {
+	output := opts.output
+	if output == "" {
+		// Default: save to video_id.mp4. The job already ran, so an existing
+		// file is never a reason to skip here.
+		policy, _ := opts.existingPolicy()
+		if policy == existingSkip {
+			policy = existingSuffix
+		}
+		var err error
+		if output, _, err = resolveOutputPath(opts.encryptedName(filepath.Join(cfg.OutputDir, jobID+".mp4")), policy); err != nil {
+			return "", err
+		}
+	}
+
+	// Construct the content download URL
+	downloadURL := strings.TrimRight(baseURL, "/") + "/videos/" + jobID + "/content"
+
+	dctx, dcancel := ctx, context.CancelFunc(func() {})
+	if opts.downloadTimeout > 0 {
+		dctx, dcancel = context.WithTimeout(ctx, opts.downloadTimeout)
+	}
+	defer dcancel()
+
+	stop := timings.start("download")
+	var err error
+	if opts.encrypted() {
+		err = downloadEncrypted(dctx, c, apiKey, downloadURL, output, opts.enc, opts.encryptTo, opts.quiet)
+	} else {
+		err = downloadFile(dctx, c, apiKey, downloadURL, output, opts.quiet)
+	}
+	stop()
+	if err != nil {
+		if errors.Is(dctx.Err(), context.DeadlineExceeded) {
+			return "", fmt.Errorf("%w: download of %s took longer than %s (--download-timeout)", errTimedOut, jobID, opts.downloadTimeout)
+		}
+		return "", fmt.Errorf("%w: %w", errDownload, err)
+	}
+	if output != "-" && !opts.encrypted() {
+		stop = timings.start("post-processing")
+		err := tagBT709(ctx, output)
+		stop()
+		if err != nil {
+			infof("Warning: could not add color tags to %s: %v\n", output, err)
+		}
+	}
+	return output, nil
+}
+
+// detachJob records a job submitted with --no-wait so `attach` can resume it,
+// and prints its ID to stdout for scripts (with --json, the submitted event
+// already carries it)
+func detachJob(entry videoHistoryEntry) {
+	entry.Pending = true
+	if err := addToHistory(entry); err != nil {
+		infof("Warning: failed to save to history: %v\n", err)
+	}
+	if !jsonOutput {
+		fmt.Println(entry.ID)
+	}
+	infof("Not waiting (--no-wait). Resume with: sora-cli attach %s\n", entry.ID)
+}
+
+// reportJob prints where the video went and how long each phase took
+func reportJob(id, output string, timings *phaseTimings) {
+	if output != "-" {
+		infof("Video saved to: %s\n", output)
+	}
+	infof("Total generation time: %s\n", formatDuration(timings.total()))
+	infof("%s", timings)
+	emitEvent(jsonEvent{Event: "done", ID: id, Output: output, Seconds: timings.total().Seconds(), Timings: timings.seconds()})
+}
+
+// existingPolicy controls what happens when the output path already exists
+type existingPolicy int
+
+const (
+	existingSuffix existingPolicy = iota // write to name-2.mp4, name-3.mp4, ...
+	existingOverwrite
+	existingSkip
+)
+
+// maxOutputSuffix is the highest -N the suffix policy tries before giving up
+const maxOutputSuffix = 1000
+
+// resolveOutputPath applies policy to path. It returns the path to write to
+// and whether the generation should be skipped entirely. A path that can't
+// be checked (e.g. its directory isn't readable) is an error rather than a
+// reason to overwrite it.
+func resolveOutputPath(path string, policy existingPolicy) (string, bool, error) {
+	if exists, err := outputExists(path); err != nil || !exists {
+		return path, false, err
+	}
+	switch policy {
+	case existingOverwrite:
+		return path, false, nil
+	case existingSkip:
+		return path, true, nil
+	}
+
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for i := 2; i <= maxOutputSuffix; i++ {
+		candidate := fmt.Sprintf("%s-%d%s", base, i, ext)
+		exists, err := outputExists(candidate)
+		if err != nil {
+			return "", false, err
+		}
+		if !exists {
+			infof("%s already exists; saving to %s instead\n", path, candidate)
+			return candidate, false, nil
+		}
+	}
+	return "", false, fmt.Errorf("%s and %s-2%s through %s-%d%s all exist", path, base, ext, base, maxOutputSuffix, ext)
+}
+
+// outputExists reports whether something is already at path
+func outputExists(path string) (bool, error) {
+	_, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
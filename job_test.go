@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveOutputPath(t *testing.T) {
+	dir := t.TempDir()
+	touch := func(names ...string) {
+		for _, name := range names {
+			if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	touch("a.mp4", "b.mp4", "b-2.mp4", "b-3.mp4", "plain")
+	full := []string{"c.mp4"}
+	for i := 2; i <= maxOutputSuffix; i++ {
+		full = append(full, fmt.Sprintf("c-%d.mp4", i))
+	}
+	touch(full...)
+
+	tests := []struct {
+		name     string
+		path     string
+		policy   existingPolicy
+		want     string
+		wantSkip bool
+		wantErr  bool
+	}{
+		{"new file", "new.mp4", existingSuffix, "new.mp4", false, false},
+		{"new file, skip", "new.mp4", existingSkip, "new.mp4", false, false},
+		{"suffix", "a.mp4", existingSuffix, "a-2.mp4", false, false},
+		{"suffix past taken ones", "b.mp4", existingSuffix, "b-4.mp4", false, false},
+		{"suffix without extension", "plain", existingSuffix, "plain-2", false, false},
+		{"overwrite", "a.mp4", existingOverwrite, "a.mp4", false, false},
+		{"skip", "a.mp4", existingSkip, "a.mp4", true, false},
+		{"every suffix taken", "c.mp4", existingSuffix, "", false, true},
+		{"every suffix taken, overwrite", "c.mp4", existingOverwrite, "c.mp4", false, false},
+		{"parent is a file", "a.mp4/x.mp4", existingOverwrite, "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, skip, err := resolveOutputPath(filepath.Join(dir, tt.path), tt.policy)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := filepath.Join(dir, tt.want); got != want || skip != tt.wantSkip {
+				t.Errorf("got %q, skip %v; want %q, skip %v", got, skip, want, tt.wantSkip)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// jobTransferFormat identifies files written by export-job
+const jobTransferFormat = "sora-cli-job"
+
+// jobTransfer is the file export-job writes and import-job reads: one
+// history entry, with where it came from
+type jobTransfer struct {
+	Format     string            `json:"format"`
+	Version    int               `json:"version"`
+	ExportedAt string            `json:"exported_at"`
+	ExportedBy string            `json:"exported_by"` // sora-cli build
+	Host       string            `json:"host,omitempty"`
+	Job        videoHistoryEntry `json:"job"`
+}
+
+// runExportJob implements `sora-cli export-job <ref>`: print a job's local
+// record as JSON so import-job can continue it on another machine
+func runExportJob(args []string) {
+	fs := newFlagSet("export-job", "<@last|@N|video_id> [flags]")
+	var out string
+	fs.StringVarP(&out, "output", "o", "", "Write to this file instead of stdout")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	id, err := resolveVideoRef(fs.Arg(0))
+	if err != nil {
+		fail("", "failed to resolve video reference", err)
+	}
+	e := findHistoryEntry(id)
+	if e == nil {
+		fmt.Fprintf(os.Stderr, "%s is not in history\n", id)
+		os.Exit(1)
+	}
+	if strings.HasPrefix(id, importedIDPrefix) {
+		fmt.Fprintf(os.Stderr, "Error: %s was added with 'history add' and has no job on the API account to continue\n", id)
+		os.Exit(1)
+	}
+
+	t := jobTransfer{
+		Format:     jobTransferFormat,
+		Version:    1,
+		ExportedAt: time.Now().UTC().Format(time.RFC3339),
+		ExportedBy: currentBuild().tag(),
+		Job:        *e,
+	}
+	t.Host, _ = os.Hostname()
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		fail(id, "export error", err)
+	}
+	data = append(data, '\n')
+
+	if out == "" || out == "-" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := os.WriteFile(out, data, 0o644); err != nil {
+		fail(id, "export error", err)
+	}
+	infof("Exported %s to %s\n", id, out)
+}
+
+// runImportJob implements `sora-cli import-job <file>`: add a job exported
+// on another machine to local history, ready for attach or download
+func runImportJob(args []string) {
+	fs := newFlagSet("import-job", "<job.json | -> [flags]")
+	var (
+		output  string
+		replace bool
+	)
+	fs.StringVarP(&output, "output", "o", "", "Where attach should save the video (default: the original path if its directory exists here, else its file name)")
+	fs.BoolVar(&replace, "replace", false, "Replace the local record if the job is already in history")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	t, err := readJobTransfer(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	e := t.Job
+
+	// The exporting machine's paths rarely exist here
+	switch {
+	case output != "":
+		e.OutputFile = output
+	case e.OutputFile != "" && e.OutputFile != "-":
+		if _, err := os.Stat(filepath.Dir(e.OutputFile)); err != nil {
+			e.OutputFile = filepath.Base(e.OutputFile)
+		}
+	}
+
+	var exists bool
+	err = editHistory(func(h *history) bool {
+		for i := range h.Videos {
+			if h.Videos[i].ID == e.ID {
+				exists = true
+				if replace {
+					h.Videos[i] = e
+				}
+				return replace
+			}
+		}
+		h.Videos = append([]videoHistoryEntry{e}, h.Videos...)
+		return true
+	})
+	if err != nil {
+		fail(e.ID, "failed to update history", err)
+	}
+	if exists && !replace {
+		fmt.Fprintf(os.Stderr, "%s is already in history; pass --replace to overwrite it\n", e.ID)
+		os.Exit(1)
+	}
+
+	if jsonOutput {
+		printJSON(map[string]any{"id": e.ID, "pending": e.Pending, "output_file": e.OutputFile, "replaced": exists})
+	} else {
+		fmt.Println(e.ID)
+	}
+	from := t.Host
+	if from == "" {
+		from = "another machine"
+	}
+	infof("Imported %s from %s\n", e.ID, from)
+	if e.Pending {
+		infof("Continue with: sora-cli attach %s\n", e.ID)
+	} else if status, _ := entryStatus(e); status != "saved" && e.OutputFile != "-" {
+		infof("Fetch the video with: sora-cli download %s\n", e.ID)
+	}
+}
+
+// readJobTransfer reads and checks a file written by export-job; "-" is stdin
+func readJobTransfer(path string) (*jobTransfer, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+		path = "stdin"
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var t jobTransfer
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("%s is not a job exported by 'sora-cli export-job': %w", path, err)
+	}
+	switch {
+	case t.Format != jobTransferFormat:
+		return nil, fmt.Errorf("%s is not a job exported by 'sora-cli export-job'", path)
+	case t.Version != 1:
+		return nil, fmt.Errorf("%s uses version %d of the job format; this sora-cli reads version 1", path, t.Version)
+	case t.Job.ID == "" || strings.HasPrefix(t.Job.ID, importedIDPrefix):
+		return nil, fmt.Errorf("%s has no job ID", path)
+	}
+	return &t, nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jsonOutput is set by --json. Stdout then carries only JSON: commands that
+// run jobs emit one event object per line, and commands that show data print
+// a single JSON document. Everything meant for people stays on stderr.
+var jsonOutput bool
+
+// jsonEvent is one line of --json output from a command that runs jobs
+type jsonEvent struct {
+	Event     string `json:"event"` // submitted, status, progress, preview, done, deleted, or error
+	Time      string `json:"time"`
+	Label     string `json:"label,omitempty"` // batch line or --explore variation
+	ID        string `json:"id,omitempty"`
+	RequestID string `json:"request_id,omitempty"` // of the submitting request
+	Status    string `json:"status,omitempty"`
+	Stage     string `json:"stage,omitempty"` // provider-reported stage or detail, if any
+	// QueuePosition is the job's place in the provider's queue, if reported
+	QueuePosition int                `json:"queue_position,omitempty"`
+	Progress      int                `json:"progress,omitempty"`
+	Output        string             `json:"output,omitempty"`
+	Variation     string             `json:"variation,omitempty"`
+	Seconds       float64            `json:"total_seconds,omitempty"`
+	Timings       map[string]float64 `json:"timings,omitempty"` // seconds per phase
+	Error         *jsonError         `json:"error,omitempty"`
+}
+
+// jsonError describes a failure; API errors keep the server's details
+type jsonError struct {
+	Message    string `json:"message"`
+	ExitCode   int    `json:"exit_code"` // the failure class; see exitcodes.go
+	HTTPStatus int    `json:"http_status,omitempty"`
+	RequestID  string `json:"request_id,omitempty"`
+	Type       string `json:"type,omitempty"`
+	Code       string `json:"code,omitempty"`
+}
+
+func newJSONError(err error) *jsonError {
+	je := &jsonError{Message: err.Error(), ExitCode: exitCode(err)}
+	var jobErr *jobError
+	if errors.As(err, &jobErr) {
+		je.Type, je.Code = jobErr.detail.Type, jobErr.detail.Code
+	}
+	var se *statusError
+	if errors.As(err, &se) {
+		je.HTTPStatus, je.RequestID = se.StatusCode, se.RequestID
+		je.Type, je.Code = se.detail.Type, se.detail.Code
+		if se.detail.Message != "" {
+			je.Message = se.detail.Message
+		}
+	}
+	return je
+}
+
+// jsonMu keeps lines from concurrent batch jobs from interleaving
+var jsonMu sync.Mutex
+
+// progressFifo is set by --progress-fifo: a named pipe (or file) that gets
+// a copy of every event, plus a progress event each time a job's
+// percentage changes, so a GUI wrapper can follow jobs without parsing
+// stderr. It is opened at the first event.
+var (
+	progressFifo     string
+	progressOut      *os.File
+	progressDisabled bool // opening or writing failed; warned once
+)
+
+// emitEvent writes e to stdout when --json is set, and to --progress-fifo
+func emitEvent(e jsonEvent) {
+	if !jsonOutput && progressFifo == "" {
+		return
+	}
+	e.Time = time.Now().UTC().Format(time.RFC3339)
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	b = append(b, '\n')
+	jsonMu.Lock()
+	defer jsonMu.Unlock()
+	if jsonOutput {
+		os.Stdout.Write(b)
+	}
+	writeProgressFifo(b)
+}
+
+// emitProgress writes a progress event to --progress-fifo only; stdout gets
+// status events when the status changes, not every percent
+func emitProgress(label, id, status string, progress int) {
+	if progressFifo == "" {
+		return
+	}
+	e := jsonEvent{Event: "progress", Time: time.Now().UTC().Format(time.RFC3339), Label: label, ID: id, Status: status, Progress: progress}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	jsonMu.Lock()
+	defer jsonMu.Unlock()
+	writeProgressFifo(append(b, '\n'))
+}
+
+// writeProgressFifo writes one event line to --progress-fifo, opening it
+// first if needed. Once it fails, a warning is printed and the pipe is left
+// alone, so a wrapper that stops reading doesn't stop the job. The caller
+// holds jsonMu.
+func writeProgressFifo(line []byte) {
+	if progressFifo == "" || progressDisabled {
+		return
+	}
+	if progressOut == nil {
+		f, err := openProgressFifo(progressFifo)
+		if err != nil {
+			progressDisabled = true
+			infof("Warning: --progress-fifo: %v; progress events are not being written\n", err)
+			return
+		}
+		progressOut = f
+	}
+	if _, err := progressOut.Write(line); err != nil {
+		progressDisabled = true
+		progressOut.Close()
+		infof("Warning: --progress-fifo: %v; progress events are no longer being written\n", err)
+	}
+}
+
+// openProgressFifo opens path for writing events. An existing named pipe
+// (from mkfifo, or \\.\pipe\name on Windows) is opened as is, which waits
+// until something reads it; a regular file is appended to, and a missing
+// one is created.
+func openProgressFifo(path string) (*os.File, error) {
+	fi, err := os.Stat(path)
+	switch {
+	case err == nil && fi.Mode().IsRegular():
+		return os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	case err == nil || strings.HasPrefix(path, `\\.\pipe\`):
+		return os.OpenFile(path, os.O_WRONLY, 0)
+	case errors.Is(err, fs.ErrNotExist):
+		return os.Create(path)
+	}
+	return nil, err
+}
+
+// printJSON writes v to stdout as an indented JSON document
+func printJSON(v any) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "encoding JSON: %v\n", err)
+		os.Exit(1)
+	}
+	os.Stdout.Write(append(b, '\n'))
+}
+
+// fail prints "prefix: err" to stderr, emits it as an error event with
+// --json, and exits with the code for err's failure class. id is the job
+// the error belongs to, if any.
+func fail(id, prefix string, err error) {
+	fmt.Fprintf(os.Stderr, "%s: %v\n", prefix, err)
+	emitEvent(jsonEvent{Event: "error", ID: id, Error: newJSONError(err)})
+	notifier.failed(id, err)
+	os.Exit(exitCode(err))
+}
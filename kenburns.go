@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// kenBurnsSupersample is how much frames are enlarged before zoompan, which
+// only moves in whole pixels and visibly jitters at the source resolution
+const kenBurnsSupersample = 4
+
+// kenBurnsKey is one --kenburns keyframe: at time t (seconds into the
+// original clip) the view is zoomed by zoom and centered on x,y, given as
+// fractions of the frame
+type kenBurnsKey struct {
+	t, zoom, x, y float64
+}
+
+// parseKenBurns parses space-separated keyframes of the form
+// SECONDS:ZOOM[,X,Y], e.g. "0:1 8:1.3,0.7,0.4". The center defaults to the
+// middle of the frame.
+func parseKenBurns(s string) ([]kenBurnsKey, error) {
+	var keys []kenBurnsKey
+	for _, field := range strings.Fields(s) {
+		ts, rest, ok := strings.Cut(field, ":")
+		if !ok {
+			return nil, fmt.Errorf("keyframe %q: expected SECONDS:ZOOM[,X,Y]", field)
+		}
+		k := kenBurnsKey{x: 0.5, y: 0.5}
+		var err error
+		if k.t, err = strconv.ParseFloat(ts, 64); err != nil || k.t < 0 {
+			return nil, fmt.Errorf("keyframe %q: invalid time %q", field, ts)
+		}
+		parts := strings.Split(rest, ",")
+		if len(parts) != 1 && len(parts) != 3 {
+			return nil, fmt.Errorf("keyframe %q: expected ZOOM or ZOOM,X,Y after the time", field)
+		}
+		vals := make([]float64, len(parts))
+		for i, p := range parts {
+			if vals[i], err = strconv.ParseFloat(p, 64); err != nil {
+				return nil, fmt.Errorf("keyframe %q: invalid number %q", field, p)
+			}
+		}
+		k.zoom = vals[0]
+		if k.zoom < 1 || k.zoom > 10 {
+			return nil, fmt.Errorf("keyframe %q: zoom must be between 1 (full frame) and 10", field)
+		}
+		if len(vals) == 3 {
+			k.x, k.y = vals[1], vals[2]
+			if k.x < 0 || k.x > 1 || k.y < 0 || k.y > 1 {
+				return nil, fmt.Errorf("keyframe %q: X and Y must be between 0 and 1", field)
+			}
+		}
+		if len(keys) > 0 && k.t <= keys[len(keys)-1].t {
+			return nil, fmt.Errorf("keyframe %q: times must increase", field)
+		}
+		keys = append(keys, k)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no keyframes given")
+	}
+	return keys, nil
+}
+
+// kenBurnsExpr builds an ffmpeg expression that interpolates one keyframe
+// value linearly over the input time "it", holding the first and last
+// values outside the keyframed range
+func kenBurnsExpr(keys []kenBurnsKey, value func(kenBurnsKey) float64) string {
+	num := func(f float64) string { return strconv.FormatFloat(f, 'f', -1, 64) }
+	expr := num(value(keys[len(keys)-1]))
+	for i := len(keys) - 2; i >= 0; i-- {
+		a, b := keys[i], keys[i+1]
+		seg := fmt.Sprintf("%s+(%s)*(it-%s)/%s", num(value(a)), num(value(b)-value(a)), num(a.t), num(b.t-a.t))
+		expr = fmt.Sprintf("if(lt(it,%s),%s,%s)", num(b.t), seg, expr)
+	}
+	return fmt.Sprintf("if(lt(it,%s),%s,%s)", num(keys[0].t), num(value(keys[0])), expr)
+}
+
+// addKenBurns appends the zoom/pan filters for keys to b. The output keeps
+// the input's size and frame rate.
+func addKenBurns(b *ffmpegBuilder, keys []kenBurnsKey, width, height int, fps float64) {
+	zoom := kenBurnsExpr(keys, func(k kenBurnsKey) float64 { return k.zoom })
+	cx := kenBurnsExpr(keys, func(k kenBurnsKey) float64 { return k.x })
+	cy := kenBurnsExpr(keys, func(k kenBurnsKey) float64 { return k.y })
+
+	b.Filter(newFilter("scale").Int("w", width*kenBurnsSupersample).Int("h", height*kenBurnsSupersample))
+	b.Filter(newFilter("zoompan").
+		String("z", zoom).
+		// Center the view on (cx, cy) but never past the frame's edges
+		String("x", fmt.Sprintf("max(0,min(iw-iw/zoom,(%s)*iw-iw/zoom/2))", cx)).
+		String("y", fmt.Sprintf("max(0,min(ih-ih/zoom,(%s)*ih-ih/zoom/2))", cy)).
+		Int("d", 1).
+		String("s", fmt.Sprintf("%dx%d", width, height)).
+		Float("fps", fps))
+}
@@ -0,0 +1,508 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/rivo/uniseg"
+	"golang.org/x/term"
+)
+
+// errInterrupted is returned by readLine when the user presses Ctrl-C
+var errInterrupted = errors.New("interrupted")
+
+// maxPromptHistory caps the number of remembered interactive prompts
+const maxPromptHistory = 500
+
+// lineEditor is a minimal readline: cursor movement, up/down history recall,
+// and Ctrl-R reverse search. Lines that wrap past the terminal width are
+// redrawn across rows (the approach linenoise uses for multi-line mode).
+type lineEditor struct {
+	in      *os.File
+	out     *os.File
+	rd      *bufio.Reader
+	history []string // oldest first
+
+	// mu guards the rendering state, so printAbove can be called while a
+	// line is being edited
+	mu     sync.Mutex
+	active bool // editLine is drawing a line
+
+	// rendering state
+	prompt  []rune
+	buf     []rune
+	pos     int
+	oldRow  int // row the cursor was left on, counting from the first
+	maxRows int
+}
+
+func newLineEditor(history []string) *lineEditor {
+	return &lineEditor{in: os.Stdin, out: os.Stderr, rd: bufio.NewReader(os.Stdin), history: history}
+}
+
+// readLine reads one line. When stdin isn't a terminal it falls back to a
+// plain buffered read so piped input keeps working.
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	return e.editLine(prompt, "")
+}
+
+// editLine is readLine with the buffer prefilled with initial. Without a
+// terminal an empty answer keeps initial.
+func (e *lineEditor) editLine(prompt, initial string) (string, error) {
+	fd := int(e.in.Fd())
+	if !term.IsTerminal(fd) {
+		fmt.Fprint(e.out, prompt)
+		s, err := e.rd.ReadString('\n')
+		if err != nil && !(errors.Is(err, io.EOF) && s != "") {
+			return "", err
+		}
+		if s = strings.TrimRight(s, "\r\n"); s == "" {
+			return initial, nil
+		}
+		return s, nil
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return "", err
+	}
+	defer term.Restore(fd, state)
+
+	e.mu.Lock()
+	e.prompt = []rune(prompt)
+	e.buf = []rune(initial)
+	e.pos, e.oldRow, e.maxRows = len(e.buf), 0, 0
+	e.refresh()
+	e.active = true
+	e.mu.Unlock()
+	defer func() {
+		e.mu.Lock()
+		e.active = false
+		e.mu.Unlock()
+	}()
+
+	histIdx := len(e.history)
+	var pending []rune // the unsubmitted line while browsing history
+
+	for {
+		r, _, err := e.rd.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		e.mu.Lock()
+		line, done, err := e.key(r, &histIdx, &pending)
+		if !done {
+			e.refresh()
+		}
+		e.mu.Unlock()
+		if done {
+			return line, err
+		}
+	}
+}
+
+// key applies one key press to the line. It reports done when the line is
+// finished, with the line or the error that ended it.
+func (e *lineEditor) key(r rune, histIdx *int, pending *[]rune) (string, bool, error) {
+	switch r {
+	case '\r', '\n':
+		fmt.Fprint(e.out, "\r\n")
+		return string(e.buf), true, nil
+	case 3: // Ctrl-C
+		fmt.Fprint(e.out, "^C\r\n")
+		return "", true, errInterrupted
+	case 4: // Ctrl-D
+		if len(e.buf) == 0 {
+			fmt.Fprint(e.out, "\r\n")
+			return "", true, io.EOF
+		}
+		e.deleteAt(e.pos)
+	case 127, 8: // Backspace
+		if e.pos > 0 {
+			e.pos--
+			e.deleteAt(e.pos)
+		}
+	case 1: // Ctrl-A
+		e.pos = 0
+	case 5: // Ctrl-E
+		e.pos = len(e.buf)
+	case 2: // Ctrl-B
+		if e.pos > 0 {
+			e.pos--
+		}
+	case 6: // Ctrl-F
+		if e.pos < len(e.buf) {
+			e.pos++
+		}
+	case 11: // Ctrl-K
+		e.buf = e.buf[:e.pos]
+	case 21: // Ctrl-U
+		e.buf = append([]rune{}, e.buf[e.pos:]...)
+		e.pos = 0
+	case 23: // Ctrl-W
+		start := e.pos
+		for start > 0 && unicode.IsSpace(e.buf[start-1]) {
+			start--
+		}
+		for start > 0 && !unicode.IsSpace(e.buf[start-1]) {
+			start--
+		}
+		e.buf = append(e.buf[:start], e.buf[e.pos:]...)
+		e.pos = start
+	case 16, 14: // Ctrl-P, Ctrl-N
+		*histIdx, *pending = e.recall(*histIdx, *pending, r == 16)
+	case 18: // Ctrl-R
+		done, err := e.reverseSearch(e.rd)
+		if err != nil {
+			return "", true, err
+		}
+		if done {
+			fmt.Fprint(e.out, "\r\n")
+			return string(e.buf), true, nil
+		}
+	case 27: // escape sequence
+		seq := readEscape(e.rd)
+		switch seq {
+		case "[A", "OA":
+			*histIdx, *pending = e.recall(*histIdx, *pending, true)
+		case "[B", "OB":
+			*histIdx, *pending = e.recall(*histIdx, *pending, false)
+		case "[C", "OC":
+			if e.pos < len(e.buf) {
+				e.pos++
+			}
+		case "[D", "OD":
+			if e.pos > 0 {
+				e.pos--
+			}
+		case "[H", "OH", "[1~", "[7~":
+			e.pos = 0
+		case "[F", "OF", "[4~", "[8~":
+			e.pos = len(e.buf)
+		case "[3~":
+			e.deleteAt(e.pos)
+		}
+	default:
+		if unicode.IsPrint(r) {
+			e.buf = append(e.buf[:e.pos], append([]rune{r}, e.buf[e.pos:]...)...)
+			e.pos++
+		}
+	}
+	return "", false, nil
+}
+
+// readEscape reads the remainder of an ANSI escape sequence after ESC
+func readEscape(rd *bufio.Reader) string {
+	var seq []rune
+	for len(seq) < 8 {
+		r, _, err := rd.ReadRune()
+		if err != nil {
+			break
+		}
+		seq = append(seq, r)
+		// A sequence ends at its first letter or '~' after the introducer
+		if len(seq) > 1 && (unicode.IsLetter(r) || r == '~') {
+			break
+		}
+		if len(seq) == 1 && r != '[' && r != 'O' {
+			break
+		}
+	}
+	return string(seq)
+}
+
+func (e *lineEditor) deleteAt(i int) {
+	if i < len(e.buf) {
+		e.buf = append(e.buf[:i], e.buf[i+1:]...)
+	}
+}
+
+// recall moves through history. idx == len(history) is the line being typed,
+// which is stashed in pending so it can be restored.
+func (e *lineEditor) recall(idx int, pending []rune, older bool) (int, []rune) {
+	if idx == len(e.history) {
+		pending = append([]rune{}, e.buf...)
+	}
+	if older && idx > 0 {
+		idx--
+	} else if !older && idx < len(e.history) {
+		idx++
+	} else {
+		return idx, pending
+	}
+	if idx == len(e.history) {
+		e.buf = append([]rune{}, pending...)
+	} else {
+		e.buf = []rune(singleLine(e.history[idx]))
+	}
+	e.pos = len(e.buf)
+	return idx, pending
+}
+
+// reverseSearch implements Ctrl-R incremental search. It returns true if the
+// user pressed Enter to submit the found line.
+func (e *lineEditor) reverseSearch(rd *bufio.Reader) (bool, error) {
+	origPrompt, origBuf, origPos := e.prompt, append([]rune{}, e.buf...), e.pos
+	var query []rune
+	match := len(e.history)
+
+	find := func(from int) int {
+		q := strings.ToLower(string(query))
+		for i := from; i >= 0; i-- {
+			if strings.Contains(strings.ToLower(e.history[i]), q) {
+				return i
+			}
+		}
+		return -1
+	}
+	show := func(failed bool) {
+		label := "reverse-i-search"
+		if failed {
+			label = "failing reverse-i-search"
+		}
+		e.prompt = []rune(fmt.Sprintf("(%s)`%s': ", label, string(query)))
+		if match < len(e.history) {
+			e.buf = []rune(singleLine(e.history[match]))
+		} else {
+			e.buf = nil
+		}
+		e.pos = len(e.buf)
+		e.refresh()
+	}
+	finish := func() {
+		e.prompt = origPrompt
+		e.refresh()
+	}
+
+	show(false)
+	for {
+		r, _, err := rd.ReadRune()
+		if err != nil {
+			return false, err
+		}
+		switch r {
+		case '\r', '\n':
+			finish()
+			return true, nil
+		case 3, 7: // Ctrl-C, Ctrl-G: abandon the search
+			e.buf, e.pos = origBuf, origPos
+			finish()
+			return false, nil
+		case 18: // Ctrl-R again: next older match
+			if match > 0 {
+				if i := find(match - 1); i >= 0 {
+					match = i
+					show(false)
+					continue
+				}
+			}
+			show(true)
+		case 127, 8:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				if i := find(len(e.history) - 1); i >= 0 {
+					match = i
+				}
+				show(false)
+			}
+		case 27:
+			// Any movement key accepts the match for editing
+			readEscape(rd)
+			finish()
+			return false, nil
+		default:
+			if !unicode.IsPrint(r) {
+				finish()
+				return false, nil
+			}
+			query = append(query, r)
+			start := match
+			if start >= len(e.history) {
+				start = len(e.history) - 1
+			}
+			if i := find(start); i >= 0 {
+				match = i
+				show(false)
+			} else {
+				show(true)
+			}
+		}
+	}
+}
+
+// refresh redraws the prompt and buffer, handling lines that wrap
+func (e *lineEditor) refresh() {
+	cols := terminalWidth(e.out)
+	if cols <= 0 {
+		cols = 80
+	}
+	line := string(e.prompt) + string(e.buf)
+	var sb strings.Builder
+
+	endRow, endCol := layout(line, cols)
+	rows := endRow
+	if endCol > 0 {
+		rows++
+	}
+	e.clearRows(&sb)
+	if rows > e.maxRows {
+		e.maxRows = rows
+	}
+
+	sb.WriteString(line)
+
+	// At the right edge with the cursor at the end, force the wrap now
+	if e.pos > 0 && e.pos == len(e.buf) && endCol == 0 {
+		sb.WriteString("\n\r")
+		rows++
+		if rows > e.maxRows {
+			e.maxRows = rows
+		}
+	}
+
+	// Move the cursor to its row and column
+	row, col := layout(string(e.prompt)+string(e.buf[:e.pos]), cols)
+	if rows-(row+1) > 0 {
+		fmt.Fprintf(&sb, "\x1b[%dA", rows-(row+1))
+	}
+	if col > 0 {
+		fmt.Fprintf(&sb, "\r\x1b[%dC", col)
+	} else {
+		sb.WriteString("\r")
+	}
+	e.oldRow = row
+
+	fmt.Fprint(e.out, sb.String())
+}
+
+// layout returns the row and column, counting from 0, where the terminal
+// leaves the cursor after drawing s from the start of a row cols cells
+// wide. Wide characters such as CJK and emoji take two cells, combining
+// marks none, and a wide character that doesn't fit at the end of a row
+// moves to the next one whole. A row filled exactly ends at the start of
+// the next.
+func layout(s string, cols int) (row, col int) {
+	g := uniseg.NewGraphemes(s)
+	for g.Next() {
+		w := g.Width()
+		if col+w > cols {
+			row, col = row+1, 0
+		}
+		col += w
+	}
+	if col >= cols {
+		row, col = row+1, 0
+	}
+	return row, col
+}
+
+// clearRows writes the escapes that erase the line as last drawn, leaving
+// the cursor at the start of its first row
+func (e *lineEditor) clearRows(sb *strings.Builder) {
+	rpos := e.oldRow + 1
+
+	// Go to the last row, then clear every row moving up
+	if e.maxRows-rpos > 0 {
+		fmt.Fprintf(sb, "\x1b[%dB", e.maxRows-rpos)
+	}
+	for j := 0; j < e.maxRows-1; j++ {
+		sb.WriteString("\r\x1b[0K\x1b[1A")
+	}
+	sb.WriteString("\r\x1b[0K")
+}
+
+// printAbove writes msg, which may come from another goroutine, above the
+// line being edited and then redraws the line. When no line is being
+// edited it just writes msg.
+func (e *lineEditor) printAbove(msg string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.active {
+		fmt.Fprint(e.out, msg)
+		return
+	}
+	var sb strings.Builder
+	e.clearRows(&sb)
+	// The terminal is in raw mode, so newlines don't return the carriage
+	sb.WriteString(strings.ReplaceAll(strings.TrimRight(msg, "\n"), "\n", "\r\n"))
+	sb.WriteString("\r\n")
+	fmt.Fprint(e.out, sb.String())
+	e.oldRow, e.maxRows = 0, 0
+	e.refresh()
+}
+
+// getPromptHistoryPath returns the path of the interactive prompt history
+func getPromptHistoryPath() (string, error) {
+	dir, err := soraDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "prompts.json"), nil
+}
+
+// loadPromptHistory returns previously entered interactive prompts, oldest first
+func loadPromptHistory() ([]string, error) {
+	path, err := getPromptHistoryPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading prompt history: %w", err)
+	}
+	var prompts []string
+	if err := json.Unmarshal(data, &prompts); err != nil {
+		return nil, fmt.Errorf("parsing prompt history: %w", err)
+	}
+	return prompts, nil
+}
+
+// addPromptHistory appends a prompt, dropping an identical earlier copy so
+// recall doesn't cycle through duplicates
+func addPromptHistory(prompt string) error {
+	prompt = strings.TrimSpace(prompt)
+	if prompt == "" {
+		return nil
+	}
+	prompts, err := loadPromptHistory()
+	if err != nil {
+		return err
+	}
+	kept := prompts[:0]
+	for _, p := range prompts {
+		if p != prompt {
+			kept = append(kept, p)
+		}
+	}
+	kept = append(kept, prompt)
+	if len(kept) > maxPromptHistory {
+		kept = kept[len(kept)-maxPromptHistory:]
+	}
+
+	path, err := getPromptHistoryPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("creating history directory: %w", err)
+	}
+	data, err := json.MarshalIndent(kept, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding prompt history: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("writing prompt history: %w", err)
+	}
+	return nil
+}
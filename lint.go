@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Default word limits for lint-prompt; [lint] in the config overrides them
+const (
+	defaultLintMinWords = 6
+	defaultLintMaxWords = 300
+)
+
+// lintConfig is the [lint] config section
+type lintConfig struct {
+	MinWords int      `toml:"min_words"`
+	MaxWords int      `toml:"max_words"`
+	Disable  []string `toml:"disable"` // check names to skip
+}
+
+// lintChecks are the names of the checks, for [lint] disable
+var lintChecks = []string{"too-short", "too-long", "camera-conflict", "missing-subject"}
+
+// validate rejects unknown check names and impossible limits
+func (l *lintConfig) validate() error {
+	for _, name := range l.Disable {
+		if !slices.Contains(lintChecks, name) {
+			return fmt.Errorf("unknown check %q in disable (checks: %s)", name, strings.Join(lintChecks, ", "))
+		}
+	}
+	if l.MinWords < 0 || l.MaxWords < 0 {
+		return fmt.Errorf("min_words and max_words cannot be negative")
+	}
+	if l.MaxWords > 0 && l.MinWords > l.MaxWords {
+		return fmt.Errorf("min_words (%d) is more than max_words (%d)", l.MinWords, l.MaxWords)
+	}
+	return nil
+}
+
+// lintFinding is one problem found in a prompt
+type lintFinding struct {
+	Line       int    `json:"line,omitempty"` // manifest line, for batch prompts
+	Check      string `json:"check"`
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion"`
+}
+
+// cameraConflicts are camera directions that can't all be followed in one
+// shot. Each entry is two groups of phrases; a prompt using phrases from
+// both groups is flagged.
+var cameraConflicts = []struct {
+	a, b string
+	fix  string
+}{
+	{`close-?ups?|extreme close|macro`, `wide shots?|wide angle|establishing shot|aerial|drone shot`,
+		`say how the framing changes, e.g. "starts wide, then slowly pushes in to a close-up"`},
+	{`static (?:camera|shot)|locked[- ]off|tripod|still camera`, `panning|pans? (?:left|right|across)|tracking shot|dolly|handheld|crane shot|orbit(?:s|ing)?`,
+		"pick a still camera or a moving one; a shot can't be both"},
+	{`zoom(?:s|ing)? in|push(?:es|ing)? in`, `zoom(?:s|ing)? out|pull(?:s|ing)? (?:back|out)`,
+		"keep one camera move per shot, or split it into two prompts"},
+	{`pan(?:s|ning)? left`, `pan(?:s|ning)? right`,
+		"keep one pan direction per shot"},
+	{`slow[- ]motion|slow-mo`, `time-?lapse|fast[- ]motion|sped up`,
+		"pick one playback speed; slow motion and time-lapse cancel out"},
+	{`low[- ]angle`, `high[- ]angle|bird'?s[- ]eye|top[- ]down`,
+		"pick one camera height"},
+}
+
+// cameraConflictRes are cameraConflicts compiled to whole-phrase patterns
+var cameraConflictRes = func() [][2]*regexp.Regexp {
+	res := make([][2]*regexp.Regexp, len(cameraConflicts))
+	for i, c := range cameraConflicts {
+		for j, p := range []string{c.a, c.b} {
+			res[i][j] = regexp.MustCompile(`(?i)\b(?:` + p + `)\b`)
+		}
+	}
+	return res
+}()
+
+// styleWords describe how a shot looks rather than what is in it. A prompt
+// made only of these (and filler) has no subject.
+var styleWords = wordSet(`a an the and or of in on at with to for by from into its it is are
+	shot shots camera angle angles lens view close-up closeup close up wide medium long extreme
+	aerial drone pan panning tracking dolly zoom zooming handheld static slow motion time-lapse timelapse
+	cinematic cinematography film filmic footage video scene style styled look looking aesthetic
+	4k 8k hd uhd hdr 35mm 50mm 24fps 60fps anamorphic bokeh depth field shallow focus sharp detailed
+	ultra hyper hyperrealistic realistic photorealistic high quality best masterpiece beautiful stunning epic
+	dramatic moody soft hard warm cool vibrant muted lighting light lit golden hour blue backlit rim
+	color graded grading grade tone tones palette grain noir vintage retro modern minimal`)
+
+// wordSet splits s into a set of words
+func wordSet(s string) map[string]bool {
+	m := make(map[string]bool)
+	for _, w := range strings.Fields(s) {
+		m[w] = true
+	}
+	return m
+}
+
+// lintWordRe splits prompts into words for counting and the subject check
+var lintWordRe = regexp.MustCompile(`[\pL\pN'-]+`)
+
+// lintPrompt runs the enabled checks on prompt
+func lintPrompt(prompt string, lc lintConfig) []lintFinding {
+	enabled := func(check string) bool { return !slices.Contains(lc.Disable, check) }
+	minWords := lc.MinWords
+	if minWords == 0 {
+		minWords = defaultLintMinWords
+	}
+	maxWords := lc.MaxWords
+	if maxWords == 0 {
+		maxWords = defaultLintMaxWords
+	}
+
+	var findings []lintFinding
+	words := lintWordRe.FindAllString(strings.ToLower(prompt), -1)
+	if enabled("too-short") && len(words) < minWords {
+		findings = append(findings, lintFinding{
+			Check:      "too-short",
+			Message:    fmt.Sprintf("only %d words (fewer than %d)", len(words), minWords),
+			Suggestion: "describe the subject, what it does, the setting, and the look, e.g. \"a red fox trotting through fresh snow at dawn, low sun, handheld\"",
+		})
+	}
+	if enabled("too-long") && len(words) > maxWords {
+		findings = append(findings, lintFinding{
+			Check:      "too-long",
+			Message:    fmt.Sprintf("%d words (more than %d)", len(words), maxWords),
+			Suggestion: "keep one shot per prompt; details past the first few sentences are often ignored",
+		})
+	}
+	if enabled("camera-conflict") {
+		for i, re := range cameraConflictRes {
+			a, b := re[0].FindString(prompt), re[1].FindString(prompt)
+			if a == "" || b == "" {
+				continue
+			}
+			findings = append(findings, lintFinding{
+				Check:      "camera-conflict",
+				Message:    fmt.Sprintf("conflicting camera directions %q and %q", a, b),
+				Suggestion: cameraConflicts[i].fix,
+			})
+		}
+	}
+	if enabled("missing-subject") && len(words) > 0 {
+		subject := false
+		for _, w := range words {
+			if !styleWords[w] {
+				subject = true
+				break
+			}
+		}
+		if !subject {
+			findings = append(findings, lintFinding{
+				Check:      "missing-subject",
+				Message:    "only describes the camera and style, not what is in the shot",
+				Suggestion: "say who or what the video shows and what happens, then add the style",
+			})
+		}
+	}
+	return findings
+}
+
+// runLintPrompt implements `sora-cli lint-prompt`: check prompts before
+// paying to render them
+func runLintPrompt(args []string) {
+	fs := newFlagSet("lint-prompt", "[<prompt> | - | --manifest <file>] [flags]")
+	var manifest string
+	fs.StringVar(&manifest, "manifest", "", "Check every prompt in a batch manifest (JSONL or CSV)")
+	fs.Parse(args)
+
+	var findings []lintFinding
+	switch {
+	case manifest != "" && fs.NArg() == 0:
+		rows, err := readBatchManifest(manifest)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(2)
+		}
+		findings = lintRows(rows)
+	case manifest == "" && fs.NArg() > 0:
+		prompt := strings.Join(fs.Args(), " ")
+		if prompt == "-" {
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				fail("", "reading prompt", err)
+			}
+			prompt = string(data)
+		}
+		findings = lintPrompt(prompt, cfg.Lint)
+	default:
+		fmt.Fprintln(os.Stderr, "Error: give a prompt, - to read one from stdin, or --manifest")
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if jsonOutput {
+		if findings == nil {
+			findings = []lintFinding{}
+		}
+		printJSON(findings)
+	} else {
+		printFindings(os.Stdout, findings)
+	}
+	if len(findings) > 0 {
+		os.Exit(1)
+	}
+}
+
+// lintRows checks the prompt of every manifest row
+func lintRows(rows []numberedRow) []lintFinding {
+	var findings []lintFinding
+	for _, r := range rows {
+		for _, f := range lintPrompt(r.row.Prompt, cfg.Lint) {
+			f.Line = r.line
+			findings = append(findings, f)
+		}
+	}
+	return findings
+}
+
+// printFindings writes one finding per line, with its suggestion below
+func printFindings(w io.Writer, findings []lintFinding) {
+	if len(findings) == 0 {
+		fmt.Fprintln(w, "No problems found")
+		return
+	}
+	for _, f := range findings {
+		where := ""
+		if f.Line > 0 {
+			where = fmt.Sprintf("line %d: ", f.Line)
+		}
+		fmt.Fprintf(w, "%s%s: %s\n", where, f.Check, f.Message)
+		fmt.Fprintf(w, "  suggestion: %s\n", f.Suggestion)
+	}
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// listMode controls which columns --list renders
+type listMode int
+
+const (
+	listModeNormal listMode = iota
+	listModeShort
+	listModeWide
+)
+
+// defaultPromptWidth is used when the terminal width cannot be detected
+const defaultPromptWidth = 60
+
+// maxNoteWidth caps the NOTE column unless --full is given
+const maxNoteWidth = 30
+
+// ANSI color codes used by the list renderer
+const (
+	colorReset  = "\033[0m"
+	colorBold   = "\033[1m"
+	colorDim    = "\033[2m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+	colorBlue   = "\033[34m"
+	colorPurple = "\033[35m"
+	colorCyan   = "\033[36m"
+)
+
+// listColumn is a single rendered column: a header plus one cell per row
+type listColumn struct {
+	header string
+	cells  []string
+	colors []string
+	// flex columns absorb leftover terminal width and are truncated to fit
+	flex bool
+}
+
+// useColor reports whether ANSI colors should be written to f
+func useColor(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// terminalWidth returns the width of f, or 0 if it is not a terminal
+func terminalWidth(f *os.File) int {
+	w, _, err := term.GetSize(int(f.Fd()))
+	if err != nil {
+		return 0
+	}
+	return w
+}
+
+// entryStatus describes where the output of a history entry lives
+func entryStatus(v videoHistoryEntry) (string, string) {
+	status, color := localStatus(v)
+	if v.Remote != "" && status != "saved" && status != "stdout" {
+		return "lost", colorRed
+	}
+	return status, color
+}
+
+// localStatus is entryStatus without regard to the remote copy
+func localStatus(v videoHistoryEntry) (string, string) {
+	if v.Pending {
+		return "pending", colorCyan
+	}
+	switch v.OutputFile {
+	case "":
+		return "unknown", colorDim
+	case "-":
+		return "stdout", colorDim
+	}
+	if _, err := os.Stat(v.OutputFile); err != nil {
+		return "missing", colorRed
+	}
+	return "saved", colorGreen
+}
+
+// modelBadge returns a short label and color for a model name
+func modelBadge(model string) (string, string) {
+	switch model {
+	case "sora-2-pro":
+		return "PRO", colorPurple
+	case "sora-2":
+		return "STD", colorBlue
+	case "":
+		return "?", colorDim
+	}
+	return model, colorCyan
+}
+
+// formatCreatedAt renders an RFC3339 timestamp in local time
+func formatCreatedAt(s string) string {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return s
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+// truncate shortens s to at most n runes, adding an ellipsis when cut
+func truncate(s string, n int) string {
+	if n <= 0 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	if n == 1 {
+		return "…"
+	}
+	r := []rune(s)
+	return string(r[:n-1]) + "…"
+}
+
+// singleLine collapses newlines and runs of whitespace so prompts fit in one row
+func singleLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// runList implements `sora-cli list`: show local generation history
+func runList(args []string) {
+	fs := newFlagSet("list", "[flags]")
+	var (
+		wide, short, full bool
+		filter            historyFilter
+	)
+	fs.BoolVar(&wide, "wide", false, "Also show output file and source columns")
+	fs.BoolVar(&short, "short", false, "Only show index, ID, and prompt")
+	fs.BoolVar(&full, "full", false, "Don't truncate prompts to the terminal width")
+	addFilterFlags(fs, &filter)
+	fs.Parse(args)
+
+	if wide && short {
+		fmt.Fprintln(os.Stderr, "Cannot use both --wide and --short")
+		os.Exit(2)
+	}
+	if err := filter.resolve(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	h, err := loadHistory()
+	if err != nil {
+		fail("", "failed to load history", err)
+	}
+	if len(h.Videos) == 0 && !jsonOutput {
+		fmt.Fprintln(os.Stderr, "No videos in history")
+		return
+	}
+
+	// Filter, keeping each entry's @N index
+	var rows []int
+	for i, v := range h.Videos {
+		if filter.match(v) {
+			rows = append(rows, i)
+		}
+	}
+	if jsonOutput {
+		printHistoryJSON(h.Videos, rows)
+		return
+	}
+	if len(rows) == 0 {
+		fmt.Fprintln(os.Stderr, "No videos match the filters")
+		return
+	}
+
+	mode := listModeNormal
+	if wide {
+		mode = listModeWide
+	} else if short {
+		mode = listModeShort
+	}
+	printHistory(os.Stdout, h.Videos, rows, mode, full)
+}
+
+// indexedEntry is a history entry with the index that @N refers to
+type indexedEntry struct {
+	Index int `json:"index"`
+	videoHistoryEntry
+}
+
+// indexedEntries returns the entries at the given indices
+func indexedEntries(videos []videoHistoryEntry, rows []int) []indexedEntry {
+	out := make([]indexedEntry, 0, len(rows))
+	for _, i := range rows {
+		out = append(out, indexedEntry{i, videos[i]})
+	}
+	return out
+}
+
+// printHistoryJSON prints the entries at the given indices as a JSON array,
+// each with the index that @N refers to
+func printHistoryJSON(videos []videoHistoryEntry, rows []int) {
+	printJSON(indexedEntries(videos, rows))
+}
+
+// printHistory renders the history entries at the given indices as aligned,
+// optionally colorized columns
+func printHistory(w *os.File, videos []videoHistoryEntry, rows []int, mode listMode, full bool) {
+	color := useColor(w)
+
+	idx := listColumn{header: "#"}
+	id := listColumn{header: "ID"}
+	created := listColumn{header: "CREATED"}
+	model := listColumn{header: "MODEL"}
+	status := listColumn{header: "STATUS"}
+	prompt := listColumn{header: "PROMPT", flex: true}
+	output := listColumn{header: "OUTPUT"}
+	source := listColumn{header: "SOURCE"}
+	note := listColumn{header: "NOTE"}
+	state := listColumn{header: "STATE"}
+	tags := listColumn{header: "TAGS"}
+	hasNotes, hasStates, anyTags := false, false, false
+
+	for _, i := range rows {
+		v := videos[i]
+		idx.cells = append(idx.cells, fmt.Sprintf("@%d", i))
+		idx.colors = append(idx.colors, colorDim)
+		id.cells = append(id.cells, v.ID)
+		id.colors = append(id.colors, colorYellow)
+		created.cells = append(created.cells, formatCreatedAt(v.CreatedAt))
+		created.colors = append(created.colors, "")
+
+		badge, badgeColor := modelBadge(v.Model)
+		model.cells = append(model.cells, badge)
+		model.colors = append(model.colors, badgeColor)
+
+		st, stColor := entryStatus(v)
+		status.cells = append(status.cells, st)
+		status.colors = append(status.colors, stColor)
+
+		prompt.cells = append(prompt.cells, singleLine(v.Prompt))
+		prompt.colors = append(prompt.colors, "")
+
+		output.cells = append(output.cells, v.OutputFile)
+		output.colors = append(output.colors, "")
+
+		var src string
+		switch {
+		case v.RemixedFrom != nil && *v.RemixedFrom != "":
+			src = "remix:" + *v.RemixedFrom
+		case v.ExtendedFrom != nil && *v.ExtendedFrom != "":
+			src = "extend:" + *v.ExtendedFrom
+		case v.ImageInput != nil && *v.ImageInput != "":
+			src = "image:" + *v.ImageInput
+		case v.Source != "":
+			src = "from:" + v.Source
+		}
+		source.cells = append(source.cells, src)
+		source.colors = append(source.colors, "")
+
+		n := singleLine(v.Note)
+		if !full {
+			n = truncate(n, maxNoteWidth)
+		}
+		note.cells = append(note.cells, n)
+		note.colors = append(note.colors, colorCyan)
+		hasNotes = hasNotes || n != ""
+
+		s := entryState(v)
+		state.cells = append(state.cells, s)
+		state.colors = append(state.colors, stateColor(s))
+		hasStates = hasStates || v.State != ""
+
+		t := tagLabel(v)
+		tags.cells = append(tags.cells, t)
+		tags.colors = append(tags.colors, colorPurple)
+		anyTags = anyTags || t != ""
+	}
+
+	var cols []*listColumn
+	switch mode {
+	case listModeShort:
+		cols = []*listColumn{&idx, &id, &prompt}
+	case listModeWide:
+		cols = []*listColumn{&idx, &id, &created, &model, &status, &output, &source, &prompt}
+	default:
+		cols = []*listColumn{&idx, &id, &created, &model, &status, &prompt}
+	}
+	// State, tags, and notes go just before the prompt, and only when in use
+	if mode != listModeShort {
+		cols = cols[:len(cols)-1]
+		if hasStates {
+			cols = append(cols, &state)
+		}
+		if anyTags {
+			cols = append(cols, &tags)
+		}
+		if hasNotes {
+			cols = append(cols, &note)
+		}
+		cols = append(cols, &prompt)
+	}
+
+	renderColumns(w, cols, color, full)
+}
+
+// renderColumns writes cols as a padded table. Widths are computed on the
+// plain text so that ANSI escapes don't break alignment.
+func renderColumns(w io.Writer, cols []*listColumn, color, full bool) {
+	const gap = 2
+
+	widths := make([]int, len(cols))
+	fixed := 0
+	for i, c := range cols {
+		widths[i] = utf8.RuneCountInString(c.header)
+		for _, cell := range c.cells {
+			if n := utf8.RuneCountInString(cell); n > widths[i] {
+				widths[i] = n
+			}
+		}
+		if !c.flex {
+			fixed += widths[i] + gap
+		}
+	}
+
+	// Fit flex columns into the remaining terminal width unless --full
+	if !full {
+		avail := defaultPromptWidth
+		if f, ok := w.(*os.File); ok {
+			if tw := terminalWidth(f); tw > 0 {
+				avail = tw - fixed
+				if avail < 20 {
+					avail = 20
+				}
+			}
+		}
+		for i, c := range cols {
+			if c.flex && widths[i] > avail {
+				widths[i] = avail
+				for j := range c.cells {
+					c.cells[j] = truncate(c.cells[j], avail)
+				}
+			}
+		}
+	}
+
+	paint := func(s, code string) string {
+		if !color || code == "" {
+			return s
+		}
+		return code + s + colorReset
+	}
+	pad := func(s string, width int, last bool) string {
+		if last {
+			return s
+		}
+		return s + strings.Repeat(" ", width-utf8.RuneCountInString(s)+gap)
+	}
+
+	var sb strings.Builder
+	for i, c := range cols {
+		sb.WriteString(paint(pad(c.header, widths[i], i == len(cols)-1), colorBold))
+	}
+	sb.WriteString("\n")
+
+	rows := len(cols[0].cells)
+	for r := 0; r < rows; r++ {
+		for i, c := range cols {
+			last := i == len(cols)-1
+			cell := c.cells[r]
+			padded := pad(cell, widths[i], last)
+			// Color only the text, not the trailing padding
+			sb.WriteString(paint(cell, c.colors[r]))
+			sb.WriteString(padded[len(cell):])
+		}
+		sb.WriteString("\n")
+	}
+
+	fmt.Fprint(w, sb.String())
+}
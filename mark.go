@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// reviewStates are the workflow states a history entry can be in. An entry
+// that was never marked is a draft.
+var reviewStates = []string{"draft", "review", "approved", "rejected"}
+
+// parseReviewState validates a state name
+func parseReviewState(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for _, st := range reviewStates {
+		if s == st {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("unknown state %q (want %s)", s, strings.Join(reviewStates, ", "))
+}
+
+// entryState returns the workflow state of a history entry
+func entryState(v videoHistoryEntry) string {
+	if v.State == "" {
+		return "draft"
+	}
+	return v.State
+}
+
+// stateColor returns the list color for a workflow state
+func stateColor(state string) string {
+	switch state {
+	case "review":
+		return colorYellow
+	case "approved":
+		return colorGreen
+	case "rejected":
+		return colorRed
+	}
+	return colorDim
+}
+
+// runMark implements `sora-cli mark <ref>... <state>`: move history entries
+// through the draft/review/approved/rejected workflow
+func runMark(args []string) {
+	fs := newFlagSet("mark", "<@last|@N|video_id>... <draft|review|approved|rejected>")
+	fs.Parse(args)
+
+	if fs.NArg() < 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	refs, stateArg := fs.Args()[:fs.NArg()-1], fs.Arg(fs.NArg()-1)
+	state, err := parseReviewState(stateArg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	// Resolve every reference first so @N indices refer to the same list
+	ids := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		id, err := resolveVideoRef(ref)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to resolve video reference %s: %v\n", ref, err)
+			os.Exit(1)
+		}
+		ids = append(ids, id)
+	}
+
+	failed := false
+	for _, id := range ids {
+		found, err := updateHistoryEntry(id, func(e *videoHistoryEntry) {
+			e.State = state
+			if state == "draft" {
+				e.State = ""
+			}
+		})
+		switch {
+		case err != nil:
+			fail("", "failed to update history", err)
+		case !found:
+			fmt.Fprintf(os.Stderr, "%s is not in history\n", id)
+			failed = true
+		default:
+			infof("%s: %s\n", id, state)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
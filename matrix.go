@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxMatrix limits how many combinations a matrix may expand to; every
+// one is billed as a separate video
+const maxMatrix = 32
+
+// matrixFile is a --matrix file. Each field is one value or a list, and
+// every combination of the lists is rendered.
+type matrixFile struct {
+	Prompt  stringList `yaml:"prompt"`
+	Model   stringList `yaml:"model"`
+	Seconds stringList `yaml:"seconds"`
+	Size    stringList `yaml:"size"`
+}
+
+// stringList is a YAML field that takes one scalar or a list of them
+type stringList []string
+
+func (l *stringList) UnmarshalYAML(n *yaml.Node) error {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		*l = stringList{n.Value}
+		return nil
+	case yaml.SequenceNode:
+		*l = nil
+		for _, item := range n.Content {
+			if item.Kind != yaml.ScalarNode {
+				return fmt.Errorf("line %d: expected a value, not a %s", item.Line, nodeKindName(item.Kind))
+			}
+			*l = append(*l, item.Value)
+		}
+		return nil
+	}
+	return fmt.Errorf("line %d: expected a value or a list, not a %s", n.Line, nodeKindName(n.Kind))
+}
+
+// nodeKindName describes a YAML node kind for error messages
+func nodeKindName(k yaml.Kind) string {
+	if k == yaml.MappingNode {
+		return "mapping"
+	}
+	return "nested list"
+}
+
+// readMatrixFile parses a --matrix file. Unknown fields are errors, to
+// catch typos.
+func readMatrixFile(path string) (*matrixFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	var m matrixFile
+	if err := dec.Decode(&m); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &m, nil
+}
+
+// braceGroups returns the {a,b,...} groups in prompt, each as its
+// alternatives. Braces without a comma are part of the prompt.
+func braceGroups(prompt string) [][]string {
+	var groups [][]string
+	for _, p := range splitBraces(prompt) {
+		if p.choices != nil {
+			groups = append(groups, p.choices)
+		}
+	}
+	return groups
+}
+
+// promptPart is literal text or one {a,b} group of a prompt
+type promptPart struct {
+	text    string
+	choices []string
+}
+
+// splitBraces splits prompt into literal text and brace groups. Groups
+// don't nest.
+func splitBraces(prompt string) []promptPart {
+	var parts []promptPart
+	var lit strings.Builder
+	for i := 0; i < len(prompt); i++ {
+		if prompt[i] == '{' {
+			end := strings.IndexAny(prompt[i+1:], "{}")
+			if end >= 0 && prompt[i+1+end] == '}' {
+				body := prompt[i+1 : i+1+end]
+				if strings.Contains(body, ",") {
+					if lit.Len() > 0 {
+						parts = append(parts, promptPart{text: lit.String()})
+						lit.Reset()
+					}
+					choices := strings.Split(body, ",")
+					for j := range choices {
+						choices[j] = strings.TrimSpace(choices[j])
+					}
+					parts = append(parts, promptPart{choices: choices})
+					i += end + 1
+					continue
+				}
+			}
+		}
+		lit.WriteByte(prompt[i])
+	}
+	if lit.Len() > 0 || len(parts) == 0 {
+		parts = append(parts, promptPart{text: lit.String()})
+	}
+	return parts
+}
+
+// expandedPrompt is one expansion of a prompt and the alternatives chosen
+// for it
+type expandedPrompt struct {
+	text    string
+	choices []string
+}
+
+// expandBraces returns every combination of prompt's brace groups, in
+// order, with the first group varying slowest
+func expandBraces(prompt string) []expandedPrompt {
+	out := []expandedPrompt{{}}
+	for _, p := range splitBraces(prompt) {
+		if p.choices == nil {
+			for i := range out {
+				out[i].text += p.text
+			}
+			continue
+		}
+		next := make([]expandedPrompt, 0, len(out)*len(p.choices))
+		for _, e := range out {
+			for _, c := range p.choices {
+				choices := append(append([]string(nil), e.choices...), c)
+				next = append(next, expandedPrompt{text: e.text + c, choices: choices})
+			}
+		}
+		out = next
+	}
+	// Empty alternatives (e.g. "{,very }") can leave doubled spaces
+	for i := range out {
+		out[i].text = strings.Join(strings.Fields(out[i].text), " ")
+	}
+	return out
+}
+
+// expandMatrix returns one row per combination of the matrix file at path
+// (if any) and the brace groups of its prompts. base supplies the prompt,
+// model, duration, and size the file doesn't list, and the output path the
+// rows are numbered from. Each row's Variation names what sets it apart.
+func expandMatrix(path string, base batchRow) ([]batchRow, error) {
+	m := &matrixFile{}
+	if path != "" {
+		var err error
+		if m, err = readMatrixFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if len(m.Prompt) > 0 && base.Prompt != "" {
+		return nil, errors.New("the prompt is set by both -p and the --matrix file; use one")
+	}
+	if len(m.Prompt) == 0 {
+		if strings.TrimSpace(base.Prompt) == "" {
+			return nil, errors.New("a matrix needs a prompt, from -p or the --matrix file")
+		}
+		m.Prompt = stringList{base.Prompt}
+	}
+	if len(m.Model) == 0 {
+		m.Model = stringList{base.Model}
+	}
+	if len(m.Seconds) == 0 {
+		m.Seconds = stringList{base.Seconds.String()}
+	}
+	if len(m.Size) == 0 {
+		m.Size = stringList{base.Size}
+	}
+
+	for i, model := range m.Model {
+		if m.Model[i] = cfg.resolveModel(strings.TrimSpace(model)); m.Model[i] == "" {
+			return nil, errors.New("model cannot be empty")
+		}
+	}
+	for _, s := range m.Seconds {
+		if s != "4" && s != "8" && s != "12" {
+			return nil, fmt.Errorf("seconds must be 4, 8, or 12, got %q", s)
+		}
+	}
+	for i, s := range m.Size {
+		switch strings.ToLower(s) {
+		case "landscape", "1280x720":
+			m.Size[i] = "1280x720"
+		case "portrait", "720x1280":
+			m.Size[i] = "720x1280"
+		default:
+			return nil, fmt.Errorf("size must be 1280x720, 720x1280, portrait, or landscape, got %q", s)
+		}
+	}
+
+	var prompts []expandedPrompt
+	for i, p := range m.Prompt {
+		if strings.TrimSpace(p) == "" {
+			return nil, fmt.Errorf("prompt %d is empty", i+1)
+		}
+		for _, e := range expandBraces(p) {
+			if len(m.Prompt) > 1 {
+				e.choices = append([]string{fmt.Sprintf("prompt %d", i+1)}, e.choices...)
+			}
+			prompts = append(prompts, e)
+		}
+	}
+	total := len(prompts) * len(m.Model) * len(m.Seconds) * len(m.Size)
+	switch {
+	case total > maxMatrix:
+		return nil, fmt.Errorf("the matrix expands to %d videos; at most %d are allowed", total, maxMatrix)
+	case total < 2:
+		return nil, errors.New("the matrix has only one combination; list more than one value, or use {a,b} in the prompt")
+	}
+
+	rows := make([]batchRow, 0, total)
+	for _, p := range prompts {
+		for _, model := range m.Model {
+			for _, secs := range m.Seconds {
+				for _, size := range m.Size {
+					row := base
+					row.Prompt, row.Model, row.Seconds, row.Size = p.text, model, json.Number(secs), size
+					label := append([]string(nil), p.choices...)
+					if len(m.Model) > 1 {
+						label = append(label, model)
+					}
+					if len(m.Seconds) > 1 {
+						label = append(label, secs+"s")
+					}
+					if len(m.Size) > 1 {
+						label = append(label, orientationName(size))
+					}
+					row.Variation = strings.Join(label, ", ")
+					if base.Output != "" {
+						row.Output = variantPath(base.Output, len(rows)+1)
+					}
+					rows = append(rows, row)
+				}
+			}
+		}
+	}
+	return rows, nil
+}
+
+// runMatrix renders every combination of the matrix at path and base's
+// prompt as one history group, after screening the prompts and confirming
+// the total cost. With a seed, combinations differ only in what the matrix
+// varies. It returns false if any of them failed.
+func runMatrix(common *commonOptions, apiKey, path string, base batchRow, seed *int64, concurrency int, tonemap, pad, yes bool, post *postOptions, opts jobOptions) bool {
+	rows, err := expandMatrix(path, base)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	for i, r := range rows {
+		mustScreen("prompt", r.Prompt)
+		infof("  v%d: %s\n", i+1, r.Variation)
+	}
+	if base.FirstFrame != "" {
+		warned := map[string]bool{}
+		for _, r := range rows {
+			if warned[r.Size] {
+				continue
+			}
+			warned[r.Size] = true
+			if m := checkReferenceAspect(base.FirstFrame, r.Size, pad); m != nil {
+				m.warn("Add --pad to keep the whole frame between black bars.")
+			}
+		}
+	}
+	if !confirmRowsCost(rows, "videos", yes) {
+		fmt.Fprintln(os.Stderr, "Aborted")
+		os.Exit(exitCanceled)
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+	c := mustHTTPClient(common.net)
+	return runGroup(ctx, c, common.baseURL, apiKey, rows, fmt.Sprintf("%d combinations", len(rows)), seed, concurrency, tonemap, pad, post, opts)
+}
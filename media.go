@@ -0,0 +1,615 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abema/go-mp4"
+	"github.com/chai2010/webp"
+	"github.com/disintegration/imaging"
+)
+
+const ffmpegInstallMsg = `ffmpeg is required but was not found in PATH.
+Please install ffmpeg:
+  Ubuntu/Debian: sudo apt-get install ffmpeg
+  macOS: brew install ffmpeg
+  Or download from: https://ffmpeg.org/download.html`
+
+// inputReference is a reference file that has already been resized and
+// re-encoded for upload
+type inputReference struct {
+	data     []byte
+	filename string
+	mimeType string
+}
+
+// loadInputReference prepares inputFile as the reference for a video of the
+// given size. tonemap converts an HDR reference to SDR first.
+func loadInputReference(inputFile, size string, tonemap, pad bool) (*inputReference, error) {
+	// Parse target dimensions from size parameter
+	targetWidth, targetHeight := parseDimensions(size)
+
+	// Process the input file based on type
+	data, filename, mimeType, err := processInputFile(inputFile, targetWidth, targetHeight, tonemap, pad)
+	if err != nil {
+		return nil, fmt.Errorf("processing input file: %w", err)
+	}
+	return &inputReference{data: data, filename: filename, mimeType: mimeType}, nil
+}
+
+func detectMIMEType(filePath string) string {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	mimeTypes := map[string]string{
+		// Images (only formats supported by API)
+		".jpg":  "image/jpeg",
+		".jpeg": "image/jpeg",
+		".png":  "image/png",
+		".webp": "image/webp",
+		// Videos
+		".mp4":  "video/mp4",
+		".webm": "video/webm",
+		".mov":  "video/quicktime",
+		".avi":  "video/x-msvideo",
+	}
+	if mime, ok := mimeTypes[ext]; ok {
+		return mime
+	}
+	return "application/octet-stream"
+}
+
+func isImageFile(filePath string) bool {
+	mime := detectMIMEType(filePath)
+	return strings.HasPrefix(mime, "image/")
+}
+
+// decodeImage decodes an image from a file, using the appropriate decoder based on format
+func decodeImage(filePath string) (image.Image, error) {
+	ext := strings.ToLower(filepath.Ext(filePath))
+
+	// Use chai2010/webp for WebP files (better format support than stdlib)
+	if ext == ".webp" {
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("reading WebP: %w", err)
+		}
+		return webp.Decode(bytes.NewReader(data))
+	}
+
+	// Use imaging library for other formats (JPEG, PNG, etc.)
+	return imaging.Open(filePath)
+}
+
+// encodeImage encodes an image to bytes in the specified format
+func encodeImage(img image.Image, ext string) ([]byte, string, string, error) {
+	var buf bytes.Buffer
+	var mimeType string
+	var newExt string = ext
+
+	switch ext {
+	case ".webp":
+		if err := webp.Encode(&buf, img, &webp.Options{Lossless: false, Quality: 90}); err != nil {
+			return nil, "", "", err
+		}
+		mimeType = "image/webp"
+	case ".png":
+		if err := imaging.Encode(&buf, img, imaging.PNG); err != nil {
+			return nil, "", "", err
+		}
+		mimeType = "image/png"
+	case ".jpg", ".jpeg":
+		if err := imaging.Encode(&buf, img, imaging.JPEG); err != nil {
+			return nil, "", "", err
+		}
+		mimeType = "image/jpeg"
+		newExt = ".jpg"
+	default:
+		// Convert unsupported formats to JPEG
+		if err := imaging.Encode(&buf, img, imaging.JPEG); err != nil {
+			return nil, "", "", err
+		}
+		mimeType = "image/jpeg"
+		newExt = ".jpg"
+	}
+
+	return buf.Bytes(), newExt, mimeType, nil
+}
+
+func parseDimensions(size string) (width, height int) {
+	// Default to landscape if not specified
+	if size == "" {
+		return 1280, 720
+	}
+	// Parse WxH format
+	parts := strings.Split(size, "x")
+	if len(parts) == 2 {
+		fmt.Sscanf(parts[0], "%d", &width)
+		fmt.Sscanf(parts[1], "%d", &height)
+		return width, height
+	}
+	return 1280, 720
+}
+
+func processInputFile(filePath string, targetWidth, targetHeight int, tonemap, pad bool) (data []byte, filename, mimeType string, err error) {
+	// Check if file exists
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		return nil, "", "", fmt.Errorf("file does not exist: %s", filePath)
+	} else if err != nil {
+		return nil, "", "", fmt.Errorf("checking file: %w", err)
+	}
+
+	mimeType = detectMIMEType(filePath)
+	filename = filepath.Base(filePath)
+
+	// For images: resize to exact dimensions (maintaining aspect ratio, cropping if needed)
+	if isImageFile(filePath) {
+		src := filePath
+		if tonemap {
+			infof("Tone mapping %s to SDR...\n", filePath)
+			sdr, err := tonemapImage(filePath)
+			if err != nil {
+				return nil, "", "", fmt.Errorf("tone mapping image: %w", err)
+			}
+			defer os.Remove(sdr)
+			src = sdr
+		}
+		img, err := decodeImage(src)
+		if err != nil {
+			return nil, "", "", fmt.Errorf("decoding image: %w", err)
+		}
+
+		// Resize if needed. Fill maintains aspect ratio by scaling and
+		// cropping from the center; with pad the whole image is kept
+		// between black bars instead.
+		bounds := img.Bounds()
+		if bounds.Dx() != targetWidth || bounds.Dy() != targetHeight {
+			if pad {
+				fit := imaging.Fit(img, targetWidth, targetHeight, imaging.Lanczos)
+				canvas := imaging.New(targetWidth, targetHeight, color.Black)
+				img = imaging.PasteCenter(canvas, fit)
+			} else {
+				img = imaging.Fill(img, targetWidth, targetHeight, imaging.Center, imaging.Lanczos)
+			}
+		}
+
+		// Encode image
+		ext := strings.ToLower(filepath.Ext(filePath))
+		data, newExt, mimeType, err := encodeImage(img, ext)
+		if err != nil {
+			return nil, "", "", fmt.Errorf("encoding image: %w", err)
+		}
+
+		// Update filename if format changed
+		if newExt != ext {
+			filename = strings.TrimSuffix(filename, ext) + newExt
+		}
+
+		return data, filename, mimeType, nil
+	}
+
+	// For videos: read dimensions directly from MP4 file (no external tools needed)
+	currentWidth, currentHeight, err := getVideoDimensions(filePath)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("getting video dimensions: %w", err)
+	}
+
+	// HDR references come out washed out or too dark unless tone mapped.
+	// Untagged video can't be checked, so --tonemap assumes it is PQ.
+	color, err := getVideoColor(filePath)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("reading color information: %w", err)
+	}
+	hdr := color.hdrTransfer()
+	if hdr != 0 && !tonemap {
+		warnf("WARNING: %s is HDR video; pass --tonemap to convert it to SDR\n", filePath)
+	}
+	var tonemapFrom uint16
+	if tonemap {
+		switch {
+		case hdr != 0:
+			tonemapFrom = hdr
+		case color.colr == nil:
+			tonemapFrom = transferPQ
+		default:
+			infof("%s is not HDR video; skipping --tonemap\n", filePath)
+		}
+	}
+
+	// Check if resize is needed
+	if currentWidth == targetWidth && currentHeight == targetHeight && tonemapFrom == 0 {
+		// No resize needed - just read the file
+		data, err = os.ReadFile(filePath)
+		if err != nil {
+			return nil, "", "", fmt.Errorf("reading video: %w", err)
+		}
+		return data, filename, mimeType, nil
+	}
+
+	// Need to resize - check if ffmpeg is available
+	if !isFFmpegAvailable() {
+		return nil, "", "", fmt.Errorf("video is %dx%d but needs to be %dx%d.\n%s",
+			currentWidth, currentHeight, targetWidth, targetHeight, ffmpegInstallMsg)
+	}
+
+	// Resize video using ffmpeg
+	if tonemapFrom != 0 {
+		infof("Tone mapping video to SDR at %dx%d using ffmpeg...\n", targetWidth, targetHeight)
+	} else {
+		infof("Resizing video from %dx%d to %dx%d using ffmpeg...\n", currentWidth, currentHeight, targetWidth, targetHeight)
+	}
+	resizedPath, err := resizeVideoWithFFmpeg(filePath, targetWidth, targetHeight, tonemapFrom, pad)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("resizing video with ffmpeg: %w", err)
+	}
+	defer os.Remove(resizedPath) // Clean up temp file
+
+	data, err = os.ReadFile(resizedPath)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("reading resized video: %w", err)
+	}
+
+	return data, filename, mimeType, nil
+}
+
+func isFFmpegAvailable() bool {
+	_, err := exec.LookPath("ffmpeg")
+	return err == nil
+}
+
+func isFFprobeAvailable() bool {
+	_, err := exec.LookPath("ffprobe")
+	return err == nil
+}
+
+// getVideoFrameRate returns the average frame rate of an MP4 file's video
+// track, from its sample count and media duration
+func getVideoFrameRate(videoPath string) (float64, error) {
+	f, err := os.Open(videoPath)
+	if err != nil {
+		return 0, fmt.Errorf("opening video file: %w", err)
+	}
+	defer f.Close()
+
+	traks, err := mp4.ExtractBox(f, nil, mp4.BoxPath{mp4.BoxTypeMoov(), mp4.BoxTypeTrak()})
+	if err != nil {
+		return 0, fmt.Errorf("extracting tracks: %w", err)
+	}
+	for _, trak := range traks {
+		boxes, err := mp4.ExtractBoxesWithPayload(f, trak, []mp4.BoxPath{
+			{mp4.BoxTypeMdia(), mp4.BoxTypeHdlr()},
+			{mp4.BoxTypeMdia(), mp4.BoxTypeMdhd()},
+			{mp4.BoxTypeMdia(), mp4.BoxTypeMinf(), mp4.BoxTypeStbl(), mp4.BoxTypeStsz()},
+		})
+		if err != nil {
+			return 0, fmt.Errorf("extracting track boxes: %w", err)
+		}
+		var video bool
+		var mdhd *mp4.Mdhd
+		var stsz *mp4.Stsz
+		for _, box := range boxes {
+			switch p := box.Payload.(type) {
+			case *mp4.Hdlr:
+				video = p.HandlerType == [4]byte{'v', 'i', 'd', 'e'}
+			case *mp4.Mdhd:
+				mdhd = p
+			case *mp4.Stsz:
+				stsz = p
+			}
+		}
+		if video && mdhd != nil && stsz != nil && mdhd.Timescale > 0 && mdhd.GetDuration() > 0 {
+			secs := float64(mdhd.GetDuration()) / float64(mdhd.Timescale)
+			return float64(stsz.SampleCount) / secs, nil
+		}
+	}
+	return 0, fmt.Errorf("video frame rate not found in MP4 file")
+}
+
+// ffmpegHasFilter reports whether the installed ffmpeg was built with the
+// named filter (optional libraries like libvidstab often aren't)
+func ffmpegHasFilter(name string) bool {
+	return ffmpegLists("-filters", name)
+}
+
+// ffmpegHasEncoder reports whether the installed ffmpeg was built with the
+// named encoder, such as libx265
+func ffmpegHasEncoder(name string) bool {
+	return ffmpegLists("-encoders", name)
+}
+
+// ffmpegLists reports whether name appears in the second column of the
+// list ffmpeg prints for option, e.g. -filters
+func ffmpegLists(option, name string) bool {
+	out, err := exec.Command("ffmpeg", "-hide_banner", option).Output()
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if f := strings.Fields(line); len(f) >= 2 && f[1] == name {
+			return true
+		}
+	}
+	return false
+}
+
+// getVideoDimensions returns the width and height of a video file by parsing the MP4 file directly
+func getVideoDimensions(videoPath string) (width, height int, err error) {
+	f, err := os.Open(videoPath)
+	if err != nil {
+		return 0, 0, fmt.Errorf("opening video file: %w", err)
+	}
+	defer f.Close()
+
+	// Extract all tkhd boxes to find video track dimensions
+	boxes, err := mp4.ExtractBoxWithPayload(f, nil, mp4.BoxPath{mp4.BoxTypeMoov(), mp4.BoxTypeTrak(), mp4.BoxTypeTkhd()})
+	if err != nil {
+		return 0, 0, fmt.Errorf("extracting track header: %w", err)
+	}
+
+	// Find first valid tkhd box with dimensions
+	for _, box := range boxes {
+		tkhd, ok := box.Payload.(*mp4.Tkhd)
+		if ok && tkhd.Width > 0 && tkhd.Height > 0 {
+			// Width and Height in tkhd are stored as fixed-point 16.16 format
+			width = int(tkhd.Width >> 16)
+			height = int(tkhd.Height >> 16)
+			return width, height, nil
+		}
+	}
+
+	return 0, 0, fmt.Errorf("video dimensions not found in MP4 file")
+}
+
+// checkReferenceLength warns when path is a video reference shorter than
+// the requested seconds. The API accepts the job and only fails it once it
+// starts rendering, with an error that doesn't say why.
+func checkReferenceLength(path, seconds string) {
+	if isImageFile(path) {
+		return
+	}
+	want, err := strconv.Atoi(seconds)
+	if err != nil {
+		return
+	}
+	d, err := getVideoDuration(path)
+	if err != nil || d >= time.Duration(want)*time.Second {
+		return
+	}
+	msg := fmt.Sprintf("WARNING: %s is only %s long, but %ss was requested; the API rejects references shorter than the video", path, d.Round(100*time.Millisecond), seconds)
+	if fit := longestSecondsWithin(d); fit != "" {
+		msg += fmt.Sprintf(" (--seconds %s fits)", fit)
+	}
+	warnf("%s\n", msg)
+}
+
+// longestSecondsWithin returns the longest allowed duration no longer than
+// d, or "" if even the shortest is longer
+func longestSecondsWithin(d time.Duration) string {
+	for _, s := range []int{12, 8, 4} {
+		if time.Duration(s)*time.Second <= d {
+			return strconv.Itoa(s)
+		}
+	}
+	return ""
+}
+
+// getVideoDuration returns the duration of an MP4 file from its movie header
+func getVideoDuration(videoPath string) (time.Duration, error) {
+	f, err := os.Open(videoPath)
+	if err != nil {
+		return 0, fmt.Errorf("opening video file: %w", err)
+	}
+	defer f.Close()
+
+	boxes, err := mp4.ExtractBoxWithPayload(f, nil, mp4.BoxPath{mp4.BoxTypeMoov(), mp4.BoxTypeMvhd()})
+	if err != nil {
+		return 0, fmt.Errorf("extracting movie header: %w", err)
+	}
+	for _, box := range boxes {
+		mvhd, ok := box.Payload.(*mp4.Mvhd)
+		if ok && mvhd.Timescale > 0 {
+			secs := float64(mvhd.GetDuration()) / float64(mvhd.Timescale)
+			return time.Duration(secs * float64(time.Second)), nil
+		}
+	}
+	return 0, fmt.Errorf("video duration not found in MP4 file")
+}
+
+// hasAudioTrack reports whether an MP4 file contains a sound track
+func hasAudioTrack(videoPath string) (bool, error) {
+	f, err := os.Open(videoPath)
+	if err != nil {
+		return false, fmt.Errorf("opening video file: %w", err)
+	}
+	defer f.Close()
+
+	boxes, err := mp4.ExtractBoxWithPayload(f, nil, mp4.BoxPath{mp4.BoxTypeMoov(), mp4.BoxTypeTrak(), mp4.BoxTypeMdia(), mp4.BoxTypeHdlr()})
+	if err != nil {
+		return false, fmt.Errorf("extracting handler boxes: %w", err)
+	}
+	for _, box := range boxes {
+		if hdlr, ok := box.Payload.(*mp4.Hdlr); ok && hdlr.HandlerType == [4]byte{'s', 'o', 'u', 'n'} {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Transfer characteristics (ITU-T H.273) of HDR video
+const (
+	transferPQ  = 16 // SMPTE ST 2084
+	transferHLG = 18 // ARIB STD-B67
+)
+
+// videoColor is the codec and color description of an MP4 video track
+type videoColor struct {
+	codec string    // sample entry type, e.g. "avc1"
+	colr  *mp4.Colr // nil when the track has no nclx color box
+}
+
+// isBT709 reports whether the track is tagged as SDR BT.709
+func (c videoColor) isBT709() bool {
+	return c.colr != nil && c.colr.ColourPrimaries == 1 && c.colr.TransferCharacteristics == 1 && c.colr.MatrixCoefficients == 1
+}
+
+// hdrTransfer returns the track's HDR transfer characteristic, or 0 for SDR
+// and untagged video
+func (c videoColor) hdrTransfer() uint16 {
+	if c.colr != nil && (c.colr.TransferCharacteristics == transferPQ || c.colr.TransferCharacteristics == transferHLG) {
+		return c.colr.TransferCharacteristics
+	}
+	return 0
+}
+
+// getVideoColor reads the codec and color description of an MP4 file's
+// video track from its sample entry
+func getVideoColor(videoPath string) (videoColor, error) {
+	f, err := os.Open(videoPath)
+	if err != nil {
+		return videoColor{}, fmt.Errorf("opening video file: %w", err)
+	}
+	defer f.Close()
+
+	stsd := mp4.BoxPath{mp4.BoxTypeMoov(), mp4.BoxTypeTrak(), mp4.BoxTypeMdia(), mp4.BoxTypeMinf(), mp4.BoxTypeStbl(), mp4.BoxTypeStsd()}
+	var paths []mp4.BoxPath
+	for _, entry := range []mp4.BoxType{mp4.BoxTypeAvc1(), mp4.BoxTypeHvc1(), mp4.BoxTypeHev1()} {
+		paths = append(paths, append(slices.Clone(stsd), entry), append(slices.Clone(stsd), entry, mp4.BoxTypeColr()))
+	}
+	boxes, err := mp4.ExtractBoxesWithPayload(f, nil, paths)
+	if err != nil {
+		return videoColor{}, fmt.Errorf("extracting sample entries: %w", err)
+	}
+	var c videoColor
+	for _, box := range boxes {
+		if colr, ok := box.Payload.(*mp4.Colr); ok {
+			if colr.ColourType == [4]byte{'n', 'c', 'l', 'x'} {
+				c.colr = colr
+			}
+		} else if c.codec == "" {
+			c.codec = box.Info.Type.String()
+		}
+	}
+	return c, nil
+}
+
+// durationTolerance is how far the actual duration may drift from the
+// requested one before it's reported (encoders rarely land on exact seconds)
+const durationTolerance = 500 * time.Millisecond
+
+// verifyOutput compares a downloaded video against the requested size and
+// seconds, returning a description of each mismatch. Empty values aren't checked.
+func verifyOutput(path, size, seconds string) ([]string, error) {
+	var problems []string
+
+	if size != "" {
+		wantW, wantH := parseDimensions(size)
+		w, h, err := getVideoDimensions(path)
+		if err != nil {
+			return nil, err
+		}
+		if w != wantW || h != wantH {
+			problems = append(problems, fmt.Sprintf("video is %dx%d but %dx%d was requested", w, h, wantW, wantH))
+		}
+	}
+
+	if seconds != "" {
+		var wantSecs int
+		if _, err := fmt.Sscanf(seconds, "%d", &wantSecs); err == nil {
+			got, err := getVideoDuration(path)
+			if err != nil {
+				return nil, err
+			}
+			want := time.Duration(wantSecs) * time.Second
+			if diff := got - want; diff > durationTolerance || diff < -durationTolerance {
+				problems = append(problems, fmt.Sprintf("video is %.1fs long but %ss was requested", got.Seconds(), seconds))
+			}
+		}
+	}
+	return problems, nil
+}
+
+// extractThumbnail writes the frame at offset at of a video to out as a JPEG
+// scaled to width pixels wide, or at full size if width is 0
+func extractThumbnail(ctx context.Context, videoPath, out string, at time.Duration, width int) error {
+	b := newFFmpeg().Input(videoPath)
+	if width > 0 {
+		b.Filter(newFilter("scale").Int("w", width).Int("h", -2))
+	}
+	return b.Option("-ss", strconv.FormatFloat(at.Seconds(), 'f', -1, 64)).
+		Option("-frames:v", "1").
+		Option("-q:v", "3").
+		Output(out).
+		Run(ctx)
+}
+
+// extractLastFrame writes the final frame of a video to out as a PNG
+func extractLastFrame(ctx context.Context, videoPath, out string) error {
+	d, err := getVideoDuration(videoPath)
+	if err != nil {
+		return err
+	}
+	// Decode only the last second, rewriting out with every frame, so the
+	// frame left in it is the final one
+	at := max(d-time.Second, 0)
+	return newFFmpeg().
+		Input(videoPath).
+		Option("-ss", strconv.FormatFloat(at.Seconds(), 'f', -1, 64)).
+		Option("-update", "1").
+		Output(out).
+		Run(ctx)
+}
+
+// resizeVideoWithFFmpeg scales a reference video to width x height,
+// converting it from the HDR transfer tonemapFrom to SDR unless that is 0.
+// With pad the frame keeps its shape and is centered between black bars;
+// otherwise it is stretched.
+func resizeVideoWithFFmpeg(inputPath string, width, height int, tonemapFrom uint16, pad bool) (string, error) {
+	// Create temp file for output
+	tmpFile, err := os.CreateTemp("", "sora-resized-*.mp4")
+	if err != nil {
+		return "", fmt.Errorf("creating temp file: %w", err)
+	}
+	outputPath := tmpFile.Name()
+	tmpFile.Close()
+
+	// Run ffmpeg to resize
+	// -c:v libx264: use H.264 codec
+	// -crf 23: quality (lower = better, 23 is good default)
+	// -preset fast: encoding speed
+	// out_color_matrix converts BT.601 (SD) sources to match the BT.709 tags
+	b := newFFmpeg().Input(inputPath)
+	if tonemapFrom != 0 {
+		addTonemap(b, tonemapFrom, false)
+	}
+	scale := newFilter("scale").Int("w", width).Int("h", height).String("out_color_matrix", "bt709")
+	if pad {
+		scale.String("force_original_aspect_ratio", "decrease")
+	}
+	b.Filter(scale)
+	if pad {
+		b.Filter(newFilter("pad").Int("w", width).Int("h", height).String("x", "(ow-iw)/2").String("y", "(oh-ih)/2"))
+	}
+	b.Option("-c:v", "libx264").
+		Option("-crf", "23").
+		Option("-preset", "fast").
+		Option("-an") // remove audio (Sora doesn't support it anyway)
+	addColorTags(b)
+	err = b.Output(outputPath).Run(context.Background())
+	if err != nil {
+		os.Remove(outputPath)
+		return "", err
+	}
+
+	infof("Video resized successfully\n")
+	return outputPath, nil
+}
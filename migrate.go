@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// historyVersion is the history format this build reads and writes: the
+// user_version of history.db, and the version of a history.json. Files
+// from before the format was versioned have no version and are version 1.
+const historyVersion = 1
+
+// historyMigrations upgrade a decoded history document one format version at
+// a time: historyMigrations[v] turns version v into v+1. They work on the
+// raw JSON so a step can rename or restructure fields the current types no
+// longer have. When the format changes, bump historyVersion and add a step;
+// never change a step that has shipped.
+var historyMigrations = map[int]func(doc map[string]any) error{}
+
+// decodeHistory parses a history document (a history.json, or the videos
+// of an older history.db), upgrading older formats. One from a newer
+// sora-cli is decoded as far as this build understands it; the caller has
+// to refuse to write it back, since that would drop what it doesn't know.
+func decodeHistory(data []byte) (*history, error) {
+	var head struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return nil, err
+	}
+	version := max(head.Version, 1)
+
+	original := data
+	if version < historyVersion {
+		var doc map[string]any
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber() // keep numbers exactly as written
+		if err := dec.Decode(&doc); err != nil {
+			return nil, err
+		}
+		for v := version; v < historyVersion; v++ {
+			if err := historyMigrations[v](doc); err != nil {
+				return nil, fmt.Errorf("upgrading history from format %d to %d: %w", v, v+1, err)
+			}
+		}
+		doc["version"] = historyVersion
+		var err error
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, err
+		}
+	}
+
+	var h history
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, err
+	}
+	h.Version = max(head.Version, historyVersion)
+	if version < historyVersion {
+		h.upgradedFrom, h.original = version, original
+	}
+	return &h, nil
+}
+
+// backupHistory keeps a copy of upgraded history as it was read, at path
+// plus .v1 and so on, before it is first saved in the new format. An
+// existing backup is left alone.
+func backupHistory(path string, h *history) error {
+	if h.upgradedFrom == 0 {
+		return nil
+	}
+	backup := fmt.Sprintf("%s.v%d", path, h.upgradedFrom)
+	if _, err := os.Stat(backup); err == nil {
+		return nil
+	}
+	if err := os.WriteFile(backup, h.original, 0o644); err != nil {
+		return fmt.Errorf("backing up history before upgrading it: %w", err)
+	}
+	return nil
+}
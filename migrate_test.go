@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDecodeHistory(t *testing.T) {
+	tests := []struct {
+		name         string
+		data         string
+		wantVersion  int
+		wantIDs      []string
+		wantUpgraded int
+		wantErr      bool
+	}{
+		{
+			name:        "unversioned file is format 1",
+			data:        `{"videos":[{"id":"video_2","prompt":"b"},{"id":"video_1","prompt":"a"}]}`,
+			wantVersion: 1,
+			wantIDs:     []string{"video_2", "video_1"},
+		},
+		{
+			name:        "current format",
+			data:        `{"version":1,"videos":[{"id":"video_1","model":"sora-2","tags":["x"]}]}`,
+			wantVersion: 1,
+			wantIDs:     []string{"video_1"},
+		},
+		{
+			name:        "newer format keeps its version and what this build knows",
+			data:        `{"version":7,"videos":[{"id":"video_1","shiny_new_field":{"a":1}}]}`,
+			wantVersion: 7,
+			wantIDs:     []string{"video_1"},
+		},
+		{name: "no videos", data: `{"version":1}`, wantVersion: 1},
+		{name: "not JSON", data: `{"videos":[`, wantErr: true},
+		{name: "wrong shape", data: `{"videos":{"id":"video_1"}}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := decodeHistory([]byte(tt.data))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %+v, want an error", h)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h.Version != tt.wantVersion || h.upgradedFrom != tt.wantUpgraded {
+				t.Errorf("version %d upgraded from %d, want %d from %d", h.Version, h.upgradedFrom, tt.wantVersion, tt.wantUpgraded)
+			}
+			var ids []string
+			for _, v := range h.Videos {
+				ids = append(ids, v.ID)
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.wantIDs, ",") {
+				t.Errorf("videos %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+// TestHistoryMigrations checks that every older format has a step to the
+// next one, and that no step is left over from a format that doesn't exist
+func TestHistoryMigrations(t *testing.T) {
+	for v := 1; v < historyVersion; v++ {
+		if historyMigrations[v] == nil {
+			t.Errorf("no migration from history format %d to %d", v, v+1)
+		}
+	}
+	for v := range historyMigrations {
+		if v < 1 || v >= historyVersion {
+			t.Errorf("migration from format %d, but formats only go from 1 to %d", v, historyVersion)
+		}
+	}
+}
+
+func TestBackupHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+	if err := backupHistory(path, &history{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".v0"); err == nil {
+		t.Error("backed up history that wasn't upgraded")
+	}
+
+	h := &history{upgradedFrom: 1, original: []byte(`{"videos":[]}`)}
+	if err := backupHistory(path, h); err != nil {
+		t.Fatal(err)
+	}
+	// A second upgrade leaves the first backup alone
+	if err := backupHistory(path, &history{upgradedFrom: 1, original: []byte(`{}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(path + ".v1"); err != nil || string(got) != `{"videos":[]}` {
+		t.Errorf("backup = %q, %v; want the original file", got, err)
+	}
+}
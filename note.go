@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// runNote implements `sora-cli note <ref> [text]`: attach a free-form note
+// to a history entry, or print the current one when no text is given
+func runNote(args []string) {
+	fs := newFlagSet("note", "<@last|@N|video_id> [text] [flags]")
+	var clearNote bool
+	fs.BoolVar(&clearNote, "clear", false, "Remove the note")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 || (clearNote && fs.NArg() > 1) {
+		fs.Usage()
+		os.Exit(2)
+	}
+	id, err := resolveVideoRef(fs.Arg(0))
+	if err != nil {
+		fail("", "failed to resolve video reference", err)
+	}
+
+	if fs.NArg() == 1 && !clearNote {
+		e := findHistoryEntry(id)
+		if e == nil {
+			fmt.Fprintf(os.Stderr, "%s is not in history\n", id)
+			os.Exit(1)
+		}
+		if jsonOutput {
+			printJSON(map[string]string{"id": id, "note": e.Note})
+		} else if e.Note != "" {
+			fmt.Println(e.Note)
+		}
+		return
+	}
+
+	note := strings.TrimSpace(strings.Join(fs.Args()[1:], " "))
+	found, err := updateHistoryEntry(id, func(e *videoHistoryEntry) { e.Note = note })
+	if err != nil {
+		fail("", "failed to update history", err)
+	}
+	if !found {
+		fmt.Fprintf(os.Stderr, "%s is not in history\n", id)
+		os.Exit(1)
+	}
+	if note == "" {
+		infof("Removed note from %s\n", id)
+	} else {
+		infof("Noted %s\n", id)
+	}
+}
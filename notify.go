@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+// notifyTimeout bounds each webhook delivery so a slow receiver can't hold
+// up the command after the job itself is done
+const notifyTimeout = 15 * time.Second
+
+// discordMaxContent is the longest message Discord accepts
+const discordMaxContent = 2000
+
+// Default chat messages, used when the config doesn't set its own
+const (
+	defaultNotifyMessage        = `Sora video ready in {{.Duration}}{{with .Cost}} ({{.}}){{end}}: "{{truncate 100 .Prompt}}" → {{.Output}}`
+	defaultNotifyFailureMessage = `Sora job{{with .ID}} {{.}}{{end}} failed: {{.Error}} ("{{truncate 100 .Prompt}}")`
+)
+
+// jobNotification is the JSON body POSTed to --notify-url when a job
+// finishes, one way or the other
+type jobNotification struct {
+	Event    string     `json:"event"`  // job.completed or job.failed
+	Status   string     `json:"status"` // completed or failed
+	Time     string     `json:"time"`
+	ID       string     `json:"id,omitempty"`
+	Label    string     `json:"label,omitempty"` // batch line or --explore variation
+	Prompt   string     `json:"prompt,omitempty"`
+	Model    string     `json:"model,omitempty"`
+	Seconds  string     `json:"seconds,omitempty"` // video length
+	Output   string     `json:"output,omitempty"`
+	Duration float64    `json:"duration_seconds,omitempty"` // wall time since submission
+	Cost     float64    `json:"estimated_cost_usd,omitempty"`
+	Error    *jsonError `json:"error,omitempty"`
+}
+
+// notifyMessage is what chat message templates see: the notification with
+// duration, cost, and error preformatted for people
+type notifyMessage struct {
+	jobNotification
+	Duration string // e.g. "2m 41s"
+	Cost     string // e.g. "$2.40", or "" when the price isn't known
+	Error    string // failure message, or ""
+}
+
+// jobNotifier reports job outcomes to --notify-url, the desktop (--notify),
+// and the chat services in the config file. It remembers the current job so a failure reported
+// through fail() still names the prompt.
+type jobNotifier struct {
+	url     string
+	desktop bool // --notify
+	quiet   bool // --no-notify: skip the config file's notifications
+	job     jobNotification
+	started time.Time
+}
+
+// notifier is shared like jsonOutput, since failures can end the command
+// from anywhere
+var notifier jobNotifier
+
+// addNotifyFlags registers --notify, --notify-url, and --no-notify
+func addNotifyFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&notifier.desktop, "notify", false, "Show a desktop notification when a job completes or fails")
+	fs.StringVar(&notifier.url, "notify-url", "", "POST a JSON summary to this URL when a job completes or fails")
+	fs.BoolVar(&notifier.quiet, "no-notify", false, "Don't send the notifications configured in the config file")
+}
+
+// validateNotify checks --notify and --notify-url before any job is submitted
+func validateNotify() error {
+	if notifier.desktop {
+		if err := checkDesktopNotifier(); err != nil {
+			return err
+		}
+	}
+	if notifier.url == "" {
+		return nil
+	}
+	u, err := url.Parse(notifier.url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("--notify-url must be an http or https URL, got %q", notifier.url)
+	}
+	return nil
+}
+
+// requested reports whether a notification flag was given; they only make
+// sense for commands that wait for the job
+func (n *jobNotifier) requested() bool {
+	return n.url != "" || n.desktop
+}
+
+// track records the job that later notifications are about. The duration
+// is measured from the first call.
+func (n *jobNotifier) track(id, prompt, model string) {
+	n.job = jobNotification{ID: id, Prompt: prompt, Model: model}
+	if n.started.IsZero() {
+		n.started = time.Now()
+	}
+}
+
+// completed reports that the tracked job was saved to output. The final
+// status supplies the video length for the cost, and the server's creation
+// time when it has one, so attach reports the whole generation.
+func (n *jobNotifier) completed(output string, st *videoStatusResponse) {
+	job := n.job
+	job.Output = output
+	started := n.started
+	if st != nil {
+		if st.Model != "" {
+			job.Model = st.Model
+		}
+		job.Seconds = st.Seconds
+		if st.CreatedAt > 0 {
+			started = time.Unix(st.CreatedAt, 0)
+		}
+	}
+	if !started.IsZero() {
+		job.Duration = time.Since(started).Seconds()
+	}
+	job.Cost, _ = videoCost(job.Model, job.Seconds)
+	n.send("completed", job)
+}
+
+// failed reports that the tracked job (or the job id, if nothing is
+// tracked yet) failed with err
+func (n *jobNotifier) failed(id string, err error) {
+	job := n.job
+	if id != "" {
+		job.ID = id
+	}
+	if !n.started.IsZero() {
+		job.Duration = time.Since(n.started).Seconds()
+	}
+	job.Error = newJSONError(err)
+	n.send("failed", job)
+}
+
+// send delivers job with the given status to every configured destination.
+// Delivery problems are only warned about: the video itself is already done.
+func (n *jobNotifier) send(status string, job jobNotification) {
+	chat := !n.quiet && cfg.Notifications.enabled()
+	if !n.requested() && !chat {
+		return
+	}
+	job.Event, job.Status = "job."+status, status
+	job.Time = time.Now().UTC().Format(time.RFC3339)
+
+	if n.url != "" {
+		if body, err := json.Marshal(job); err == nil {
+			postNotification(n.url, n.url, "application/json", body, nil)
+		}
+	}
+	if n.desktop {
+		showDesktopNotification(desktopMessage(job))
+	}
+	if chat {
+		cfg.Notifications.deliver(job)
+	}
+}
+
+// desktopMessage returns the title and body of a desktop notification:
+// the prompt, and where the video was saved or why it failed
+func desktopMessage(job jobNotification) (title, body string) {
+	prompt := truncate(singleLine(job.Prompt), 100)
+	if job.Status == "failed" {
+		reason := "unknown error"
+		if job.Error != nil {
+			reason = job.Error.Message
+		}
+		return "Sora job failed", prompt + "\n" + reason
+	}
+	return "Sora video ready", prompt + "\nSaved to " + filepath.Base(job.Output)
+}
+
+// postNotification POSTs body to target, warning on failure. name stands
+// in for the URL in warnings, since chat webhook URLs are secrets.
+func postNotification(name, target, contentType string, body []byte, header http.Header) {
+	// Not the API client: the receiver must not see API headers such as
+	// OpenAI-Organization, and Ctrl-C shouldn't cancel a failure report
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		infof("Warning: notification to %s failed: %v\n", name, err)
+		return
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		infof("Warning: notification to %s failed: %v\n", name, err)
+		return
+	}
+	defer closeBody(resp)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		infof("Warning: notification to %s failed: %s\n", name, resp.Status)
+	}
+}
+
+// validate checks the URLs and parses the message templates
+func (c *notifications) validate() error {
+	for _, u := range []struct{ key, value string }{
+		{"slack_webhook", c.SlackWebhook},
+		{"discord_webhook", c.DiscordWebhook},
+		{"ntfy_server", c.NtfyServer},
+	} {
+		if u.value == "" {
+			continue
+		}
+		if parsed, err := url.Parse(u.value); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("%s must be an http or https URL", u.key)
+		}
+	}
+	if c.NtfyTopic != "" && !strings.Contains(c.NtfyTopic, "://") && strings.ContainsAny(c.NtfyTopic, "/ ") {
+		return fmt.Errorf("ntfy_topic must be a topic name or a full URL, got %q", c.NtfyTopic)
+	}
+
+	var err error
+	if c.message, err = parseNotifyTemplate("message", c.Message, defaultNotifyMessage); err != nil {
+		return err
+	}
+	if c.failureMessage, err = parseNotifyTemplate("failure_message", c.FailureMessage, defaultNotifyFailureMessage); err != nil {
+		return err
+	}
+	return nil
+}
+
+// parseNotifyTemplate parses text, or def when text is empty. The template
+// is tried against a sample message so a misspelled field fails at load time
+// rather than after a long generation.
+func parseNotifyTemplate(name, text, def string) (*template.Template, error) {
+	if text == "" {
+		text = def
+	}
+	t, err := template.New(name).Funcs(template.FuncMap{
+		"truncate": func(n int, s string) string { return truncate(singleLine(s), n) },
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template: %w", name, err)
+	}
+	if err := t.Execute(io.Discard, notifyMessage{}); err != nil {
+		return nil, fmt.Errorf("invalid %s template: %w", name, err)
+	}
+	return t, nil
+}
+
+// enabled reports whether any chat service is configured
+func (c *notifications) enabled() bool {
+	return c.SlackWebhook != "" || c.DiscordWebhook != "" || c.NtfyTopic != ""
+}
+
+// ntfyURL returns the URL to publish to
+func (c *notifications) ntfyURL() string {
+	if strings.Contains(c.NtfyTopic, "://") {
+		return c.NtfyTopic
+	}
+	server := c.NtfyServer
+	if server == "" {
+		server = "https://ntfy.sh"
+	}
+	return strings.TrimSuffix(server, "/") + "/" + c.NtfyTopic
+}
+
+// deliver renders the message for job and sends it to each chat service
+func (c *notifications) deliver(job jobNotification) {
+	msg := notifyMessage{jobNotification: job, Duration: "unknown"}
+	if job.Duration > 0 {
+		msg.Duration = formatDuration(time.Duration(job.Duration * float64(time.Second)))
+	}
+	if job.Cost > 0 {
+		msg.Cost = fmt.Sprintf("$%.2f", job.Cost)
+	}
+	if job.Error != nil {
+		msg.Error = job.Error.Message
+	}
+	t, title, tag := c.message, "Sora video ready", "white_check_mark"
+	if job.Status == "failed" {
+		t, title, tag = c.failureMessage, "Sora job failed", "x"
+	}
+	var sb strings.Builder
+	if err := t.Execute(&sb, msg); err != nil {
+		infof("Warning: notification message: %v\n", err)
+		return
+	}
+	text := sb.String()
+
+	if c.SlackWebhook != "" {
+		body, _ := json.Marshal(map[string]string{"text": text})
+		postNotification("Slack", c.SlackWebhook, "application/json", body, nil)
+	}
+	if c.DiscordWebhook != "" {
+		body, _ := json.Marshal(map[string]string{"content": truncate(text, discordMaxContent)})
+		postNotification("Discord", c.DiscordWebhook, "application/json", body, nil)
+	}
+	if c.NtfyTopic != "" {
+		h := http.Header{}
+		h.Set("Title", title)
+		h.Set("Tags", tag)
+		if c.NtfyToken != "" {
+			h.Set("Authorization", "Bearer "+c.NtfyToken)
+		}
+		postNotification("ntfy", c.ntfyURL(), "text/plain; charset=utf-8", []byte(text), h)
+	}
+}
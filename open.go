@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// playerCommand returns the command that plays path: the configured
+// player, or the platform's handler for the file type
+func playerCommand(path string) (*exec.Cmd, error) {
+	if args := strings.Fields(cfg.Player); len(args) > 0 {
+		return exec.Command(args[0], append(args[1:], path)...), nil
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", path), nil
+	case "windows":
+		// start is a cmd builtin; its first quoted argument is a window title
+		return exec.Command("cmd", "/c", "start", "", path), nil
+	case "linux", "freebsd", "openbsd", "netbsd":
+		return exec.Command("xdg-open", path), nil
+	}
+	return nil, fmt.Errorf("no default player on %s; set player in the config file", runtime.GOOS)
+}
+
+// openVideo launches the player on path (--open) without waiting for it,
+// warning if it can't
+func openVideo(path string) {
+	cmd, err := playerCommand(path)
+	if err == nil {
+		err = cmd.Start()
+	}
+	if err != nil {
+		infof("Warning: could not open %s: %v\n", path, err)
+		return
+	}
+	// The player may outlive sora-cli
+	cmd.Process.Release()
+}
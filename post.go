@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+// Limits for post-processing flags; beyond these the result is rarely useful
+// and usually a typo (e.g. --hold-last 2 meaning 2s, not 2ns)
+const (
+	minSpeed        = 0.25
+	maxSpeed        = 4.0
+	maxHoldLast     = time.Minute
+	minCardDuration = 0.5
+	maxCardDuration = 30.0
+)
+
+// postOptions are the ffmpeg steps applied to a downloaded video
+type postOptions struct {
+	stabilize bool
+	kenBurns  string
+	keys      []kenBurnsKey // parsed from kenBurns by validate
+	speed     float64
+	reverse   bool
+	pingpong  bool
+	holdLast  time.Duration
+	encode    encodeOptions
+	safeArea  string   // platform whose interface is previewed over a copy
+	exports   []string // extra formats written alongside (--export)
+	gif       gifOptions
+
+	titleCard, endCard string  // stills shown before and after the video
+	cardDuration       float64 // seconds each card is shown
+}
+
+// addPostFlags registers the post-processing flags
+func addPostFlags(fs *flag.FlagSet, p *postOptions) {
+	fs.BoolVar(&p.stabilize, "stabilize", false, "Remove camera shake (two ffmpeg passes; needs ffmpeg built with libvidstab)")
+	fs.StringVar(&p.kenBurns, "kenburns", "", "Zoom and pan between keyframes SECONDS:ZOOM[,X,Y], e.g. \"0:1 8:1.3,0.7,0.4\"")
+	fs.Float64Var(&p.speed, "speed", 1, fmt.Sprintf("Change playback speed, e.g. 0.5 (half speed) or 2 (double); %g to %g", minSpeed, maxSpeed))
+	fs.BoolVar(&p.reverse, "reverse", false, "Play the video backwards")
+	fs.BoolVar(&p.pingpong, "pingpong", false, "Play forwards then backwards, for a seamless loop (drops audio)")
+	fs.DurationVar(&p.holdLast, "hold-last", 0, "Freeze the last frame for this long at the end, e.g. 2s")
+	fs.StringVar(&p.titleCard, "title-card", "", "Show this image (JPEG, PNG, WebP) before the video")
+	fs.StringVar(&p.endCard, "end-card", "", "Show this image (JPEG, PNG, WebP) after the video")
+	fs.Float64Var(&p.cardDuration, "card-duration", 2, fmt.Sprintf("Seconds each --title-card and --end-card is shown; %g to %g", minCardDuration, maxCardDuration))
+	addEncodeFlags(fs, &p.encode)
+	fs.StringVar(&p.safeArea, "safe-area", "", "Also write a preview with a platform's UI regions marked: "+strings.Join(safeAreaNames(), ", "))
+	fs.StringSliceVar(&p.exports, "export", nil, "Also transcode the video to these formats, written alongside it: "+strings.Join(exportFormatNames(), ", "))
+	addGIFFlags(fs, &p.gif)
+}
+
+// enabled reports whether any post-processing was requested
+func (p *postOptions) enabled() bool {
+	return p.reencodes() || p.safeArea != "" || len(p.exports) > 0 || p.gif.export
+}
+
+// reencodes reports whether the video itself is changed; safe-area
+// previews, exports, and GIFs are written alongside it instead
+func (p *postOptions) reencodes() bool {
+	return p.stabilize || p.kenBurns != "" || p.speed != 1 || p.reverse || p.pingpong || p.holdLast > 0 || p.hasCards() || p.encode.enabled()
+}
+
+// hasCards reports whether a title or end card was given
+func (p *postOptions) hasCards() bool {
+	return p.titleCard != "" || p.endCard != ""
+}
+
+// validate checks the flag values; output is the -o value, since a video
+// streamed to stdout can't be processed afterwards
+func (p *postOptions) validate(output string) error {
+	if p.speed < minSpeed || p.speed > maxSpeed {
+		return fmt.Errorf("--speed must be between %g and %g", minSpeed, maxSpeed)
+	}
+	if p.holdLast < 0 || p.holdLast > maxHoldLast {
+		return fmt.Errorf("--hold-last must be between 0 and %s", maxHoldLast)
+	}
+	if p.cardDuration < minCardDuration || p.cardDuration > maxCardDuration {
+		return fmt.Errorf("--card-duration must be between %g and %g seconds", minCardDuration, maxCardDuration)
+	}
+	for _, card := range []struct{ flag, path string }{{"--title-card", p.titleCard}, {"--end-card", p.endCard}} {
+		if card.path == "" {
+			continue
+		}
+		if !isImageFile(card.path) {
+			return fmt.Errorf("%s must be a JPEG, PNG, or WebP image", card.flag)
+		}
+		if _, err := os.Stat(card.path); err != nil {
+			return fmt.Errorf("%s: %w", card.flag, err)
+		}
+	}
+	if err := p.encode.resolve(); err != nil {
+		return err
+	}
+	if err := p.gif.validate(); err != nil {
+		return err
+	}
+	exports, err := validateExports(p.exports)
+	if err != nil {
+		return err
+	}
+	p.exports = exports
+	if p.kenBurns != "" {
+		keys, err := parseKenBurns(p.kenBurns)
+		if err != nil {
+			return fmt.Errorf("--kenburns: %w", err)
+		}
+		p.keys = keys
+	}
+	if p.safeArea != "" {
+		p.safeArea = strings.ToLower(p.safeArea)
+		if _, ok := safeAreaLayouts[p.safeArea]; !ok {
+			return fmt.Errorf("unknown --safe-area %q (available: %s)", p.safeArea, strings.Join(safeAreaNames(), ", "))
+		}
+	}
+	if p.enabled() && output == "-" {
+		return errors.New("post-processing options cannot be used with -o -")
+	}
+	if p.enabled() && !isFFmpegAvailable() {
+		return errors.New(ffmpegInstallMsg)
+	}
+	if p.stabilize && !ffmpegHasFilter("vidstabdetect") {
+		return errors.New("--stabilize needs an ffmpeg built with libvidstab (--enable-libvidstab); this one doesn't have the vidstab filters")
+	}
+	return nil
+}
+
+// apply runs the requested steps on path, then writes the safe-area
+// preview, other formats, and GIF of the result, if they were asked for
+func (p *postOptions) apply(ctx context.Context, path string) error {
+	if p.reencodes() {
+		if err := p.transform(ctx, path); err != nil {
+			return err
+		}
+	}
+	if p.safeArea != "" {
+		preview, err := renderSafeArea(ctx, path, p.safeArea)
+		if err != nil {
+			return err
+		}
+		infof("Safe-area preview saved to: %s\n", preview)
+	}
+	for _, format := range p.exports {
+		out, err := renderExport(ctx, path, format)
+		if err != nil {
+			return err
+		}
+		infof("%s copy saved to: %s\n", strings.ToUpper(format), out)
+	}
+	if p.gif.export {
+		gif, err := renderGIF(ctx, path, p.gif)
+		if err != nil {
+			return err
+		}
+		infof("GIF saved to: %s\n", gif)
+	}
+	return nil
+}
+
+// transform re-encodes path in place with the requested filters. The result
+// replaces the original only once ffmpeg has succeeded.
+func (p *postOptions) transform(ctx context.Context, path string) error {
+	var in postInput
+	var err error
+	in.audio, err = hasAudioTrack(path)
+	if err != nil {
+		return err
+	}
+	// Backwards audio doesn't loop smoothly, so ping-pong loops are silent
+	in.audio = in.audio && !p.pingpong
+	if len(p.keys) > 0 || p.hasCards() {
+		if in.width, in.height, err = getVideoDimensions(path); err != nil {
+			return err
+		}
+		if in.fps, err = getVideoFrameRate(path); err != nil {
+			return err
+		}
+	}
+
+	// Stabilizing takes an analysis pass that writes the camera motion to
+	// a transforms file, which the main pass then reads
+	if p.stabilize {
+		if in.transforms, err = detectShake(ctx, path); err != nil {
+			return err
+		}
+		defer os.Remove(in.transforms)
+	}
+
+	// A target bitrate is met with a two-pass encode; the first pass only
+	// measures the (filtered) video
+	var passLog string
+	if p.encode.bitrate != "" {
+		b := newFFmpeg().Input(path)
+		p.addFilters(b, postInput{transforms: in.transforms, width: in.width, height: in.height, fps: in.fps})
+		if passLog, err = p.encode.firstPass(ctx, b); err != nil {
+			return err
+		}
+		defer os.RemoveAll(filepath.Dir(passLog))
+	}
+
+	b := newFFmpeg().Input(path)
+	p.addFilters(b, in)
+	p.encode.addVideoCodec(b, 2, passLog)
+	p.encode.addAudioCodec(b, in.audio)
+	// Put the index first so players and upload checks can start reading
+	// before the whole file arrives
+	b.Option("-movflags", "+faststart+write_colr")
+	return b.RunReplacing(ctx, path)
+}
+
+// postInput is what apply learns about the video before building the chain
+type postInput struct {
+	audio         bool
+	transforms    string // vid.stab motion file, when stabilizing
+	width, height int
+	fps           float64
+}
+
+// addFilters appends the post-processing chain in a fixed order:
+// stabilization (on the original frames the motion was measured on), Ken
+// Burns (whose keyframe times refer to the original clip), speed, reverse,
+// ping-pong, then the hold, so the hold is always on the last frame of the
+// finished clip. Cards go around the result.
+func (p *postOptions) addFilters(b *ffmpegBuilder, in postInput) {
+	audio := in.audio
+	if p.hasCards() {
+		// The cards are extra inputs, so the video's chain must name its own
+		b.Filter(newFilter("null").From("0:v"))
+	}
+	if in.transforms != "" {
+		b.Filter(newFilter("vidstabtransform").String("input", in.transforms).Int("smoothing", 10))
+		// Stabilizing resamples every frame; vid.stab recommends sharpening after
+		b.Filter(newFilter("unsharp").Int("luma_msize_x", 5).Int("luma_msize_y", 5).Float("luma_amount", 0.8))
+	}
+	if len(p.keys) > 0 {
+		addKenBurns(b, p.keys, in.width, in.height, in.fps)
+	}
+	if p.speed != 1 {
+		b.Filter(newFilter("setpts").String("expr", fmt.Sprintf("PTS/%g", p.speed)))
+		if audio {
+			for _, tempo := range atempoSteps(p.speed) {
+				b.AudioFilter(newFilter("atempo").Float("tempo", tempo))
+			}
+		}
+	}
+	if p.reverse {
+		b.Filter(newFilter("reverse"))
+		if audio {
+			b.AudioFilter(newFilter("areverse"))
+		}
+	}
+	if p.pingpong {
+		// Drop the first and last frames of the backwards half so neither
+		// turning point shows the same frame twice
+		b.Filter(newFilter("split").To("fwd", "back"))
+		b.Filter(newFilter("trim").From("back").Int("start_frame", 1))
+		b.Filter(newFilter("reverse"))
+		b.Filter(newFilter("trim").Int("start_frame", 1))
+		b.Filter(newFilter("setpts").String("expr", "PTS-STARTPTS").To("rev"))
+		b.Filter(newFilter("concat").From("fwd", "rev").Int("n", 2).Int("v", 1).Int("a", 0))
+	}
+	if p.holdLast > 0 {
+		b.Filter(newFilter("tpad").String("stop_mode", "clone").Float("stop_duration", p.holdLast.Seconds()))
+		if audio {
+			b.AudioFilter(newFilter("apad").Float("pad_dur", p.holdLast.Seconds()))
+		}
+	}
+	if p.hasCards() {
+		p.addCards(b, in)
+	}
+}
+
+// addCards joins the title card, the video, and the end card. Each still
+// becomes a segment of the video's size and frame rate (after --speed), so
+// concat can join them; the audio is shifted and padded to line up.
+func (p *postOptions) addCards(b *ffmpegBuilder, in postInput) {
+	d := time.Duration(p.cardDuration * float64(time.Second))
+	b.Filter(newFilter("setsar").String("sar", "1").To("main"))
+	segments := []string{"main"}
+	if p.titleCard != "" {
+		b.StillInput(p.titleCard, d)
+		addCard(b, b.ninputs-1, "title", in.width, in.height, in.fps*p.speed)
+		segments = append([]string{"title"}, segments...)
+	}
+	if p.endCard != "" {
+		b.StillInput(p.endCard, d)
+		addCard(b, b.ninputs-1, "end", in.width, in.height, in.fps*p.speed)
+		segments = append(segments, "end")
+	}
+	b.Filter(newFilter("concat").From(segments...).Int("n", len(segments)).Int("v", 1).Int("a", 0))
+
+	if in.audio {
+		if p.titleCard != "" {
+			b.AudioFilter(newFilter("adelay").String("delays", fmt.Sprintf("%dms", d.Milliseconds())).Int("all", 1))
+		}
+		if p.endCard != "" {
+			b.AudioFilter(newFilter("apad").Float("pad_dur", d.Seconds()))
+		}
+	}
+}
+
+// addCard fits the still from input into a w x h frame, letterboxed, and
+// labels the result
+func addCard(b *ffmpegBuilder, input int, label string, w, h int, fps float64) {
+	b.Filter(newFilter("scale").From(fmt.Sprintf("%d:v", input)).Int("w", w).Int("h", h).String("force_original_aspect_ratio", "decrease"))
+	b.Filter(newFilter("pad").Int("w", w).Int("h", h).String("x", "(ow-iw)/2").String("y", "(oh-ih)/2"))
+	b.Filter(newFilter("setsar").String("sar", "1"))
+	b.Filter(newFilter("fps").Float("fps", fps))
+	b.Filter(newFilter("format").String("pix_fmts", "yuv420p").To(label))
+}
+
+// detectShake runs the vid.stab analysis pass over path and returns the
+// transforms file it wrote; the caller removes it
+func detectShake(ctx context.Context, path string) (string, error) {
+	tmp, err := os.CreateTemp("", "sora-vidstab-*.trf")
+	if err != nil {
+		return "", fmt.Errorf("creating temp file: %w", err)
+	}
+	transforms := tmp.Name()
+	tmp.Close()
+
+	err = newFFmpeg().
+		Input(path).
+		Filter(newFilter("vidstabdetect").Int("shakiness", 5).Int("accuracy", 15).String("result", transforms)).
+		Option("-f", "null").
+		Output(os.DevNull).
+		Run(ctx)
+	if err != nil {
+		os.Remove(transforms)
+		return "", fmt.Errorf("analyzing camera motion: %w", err)
+	}
+	return transforms, nil
+}
+
+// atempoSteps splits a speed factor into atempo filters, which older ffmpeg
+// builds only accept between 0.5 and 2 each
+func atempoSteps(speed float64) []float64 {
+	var steps []float64
+	for speed > 2 {
+		steps = append(steps, 2)
+		speed /= 2
+	}
+	for speed < 0.5 {
+		steps = append(steps, 0.5)
+		speed /= 0.5
+	}
+	return append(steps, speed)
+}
+
+// postProcess applies p to a finished download, exiting on failure since the
+// caller asked for a result ffmpeg couldn't produce. Callers record the job
+// in history first, so a failure here doesn't lose the video.
+func postProcess(ctx context.Context, p *postOptions, path string) {
+	if !p.enabled() || path == "-" {
+		return
+	}
+	infof("Post-processing %s...\n", path)
+	if err := p.apply(ctx, path); err != nil {
+		fail("", "post-processing error", fmt.Errorf("%w (the unprocessed video is still at %s)", err, path))
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/chai2010/webp"
+	"github.com/disintegration/imaging"
+	"golang.org/x/term"
+)
+
+// previewInterval is the least time between --live-preview fetches; each
+// one downloads a whole frame
+const previewInterval = 10 * time.Second
+
+// previewTimeout bounds one preview fetch, so a slow one doesn't hold up
+// polling
+const previewTimeout = 30 * time.Second
+
+// previewColumns is how wide inline previews are drawn, in terminal cells
+const previewColumns = 40
+
+// livePreview fetches the frames the API shows of a job while it renders
+// (--live-preview), saving each new one and drawing it inline in terminals
+// that can show images
+type livePreview struct {
+	c                   *http.Client
+	baseURL, apiKey, id string
+
+	path   string // where the latest frame is written
+	inline string // terminal image protocol: "iterm", "kitty", or ""
+
+	last   time.Time
+	digest [sha256.Size]byte
+	tries  int
+	frames int
+}
+
+func newLivePreview(c *http.Client, baseURL, apiKey, id, output string) *livePreview {
+	return &livePreview{c: c, baseURL: baseURL, apiKey: apiKey, id: id, path: previewPath(output, id), inline: inlineImageProtocol()}
+}
+
+// previewPath returns where live preview frames of job id are saved: next
+// to its output as name.preview.jpg, or in the output directory
+func previewPath(output, id string) string {
+	if output == "" || output == "-" {
+		return filepath.Join(cfg.OutputDir, id+".preview.jpg")
+	}
+	return strings.TrimSuffix(output, filepath.Ext(output)) + ".preview.jpg"
+}
+
+// inlineImageProtocol returns the image protocol the terminal on stderr
+// understands, or "" if it has none sora-cli knows. Multiplexers like tmux
+// pass neither through by default.
+func inlineImageProtocol() string {
+	if !term.IsTerminal(int(os.Stderr.Fd())) || os.Getenv("TMUX") != "" || strings.HasPrefix(os.Getenv("TERM"), "screen") {
+		return ""
+	}
+	switch {
+	case os.Getenv("KITTY_WINDOW_ID") != "" || os.Getenv("TERM") == "xterm-kitty" || os.Getenv("TERM_PROGRAM") == "ghostty":
+		return "kitty"
+	case os.Getenv("TERM_PROGRAM") == "iTerm.app" || os.Getenv("TERM_PROGRAM") == "WezTerm":
+		return "iterm"
+	}
+	return ""
+}
+
+// poll fetches the current frame if previewInterval has passed since the
+// last try. The API may have nothing to show yet, so failures are quiet.
+func (p *livePreview) poll(ctx context.Context) {
+	if time.Since(p.last) < previewInterval {
+		return
+	}
+	p.last = time.Now()
+	p.tries++
+
+	ctx, cancel := context.WithTimeout(ctx, previewTimeout)
+	defer cancel()
+	url := strings.TrimRight(p.baseURL, "/") + "/videos/" + p.id + "/content?variant=thumbnail"
+	resp, err := openDownload(ctx, p.c, p.apiKey, url)
+	if err != nil {
+		return
+	}
+	defer closeBody(resp)
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 20<<20))
+	if err != nil {
+		return
+	}
+	digest := sha256.Sum256(data)
+	if digest == p.digest {
+		return
+	}
+	var img image.Image
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "image/webp") {
+		img, err = webp.Decode(bytes.NewReader(data))
+	} else {
+		img, _, err = image.Decode(bytes.NewReader(data))
+	}
+	if err != nil {
+		return
+	}
+	p.digest = digest
+	if err := p.save(img); err != nil {
+		warnf("\nWarning: could not save preview frame: %v\n", err)
+		return
+	}
+	p.frames++
+	if p.frames == 1 {
+		infof("\nLive preview: %s (updated as the job renders)\n", p.path)
+	}
+	emitEvent(jsonEvent{Event: "preview", ID: p.id, Output: p.path})
+	p.draw(img)
+}
+
+// save writes img to p.path, replacing the previous frame in one step so a
+// viewer watching the file never sees half of one
+func (p *livePreview) save(img image.Image) error {
+	if dir := filepath.Dir(p.path); dir != "." && dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	tmp := p.path + ".part"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := imaging.Encode(f, img, imaging.JPEG, imaging.JPEGQuality(85)); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, p.path)
+}
+
+// draw shows img on stderr using the terminal's image protocol, if any
+func (p *livePreview) draw(img image.Image) {
+	if p.inline == "" {
+		return
+	}
+	var buf bytes.Buffer
+	small := imaging.Fit(img, 640, 640, imaging.Lanczos)
+	if err := imaging.Encode(&buf, small, imaging.PNG); err != nil {
+		return
+	}
+	data := base64.StdEncoding.EncodeToString(buf.Bytes())
+
+	var out strings.Builder
+	out.WriteString("\n")
+	switch p.inline {
+	case "iterm":
+		fmt.Fprintf(&out, "\x1b]1337;File=inline=1;size=%d;width=%d;preserveAspectRatio=1:%s\a", buf.Len(), previewColumns, data)
+	case "kitty":
+		// Kitty takes the image in chunks of at most 4096 base64 bytes
+		for first := true; data != ""; first = false {
+			chunk := data[:min(4096, len(data))]
+			data = data[len(chunk):]
+			more := 0
+			if data != "" {
+				more = 1
+			}
+			if first {
+				fmt.Fprintf(&out, "\x1b_Ga=T,f=100,c=%d,m=%d;%s\x1b\\", previewColumns, more, chunk)
+			} else {
+				fmt.Fprintf(&out, "\x1b_Gm=%d;%s\x1b\\", more, chunk)
+			}
+		}
+	}
+	out.WriteString("\n")
+	fmt.Fprint(os.Stderr, out.String())
+}
+
+// finish reports on the preview once the job has ended. The preview of a
+// finished job is removed, since the video itself replaces it.
+func (p *livePreview) finish(completed bool) {
+	switch {
+	case p.frames == 0 && p.tries > 0:
+		infof("The API offered no preview frames while %s rendered\n", p.id)
+	case p.frames > 0 && completed:
+		os.Remove(p.path)
+	case p.frames > 0:
+		infof("Last preview frame: %s\n", p.path)
+	}
+}
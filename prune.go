@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// runHistoryPrune implements `sora-cli history prune`: drop entries whose
+// files are gone or that are older than a cutoff. Favorites are kept.
+func runHistoryPrune(args []string) {
+	fs := newFlagSet("history prune", "[--missing] [--older-than <age>] [flags]")
+	var (
+		missing   bool
+		olderThan string
+		dryRun    bool
+	)
+	fs.BoolVar(&missing, "missing", false, "Drop entries whose output file no longer exists")
+	fs.StringVar(&olderThan, "older-than", "", "Drop entries created longer ago than this (e.g. 90d or 720h)")
+	fs.BoolVar(&dryRun, "dry-run", false, "Only show what would be dropped")
+	fs.Parse(args)
+
+	if fs.NArg() > 0 || (!missing && olderThan == "") {
+		fs.Usage()
+		os.Exit(2)
+	}
+	var cutoff time.Time
+	if olderThan != "" {
+		age, err := parseAge(olderThan)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --older-than: %v\n", err)
+			os.Exit(2)
+		}
+		cutoff = time.Now().Add(-age)
+	}
+
+	// prunable reports why an entry would be dropped, or "" to keep it
+	prunable := func(v videoHistoryEntry) string {
+		if v.Favorite {
+			return ""
+		}
+		if missing {
+			if status, _ := localStatus(v); status == "missing" {
+				return "file missing"
+			}
+		}
+		if !cutoff.IsZero() {
+			if created, err := time.Parse(time.RFC3339, v.CreatedAt); err == nil && created.Before(cutoff) {
+				return "created " + formatCreatedAt(v.CreatedAt)
+			}
+		}
+		return ""
+	}
+
+	var dropped []videoHistoryEntry
+	var reasons []string
+	prune := func(h *history) bool {
+		kept := h.Videos[:0]
+		for _, v := range h.Videos {
+			if why := prunable(v); why != "" {
+				dropped = append(dropped, v)
+				reasons = append(reasons, why)
+				continue
+			}
+			kept = append(kept, v)
+		}
+		h.Videos = kept
+		return len(dropped) > 0
+	}
+
+	if dryRun {
+		h, err := loadHistory()
+		if err != nil {
+			fail("", "failed to load history", err)
+		}
+		prune(h)
+	} else if err := editHistory(prune); err != nil {
+		fail("", "failed to update history", err)
+	}
+
+	if jsonOutput {
+		ids := make([]string, len(dropped))
+		for i, v := range dropped {
+			ids[i] = v.ID
+		}
+		printJSON(map[string]any{"dropped": ids, "dry_run": dryRun})
+		return
+	}
+	verb := "Dropped"
+	if dryRun {
+		verb = "Would drop"
+	}
+	for i, v := range dropped {
+		fmt.Printf("%s %s (%s)\n", verb, v.ID, reasons[i])
+	}
+	if len(dropped) == 0 {
+		infof("Nothing to prune\n")
+		return
+	}
+	infof("%s %d history entries\n", verb, len(dropped))
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// runRemix implements `sora-cli remix <ref>`: remix a previous Sora video
+// with a new prompt. Duration, resolution, and model come from the original
+// unless overridden; whether an override is allowed is up to the server.
+func runRemix(args []string) {
+	fs := newFlagSet("remix", "<@last|@N|video_id> [flags]")
+	var (
+		promptFile                  string
+		edit                        editOptions
+		prompt                      string
+		model                       string
+		usePro, portrait, landscape bool
+		seconds                     string
+		noWait                      bool
+		idemKey                     string
+		seedRef                     string
+		yes                         bool
+		translate                   translateOptions
+		post                        postOptions
+		opts                        jobOptions
+		common                      commonOptions
+
+		// Accepted only to explain why it can't be used
+		firstFrame string
+	)
+	fs.StringVarP(&prompt, "prompt", "p", "", "Text prompt describing the change (- reads it from stdin). If empty, reads interactively.")
+	addPromptFileFlag(fs, &promptFile)
+	addEditFlags(fs, &edit)
+	fs.StringVar(&model, "model", "", "Request a different model ID or alias (default: the original's)")
+	fs.BoolVar(&usePro, "pro", false, "Request sora-2-pro instead of the original's model")
+	fs.StringVar(&seconds, "seconds", "", "Request a different duration: 4, 8, or 12 (default: the original's)")
+	fs.BoolVar(&portrait, "portrait", false, "Request portrait output (720x1280)")
+	fs.BoolVar(&landscape, "landscape", false, "Request landscape output (1280x720)")
+	fs.BoolVar(&noWait, "no-wait", false, "Print the job ID and exit without waiting; resume later with 'sora-cli attach'")
+	fs.StringVar(&idemKey, "idempotency-key", "", "Submit with this Idempotency-Key, so rerunning the same command returns the job it already created")
+	addSeedFlag(fs, &seedRef)
+	addTranslateFlags(fs, &translate)
+	addJobFlags(fs, &opts)
+	addSessionFlag(fs, &opts.session)
+	addYesFlag(fs, &yes)
+	addPostFlags(fs, &post)
+	addCommonFlags(fs, &common)
+	fs.StringVar(&firstFrame, "first-frame", "", "")
+	fs.MarkHidden("first-frame")
+	fs.Parse(args)
+	common.requireWritable("remix videos")
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	prompt = mustReadPrompt(prompt, promptFile)
+	edit.exitIfInvalid(prompt, promptFile)
+
+	// Overrides are only sent when given; the server decides whether it
+	// accepts them, so only locally invalid values are rejected here
+	var overrides []string
+	body := remixVideoRequest{}
+	if usePro && model != "" {
+		fmt.Fprintln(os.Stderr, "Cannot use both --pro and --model")
+		os.Exit(2)
+	}
+	if usePro {
+		body.Model = "sora-2-pro"
+		overrides = append(overrides, "--pro")
+	} else if model != "" {
+		body.Model = cfg.resolveModel(model)
+		overrides = append(overrides, "--model")
+	}
+	if seconds != "" {
+		if seconds != "4" && seconds != "8" && seconds != "12" {
+			fmt.Fprintf(os.Stderr, "Invalid --seconds value: %s (must be 4, 8, or 12)\n", seconds)
+			os.Exit(2)
+		}
+		body.Seconds = seconds
+		overrides = append(overrides, "--seconds")
+	}
+	if portrait && landscape {
+		fmt.Fprintln(os.Stderr, "Cannot use both --portrait and --landscape")
+		os.Exit(2)
+	}
+	if portrait {
+		body.Size = "720x1280"
+		overrides = append(overrides, "--portrait")
+	} else if landscape {
+		body.Size = "1280x720"
+		overrides = append(overrides, "--landscape")
+	}
+	seed, err := resolveSeed(seedRef)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --seed: %v\n", err)
+		os.Exit(2)
+	}
+	if seed != nil {
+		body.Seed = seed
+		overrides = append(overrides, "--seed")
+	}
+	if noWait && opts.output == "-" {
+		fmt.Fprintln(os.Stderr, "Cannot use --no-wait with -o - (there is nothing to pipe yet)")
+		os.Exit(2)
+	}
+	if err := post.validate(opts.output); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	if opts.encrypted() && post.enabled() {
+		fmt.Fprintln(os.Stderr, "Error: post-processing can't be combined with --encrypt-to; the video is never decrypted on disk")
+		os.Exit(2)
+	}
+	if noWait && post.enabled() {
+		fmt.Fprintln(os.Stderr, "Cannot use post-processing options with --no-wait; pass them to 'sora-cli attach' instead")
+		os.Exit(2)
+	}
+	if err := validateNotify(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	if noWait && notifier.requested() {
+		fmt.Fprintln(os.Stderr, "Cannot use --notify or --notify-url with --no-wait; pass them to 'sora-cli attach' instead")
+		os.Exit(2)
+	}
+	if noWait && opts.livePreview {
+		fmt.Fprintln(os.Stderr, "Cannot use --live-preview with --no-wait; pass it to 'sora-cli attach' instead")
+		os.Exit(2)
+	}
+	if err := checkIdempotencyKey(idemKey); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	if firstFrame != "" {
+		fmt.Fprintln(os.Stderr, "Error: Cannot use --first-frame with remix.")
+		fmt.Fprintln(os.Stderr, "Use 'sora-cli create --first-frame' for image-to-video, or remix to modify existing Sora videos.")
+		os.Exit(2)
+	}
+
+	// Resolve the reference before asking for a prompt
+	sourceID, err := resolveRemoteRef(fs.Arg(0))
+	if err != nil {
+		fail("", "failed to resolve remix reference", err)
+	}
+
+	if err := opts.validateBudgets(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	// A remix stays in its source's session unless moved with --session
+	if opts.session == "" {
+		if e := findHistoryEntry(sourceID); e != nil {
+			opts.session = e.Session
+		}
+	}
+	opts.prepareOutput()
+	translate.exitIfInvalid()
+
+	apiKey := common.mustAPIKey()
+	if edit.enabled {
+		// Start from the source's prompt, so a remix can be a small change to it
+		var prefill string
+		if e := findHistoryEntry(sourceID); e != nil {
+			prefill = e.Prompt
+		}
+		prompt = edit.mustCompose(prefill)
+	}
+	prompt = mustPrompt(prompt)
+	mustScreen("prompt", prompt)
+	prompt, original := translate.mustTranslate(&common, apiKey, prompt)
+	if original != "" {
+		mustScreen("translated prompt", prompt)
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	client := mustHTTPClient(common.net)
+	timings := newPhaseTimings()
+
+	// Settings that aren't overridden are inherited, so the source decides
+	// what the remix costs
+	model, secs := body.Model, body.Seconds
+	if model == "" || secs == "" {
+		if src, err := fetchVideoStatus(ctx, client, common.baseURL, apiKey, sourceID); err == nil {
+			model, secs = cmp.Or(model, src.Model), cmp.Or(secs, src.Seconds)
+		}
+	}
+	if cost, ok := videoCost(model, secs); ok && !confirmCost(cost, fmt.Sprintf("%s, %ss", model, secs), yes) {
+		fmt.Fprintln(os.Stderr, "Aborted")
+		os.Exit(exitCanceled)
+	}
+
+	infof("Remixing from video: %s\n", sourceID)
+	stop := timings.start("upload")
+	body.Prompt = prompt
+	notifier.track("", prompt, body.Model)
+	jobID, reqID, err := remixVideo(ctx, client, common.baseURL, apiKey, sourceID, body, idemKey)
+	stop()
+	if err != nil {
+		if len(overrides) > 0 {
+			fmt.Fprintf(os.Stderr, "The server may not allow %s when remixing; retry without it to inherit the original's settings.\n", strings.Join(overrides, ", "))
+		}
+		fail("", "create job error", err)
+	}
+	infof("Created job: %s\n", jobID)
+	notifier.track(jobID, prompt, body.Model)
+	emitEvent(jsonEvent{Event: "submitted", ID: jobID, RequestID: reqID})
+
+	entry := videoHistoryEntry{
+		ID:             jobID,
+		Prompt:         prompt,
+		OriginalPrompt: original,
+		CreatedAt:      time.Now().UTC().Format(time.RFC3339),
+		OutputFile:     opts.output,
+		Model:          body.Model,
+		RemixedFrom:    &sourceID,
+		Session:        opts.session,
+		RequestID:      reqID,
+		Seed:           seed,
+	}
+	if noWait {
+		detachJob(entry)
+		return
+	}
+
+	st, err := waitForJob(ctx, client, common.baseURL, apiKey, jobID, opts, time.Now(), timings)
+	if err != nil {
+		fail(jobID, "\nError", err)
+	}
+
+	output, err := saveJobOutput(ctx, client, common.baseURL, apiKey, jobID, opts, timings)
+	if err != nil {
+		fail(jobID, "\nError", err)
+	}
+
+	// Save to history as soon as the video is here, so a failed
+	// post-processing step below doesn't lose a job that was paid for
+	entry.OutputFile = output
+	entry.Model = st.Model
+	entry.recordResult(st)
+	if err := addToHistory(entry); err != nil {
+		// Non-fatal: just warn
+		infof("Warning: failed to save to history: %v\n", err)
+	}
+
+	// Servers that don't support an override may silently ignore it
+	if body.Model != "" && st.Model != "" && st.Model != body.Model {
+		warnf("WARNING: requested model %s but the remix used %s\n", body.Model, st.Model)
+	}
+	// Everything done to the video after the download counts as
+	// post-processing
+	stopPost := timings.start("post-processing")
+	if output != "-" && !opts.encrypted() && (body.Size != "" || body.Seconds != "") {
+		if problems, err := verifyOutput(output, body.Size, body.Seconds); err != nil {
+			infof("Warning: could not verify output: %v\n", err)
+		} else {
+			for _, p := range problems {
+				warnf("WARNING: %s\n", p)
+			}
+		}
+	}
+
+	postProcess(ctx, &post, output)
+	opts.saveThumbnail(ctx, client, common.baseURL, apiKey, jobID, output)
+	stopPost()
+
+	reportJob(jobID, output, timings)
+	notifier.completed(output, st)
+	opts.openOutput(output)
+}
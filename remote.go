@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// remoteCommands are the subcommands of `sora-cli remote`
+var remoteCommands = []command{
+	{"list", "List videos on the API account, including ones missing from local history", runRemoteList},
+}
+
+// runRemote implements `sora-cli remote <subcommand>`: operations on the
+// videos stored on the API account rather than in local history
+func runRemote(args []string) {
+	runSubcommand("remote", remoteCommands, args)
+}
+
+// runRemoteList implements `sora-cli remote list`
+func runRemoteList(args []string) {
+	fs := newFlagSet("remote list", "[flags]")
+	var (
+		limit  int
+		status string
+		full   bool
+		common commonOptions
+	)
+	fs.IntVarP(&limit, "limit", "n", 50, "Show at most this many of the most recent videos (0 = all)")
+	fs.StringVar(&status, "status", "", "Only show videos with this status (e.g. completed, failed, in_progress)")
+	fs.BoolVar(&full, "full", false, "Don't truncate prompts to the terminal width")
+	addCommonFlags(fs, &common)
+	fs.Parse(args)
+
+	if fs.NArg() > 0 || limit < 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	apiKey := common.mustAPIKey()
+	ctx, cancel := commandContext()
+	defer cancel()
+	client := mustHTTPClient(common.net)
+
+	// A status filter applies after fetching, so it needs the whole listing
+	fetch := limit
+	if status != "" {
+		fetch = 0
+	}
+	videos, err := listRecentVideos(ctx, client, common.baseURL, apiKey, fetch)
+	if err != nil {
+		fail("", "failed to list remote videos", err)
+	}
+	if status != "" {
+		var matched []videoObject
+		for _, v := range videos {
+			if strings.EqualFold(v.Status, status) {
+				matched = append(matched, v)
+			}
+		}
+		videos = matched
+		if limit > 0 && len(videos) > limit {
+			videos = videos[:limit]
+		}
+	}
+	if jsonOutput {
+		if videos == nil {
+			videos = []videoObject{}
+		}
+		printJSON(videos)
+		return
+	}
+	if len(videos) == 0 {
+		fmt.Fprintln(os.Stderr, "No remote videos found")
+		return
+	}
+
+	// Local history is only used to flag videos this machine doesn't know about
+	local := make(map[string]videoHistoryEntry)
+	if h, err := loadHistory(); err != nil {
+		infof("Warning: failed to load history: %v\n", err)
+	} else {
+		for _, v := range h.Videos {
+			local[v.ID] = v
+		}
+	}
+
+	printRemoteVideos(os.Stdout, videos, local, full)
+}
+
+// remoteStatus returns the display text and color for a remote video's status
+func remoteStatus(v videoObject) (string, string) {
+	s := strings.ToLower(v.Status)
+	if slices.Contains(endedStatuses, s) {
+		return s, colorRed
+	}
+	switch s {
+	case "completed", "succeeded":
+		return s, colorGreen
+	case "in_progress":
+		if v.Progress > 0 {
+			return fmt.Sprintf("%s %d%%", s, v.Progress), colorCyan
+		}
+		return s, colorCyan
+	default:
+		return s, colorCyan
+	}
+}
+
+// expiresIn describes when a remote video's content stops being downloadable
+func expiresIn(expiresAt int64, now time.Time) (string, string) {
+	if expiresAt == 0 {
+		return "-", colorDim
+	}
+	d := time.Unix(expiresAt, 0).Sub(now)
+	switch {
+	case d <= 0:
+		return "expired", colorYellow
+	case d < time.Hour:
+		return fmt.Sprintf("in %dm", int(d.Minutes())), colorYellow
+	}
+	return fmt.Sprintf("in %dh", int(d.Hours())), ""
+}
+
+// printRemoteVideos renders the remote listing using the same table layout as list
+func printRemoteVideos(w *os.File, videos []videoObject, local map[string]videoHistoryEntry, full bool) {
+	id := listColumn{header: "ID"}
+	created := listColumn{header: "CREATED"}
+	model := listColumn{header: "MODEL"}
+	status := listColumn{header: "STATUS"}
+	expires := listColumn{header: "EXPIRES"}
+	inHistory := listColumn{header: "LOCAL"}
+	prompt := listColumn{header: "PROMPT", flex: true}
+
+	now := time.Now()
+	for _, v := range videos {
+		id.cells = append(id.cells, v.ID)
+		id.colors = append(id.colors, colorYellow)
+
+		ts := ""
+		if v.CreatedAt > 0 {
+			ts = time.Unix(v.CreatedAt, 0).Local().Format("2006-01-02 15:04")
+		}
+		created.cells = append(created.cells, ts)
+		created.colors = append(created.colors, "")
+
+		badge, badgeColor := modelBadge(v.Model)
+		model.cells = append(model.cells, badge)
+		model.colors = append(model.colors, badgeColor)
+
+		s, sColor := remoteStatus(v)
+		status.cells = append(status.cells, s)
+		status.colors = append(status.colors, sColor)
+
+		e, eColor := expiresIn(v.ExpiresAt, now)
+		expires.cells = append(expires.cells, e)
+		expires.colors = append(expires.colors, eColor)
+
+		l, lColor := "-", colorDim
+		if entry, ok := local[v.ID]; ok {
+			l, lColor = entryStatus(entry)
+		}
+		inHistory.cells = append(inHistory.cells, l)
+		inHistory.colors = append(inHistory.colors, lColor)
+
+		prompt.cells = append(prompt.cells, singleLine(v.Prompt))
+		prompt.colors = append(prompt.colors, "")
+	}
+
+	renderColumns(w, []*listColumn{&id, &created, &model, &status, &expires, &inHistory, &prompt}, useColor(w), full)
+}
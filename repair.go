@@ -0,0 +1,239 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// repairReport is what history repair fixed
+type repairReport struct {
+	Backup     string   `json:"backup,omitempty"` // where an unreadable history database was moved
+	Invalid    int      `json:"invalid"`          // entries without an ID, dropped
+	Duplicates []string `json:"duplicates"`       // IDs that appeared more than once, merged
+	Filled     []string `json:"filled"`           // entries given missing details from the API
+	Relinked   []string `json:"relinked"`         // entries pointed at their file in the output directory
+	Imported   []string `json:"imported"`         // remote videos added to history
+	DryRun     bool     `json:"dry_run,omitempty"`
+}
+
+// changed reports whether the repair changed anything
+func (r repairReport) changed() bool {
+	return r.Backup != "" || r.Invalid > 0 || len(r.Duplicates) > 0 || len(r.Filled) > 0 ||
+		len(r.Relinked) > 0 || len(r.Imported) > 0
+}
+
+// runHistoryRepair implements `sora-cli history repair`: fix a damaged or
+// incomplete history, rebuilding it from the API account where possible
+func runHistoryRepair(args []string) {
+	fs := newFlagSet("history repair", "[flags]")
+	var (
+		dryRun    bool
+		localOnly bool
+		common    commonOptions
+	)
+	fs.BoolVar(&dryRun, "dry-run", false, "Only show what would be repaired")
+	fs.BoolVar(&localOnly, "local-only", false, "Don't ask the API; only fix problems in the history itself")
+	addCommonFlags(fs, &common)
+	fs.Parse(args)
+
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	var remote []videoObject
+	if !localOnly {
+		apiKey := common.mustAPIKey()
+		ctx, cancel := commandContext()
+		defer cancel()
+		var err error
+		remote, err = listRecentVideos(ctx, mustHTTPClient(common.net), common.baseURL, apiKey, 0)
+		if err != nil {
+			fail("", "failed to list remote videos", err)
+		}
+	}
+
+	newReport := func() repairReport {
+		return repairReport{Duplicates: []string{}, Filled: []string{}, Relinked: []string{}, Imported: []string{}, DryRun: dryRun}
+	}
+	report := newReport()
+	repair := func(h *history) bool {
+		repairHistory(h, remote, &report)
+		return !dryRun && report.changed()
+	}
+	err := editHistory(repair)
+	if historyCorrupt(err) {
+		// Start over from the API, keeping the damaged database for inspection
+		path, _ := getHistoryPath()
+		report = newReport()
+		report.Backup = fmt.Sprintf("%s.corrupt-%s", path, time.Now().Format("20060102-150405"))
+		if dryRun {
+			repair(&history{})
+			err = nil
+		} else if err = moveHistoryAside(report.Backup); err != nil {
+			fail("", "failed to move damaged history aside", err)
+		} else {
+			err = editHistory(repair)
+		}
+	}
+	if err != nil {
+		fail("", "failed to repair history", err)
+	}
+
+	if jsonOutput {
+		printJSON(report)
+		return
+	}
+	printRepairReport(report)
+}
+
+// repairHistory fixes h in place: it drops entries without an ID, merges
+// duplicates, fills in details the API still has, points entries whose file
+// is missing at {output_dir}/{id}.mp4 when that exists, imports finished
+// remote videos it doesn't know, and restores newest-first order
+func repairHistory(h *history, remote []videoObject, r *repairReport) {
+	listed := make(map[string]videoObject, len(remote))
+	for _, o := range remote {
+		listed[o.ID] = o
+	}
+
+	seen := make(map[string]int)
+	var videos []videoHistoryEntry
+	for _, v := range h.Videos {
+		if strings.TrimSpace(v.ID) == "" {
+			r.Invalid++
+			continue
+		}
+		if i, ok := seen[v.ID]; ok {
+			mergeEntry(&videos[i], v)
+			if !slices.Contains(r.Duplicates, v.ID) {
+				r.Duplicates = append(r.Duplicates, v.ID)
+			}
+			continue
+		}
+		seen[v.ID] = len(videos)
+		videos = append(videos, v)
+	}
+
+	for i := range videos {
+		e := &videos[i]
+		if o, ok := listed[e.ID]; ok && fillFromRemote(e, o) {
+			r.Filled = append(r.Filled, e.ID)
+		}
+		if status, _ := localStatus(*e); status == "missing" || status == "unknown" {
+			if path := defaultOutputFile(e.ID); path != "" && path != e.OutputFile {
+				e.OutputFile = path
+				r.Relinked = append(r.Relinked, e.ID)
+			}
+		}
+	}
+
+	for _, o := range remote {
+		switch strings.ToLower(o.Status) {
+		case "completed", "succeeded":
+			if _, ok := seen[o.ID]; !ok {
+				videos = append(videos, remoteHistoryEntry(o.statusResponse(), defaultOutputFile(o.ID), ""))
+				r.Imported = append(r.Imported, o.ID)
+			}
+		}
+	}
+
+	// Entries with unreadable times sort last
+	slices.SortStableFunc(videos, func(a, b videoHistoryEntry) int {
+		ta, _ := time.Parse(time.RFC3339, a.CreatedAt)
+		tb, _ := time.Parse(time.RFC3339, b.CreatedAt)
+		return tb.Compare(ta)
+	})
+	h.Videos = videos
+}
+
+// mergeEntry copies into e what a duplicate entry d knows and e doesn't
+func mergeEntry(e *videoHistoryEntry, d videoHistoryEntry) {
+	if status, _ := localStatus(*e); status != "saved" && d.OutputFile != "" {
+		if status, _ := localStatus(d); status == "saved" {
+			e.OutputFile = d.OutputFile
+		}
+	}
+	e.Prompt = cmp.Or(e.Prompt, d.Prompt)
+	e.Model = cmp.Or(e.Model, d.Model)
+	e.Note = cmp.Or(e.Note, d.Note)
+	e.State = cmp.Or(e.State, d.State)
+	e.Session = cmp.Or(e.Session, d.Session)
+	e.Favorite = e.Favorite || d.Favorite
+	for _, t := range d.Tags {
+		if !slices.Contains(e.Tags, t) {
+			e.Tags = append(e.Tags, t)
+		}
+	}
+}
+
+// fillFromRemote fills in details missing from e that the API reports, and
+// reports whether anything changed
+func fillFromRemote(e *videoHistoryEntry, o videoObject) bool {
+	before := *e
+	e.Prompt = cmp.Or(e.Prompt, o.Prompt)
+	e.Model = cmp.Or(e.Model, o.Model)
+	if _, err := time.Parse(time.RFC3339, e.CreatedAt); err != nil && o.CreatedAt > 0 {
+		e.CreatedAt = time.Unix(o.CreatedAt, 0).UTC().Format(time.RFC3339)
+	}
+	if e.RemixedFrom == nil && o.RemixedFromVideoID != "" {
+		e.RemixedFrom = &o.RemixedFromVideoID
+	}
+	if e.Seed == nil && o.Seed != nil {
+		e.Seed = o.Seed
+	}
+	if e.Size == "" || e.Seconds == "" || e.Cost == 0 {
+		e.recordResult(o.statusResponse())
+	}
+	return e.Prompt != before.Prompt || e.Model != before.Model || e.CreatedAt != before.CreatedAt ||
+		e.RemixedFrom != before.RemixedFrom || e.Size != before.Size || e.Seconds != before.Seconds || e.Cost != before.Cost ||
+		e.Seed != before.Seed
+}
+
+// defaultOutputFile returns {output_dir}/{id}.mp4, where a job saved
+// without -o is written, if that file exists
+func defaultOutputFile(id string) string {
+	path, err := filepath.Abs(filepath.Join(cfg.OutputDir, id+".mp4"))
+	if err != nil {
+		return ""
+	}
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// printRepairReport summarizes what repair fixed
+func printRepairReport(r repairReport) {
+	if !r.changed() {
+		infof("History needs no repair\n")
+		return
+	}
+	if r.DryRun {
+		infof("Dry run; history was not changed\n")
+	}
+	if r.Backup != "" {
+		fmt.Printf("Moved the unreadable history database to %s and rebuilt it\n", r.Backup)
+	}
+	if r.Invalid > 0 {
+		fmt.Printf("Dropped %d entries without an ID\n", r.Invalid)
+	}
+	for _, line := range []struct {
+		what string
+		ids  []string
+	}{
+		{"Merged duplicate entries for", r.Duplicates},
+		{"Filled in details from the API for", r.Filled},
+		{"Found the saved file for", r.Relinked},
+		{"Imported", r.Imported},
+	} {
+		if len(line.ids) > 0 {
+			fmt.Printf("%s %d: %s\n", line.what, len(line.ids), strings.Join(line.ids, ", "))
+		}
+	}
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// replHelp lists the repl's commands
+const replHelp = `Type a prompt to render it with the current settings. Renders run in the
+background, so you can keep typing; each is reported when it finishes.
+
+  :model <id|alias>    render with this model (:pro on/off is short for pro/std)
+  :portrait            render 720x1280
+  :landscape           render 1280x720
+  :seconds <4|8|12>    render this long
+  :seed <n|@ref|off>   render with this seed, or let the server pick
+  :remix <ref>         remix this video with the prompts that follow
+  :new                 go back to rendering new videos
+  :jobs                list this session's renders
+  :settings            show the current settings
+  :help                show this help
+  :quit                leave, once running renders finish (or Ctrl-D)
+`
+
+// replState is what the next prompt will be rendered with
+type replState struct {
+	model   string
+	size    string
+	seconds string
+	seed    *int64
+	remix   string // source video ID while remixing
+}
+
+// repl is one interactive session: its settings and the renders it started
+type repl struct {
+	state    replState
+	editor   *lineEditor
+	progress *batchProgress
+
+	ctx     context.Context
+	c       *http.Client
+	baseURL string
+	apiKey  string
+	opts    jobOptions
+	yes     bool
+
+	wg   sync.WaitGroup
+	jobs []*batchJob
+}
+
+// runRepl implements `sora-cli repl`: an interactive session that renders
+// each prompt typed at it in the background, with commands to change the
+// settings in between
+func runRepl(args []string) {
+	fs := newFlagSet("repl", "[flags]")
+	var (
+		model   string
+		seconds string
+		yes     bool
+		opts    jobOptions
+		common  commonOptions
+	)
+	fs.StringVar(&model, "model", cfg.model(), "Model ID or alias to start with")
+	fs.StringVar(&seconds, "seconds", cfg.seconds(), "Duration to start with: 4, 8, or 12")
+	addBudgetFlags(fs, &opts)
+	addSessionFlag(fs, &opts.session)
+	addYesFlag(fs, &yes)
+	addCommonFlags(fs, &common)
+	fs.Parse(args)
+	common.requireWritable("create videos")
+
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if seconds != "4" && seconds != "8" && seconds != "12" {
+		fmt.Fprintf(os.Stderr, "Invalid --seconds value: %s (must be 4, 8, or 12)\n", seconds)
+		os.Exit(2)
+	}
+	if jsonOutput {
+		fmt.Fprintln(os.Stderr, "Cannot use --json with repl")
+		os.Exit(2)
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Fprintln(os.Stderr, "repl needs a terminal; use create or batch in scripts")
+		os.Exit(2)
+	}
+	if err := opts.validateBudgets(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	past, err := loadPromptHistory()
+	if err != nil {
+		infof("Warning: %v\n", err)
+	}
+	r := &repl{
+		state:   replState{model: cfg.resolveModel(model), size: cfg.size(), seconds: seconds},
+		editor:  newLineEditor(past),
+		baseURL: common.baseURL,
+		apiKey:  common.mustAPIKey(),
+		c:       mustHTTPClient(common.net),
+		opts:    opts,
+		yes:     yes,
+	}
+	r.progress = &batchProgress{print: r.editor.printAbove}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r.ctx = ctx
+
+	infof("Type a prompt to render it, or :help for commands.\n")
+	for {
+		line, err := r.editor.readLine(r.promptLabel())
+		switch {
+		case errors.Is(err, errInterrupted):
+			continue
+		case errors.Is(err, io.EOF):
+			r.quit(cancel)
+			return
+		case err != nil:
+			fail("", "failed to read prompt", err)
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, ":"):
+			if r.command(line) {
+				r.quit(cancel)
+				return
+			}
+		default:
+			r.render(line)
+		}
+	}
+}
+
+// promptLabel is the input prompt, showing what the next prompt will do
+func (r *repl) promptLabel() string {
+	if r.state.remix != "" {
+		return fmt.Sprintf("remix %s> ", r.state.remix)
+	}
+	return fmt.Sprintf("%s %s %ss> ", r.state.model, orientationName(r.state.size), r.state.seconds)
+}
+
+// command runs a :command line. It reports whether the session should end.
+func (r *repl) command(line string) bool {
+	name, arg, _ := strings.Cut(strings.TrimPrefix(line, ":"), " ")
+	arg = strings.TrimSpace(arg)
+	s := &r.state
+	switch name {
+	case "help", "h", "?":
+		fmt.Fprint(os.Stderr, replHelp)
+	case "quit", "q", "exit":
+		return true
+	case "model":
+		if m := cfg.resolveModel(arg); m != "" {
+			s.model = m
+		} else {
+			infof("Usage: :model <id|alias>\n")
+		}
+	case "pro":
+		switch arg {
+		case "on", "":
+			s.model = cfg.resolveModel("pro")
+		case "off":
+			s.model = cfg.resolveModel("std")
+		default:
+			infof("Usage: :pro on|off\n")
+		}
+	case "portrait":
+		s.size = "720x1280"
+	case "landscape":
+		s.size = "1280x720"
+	case "seconds":
+		if arg == "4" || arg == "8" || arg == "12" {
+			s.seconds = arg
+		} else {
+			infof("Usage: :seconds 4|8|12\n")
+		}
+	case "seed":
+		if arg == "off" {
+			s.seed = nil
+			break
+		}
+		seed, err := resolveSeed(arg)
+		if err != nil || seed == nil {
+			infof("Usage: :seed <n|@last|@N|off>%s\n", errSuffix(err))
+			break
+		}
+		s.seed = seed
+	case "remix":
+		id, err := resolveRemoteRef(arg)
+		if err != nil {
+			infof("Usage: :remix <@last|@N|video_id>%s\n", errSuffix(err))
+			break
+		}
+		s.remix = id
+		infof("Prompts now remix %s; :new goes back to new videos\n", id)
+	case "new":
+		s.remix = ""
+	case "jobs":
+		r.listJobs()
+	case "settings", "show":
+		seed := "server's choice"
+		if s.seed != nil {
+			seed = fmt.Sprint(*s.seed)
+		}
+		infof("Model: %s\nSize: %s\nSeconds: %s\nSeed: %s\n", s.model, s.size, s.seconds, seed)
+		if s.remix != "" {
+			infof("Remixing: %s\n", s.remix)
+		}
+	default:
+		infof("Unknown command :%s; :help lists them\n", name)
+	}
+	return false
+}
+
+// errSuffix formats err to follow a usage message, or "" for nil
+func errSuffix(err error) string {
+	if err == nil {
+		return ""
+	}
+	return " (" + err.Error() + ")"
+}
+
+// render starts rendering prompt with the current settings in the
+// background, after screening it and confirming its cost
+func (r *repl) render(prompt string) {
+	if err := screenText("prompt", prompt); err != nil {
+		infof("Error: %v\n", err)
+		return
+	}
+	if err := addPromptHistory(prompt); err != nil {
+		infof("Warning: failed to save prompt history: %v\n", err)
+	}
+	r.editor.history = append(r.editor.history, prompt)
+
+	s := r.state
+	row := batchRow{Prompt: prompt, Model: s.model, Size: s.size, Seconds: json.Number(s.seconds)}
+	if s.remix != "" {
+		// A remix inherits its source's settings, so they decide the cost
+		row = batchRow{Prompt: prompt}
+		if e := findHistoryEntry(s.remix); e != nil {
+			row.Model, row.Seconds = e.Model, json.Number(e.Seconds)
+		}
+	}
+	if cost, ok := videoCost(row.Model, row.Seconds.String()); ok && !confirmCost(cost, fmt.Sprintf("%s, %ss", row.Model, row.Seconds), r.yes) {
+		infof("Not rendered\n")
+		return
+	}
+
+	j := &batchJob{label: fmt.Sprintf("#%d", len(r.jobs)+1), row: row, seed: s.seed, remix: s.remix}
+	r.jobs = append(r.jobs, j)
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		runBatchJob(r.ctx, r.c, r.baseURL, r.apiKey, j, r.opts, r.progress)
+	}()
+}
+
+// listJobs prints this session's renders and how each is doing
+func (r *repl) listJobs() {
+	if len(r.jobs) == 0 {
+		infof("Nothing rendered yet\n")
+		return
+	}
+	r.progress.mu.Lock()
+	defer r.progress.mu.Unlock()
+	for _, j := range r.jobs {
+		state := j.result
+		switch {
+		case state == "succeeded":
+			state = "saved " + j.output
+		case state != "":
+		case j.id == "":
+			state = "submitting"
+		case isQueuedStatus(j.status):
+			state = "queued"
+		default:
+			state = fmt.Sprintf("rendering (%d%%)", j.progress)
+		}
+		infof("%s\t%s\t%s\t%s\n", j.label, cmp.Or(j.id, "-"), state, truncate(j.row.Prompt, 50))
+	}
+}
+
+// quit waits for running renders before the session ends. Ctrl-C stops
+// waiting; renders already submitted keep going, recorded in history as
+// pending so 'sora-cli attach' can fetch them.
+func (r *repl) quit(cancel context.CancelFunc) {
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	running := 0
+	r.progress.mu.Lock()
+	for _, j := range r.jobs {
+		if j.result == "" {
+			running++
+		}
+	}
+	r.progress.mu.Unlock()
+	if running > 0 {
+		infof("Waiting for %d render(s) to finish; press Ctrl-C to leave them rendering\n", running)
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		defer signal.Stop(interrupt)
+		select {
+		case <-done:
+		case <-interrupt:
+			cancel()
+			<-done
+		}
+	}
+
+	for _, j := range r.jobs {
+		if j.result != "pending" || j.id == "" {
+			continue
+		}
+		entry := videoHistoryEntry{
+			ID:        j.id,
+			Prompt:    j.row.Prompt,
+			CreatedAt: time.Now().UTC().Format(time.RFC3339),
+			Model:     j.row.Model,
+			Session:   r.opts.session,
+			RequestID: j.requestID,
+			Seed:      j.seed,
+			Pending:   true,
+		}
+		if j.remix != "" {
+			entry.RemixedFrom = &j.remix
+		}
+		if err := addToHistory(entry); err != nil {
+			infof("Warning: failed to save to history: %v\n", err)
+		}
+		infof("%s is still rendering; fetch it with: sora-cli attach %s\n", j.id, j.id)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// uiRegion is part of the frame covered by a platform's interface, as
+// fractions of a portrait frame's width and height
+type uiRegion struct {
+	x, y, w, h float64
+}
+
+// safeAreaLayout describes where a platform draws its interface over a
+// full-screen vertical video
+type safeAreaLayout struct {
+	ui   []uiRegion
+	safe uiRegion // what's left clear of captions and buttons
+}
+
+// safeAreaLayouts are measured from 1080x1920 screenshots of each app. Apps
+// change their layout over time, so these are deliberately generous.
+var safeAreaLayouts = map[string]safeAreaLayout{
+	"tiktok": {
+		ui: []uiRegion{
+			{0, 0, 1, 0.08},          // Following / For You tabs
+			{0.87, 0.40, 0.13, 0.45}, // like, comment, share, sound buttons
+			{0, 0.75, 0.87, 0.25},    // username, caption, and sound
+		},
+		safe: uiRegion{0.055, 0.08, 0.815, 0.67},
+	},
+	"reels": {
+		ui: []uiRegion{
+			{0, 0, 1, 0.14},          // Reels title and camera button
+			{0.89, 0.50, 0.11, 0.40}, // like, comment, share, more buttons
+			{0, 0.65, 0.89, 0.35},    // username, caption, and audio
+		},
+		safe: uiRegion{0.055, 0.14, 0.835, 0.51},
+	},
+}
+
+func safeAreaNames() []string {
+	names := make([]string, 0, len(safeAreaLayouts))
+	for name := range safeAreaLayouts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// safeAreaPath returns where the preview for video path is written, e.g.
+// clip.mp4 -> clip.tiktok-preview.mp4
+func safeAreaPath(path, platform string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + platform + "-preview" + ext
+}
+
+// renderSafeArea writes a copy of path with platform's interface regions
+// shaded and the safe area outlined, and returns its path. The video itself
+// isn't changed.
+func renderSafeArea(ctx context.Context, path, platform string) (string, error) {
+	layout := safeAreaLayouts[platform]
+	w, h, err := getVideoDimensions(path)
+	if err != nil {
+		return "", err
+	}
+	if w > h {
+		return "", fmt.Errorf("--safe-area %s is for portrait video, but %s is %dx%d", platform, path, w, h)
+	}
+
+	b := newFFmpeg().Input(path)
+	for _, r := range layout.ui {
+		addBox(b, r, w, h, "red@0.35", "fill")
+	}
+	addBox(b, layout.safe, w, h, "lime@0.9", "3")
+	b.Option("-c:v", "libx264").
+		Option("-preset", "fast").
+		Option("-crf", "23").
+		Option("-pix_fmt", "yuv420p").
+		Option("-c:a", "copy")
+	addColorTags(b)
+	preview := safeAreaPath(path, platform)
+	if err := b.Output(preview).Run(ctx); err != nil {
+		return "", fmt.Errorf("rendering safe-area preview: %w", err)
+	}
+	return preview, nil
+}
+
+// addBox draws region r of a w x h frame; thickness is in pixels, or "fill"
+func addBox(b *ffmpegBuilder, r uiRegion, w, h int, color, thickness string) {
+	b.Filter(newFilter("drawbox").
+		Int("x", int(r.x*float64(w))).
+		Int("y", int(r.y*float64(h))).
+		Int("w", int(r.w*float64(w))).
+		Int("h", int(r.h*float64(h))).
+		String("color", color).
+		String("t", thickness))
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// strictSchema makes API responses with unknown fields or job statuses an
+// error (--strict-schema) rather than a warning
+var strictSchema bool
+
+// knownStatuses are the job statuses the CLI acts on; "" is treated as queued
+var knownStatuses = []string{
+	"", "queued", "pending", "submitted", "in_progress",
+	"succeeded", "completed", "complete", "done", "ready",
+	"failed", "error", "cancelled", "canceled", "expired", "rejected",
+}
+
+// envelopeFields appear on every OpenAI response object and carry nothing
+// the CLI needs
+var envelopeFields = []string{"object"}
+
+// schemaError is an API response that no longer matches what the CLI
+// expects, returned under --strict-schema
+type schemaError struct {
+	endpoint string
+	drift    []string
+	log      string // where the payload was saved
+}
+
+func (e *schemaError) Error() string {
+	return fmt.Sprintf("unexpected API response from %s: %s (payload saved to %s; --strict-schema)", e.endpoint, strings.Join(e.drift, ", "), e.log)
+}
+
+// decodeResponse decodes a JSON response body into out, a pointer to one of
+// the API response types, and checks it for schema drift
+func decodeResponse(resp *http.Response, out any) error {
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return err
+	}
+	return checkSchema(resp, data, out)
+}
+
+// checkSchema compares a decoded response with its raw payload. Fields the
+// response type doesn't declare and job statuses the CLI doesn't know are
+// reported once per run, with the payload written to the debug log so a
+// provider-side change can be diagnosed.
+func checkSchema(resp *http.Response, data []byte, out any) error {
+	var drift []string
+	for _, f := range unknownFields(data, reflect.TypeOf(out), "") {
+		drift = append(drift, fmt.Sprintf("unknown field %q", f))
+	}
+	for _, s := range responseStatuses(out) {
+		if !slices.Contains(knownStatuses, strings.ToLower(s)) {
+			drift = append(drift, fmt.Sprintf("unknown status %q", s))
+		}
+	}
+	if len(drift) == 0 {
+		return nil
+	}
+	slices.Sort(drift)
+	drift = slices.Compact(drift)
+
+	endpoint := resp.Request.Method + " " + endpointPattern(resp.Request.URL.Path)
+	fresh := newDrift(endpoint, drift)
+	if len(fresh) == 0 && !strictSchema {
+		return nil // already reported; polling would repeat it every few seconds
+	}
+	where := "the debug log"
+	err := appendDebugLog(debugRecord{
+		Event:     "schema_drift",
+		Endpoint:  endpoint,
+		RequestID: requestID(resp),
+		Drift:     drift,
+		Payload:   json.RawMessage(data),
+	})
+	if path, perr := debugLogPath(); perr == nil && err == nil {
+		where = path
+	}
+	if strictSchema {
+		return &schemaError{endpoint: endpoint, drift: drift, log: where}
+	}
+	warnf("WARNING: API response from %s doesn't match what sora-cli expects: %s (payload saved to %s; --strict-schema makes this an error)\n",
+		endpoint, strings.Join(fresh, ", "), where)
+	return nil
+}
+
+// unknownFields lists the keys of a JSON object that type t doesn't
+// declare, descending into arrays of objects (e.g. a list's data). Nested
+// objects such as error details are not checked; they vary by provider.
+func unknownFields(data []byte, t reflect.Type, prefix string) []string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	var obj map[string]json.RawMessage
+	if json.Unmarshal(data, &obj) != nil {
+		return nil
+	}
+	known := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			known[name] = f.Type
+		}
+	}
+
+	var unknown []string
+	for key, raw := range obj {
+		ft, ok := known[key]
+		switch {
+		case !ok && !slices.Contains(envelopeFields, key):
+			unknown = append(unknown, prefix+key)
+		case ok && ft.Kind() == reflect.Slice:
+			var items []json.RawMessage
+			if json.Unmarshal(raw, &items) == nil {
+				for _, item := range items {
+					unknown = append(unknown, unknownFields(item, ft.Elem(), prefix+key+"[].")...)
+				}
+			}
+		}
+	}
+	return unknown
+}
+
+// responseStatuses returns the job statuses in a decoded response
+func responseStatuses(out any) []string {
+	switch v := out.(type) {
+	case *videoStatusResponse:
+		return []string{v.Status}
+	case *listVideosResponse:
+		statuses := make([]string, len(v.Data))
+		for i, o := range v.Data {
+			statuses[i] = o.Status
+		}
+		return statuses
+	}
+	return nil
+}
+
+// videoIDPathRe matches the video ID in an API path
+var videoIDPathRe = regexp.MustCompile(`/videos/[^/]+`)
+
+// endpointPattern replaces the video ID in an API path with {id}, so drift
+// on one endpoint is reported once however many jobs hit it
+func endpointPattern(path string) string {
+	return videoIDPathRe.ReplaceAllString(path, "/videos/{id}")
+}
+
+var (
+	reportedDriftMu sync.Mutex
+	reportedDrift   = make(map[string]bool)
+)
+
+// newDrift returns the items of drift not yet reported for endpoint in this
+// run, and marks them reported
+func newDrift(endpoint string, drift []string) []string {
+	reportedDriftMu.Lock()
+	defer reportedDriftMu.Unlock()
+	var fresh []string
+	for _, d := range drift {
+		key := endpoint + " " + d
+		if !reportedDrift[key] {
+			reportedDrift[key] = true
+			fresh = append(fresh, d)
+		}
+	}
+	return fresh
+}
+
+// debugRecord is one line of the debug log
+type debugRecord struct {
+	Time      string          `json:"time"`
+	Event     string          `json:"event"`
+	Endpoint  string          `json:"endpoint,omitempty"`
+	RequestID string          `json:"request_id,omitempty"`
+	Drift     []string        `json:"drift,omitempty"`
+	Version   string          `json:"version"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+}
+
+// debugLogPath returns the path of the debug log
+func debugLogPath() (string, error) {
+	dir, err := soraDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "debug.log"), nil
+}
+
+var debugLogMu sync.Mutex
+
+// appendDebugLog adds r to the debug log as one line of JSON
+func appendDebugLog(r debugRecord) error {
+	r.Time = time.Now().UTC().Format(time.RFC3339)
+	r.Version = currentBuild().tag()
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	path, err := debugLogPath()
+	if err != nil {
+		return err
+	}
+	debugLogMu.Lock()
+	defer debugLogMu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("creating debug log directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening debug log: %w", err)
+	}
+	_, err = f.Write(append(line, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
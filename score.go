@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// qualityScore is what `sora-cli score` measured for a video against a
+// reference, kept in history
+type qualityScore struct {
+	Reference string `json:"reference"`
+	compareMetrics
+	ScoredAt string `json:"scored_at"`
+}
+
+// runScore implements `sora-cli score <file>... --reference <file>`:
+// measure how close each video is to a reference and record the scores in
+// history, so variants and models can be ranked by them
+func runScore(args []string) {
+	fs := newFlagSet("score", "<video>... --reference <video> [flags]")
+	var (
+		reference string
+		noSave    bool
+	)
+	fs.StringVarP(&reference, "reference", "r", "", "The video to score against: a history ref or an MP4 file")
+	fs.BoolVar(&noSave, "no-save", false, "Print the scores without recording them in history")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 || reference == "" {
+		fmt.Fprintln(os.Stderr, "Error: give the videos to score and --reference")
+		fs.Usage()
+		os.Exit(2)
+	}
+	if !isFFmpegAvailable() {
+		fmt.Fprintln(os.Stderr, ffmpegInstallMsg)
+		os.Exit(1)
+	}
+	ref, err := compareInput(reference)
+	if err != nil {
+		fail("", "score error", err)
+	}
+	type target struct {
+		arg, path, id string
+	}
+	targets := make([]target, fs.NArg())
+	for i, arg := range fs.Args() {
+		path, err := compareInput(arg)
+		if err != nil {
+			fail("", "score error", err)
+		}
+		targets[i] = target{arg, path, historyIDForFile(arg, path)}
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	var results []map[string]any
+	vmafNoted := false
+	for _, t := range targets {
+		infof("Scoring %s against %s...\n", t.path, ref)
+		checkComparable(ref, t.path)
+		m, err := measureSimilarity(ctx, ref, t.path)
+		if err != nil {
+			fail(t.id, "score error", err)
+		}
+		if m.noVMAF && !vmafNoted {
+			infof("VMAF needs ffmpeg built with libvmaf; scoring with SSIM and PSNR only\n")
+			vmafNoted = true
+		}
+		saved := false
+		if !noSave && t.id != "" {
+			score := &qualityScore{Reference: ref, compareMetrics: *m, ScoredAt: time.Now().UTC().Format(time.RFC3339)}
+			if saved, err = updateHistoryEntry(t.id, func(e *videoHistoryEntry) { e.Quality = score }); err != nil {
+				infof("Warning: failed to save the score to history: %v\n", err)
+			}
+		}
+		if !noSave && !saved {
+			infof("%s is not in history; its score isn't recorded\n", t.arg)
+		}
+		if jsonOutput {
+			results = append(results, map[string]any{"video": t.path, "id": t.id, "reference": ref, "metrics": m})
+			continue
+		}
+		fmt.Printf("%s\t%s\n", t.path, m.summary())
+	}
+	if jsonOutput {
+		printJSON(results)
+	}
+}
+
+// historyIDForFile returns the ID of the history entry for a score
+// argument: the ref itself, or the entry saved at path. It is "" for a file
+// history doesn't know.
+func historyIDForFile(arg, path string) string {
+	if path != arg {
+		id, _ := resolveVideoRef(arg)
+		return id
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return ""
+	}
+	h, err := loadHistory()
+	if err != nil {
+		return ""
+	}
+	for _, v := range h.Videos {
+		if v.OutputFile == "" {
+			continue
+		}
+		if other, err := filepath.Abs(v.OutputFile); err == nil && other == abs {
+			return v.ID
+		}
+	}
+	return ""
+}
+
+// summary formats the scores on one line, e.g. "SSIM 0.9120  PSNR 31.45 dB
+// VMAF 78.3", with - for a metric that wasn't measured
+func (m *compareMetrics) summary() string {
+	parts := []string{"SSIM -", "PSNR -", "VMAF -"}
+	if m.SSIM != nil {
+		parts[0] = fmt.Sprintf("SSIM %.4f", *m.SSIM)
+	}
+	switch {
+	case m.Identical:
+		parts[1] = "PSNR inf"
+	case m.PSNR != nil:
+		parts[1] = fmt.Sprintf("PSNR %.2f dB", *m.PSNR)
+	}
+	if m.VMAF != nil {
+		parts[2] = fmt.Sprintf("VMAF %.1f", *m.VMAF)
+	}
+	return strings.Join(parts, "  ")
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// addSeedFlag registers --seed
+func addSeedFlag(fs *flag.FlagSet, seed *string) {
+	fs.StringVar(seed, "seed", "", "Render with this seed, if the model accepts one; @last or @N reuses the seed recorded for a video in history")
+}
+
+// resolveSeed turns a --seed value into a seed: a non-negative number, or
+// @last or @N for the seed history recorded with that video. Empty means
+// the server picks one.
+func resolveSeed(s string) (*int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(s, "@") {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("seed must be a non-negative integer, @last, or @N, got %q", s)
+		}
+		return &n, nil
+	}
+	id, err := resolveVideoRef(s)
+	if err != nil {
+		return nil, err
+	}
+	e := findHistoryEntry(id)
+	if e == nil || e.Seed == nil {
+		return nil, fmt.Errorf("%s (%s) has no recorded seed", s, id)
+	}
+	return e.Seed, nil
+}
+
+// seedRejected reports whether err is the server refusing a seed, which
+// models without seed support do
+func seedRejected(err error) bool {
+	var se *statusError
+	return errors.As(err, &se) && se.StatusCode == 400 && strings.Contains(strings.ToLower(se.Body), "seed")
+}
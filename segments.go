@@ -0,0 +1,752 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// segmentConcurrency limits how many segments of one output are fetched at
+// a time
+const segmentConcurrency = 6
+
+// maxManifestSize bounds how much of a playlist or MPD is read
+const maxManifestSize = 4 << 20
+
+// Manifest kinds a content response may be instead of a single MP4
+const (
+	manifestHLS  = "hls"
+	manifestDASH = "dash"
+)
+
+// manifestKind reports whether resp is an HLS playlist or DASH manifest
+// rather than the video itself, going by its Content-Type
+func manifestKind(resp *http.Response) string {
+	ct, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch strings.ToLower(ct) {
+	case "application/vnd.apple.mpegurl", "application/x-mpegurl", "audio/mpegurl", "audio/x-mpegurl":
+		return manifestHLS
+	case "application/dash+xml":
+		return manifestDASH
+	}
+	return ""
+}
+
+// mediaTrack is one stream of a segmented output: an optional init segment
+// followed by media segments, all as absolute URLs
+type mediaTrack struct {
+	kind     string // "video", "audio", or "" when muxed together
+	init     string
+	segments []string
+}
+
+// downloadSegmented fetches every segment the manifest in resp lists and
+// remuxes them into one MP4 at outPath. Segments are only sent the API key
+// when they live on the same host as the content URL.
+func downloadSegmented(ctx context.Context, c *http.Client, apiKey string, resp *http.Response, kind, outPath string, quiet bool) error {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize))
+	if err != nil {
+		return fmt.Errorf("reading %s manifest: %w", strings.ToUpper(kind), err)
+	}
+	base := resp.Request.URL
+	f := &segmentFetcher{c: c, apiKey: apiKey, origin: base}
+
+	var tracks []mediaTrack
+	switch kind {
+	case manifestHLS:
+		tracks, err = parseHLS(ctx, f, base, string(body))
+	case manifestDASH:
+		tracks, err = parseDASH(base, body)
+	}
+	if err != nil {
+		return fmt.Errorf("%s manifest: %w", strings.ToUpper(kind), err)
+	}
+	n := 0
+	for _, t := range tracks {
+		n += len(t.segments)
+	}
+	if !quiet {
+		infof("Output is segmented (%s); fetching %d segments\n", strings.ToUpper(kind), n)
+	}
+
+	// Keep the segments next to the output, so the result can be renamed
+	// into place even when the system temp dir is on another filesystem
+	parent := ""
+	if outPath != "-" {
+		parent = filepath.Dir(outPath)
+		if err := os.MkdirAll(parent, 0o755); err != nil {
+			return err
+		}
+	}
+	dir, err := os.MkdirTemp(parent, ".sora-segments-*")
+	if err != nil {
+		return fmt.Errorf("creating temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var written int64
+	f.progress = &progressWriter{total: -1, written: &written, quiet: quiet}
+	files := make([]string, len(tracks))
+	for i, t := range tracks {
+		files[i] = filepath.Join(dir, fmt.Sprintf("track%d", i))
+		if err := f.fetchTrack(ctx, t, files[i]); err != nil {
+			return err
+		}
+	}
+	f.progress.done()
+
+	if outPath == "-" {
+		assembled := filepath.Join(dir, "out.mp4")
+		if err := remuxTracks(ctx, tracks, files, assembled); err != nil {
+			return err
+		}
+		in, err := os.Open(assembled)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		_, err = io.Copy(os.Stdout, in)
+		return err
+	}
+
+	tmp := outPath + ".part"
+	if err := remuxTracks(ctx, tracks, files, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, outPath)
+}
+
+// remuxTracks joins the downloaded tracks into one MP4 without re-encoding.
+// A lone fragmented MP4 track is already playable, so it's used as is when
+// ffmpeg isn't installed.
+func remuxTracks(ctx context.Context, tracks []mediaTrack, files []string, out string) error {
+	if !isFFmpegAvailable() {
+		if len(files) == 1 && tracks[0].init != "" {
+			return os.Rename(files[0], out)
+		}
+		return fmt.Errorf("assembling a segmented download: %s", ffmpegInstallMsg)
+	}
+	b := newFFmpeg()
+	for _, f := range files {
+		b.Input(f)
+	}
+	err := b.Option("-c", "copy").
+		Option("-movflags", "+faststart").
+		Option("-f", "mp4").
+		Output(out).
+		Run(ctx)
+	if err != nil {
+		return fmt.Errorf("assembling segments: %w", err)
+	}
+	return nil
+}
+
+// segmentFetcher downloads manifests and segments
+type segmentFetcher struct {
+	c        *http.Client
+	apiKey   string
+	origin   *url.URL
+	progress *progressWriter
+}
+
+// open requests u, authorizing only requests to the API's own host; presigned
+// CDN URLs must not see the API key
+func (f *segmentFetcher) open(ctx context.Context, u string) (*http.Response, error) {
+	return f.openAt(ctx, u, 0)
+}
+
+// openAt is open from a byte offset, to resume a segment that was cut off
+func (f *segmentFetcher) openAt(ctx context.Context, u string, offset int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if req.URL.Scheme == f.origin.Scheme && req.URL.Host == f.origin.Host {
+		req.Header.Set("Authorization", "Bearer "+f.apiKey)
+	}
+	// Resume offsets count the bytes as stored, so they have to be the
+	// bytes as sent; a gzip body would be decoded and its offsets lost
+	req.Header.Set("Accept-Encoding", "identity")
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := f.c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		closeBody(resp)
+		return nil, fmt.Errorf("GET %s: %s", redactURL(u), resp.Status)
+	}
+	return resp, nil
+}
+
+// get returns the body of a (small) playlist
+func (f *segmentFetcher) get(ctx context.Context, u string) (string, error) {
+	resp, err := f.open(ctx, u)
+	if err != nil {
+		return "", err
+	}
+	defer closeBody(resp)
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize))
+	return string(b), err
+}
+
+// fetchTrack downloads t's segments concurrently, then writes them to path
+// in order
+func (f *segmentFetcher) fetchTrack(ctx context.Context, t mediaTrack, path string) error {
+	urls := t.segments
+	if t.init != "" {
+		urls = append([]string{t.init}, urls...)
+	}
+	parts := make([]string, len(urls))
+	for i := range parts {
+		parts[i] = fmt.Sprintf("%s.%05d", path, i)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	sem := make(chan struct{}, segmentConcurrency)
+	for i, u := range urls {
+		wg.Add(1)
+		go func(i int, u string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if err := f.fetchSegment(ctx, u, parts[i]); err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(i, u)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	for _, p := range parts {
+		in, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, in)
+		in.Close()
+		os.Remove(p)
+		if err != nil {
+			return err
+		}
+	}
+	return out.Close()
+}
+
+// fetchSegment downloads one segment to path
+func (f *segmentFetcher) fetchSegment(ctx context.Context, u, path string) error {
+	resp, err := f.open(ctx, u)
+	if err != nil {
+		return fmt.Errorf("%w: segment: %v", errDownload, err)
+	}
+	defer closeBody(resp)
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = resumeCopy(ctx, f.c, resp, io.MultiWriter(out, f.progress), func(offset int64) (*http.Response, error) {
+		return f.openAt(ctx, u, offset)
+	})
+	if err != nil {
+		out.Close()
+		return fmt.Errorf("%w: segment %s: %v", errDownload, redactURL(u), err)
+	}
+	return out.Close()
+}
+
+// redactURL drops the query string, which for presigned URLs holds the
+// signature
+func redactURL(u string) string {
+	if i := strings.IndexByte(u, '?'); i >= 0 {
+		return u[:i]
+	}
+	return u
+}
+
+// resolveURL resolves ref against base
+func resolveURL(base *url.URL, ref string) (string, error) {
+	r, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return "", fmt.Errorf("bad URL %q: %w", ref, err)
+	}
+	return base.ResolveReference(r).String(), nil
+}
+
+// hlsAttrRe matches one KEY=value or KEY="quoted, value" attribute
+var hlsAttrRe = regexp.MustCompile(`([A-Z0-9-]+)=("[^"]*"|[^,]*)`)
+
+// hlsAttrs parses the attribute list of an HLS tag
+func hlsAttrs(s string) map[string]string {
+	attrs := map[string]string{}
+	for _, m := range hlsAttrRe.FindAllStringSubmatch(s, -1) {
+		attrs[m[1]] = strings.Trim(m[2], `"`)
+	}
+	return attrs
+}
+
+// parseHLS turns a playlist into tracks. For a master playlist it takes the
+// highest-bandwidth variant, plus its separate audio rendition if it has
+// one.
+func parseHLS(ctx context.Context, f *segmentFetcher, base *url.URL, body string) ([]mediaTrack, error) {
+	body = strings.TrimPrefix(body, "\ufeff")
+	if !strings.HasPrefix(body, "#EXTM3U") {
+		return nil, errors.New("not an M3U8 playlist")
+	}
+	if !strings.Contains(body, "#EXT-X-STREAM-INF") {
+		t, err := parseHLSMedia(base, body)
+		if err != nil {
+			return nil, err
+		}
+		return []mediaTrack{t}, nil
+	}
+
+	var (
+		best      map[string]string
+		bestURI   string
+		bestBW    = -1
+		audio     = map[string][]map[string]string{}
+		pendingSI map[string]string
+	)
+	sc := bufio.NewScanner(strings.NewReader(body))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			pendingSI = hlsAttrs(strings.TrimPrefix(line, "#EXT-X-STREAM-INF:"))
+		case strings.HasPrefix(line, "#EXT-X-MEDIA:"):
+			a := hlsAttrs(strings.TrimPrefix(line, "#EXT-X-MEDIA:"))
+			if a["TYPE"] == "AUDIO" && a["URI"] != "" {
+				audio[a["GROUP-ID"]] = append(audio[a["GROUP-ID"]], a)
+			}
+		case line == "" || strings.HasPrefix(line, "#"):
+		case pendingSI != nil:
+			bw, _ := strconv.Atoi(pendingSI["BANDWIDTH"])
+			if bw > bestBW {
+				best, bestURI, bestBW = pendingSI, line, bw
+			}
+			pendingSI = nil
+		}
+	}
+	if best == nil {
+		return nil, errors.New("master playlist lists no variants")
+	}
+
+	video, err := fetchHLSMedia(ctx, f, base, bestURI)
+	if err != nil {
+		return nil, err
+	}
+	renditions := audio[best["AUDIO"]]
+	if best["AUDIO"] == "" || len(renditions) == 0 {
+		return []mediaTrack{video}, nil
+	}
+	pick := renditions[0]
+	for _, a := range renditions {
+		if a["DEFAULT"] == "YES" {
+			pick = a
+			break
+		}
+	}
+	sound, err := fetchHLSMedia(ctx, f, base, pick["URI"])
+	if err != nil {
+		return nil, err
+	}
+	video.kind, sound.kind = "video", "audio"
+	return []mediaTrack{video, sound}, nil
+}
+
+// fetchHLSMedia fetches and parses the media playlist at ref
+func fetchHLSMedia(ctx context.Context, f *segmentFetcher, base *url.URL, ref string) (mediaTrack, error) {
+	u, err := resolveURL(base, ref)
+	if err != nil {
+		return mediaTrack{}, err
+	}
+	body, err := f.get(ctx, u)
+	if err != nil {
+		return mediaTrack{}, err
+	}
+	pu, _ := url.Parse(u)
+	return parseHLSMedia(pu, body)
+}
+
+// parseHLSMedia lists the segments of a media playlist. Encrypted and
+// byte-range segments aren't supported, and the playlist must be complete.
+func parseHLSMedia(base *url.URL, body string) (mediaTrack, error) {
+	var (
+		t      mediaTrack
+		ended  bool
+		sc     = bufio.NewScanner(strings.NewReader(strings.TrimPrefix(body, "\ufeff")))
+		maxLen = 64 << 10
+	)
+	sc.Buffer(make([]byte, maxLen), maxLen)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-KEY:"):
+			if m := hlsAttrs(strings.TrimPrefix(line, "#EXT-X-KEY:"))["METHOD"]; m != "NONE" {
+				return t, fmt.Errorf("encrypted segments (%s) aren't supported", m)
+			}
+		case strings.HasPrefix(line, "#EXT-X-BYTERANGE"):
+			return t, errors.New("byte-range segments aren't supported")
+		case strings.HasPrefix(line, "#EXT-X-MAP:"):
+			a := hlsAttrs(strings.TrimPrefix(line, "#EXT-X-MAP:"))
+			if a["BYTERANGE"] != "" {
+				return t, errors.New("byte-range segments aren't supported")
+			}
+			u, err := resolveURL(base, a["URI"])
+			if err != nil {
+				return t, err
+			}
+			t.init = u
+		case line == "#EXT-X-ENDLIST":
+			ended = true
+		case line == "" || strings.HasPrefix(line, "#"):
+		default:
+			u, err := resolveURL(base, line)
+			if err != nil {
+				return t, err
+			}
+			t.segments = append(t.segments, u)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return t, err
+	}
+	if !ended {
+		return t, errors.New("playlist has no #EXT-X-ENDLIST; the output isn't finished")
+	}
+	if len(t.segments) == 0 {
+		return t, errors.New("playlist lists no segments")
+	}
+	return t, nil
+}
+
+// dashMPD is the part of a DASH manifest needed to list segments
+type dashMPD struct {
+	Type     string       `xml:"type,attr"`
+	Duration string       `xml:"mediaPresentationDuration,attr"`
+	BaseURL  string       `xml:"BaseURL"`
+	Periods  []dashPeriod `xml:"Period"`
+}
+
+type dashPeriod struct {
+	Duration string              `xml:"duration,attr"`
+	BaseURL  string              `xml:"BaseURL"`
+	Sets     []dashAdaptationSet `xml:"AdaptationSet"`
+}
+
+type dashAdaptationSet struct {
+	ContentType     string               `xml:"contentType,attr"`
+	MimeType        string               `xml:"mimeType,attr"`
+	BaseURL         string               `xml:"BaseURL"`
+	Template        *dashTemplate        `xml:"SegmentTemplate"`
+	Representations []dashRepresentation `xml:"Representation"`
+}
+
+type dashRepresentation struct {
+	ID        string           `xml:"id,attr"`
+	Bandwidth int              `xml:"bandwidth,attr"`
+	MimeType  string           `xml:"mimeType,attr"`
+	BaseURL   string           `xml:"BaseURL"`
+	Template  *dashTemplate    `xml:"SegmentTemplate"`
+	List      *dashSegmentList `xml:"SegmentList"`
+}
+
+type dashTemplate struct {
+	Initialization string     `xml:"initialization,attr"`
+	Media          string     `xml:"media,attr"`
+	StartNumber    *int64     `xml:"startNumber,attr"`
+	Timescale      int64      `xml:"timescale,attr"`
+	Duration       int64      `xml:"duration,attr"`
+	Timeline       []dashTime `xml:"SegmentTimeline>S"`
+}
+
+type dashTime struct {
+	T *int64 `xml:"t,attr"`
+	D int64  `xml:"d,attr"`
+	R int64  `xml:"r,attr"`
+}
+
+type dashSegmentList struct {
+	Initialization struct {
+		SourceURL string `xml:"sourceURL,attr"`
+	} `xml:"Initialization"`
+	Segments []struct {
+		Media string `xml:"media,attr"`
+	} `xml:"SegmentURL"`
+}
+
+// maxDASHSegments guards against a manifest whose template arithmetic
+// would list an absurd number of segments
+const maxDASHSegments = 100000
+
+// parseDASH turns a static, single-period MPD into tracks: the
+// highest-bandwidth representation of the first video and audio sets
+func parseDASH(base *url.URL, body []byte) ([]mediaTrack, error) {
+	var m dashMPD
+	if err := xml.Unmarshal(body, &m); err != nil {
+		return nil, fmt.Errorf("parsing MPD: %w", err)
+	}
+	if m.Type == "dynamic" {
+		return nil, errors.New("live (dynamic) manifests aren't supported")
+	}
+	if len(m.Periods) != 1 {
+		return nil, fmt.Errorf("only single-period manifests are supported, got %d periods", len(m.Periods))
+	}
+	p := m.Periods[0]
+	length := p.Duration
+	if length == "" {
+		length = m.Duration
+	}
+	seconds, err := parseISODuration(length)
+	if err != nil && length != "" {
+		return nil, err
+	}
+
+	base, err = joinBaseURL(base, m.BaseURL, p.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	var tracks []mediaTrack
+	seen := map[string]bool{}
+	for _, set := range p.Sets {
+		kind := dashKind(set.ContentType, set.MimeType)
+		if len(set.Representations) == 0 || (kind != "video" && kind != "audio") || seen[kind] {
+			continue
+		}
+		rep := set.Representations[0]
+		for _, r := range set.Representations[1:] {
+			if r.Bandwidth > rep.Bandwidth {
+				rep = r
+			}
+		}
+		if k := dashKind("", rep.MimeType); k != "" && k != kind {
+			continue
+		}
+		t, err := dashTrack(base, set, rep, seconds)
+		if err != nil {
+			return nil, fmt.Errorf("representation %q: %w", rep.ID, err)
+		}
+		t.kind = kind
+		seen[kind] = true
+		tracks = append(tracks, t)
+	}
+	if len(tracks) == 0 {
+		return nil, errors.New("manifest has no video or audio representations")
+	}
+	return tracks, nil
+}
+
+// dashKind returns "video" or "audio" from a contentType or mimeType
+func dashKind(contentType, mimeType string) string {
+	if contentType != "" {
+		return contentType
+	}
+	kind, _, _ := strings.Cut(mimeType, "/")
+	return kind
+}
+
+// joinBaseURL applies nested BaseURL elements in order
+func joinBaseURL(base *url.URL, refs ...string) (*url.URL, error) {
+	for _, ref := range refs {
+		if strings.TrimSpace(ref) == "" {
+			continue
+		}
+		r, err := url.Parse(strings.TrimSpace(ref))
+		if err != nil {
+			return nil, fmt.Errorf("bad BaseURL %q: %w", ref, err)
+		}
+		base = base.ResolveReference(r)
+	}
+	return base, nil
+}
+
+// dashTrack lists the segments of one representation
+func dashTrack(base *url.URL, set dashAdaptationSet, rep dashRepresentation, seconds float64) (mediaTrack, error) {
+	base, err := joinBaseURL(base, set.BaseURL, rep.BaseURL)
+	if err != nil {
+		return mediaTrack{}, err
+	}
+	var t mediaTrack
+
+	if l := rep.List; l != nil {
+		if l.Initialization.SourceURL != "" {
+			if t.init, err = resolveURL(base, l.Initialization.SourceURL); err != nil {
+				return t, err
+			}
+		}
+		for _, s := range l.Segments {
+			u, err := resolveURL(base, s.Media)
+			if err != nil {
+				return t, err
+			}
+			t.segments = append(t.segments, u)
+		}
+		if len(t.segments) == 0 {
+			return t, errors.New("SegmentList lists no segments")
+		}
+		return t, nil
+	}
+
+	tmpl := rep.Template
+	if tmpl == nil {
+		tmpl = set.Template
+	}
+	if tmpl == nil {
+		// The representation is one file
+		t.segments = []string{base.String()}
+		return t, nil
+	}
+	if tmpl.Media == "" {
+		return t, errors.New("SegmentTemplate has no media attribute")
+	}
+	if tmpl.Initialization != "" {
+		if t.init, err = resolveURL(base, expandDASHTemplate(tmpl.Initialization, rep, 0, 0)); err != nil {
+			return t, err
+		}
+	}
+	number := int64(1)
+	if tmpl.StartNumber != nil {
+		number = *tmpl.StartNumber
+	}
+	timescale := tmpl.Timescale
+	if timescale <= 0 {
+		timescale = 1
+	}
+	add := func(n, time int64) error {
+		if len(t.segments) >= maxDASHSegments {
+			return fmt.Errorf("manifest lists more than %d segments", maxDASHSegments)
+		}
+		u, err := resolveURL(base, expandDASHTemplate(tmpl.Media, rep, n, time))
+		if err != nil {
+			return err
+		}
+		t.segments = append(t.segments, u)
+		return nil
+	}
+
+	switch {
+	case len(tmpl.Timeline) > 0:
+		var at int64
+		end := int64(math.Round(seconds * float64(timescale)))
+		for i, s := range tmpl.Timeline {
+			if s.T != nil {
+				at = *s.T
+			}
+			if s.D <= 0 {
+				return t, errors.New("SegmentTimeline entry has no duration")
+			}
+			repeat := s.R
+			if repeat < 0 {
+				// Repeat until the next entry, or the end of the period
+				until := end
+				if i+1 < len(tmpl.Timeline) && tmpl.Timeline[i+1].T != nil {
+					until = *tmpl.Timeline[i+1].T
+				}
+				if until <= at {
+					return t, errors.New("SegmentTimeline repeats to an unknown end")
+				}
+				repeat = (until-at+s.D-1)/s.D - 1
+			}
+			for j := int64(0); j <= repeat; j++ {
+				if err := add(number, at); err != nil {
+					return t, err
+				}
+				number++
+				at += s.D
+			}
+		}
+	case tmpl.Duration > 0:
+		if seconds <= 0 {
+			return t, errors.New("SegmentTemplate needs the presentation duration to count segments")
+		}
+		count := int64(math.Ceil(seconds * float64(timescale) / float64(tmpl.Duration)))
+		for i := int64(0); i < count; i++ {
+			if err := add(number+i, i*tmpl.Duration); err != nil {
+				return t, err
+			}
+		}
+	default:
+		return t, errors.New("SegmentTemplate has neither a duration nor a SegmentTimeline")
+	}
+	return t, nil
+}
+
+// dashTemplateRe matches $Identifier$ and $Identifier%0Nd$ placeholders
+var dashTemplateRe = regexp.MustCompile(`\$(RepresentationID|Number|Bandwidth|Time|)(%0\d+d)?\$`)
+
+// expandDASHTemplate fills in a SegmentTemplate URL
+func expandDASHTemplate(s string, rep dashRepresentation, number, time int64) string {
+	return dashTemplateRe.ReplaceAllStringFunc(s, func(m string) string {
+		sub := dashTemplateRe.FindStringSubmatch(m)
+		format := sub[2]
+		if format == "" {
+			format = "%d"
+		}
+		switch sub[1] {
+		case "":
+			return "$"
+		case "RepresentationID":
+			return rep.ID
+		case "Number":
+			return fmt.Sprintf(format, number)
+		case "Bandwidth":
+			return fmt.Sprintf(format, rep.Bandwidth)
+		case "Time":
+			return fmt.Sprintf(format, time)
+		}
+		return m
+	})
+}
+
+// isoDurationRe matches the ISO 8601 durations MPDs use, e.g. PT1M4.5S
+var isoDurationRe = regexp.MustCompile(`^P(?:(\d+(?:\.\d+)?)D)?(?:T(?:(\d+(?:\.\d+)?)H)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// parseISODuration returns an ISO 8601 duration in seconds
+func parseISODuration(s string) (float64, error) {
+	m := isoDurationRe.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil || s == "P" || s == "PT" {
+		return 0, fmt.Errorf("bad duration %q", s)
+	}
+	var total float64
+	for i, unit := range []time.Duration{24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		if m[i+1] == "" {
+			continue
+		}
+		v, _ := strconv.ParseFloat(m[i+1], 64)
+		total += v * unit.Seconds()
+	}
+	return total, nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseHLS(t *testing.T) {
+	// Media playlists a master playlist points at
+	playlists := map[string]string{
+		"/hls/low.m3u8":   "#EXTM3U\n#EXTINF:2,\nlow0.ts\n#EXT-X-ENDLIST\n",
+		"/hls/high.m3u8":  "#EXTM3U\n#EXT-X-MAP:URI=\"init.mp4\"\n#EXTINF:2,\nhigh0.m4s\n#EXTINF:2,\nhigh1.m4s\n#EXT-X-ENDLIST\n",
+		"/hls/en.m3u8":    "#EXTM3U\n#EXTINF:2,\nen0.aac\n#EXT-X-ENDLIST\n",
+		"/hls/de.m3u8":    "#EXTM3U\n#EXTINF:2,\nde0.aac\n#EXT-X-ENDLIST\n",
+		"/hls/open.m3u8":  "#EXTM3U\n#EXTINF:2,\nopen0.ts\n",
+		"/other/v.m3u8":   "#EXTM3U\n#EXTINF:2,\nv0.ts\n#EXT-X-ENDLIST\n",
+		"/hls/empty.m3u8": "#EXTM3U\n#EXT-X-ENDLIST\n",
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := playlists[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+	base, _ := url.Parse(srv.URL + "/hls/master.m3u8")
+	f := &segmentFetcher{c: srv.Client(), origin: base}
+	u := func(path string) string { return srv.URL + path }
+
+	tests := []struct {
+		name    string
+		body    string
+		want    []mediaTrack
+		wantErr string
+	}{
+		{
+			name: "media playlist",
+			body: "#EXTM3U\n#EXT-X-TARGETDURATION:2\n#EXTINF:2,\nseg0.ts\n#EXTINF:2,\n/abs/seg1.ts\n#EXT-X-ENDLIST\n",
+			want: []mediaTrack{{segments: []string{u("/hls/seg0.ts"), u("/abs/seg1.ts")}}},
+		},
+		{
+			name: "media playlist with a BOM and an init segment",
+			body: "\ufeff#EXTM3U\n#EXT-X-MAP:URI=\"init.mp4\"\n#EXT-X-KEY:METHOD=NONE\n#EXTINF:2,\nseg0.m4s\n#EXT-X-ENDLIST\n",
+			want: []mediaTrack{{init: u("/hls/init.mp4"), segments: []string{u("/hls/seg0.m4s")}}},
+		},
+		{
+			name: "master playlist takes the highest bandwidth",
+			body: "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=500000\nlow.m3u8\n#EXT-X-STREAM-INF:BANDWIDTH=2000000,CODECS=\"avc1.640028,mp4a.40.2\"\nhigh.m3u8\n",
+			want: []mediaTrack{{init: u("/hls/init.mp4"), segments: []string{u("/hls/high0.m4s"), u("/hls/high1.m4s")}}},
+		},
+		{
+			name: "master playlist with the default audio rendition",
+			body: "#EXTM3U\n" +
+				"#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"aud\",NAME=\"German\",URI=\"de.m3u8\"\n" +
+				"#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"aud\",NAME=\"English\",DEFAULT=YES,URI=\"en.m3u8\"\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=500000,AUDIO=\"aud\"\nlow.m3u8\n",
+			want: []mediaTrack{
+				{kind: "video", segments: []string{u("/hls/low0.ts")}},
+				{kind: "audio", segments: []string{u("/hls/en0.aac")}},
+			},
+		},
+		{
+			name: "variant segments resolve against the variant",
+			body: "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1\n../other/v.m3u8\n",
+			want: []mediaTrack{{segments: []string{u("/other/v0.ts")}}},
+		},
+		{name: "not a playlist", body: "<html>", wantErr: "not an M3U8 playlist"},
+		{name: "unfinished", body: "#EXTM3U\n#EXTINF:2,\nseg0.ts\n", wantErr: "no #EXT-X-ENDLIST"},
+		{name: "unfinished variant", body: "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1\nopen.m3u8\n", wantErr: "no #EXT-X-ENDLIST"},
+		{name: "no segments", body: "#EXTM3U\n#EXT-X-ENDLIST\n", wantErr: "no segments"},
+		{name: "encrypted", body: "#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"k\"\n#EXTINF:2,\nseg0.ts\n#EXT-X-ENDLIST\n", wantErr: "encrypted segments (AES-128)"},
+		{name: "byte ranges", body: "#EXTM3U\n#EXTINF:2,\n#EXT-X-BYTERANGE:1000@0\nall.ts\n#EXT-X-ENDLIST\n", wantErr: "byte-range"},
+		{name: "byte-range init", body: "#EXTM3U\n#EXT-X-MAP:URI=\"all.mp4\",BYTERANGE=\"100@0\"\n#EXTINF:2,\nseg0.ts\n#EXT-X-ENDLIST\n", wantErr: "byte-range"},
+		{name: "master without variants", body: "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1\n", wantErr: "no variants"},
+		{name: "missing variant", body: "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1\ngone.m3u8\n", wantErr: "404"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseHLS(context.Background(), f, base, tt.body)
+			checkTracks(t, got, err, tt.want, tt.wantErr)
+		})
+	}
+}
+
+func TestParseDASH(t *testing.T) {
+	base, _ := url.Parse("https://cdn.example.com/v/manifest.mpd?sig=1")
+	mpd := func(attrs, period string) string {
+		return `<?xml version="1.0"?><MPD xmlns="urn:mpeg:dash:schema:mpd:2011" ` + attrs + `>` + period + `</MPD>`
+	}
+
+	tests := []struct {
+		name    string
+		body    string
+		want    []mediaTrack
+		wantErr string
+	}{
+		{
+			name: "template with a duration and the highest bandwidth",
+			body: mpd(`type="static" mediaPresentationDuration="PT5S"`, `<Period><BaseURL>seg/</BaseURL>
+				<AdaptationSet contentType="video">
+					<SegmentTemplate initialization="$RepresentationID$-init.mp4" media="$RepresentationID$-$Number%03d$.m4s" duration="2" timescale="1"/>
+					<Representation id="v1" bandwidth="100"/><Representation id="v2" bandwidth="500"/>
+				</AdaptationSet></Period>`),
+			want: []mediaTrack{{kind: "video", init: "https://cdn.example.com/v/seg/v2-init.mp4", segments: []string{
+				"https://cdn.example.com/v/seg/v2-001.m4s", "https://cdn.example.com/v/seg/v2-002.m4s", "https://cdn.example.com/v/seg/v2-003.m4s",
+			}}},
+		},
+		{
+			name: "timeline with repeats, and audio by mime type",
+			body: mpd(`mediaPresentationDuration="PT6S"`, `<Period>
+				<AdaptationSet mimeType="video/mp4"><Representation id="v" bandwidth="1">
+					<SegmentTemplate media="v-$Time$.m4s" startNumber="0" timescale="1000"><SegmentTimeline><S t="0" d="2000" r="2"/></SegmentTimeline></SegmentTemplate>
+				</Representation></AdaptationSet>
+				<AdaptationSet mimeType="audio/mp4"><Representation id="a" bandwidth="1">
+					<SegmentTemplate media="a-$Number$.m4s" timescale="1"><SegmentTimeline><S d="4"/><S d="2"/></SegmentTimeline></SegmentTemplate>
+				</Representation></AdaptationSet></Period>`),
+			want: []mediaTrack{
+				{kind: "video", segments: []string{"https://cdn.example.com/v/v-0.m4s", "https://cdn.example.com/v/v-2000.m4s", "https://cdn.example.com/v/v-4000.m4s"}},
+				{kind: "audio", segments: []string{"https://cdn.example.com/v/a-1.m4s", "https://cdn.example.com/v/a-2.m4s"}},
+			},
+		},
+		{
+			name: "timeline repeating to the end of the period",
+			body: mpd(`mediaPresentationDuration="PT5S"`, `<Period><AdaptationSet contentType="video"><Representation id="v" bandwidth="1">
+				<SegmentTemplate media="$Number$.m4s" timescale="1"><SegmentTimeline><S t="0" d="2" r="-1"/></SegmentTimeline></SegmentTemplate>
+				</Representation></AdaptationSet></Period>`),
+			want: []mediaTrack{{kind: "video", segments: []string{
+				"https://cdn.example.com/v/1.m4s", "https://cdn.example.com/v/2.m4s", "https://cdn.example.com/v/3.m4s",
+			}}},
+		},
+		{
+			name: "segment list",
+			body: mpd(``, `<Period><AdaptationSet contentType="video"><Representation id="v" bandwidth="1"><BaseURL>https://other.example.com/x/</BaseURL>
+				<SegmentList><Initialization sourceURL="init.mp4"/><SegmentURL media="s1.m4s"/><SegmentURL media="s2.m4s"/></SegmentList>
+				</Representation></AdaptationSet></Period>`),
+			want: []mediaTrack{{kind: "video", init: "https://other.example.com/x/init.mp4", segments: []string{
+				"https://other.example.com/x/s1.m4s", "https://other.example.com/x/s2.m4s",
+			}}},
+		},
+		{
+			name: "one file per representation, text sets ignored",
+			body: mpd(``, `<Period>
+				<AdaptationSet contentType="text"><Representation id="t" bandwidth="1"><BaseURL>subs.vtt</BaseURL></Representation></AdaptationSet>
+				<AdaptationSet contentType="video"><Representation id="v" bandwidth="1"><BaseURL>video.mp4</BaseURL></Representation></AdaptationSet>
+				</Period>`),
+			want: []mediaTrack{{kind: "video", segments: []string{"https://cdn.example.com/v/video.mp4"}}},
+		},
+		{name: "not XML", body: "#EXTM3U", wantErr: "parsing MPD"},
+		{name: "live", body: mpd(`type="dynamic"`, `<Period/>`), wantErr: "live (dynamic)"},
+		{name: "two periods", body: mpd(``, `<Period/><Period/>`), wantErr: "got 2 periods"},
+		{name: "bad duration", body: mpd(`mediaPresentationDuration="5 seconds"`, `<Period/>`), wantErr: "bad duration"},
+		{name: "no representations", body: mpd(``, `<Period><AdaptationSet contentType="video"/></Period>`), wantErr: "no video or audio"},
+		{
+			name: "template duration without a presentation duration",
+			body: mpd(``, `<Period><AdaptationSet contentType="video"><Representation id="v" bandwidth="1">
+				<SegmentTemplate media="$Number$.m4s" duration="2"/></Representation></AdaptationSet></Period>`),
+			wantErr: "needs the presentation duration",
+		},
+		{
+			name: "too many segments",
+			body: mpd(`mediaPresentationDuration="PT1000000S"`, `<Period><AdaptationSet contentType="video"><Representation id="v" bandwidth="1">
+				<SegmentTemplate media="$Number$.m4s" duration="1"/></Representation></AdaptationSet></Period>`),
+			wantErr: "more than 100000 segments",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDASH(base, []byte(tt.body))
+			checkTracks(t, got, err, tt.want, tt.wantErr)
+		})
+	}
+}
+
+// checkTracks compares a parser's result with the tracks, or the error
+// text, a test case wants
+func checkTracks(t *testing.T, got []mediaTrack, err error, want []mediaTrack, wantErr string) {
+	t.Helper()
+	if wantErr != "" {
+		if err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Fatalf("got error %v, want one containing %q", err, wantErr)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.EqualFunc(got, want, func(a, b mediaTrack) bool {
+		return a.kind == b.kind && a.init == b.init && slices.Equal(a.segments, b.segments)
+	}) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// spendPeriods maps --by values to the label of the period containing t
+var spendPeriods = map[string]func(t time.Time) string{
+	"day":   func(t time.Time) string { return t.Format("2006-01-02") },
+	"week":  func(t time.Time) string { y, w := t.ISOWeek(); return fmt.Sprintf("%d-W%02d", y, w) },
+	"month": func(t time.Time) string { return t.Format("2006-01") },
+}
+
+// spendRow is the spend of one period or model
+type spendRow struct {
+	Key     string  `json:"key"`
+	Videos  int     `json:"videos"`
+	Seconds int     `json:"seconds"`
+	Cost    float64 `json:"cost_usd"`
+}
+
+// spendReport totals the recorded cost of history entries
+type spendReport struct {
+	By       string     `json:"by"`
+	Periods  []spendRow `json:"periods"`
+	Models   []spendRow `json:"models"`
+	Total    spendRow   `json:"total"`
+	Unpriced int        `json:"unpriced"` // finished videos without a recorded cost
+}
+
+// runStats implements `sora-cli stats`: a summary of local history, or with
+// --spend, what it cost by period and model
+func runStats(args []string) {
+	fs := newFlagSet("stats", "[flags]")
+	var (
+		spend   bool
+		by      string
+		session string
+	)
+	fs.BoolVar(&spend, "spend", false, "Summarize the estimated spend by period and by model")
+	fs.StringVar(&by, "by", "month", "Period for --spend: day, week, or month")
+	fs.StringVar(&session, "session", "", "Only count entries in this session")
+	fs.Parse(args)
+
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if _, ok := spendPeriods[by]; !ok {
+		fmt.Fprintf(os.Stderr, "Error: invalid --by %q (use day, week, or month)\n", by)
+		os.Exit(2)
+	}
+
+	h, err := loadHistory()
+	if err != nil {
+		fail("", "failed to load history", err)
+	}
+	var entries []videoHistoryEntry
+	for _, v := range h.Videos {
+		if session == "" || v.Session == session {
+			entries = append(entries, v)
+		}
+	}
+
+	if !spend {
+		printSummary(entries)
+		return
+	}
+	r := newSpendReport(entries, by)
+	if jsonOutput {
+		printJSON(r)
+		return
+	}
+	if r.Total.Videos == 0 {
+		fmt.Fprintln(os.Stderr, "No videos with a recorded cost")
+		return
+	}
+	printSpend(r)
+}
+
+// newSpendReport totals entries by the period named by and by model
+func newSpendReport(entries []videoHistoryEntry, by string) spendReport {
+	r := spendReport{By: by, Total: spendRow{Key: "total"}}
+	period := spendPeriods[by]
+	periods := map[string]*spendRow{}
+	models := map[string]*spendRow{}
+	add := func(m map[string]*spendRow, key string, secs int, cost float64) {
+		row := m[key]
+		if row == nil {
+			row = &spendRow{Key: key}
+			m[key] = row
+		}
+		row.Videos++
+		row.Seconds += secs
+		row.Cost += cost
+	}
+	for _, v := range entries {
+		if v.Pending {
+			continue
+		}
+		if v.Cost == 0 {
+			r.Unpriced++
+			continue
+		}
+		created, err := time.Parse(time.RFC3339, v.CreatedAt)
+		if err != nil {
+			r.Unpriced++
+			continue
+		}
+		secs, _ := strconv.Atoi(v.Seconds)
+		add(periods, period(created.Local()), secs, v.Cost)
+		add(models, v.Model, secs, v.Cost)
+		r.Total.Videos++
+		r.Total.Seconds += secs
+		r.Total.Cost += v.Cost
+	}
+	r.Periods = sortedRows(periods, func(a, b spendRow) bool { return a.Key < b.Key })
+	r.Models = sortedRows(models, func(a, b spendRow) bool { return a.Cost > b.Cost })
+	return r
+}
+
+// sortedRows returns the rows of m ordered by less
+func sortedRows(m map[string]*spendRow, less func(a, b spendRow) bool) []spendRow {
+	rows := make([]spendRow, 0, len(m))
+	for _, row := range m {
+		rows = append(rows, *row)
+	}
+	sort.Slice(rows, func(i, j int) bool { return less(rows[i], rows[j]) })
+	return rows
+}
+
+// printSpend writes the period and model tables of r to stdout
+func printSpend(r spendReport) {
+	table := func(header string, rows []spendRow) {
+		key := listColumn{header: strings.ToUpper(header)}
+		videos := listColumn{header: "VIDEOS"}
+		seconds := listColumn{header: "SECONDS"}
+		cost := listColumn{header: "COST"}
+		for _, row := range append(rows, r.Total) {
+			key.cells = append(key.cells, row.Key)
+			videos.cells = append(videos.cells, strconv.Itoa(row.Videos))
+			seconds.cells = append(seconds.cells, strconv.Itoa(row.Seconds))
+			cost.cells = append(cost.cells, fmt.Sprintf("$%.2f", row.Cost))
+		}
+		for _, c := range []*listColumn{&key, &videos, &seconds, &cost} {
+			c.colors = make([]string, len(c.cells))
+		}
+		renderColumns(os.Stdout, []*listColumn{&key, &videos, &seconds, &cost}, false, true)
+	}
+	table(r.By, r.Periods)
+	fmt.Println()
+	table("model", r.Models)
+	if r.Unpriced > 0 {
+		infof("\n%d videos have no recorded cost (saved before costs were tracked, imported, or an unknown model's price)\n", r.Unpriced)
+	}
+	infof("Costs are estimates from published per-second prices, not billing data.\n")
+}
+
+// printSummary writes counts of entries by model and review state
+func printSummary(entries []videoHistoryEntry) {
+	type summary struct {
+		Videos   int            `json:"videos"`
+		Pending  int            `json:"pending"`
+		Sessions int            `json:"sessions"`
+		Models   map[string]int `json:"models"`
+		States   map[string]int `json:"states"`
+		Cost     float64        `json:"cost_usd"`
+	}
+	s := summary{Models: map[string]int{}, States: map[string]int{}}
+	sessions := map[string]bool{}
+	for _, v := range entries {
+		s.Videos++
+		if v.Pending {
+			s.Pending++
+		}
+		if v.Session != "" {
+			sessions[v.Session] = true
+		}
+		s.Models[cmp.Or(v.Model, "unknown")]++
+		s.States[entryState(v)]++
+		s.Cost += v.Cost
+	}
+	s.Sessions = len(sessions)
+	if jsonOutput {
+		printJSON(s)
+		return
+	}
+	counts := func(m map[string]int) string {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		parts := make([]string, len(keys))
+		for i, k := range keys {
+			parts[i] = fmt.Sprintf("%s %d", k, m[k])
+		}
+		return strings.Join(parts, ", ")
+	}
+	fmt.Printf("%-9s %d (%d pending)\n", "Videos:", s.Videos, s.Pending)
+	fmt.Printf("%-9s %d\n", "Sessions:", s.Sessions)
+	fmt.Printf("%-9s %s\n", "Models:", counts(s.Models))
+	fmt.Printf("%-9s %s\n", "States:", counts(s.States))
+	fmt.Printf("%-9s $%.2f (estimated; see --spend)\n", "Spend:", s.Cost)
+}
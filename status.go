@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// runStatus implements `sora-cli status <ref>`: print a job's current state
+func runStatus(args []string) {
+	fs := newFlagSet("status", "<@last|@N|video_id> [flags]")
+	var common commonOptions
+	addCommonFlags(fs, &common)
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	id, err := resolveRemoteRef(fs.Arg(0))
+	if err != nil {
+		fail("", "failed to resolve video reference", err)
+	}
+
+	apiKey := common.mustAPIKey()
+	ctx, cancel := commandContext()
+	defer cancel()
+	client := mustHTTPClient(common.net)
+
+	st, err := fetchVideoStatus(ctx, client, common.baseURL, apiKey, id)
+	if err != nil {
+		fail(id, "status error", err)
+	}
+	if jsonOutput {
+		out := struct {
+			*videoStatusResponse
+			State     string        `json:"state,omitempty"`
+			Variation string        `json:"variation,omitempty"`
+			Note      string        `json:"note,omitempty"`
+			Session   string        `json:"session,omitempty"`
+			Original  string        `json:"original_prompt,omitempty"`
+			Tool      string        `json:"tool_version,omitempty"`
+			RequestID string        `json:"request_id,omitempty"`
+			Tags      []string      `json:"tags,omitempty"`
+			Favorite  bool          `json:"favorite,omitempty"`
+			Quality   *qualityScore `json:"quality,omitempty"`
+		}{videoStatusResponse: st}
+		if e := findHistoryEntry(id); e != nil {
+			out.State, out.Variation, out.Note, out.Session = entryState(*e), e.Variation, e.Note, e.Session
+			out.Original, out.Tool, out.RequestID = e.OriginalPrompt, e.ToolVersion, e.RequestID
+			out.Tags, out.Favorite, out.Quality = e.Tags, e.Favorite, e.Quality
+		}
+		printJSON(out)
+		return
+	}
+	printStatus(st)
+	if e := findHistoryEntry(id); e != nil {
+		fmt.Printf("%-9s %s\n", "State:", entryState(*e))
+		if e.OriginalPrompt != "" {
+			fmt.Printf("%-9s %s\n", "Original:", e.OriginalPrompt)
+		}
+		if label := tagLabel(*e); label != "" {
+			fmt.Printf("%-9s %s\n", "Tags:", label)
+		}
+		if e.Variation != "" {
+			fmt.Printf("%-9s %s\n", "Variant:", e.Variation)
+		}
+		if e.Note != "" {
+			fmt.Printf("%-9s %s\n", "Note:", e.Note)
+		}
+		if e.Session != "" {
+			fmt.Printf("%-9s %s\n", "Session:", e.Session)
+		}
+		if e.Group != "" {
+			fmt.Printf("%-9s %s\n", "Group:", e.Group)
+		}
+		if e.Seed != nil {
+			fmt.Printf("%-9s %d\n", "Seed:", *e.Seed)
+		}
+		if q := e.Quality; q != nil {
+			fmt.Printf("%-9s %s (vs %s)\n", "Quality:", q.summary(), q.Reference)
+		}
+		if e.ToolVersion != "" {
+			fmt.Printf("%-9s sora-cli %s\n", "Made by:", e.ToolVersion)
+		}
+		if e.RequestID != "" {
+			fmt.Printf("%-9s %s\n", "Request:", e.RequestID)
+		}
+		if e.Remote != "" {
+			fmt.Printf("%-9s %s\n", "Remote:", e.Remote)
+		}
+	}
+}
+
+// printStatus writes a job's status fields to stdout, one per line
+func printStatus(st *videoStatusResponse) {
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Printf("%-9s %s\n", name+":", value)
+		}
+	}
+	unix := func(ts int64) string {
+		if ts == 0 {
+			return ""
+		}
+		return time.Unix(ts, 0).Local().Format("2006-01-02 15:04:05")
+	}
+
+	status := st.Status
+	if st.Progress > 0 && !isQueuedStatus(st.Status) {
+		status = fmt.Sprintf("%s (%d%%)", st.Status, st.Progress)
+	}
+	field("ID", st.ID)
+	field("Status", status)
+	if desc := st.describe(); desc != capitalize(st.Status) {
+		field("Stage", desc)
+	}
+	field("Model", st.Model)
+	field("Size", st.Size)
+	field("Seconds", st.Seconds)
+	field("Created", unix(st.CreatedAt))
+	field("Finished", unix(st.CompletedAt))
+	field("Expires", unix(st.ExpiresAt))
+	if st.Error != nil {
+		field("Error", st.Error.Message)
+	}
+}
@@ -0,0 +1,483 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxScenes limits how long a storyboard can be; each scene is a paid
+// generation
+const maxScenes = 50
+
+// storyboard is a multi-scene script for `sora-cli storyboard`. Fields
+// left empty default as for `create`.
+type storyboard struct {
+	Title   string            `yaml:"title"` // also the default session
+	Model   string            `yaml:"model"`
+	Size    string            `yaml:"size"` // every scene shares it, so the cuts line up
+	Seconds string            `yaml:"seconds"`
+	Scenes  []storyboardScene `yaml:"scenes"`
+
+	// Transition and TransitionDuration apply to every joint between
+	// scenes that doesn't set its own
+	Transition         string `yaml:"transition"`
+	TransitionDuration string `yaml:"transition_duration"`
+
+	joints []transition // between scene i and i+1, set by validate
+}
+
+// storyboardScene is one generation in a storyboard
+type storyboardScene struct {
+	Prompt     string `yaml:"prompt"`
+	Model      string `yaml:"model"`
+	Seconds    string `yaml:"seconds"`
+	Continue   bool   `yaml:"continue"` // start from the previous scene's last frame
+	FirstFrame string `yaml:"first_frame"`
+	// Transition and TransitionDuration set how the previous scene gives
+	// way to this one
+	Transition         string `yaml:"transition"`
+	TransitionDuration string `yaml:"transition_duration"`
+}
+
+// sceneReport is the result of one scene in the storyboard summary
+type sceneReport struct {
+	Scene     int    `json:"scene"`
+	Prompt    string `json:"prompt"`
+	Model     string `json:"model"`
+	Seconds   string `json:"seconds"`
+	Continued bool   `json:"continued,omitempty"`
+	// Transition is how the previous scene gives way to this one, unless
+	// it is a cut
+	Transition string  `json:"transition,omitempty"`
+	ID         string  `json:"id,omitempty"`
+	Result     string  `json:"result"` // generated, reused, failed, or pending
+	Output     string  `json:"output"`
+	Cost       float64 `json:"cost_usd,omitempty"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// storyboardReport summarizes a storyboard run
+type storyboardReport struct {
+	Title   string        `json:"title,omitempty"`
+	Output  string        `json:"output,omitempty"` // the joined video, once every scene is done
+	Scenes  []sceneReport `json:"scenes"`
+	Seconds int           `json:"seconds"`
+	Cost    float64       `json:"cost_usd"` // of the scenes generated by this run
+}
+
+// runStoryboard implements `sora-cli storyboard <file>`: generate each scene
+// of a YAML or JSON storyboard in order, chaining last frames where asked,
+// and join them into one video
+func runStoryboard(args []string) {
+	fs := newFlagSet("storyboard", "<storyboard.yaml|storyboard.json> [flags]")
+	var (
+		output    string
+		overwrite bool
+		tonemap   bool
+		trans     string
+		transLen  time.Duration
+		yes       bool
+		opts      jobOptions
+		common    commonOptions
+	)
+	fs.StringVarP(&output, "output", "o", "", "Write the joined video here (default: the storyboard's name with .mp4)")
+	fs.BoolVar(&overwrite, "overwrite", false, "Regenerate scenes whose files already exist, and overwrite the joined video")
+	fs.BoolVar(&tonemap, "tonemap", false, "Convert HDR first_frame references to SDR BT.709 (needs ffmpeg with zscale)")
+	addTransitionFlags(fs, &trans, &transLen)
+	fs.DurationVar(&opts.downloadTimeout, "download-timeout", 10*time.Minute, "Give up if downloading a finished scene takes longer than this (0 = no limit)")
+	addBudgetFlags(fs, &opts)
+	addSessionFlag(fs, &opts.session)
+	addYesFlag(fs, &yes)
+	addNotifyFlags(fs)
+	addCommonFlags(fs, &common)
+	fs.Parse(args)
+	common.requireWritable("generate storyboards")
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	path := fs.Arg(0)
+	if output == "" {
+		output = strings.TrimSuffix(path, filepath.Ext(path)) + ".mp4"
+	}
+	if output == "-" {
+		fmt.Fprintln(os.Stderr, "Error: storyboard can't write to stdout; give -o a file name")
+		os.Exit(2)
+	}
+	if tonemap {
+		if err := checkTonemap(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	joint, err := newTransition(trans, transLen)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --transition: %v\n", err)
+		os.Exit(2)
+	}
+	if err := validateNotify(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	if err := opts.validateBudgets(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	if !isFFmpegAvailable() {
+		fmt.Fprintln(os.Stderr, ffmpegInstallMsg)
+		os.Exit(1)
+	}
+
+	sb, err := readStoryboard(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	if err := sb.validate(joint); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s: %v\n", path, err)
+		var be *blockedError
+		if errors.As(err, &be) {
+			os.Exit(exitPolicy)
+		}
+		os.Exit(2)
+	}
+	if err := checkTransitions(sb.joints); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if opts.session == "" {
+		if opts.session, err = cleanSession(sb.Title); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: title: %v\n", path, err)
+			os.Exit(2)
+		}
+	}
+
+	// Scenes already on disk from an earlier run are kept, so a storyboard
+	// that stopped partway resumes where it left off
+	report := storyboardReport{Title: sb.Title}
+	var total float64
+	todo := 0
+	for i, s := range sb.Scenes {
+		r := sceneReport{Scene: i + 1, Prompt: s.Prompt, Model: s.Model, Seconds: s.Seconds, Continued: s.Continue, Result: "pending", Output: scenePath(output, i)}
+		if i > 0 && !sb.joints[i-1].cut() {
+			r.Transition = sb.joints[i-1].String()
+		}
+		if _, err := os.Stat(r.Output); err == nil && !overwrite {
+			r.Result = "reused"
+			if e := historyEntryForFile(r.Output); e != nil {
+				r.ID, r.Seconds = e.ID, cmp.Or(e.Seconds, r.Seconds)
+			}
+			infof("Scene %d: keeping %s (use --overwrite to regenerate it)\n", r.Scene, r.Output)
+		} else {
+			todo++
+			if cost, ok := videoCost(s.Model, s.Seconds); ok {
+				total += cost
+			}
+		}
+		report.Scenes = append(report.Scenes, r)
+	}
+	if todo > 0 && !confirmCost(total, fmt.Sprintf("%d scenes", todo), yes) {
+		fmt.Fprintln(os.Stderr, "Aborted")
+		os.Exit(exitCanceled)
+	}
+
+	// First-frame images are loaded up front so a bad path fails before
+	// anything is paid for
+	refs := make([]*inputReference, len(sb.Scenes))
+	for i, s := range sb.Scenes {
+		if s.FirstFrame == "" || report.Scenes[i].Result == "reused" {
+			continue
+		}
+		checkReferenceLength(s.FirstFrame, s.Seconds)
+		if m := checkReferenceAspect(s.FirstFrame, sb.Size, false); m != nil {
+			if m.better != "" {
+				m.warn(fmt.Sprintf("Set the storyboard's size to %s to render it that way.", orientationName(m.better)))
+			} else {
+				m.warn()
+			}
+		}
+		if refs[i], err = loadInputReference(s.FirstFrame, sb.Size, tonemap, false); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: scene %d: %v\n", path, i+1, err)
+			os.Exit(2)
+		}
+	}
+
+	apiKey := common.mustAPIKey()
+	ctx, cancel := commandContext()
+	defer cancel()
+	client := mustHTTPClient(common.net)
+	tmpDir, err := os.MkdirTemp("", "sora-storyboard-*")
+	if err != nil {
+		fail("", "failed to create temp dir", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var failed error
+	for i, s := range sb.Scenes {
+		r := &report.Scenes[i]
+		if r.Result == "reused" {
+			continue
+		}
+		infof("Scene %d of %d: %s\n", i+1, len(sb.Scenes), truncate(s.Prompt, 60))
+		ref := refs[i]
+		if s.Continue {
+			frame := filepath.Join(tmpDir, fmt.Sprintf("scene%02d-last.png", i))
+			if err := extractLastFrame(ctx, report.Scenes[i-1].Output, frame); err != nil {
+				failed = fmt.Errorf("extracting the last frame of scene %d: %w", i, err)
+			} else if ref, err = loadInputReference(frame, sb.Size, false, false); err != nil {
+				failed = fmt.Errorf("scene %d: %w", i+1, err)
+			}
+		}
+		if failed == nil {
+			failed = generateScene(ctx, client, common.baseURL, apiKey, s, ref, sb.Size, r, report.Scenes, opts)
+		}
+		if failed != nil {
+			r.Result, r.Error = "failed", failed.Error()
+			break
+		}
+		report.Cost += r.Cost
+	}
+
+	if failed == nil {
+		paths := make([]string, len(report.Scenes))
+		for i, r := range report.Scenes {
+			paths[i] = r.Output
+		}
+		resolved, _, err := resolveOutputPath(output, rewritePolicy(overwrite))
+		if err == nil {
+			infof("Joining %d scenes...\n", len(paths))
+			err = concatVideos(ctx, paths, sb.joints, resolved, &encodeOptions{})
+		}
+		if err != nil {
+			failed = fmt.Errorf("joining scenes: %w", err)
+		} else {
+			report.Output = resolved
+		}
+	}
+	for _, r := range report.Scenes {
+		if r.Result == "generated" || r.Result == "reused" {
+			n, _ := strconv.Atoi(r.Seconds)
+			report.Seconds += n
+		}
+	}
+
+	if jsonOutput {
+		printJSON(report)
+	} else {
+		printStoryboardReport(os.Stdout, report)
+	}
+	if failed != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", failed)
+		if ctx.Err() == nil {
+			infof("Finished scenes are kept; rerun the same command to continue from where it stopped.\n")
+		}
+		notifier.failed("", failed)
+		os.Exit(exitCode(failed))
+	}
+	infof("Storyboard saved to: %s\n", report.Output)
+}
+
+// generateScene submits one scene, waits for it, and saves it to r.Output,
+// recording it in history. A continued scene is recorded as an extension of
+// the scene before it.
+func generateScene(ctx context.Context, c *http.Client, baseURL, apiKey string, s storyboardScene, ref *inputReference, size string, r *sceneReport, scenes []sceneReport, opts jobOptions) error {
+	timings := newPhaseTimings()
+	notifier.track("", s.Prompt, s.Model)
+	jobID, reqID, err := createVideoJob(ctx, c, baseURL, apiKey, s.Model, s.Prompt, ref, size, s.Seconds, nil, "")
+	if err != nil {
+		return fmt.Errorf("scene %d: submit failed: %w", r.Scene, err)
+	}
+	r.ID = jobID
+	infof("Created job: %s\n", jobID)
+	notifier.track(jobID, s.Prompt, s.Model)
+	emitEvent(jsonEvent{Event: "submitted", ID: jobID, RequestID: reqID})
+
+	st, err := waitForJob(ctx, c, baseURL, apiKey, jobID, opts, time.Now(), timings)
+	if err != nil {
+		return fmt.Errorf("scene %d: %w", r.Scene, err)
+	}
+	opts.output = r.Output
+	if _, err := saveJobOutput(ctx, c, baseURL, apiKey, jobID, opts, timings); err != nil {
+		return fmt.Errorf("scene %d: %w", r.Scene, err)
+	}
+
+	entry := videoHistoryEntry{
+		ID:         jobID,
+		Prompt:     s.Prompt,
+		CreatedAt:  time.Now().UTC().Format(time.RFC3339),
+		OutputFile: r.Output,
+		Model:      s.Model,
+		Session:    opts.session,
+		RequestID:  reqID,
+	}
+	if s.FirstFrame != "" {
+		entry.ImageInput = &s.FirstFrame
+	}
+	if prev := r.Scene - 2; s.Continue && scenes[prev].ID != "" {
+		entry.ExtendedFrom = &scenes[prev].ID
+	}
+	entry.recordResult(st)
+	if err := addToHistory(entry); err != nil {
+		infof("Warning: failed to save to history: %v\n", err)
+	}
+	r.Result, r.Seconds, r.Cost = "generated", entry.Seconds, entry.Cost
+	infof("Scene %d saved to: %s\n", r.Scene, r.Output)
+	return nil
+}
+
+// readStoryboard parses a storyboard file. JSON is read by the same parser,
+// since it is also YAML; unknown fields are errors, to catch typos.
+func readStoryboard(path string) (*storyboard, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	var sb storyboard
+	if err := dec.Decode(&sb); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &sb, nil
+}
+
+// validate fills in defaults and checks every scene, so nothing is
+// submitted if any scene is wrong. Joints the file doesn't set get the
+// transition def.
+func (sb *storyboard) validate(def transition) error {
+	switch {
+	case len(sb.Scenes) == 0:
+		return errors.New("no scenes")
+	case len(sb.Scenes) > maxScenes:
+		return fmt.Errorf("%d scenes; at most %d are allowed", len(sb.Scenes), maxScenes)
+	}
+	switch strings.ToLower(sb.Size) {
+	case "":
+		sb.Size = cfg.size()
+	case "landscape", "1280x720":
+		sb.Size = "1280x720"
+	case "portrait", "720x1280":
+		sb.Size = "720x1280"
+	default:
+		return fmt.Errorf("size must be 1280x720, 720x1280, portrait, or landscape, got %q", sb.Size)
+	}
+	for i := range sb.Scenes {
+		s := &sb.Scenes[i]
+		if strings.TrimSpace(s.Prompt) == "" {
+			return fmt.Errorf("scene %d: prompt is empty", i+1)
+		}
+		if err := screenText(fmt.Sprintf("scene %d: prompt", i+1), s.Prompt); err != nil {
+			return err
+		}
+		s.Model = cfg.resolveModel(cmp.Or(s.Model, sb.Model, cfg.model()))
+		s.Seconds = cmp.Or(s.Seconds, sb.Seconds, cfg.seconds())
+		switch s.Seconds {
+		case "4", "8", "12":
+		default:
+			return fmt.Errorf("scene %d: seconds must be 4, 8, or 12, got %s", i+1, s.Seconds)
+		}
+		switch {
+		case s.Continue && i == 0:
+			return errors.New("scene 1: continue needs a scene before it")
+		case s.Continue && s.FirstFrame != "":
+			return fmt.Errorf("scene %d: continue and first_frame both set the first frame; use one", i+1)
+		case i == 0 && (s.Transition != "" || s.TransitionDuration != ""):
+			return errors.New("scene 1: transition needs a scene before it")
+		}
+		if i == 0 {
+			continue
+		}
+		t, err := sb.joint(*s, def)
+		if err != nil {
+			return fmt.Errorf("scene %d: %w", i+1, err)
+		}
+		sb.joints = append(sb.joints, t)
+	}
+	return nil
+}
+
+// joint returns the transition into scene s: its own, else the
+// storyboard's, else def
+func (sb *storyboard) joint(s storyboardScene, def transition) (transition, error) {
+	d := def.duration
+	if def.cut() {
+		d = defaultTransitionDuration
+	}
+	for _, v := range []string{sb.TransitionDuration, s.TransitionDuration} {
+		if v == "" {
+			continue
+		}
+		// A bare number is seconds
+		if secs, err := strconv.ParseFloat(v, 64); err == nil {
+			d = time.Duration(secs * float64(time.Second))
+		} else if d, err = time.ParseDuration(v); err != nil {
+			return transition{}, fmt.Errorf("invalid transition_duration %q", v)
+		}
+	}
+	return newTransition(cmp.Or(s.Transition, sb.Transition, def.kind), d)
+}
+
+// scenePath returns where scene i (from 0) of the storyboard joined into
+// output is saved, e.g. film.mp4 -> film.scene01.mp4
+func scenePath(output string, i int) string {
+	return fmt.Sprintf("%s.scene%02d.mp4", strings.TrimSuffix(output, filepath.Ext(output)), i+1)
+}
+
+// historyEntryForFile returns the history entry saved to path, or nil
+func historyEntryForFile(path string) *videoHistoryEntry {
+	h, err := loadHistory()
+	if err != nil {
+		return nil
+	}
+	for i := range h.Videos {
+		if h.Videos[i].OutputFile == path {
+			return &h.Videos[i]
+		}
+	}
+	return nil
+}
+
+// printStoryboardReport writes the per-scene summary table and totals
+func printStoryboardReport(w io.Writer, r storyboardReport) {
+	scene := listColumn{header: "SCENE"}
+	result := listColumn{header: "RESULT"}
+	seconds := listColumn{header: "SECONDS"}
+	cost := listColumn{header: "COST"}
+	id := listColumn{header: "ID"}
+	prompt := listColumn{header: "PROMPT", flex: true}
+	for _, s := range r.Scenes {
+		scene.cells = append(scene.cells, strconv.Itoa(s.Scene))
+		res := s.Result
+		if s.Continued {
+			res += " (cont.)"
+		}
+		result.cells = append(result.cells, res)
+		seconds.cells = append(seconds.cells, s.Seconds)
+		c := "-"
+		if s.Cost > 0 {
+			c = fmt.Sprintf("$%.2f", s.Cost)
+		}
+		cost.cells = append(cost.cells, c)
+		id.cells = append(id.cells, cmp.Or(s.ID, "-"))
+		prompt.cells = append(prompt.cells, s.Prompt)
+	}
+	cols := []*listColumn{&scene, &result, &seconds, &cost, &id, &prompt}
+	for _, c := range cols {
+		c.colors = make([]string, len(c.cells))
+	}
+	renderColumns(w, cols, false, false)
+	infof("%d seconds in %d scenes; this run cost about $%.2f\n", r.Seconds, len(r.Scenes), r.Cost)
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// syncConcurrency is how many videos missing from the remote listing sync
+// looks up at once
+const syncConcurrency = 8
+
+// Values of videoHistoryEntry.Remote
+const (
+	remoteDeleted = "deleted"
+	remoteExpired = "expired"
+)
+
+// syncChange is one history entry whose remote state sync changed
+type syncChange struct {
+	ID     string `json:"id"`
+	Remote string `json:"remote"` // new state; "" when the video is available again
+}
+
+// syncReport is what sync found and did
+type syncReport struct {
+	Changed  []syncChange `json:"changed"`
+	Imported []string     `json:"imported"`
+	// OnlyCopy are saved local files whose remote copy is gone; Lost are
+	// entries with neither
+	OnlyCopy []string `json:"only_copy"`
+	Lost     []string `json:"lost"`
+	DryRun   bool     `json:"dry_run,omitempty"`
+}
+
+// runSync implements `sora-cli sync`: reconcile local history with the API
+// account, marking videos deleted or expired remotely and importing
+// finished videos that history doesn't know about
+func runSync(args []string) {
+	fs := newFlagSet("sync", "[flags]")
+	var (
+		dryRun   bool
+		noImport bool
+		session  string
+		common   commonOptions
+	)
+	fs.BoolVar(&dryRun, "dry-run", false, "Only show what would change")
+	fs.BoolVar(&noImport, "no-import", false, "Don't add remote videos missing from history")
+	fs.StringVar(&session, "session", "", "Session for imported videos")
+	addCommonFlags(fs, &common)
+	fs.Parse(args)
+
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	apiKey := common.mustAPIKey()
+	ctx, cancel := commandContext()
+	defer cancel()
+	client := mustHTTPClient(common.net)
+
+	remote, err := listRecentVideos(ctx, client, common.baseURL, apiKey, 0)
+	if err != nil {
+		fail("", "failed to list remote videos", err)
+	}
+	h, err := loadHistory()
+	if err != nil {
+		fail("", "failed to load history", err)
+	}
+
+	// The listing may leave out some videos, so only a lookup that finds
+	// nothing counts as deleted
+	listed := make(map[string]videoObject, len(remote))
+	for _, v := range remote {
+		listed[v.ID] = v
+	}
+	var unlisted []string
+	for _, v := range h.Videos {
+		if _, ok := listed[v.ID]; !ok && !strings.HasPrefix(v.ID, importedIDPrefix) {
+			unlisted = append(unlisted, v.ID)
+		}
+	}
+	found := lookupVideos(ctx, client, common.baseURL, apiKey, unlisted)
+	if ctx.Err() != nil {
+		fail("", "sync interrupted", ctx.Err())
+	}
+
+	// Work out each entry's remote state
+	now := time.Now()
+	states := make(map[string]string)
+	known := make(map[string]bool, len(h.Videos))
+	for _, v := range h.Videos {
+		known[v.ID] = true
+		if strings.HasPrefix(v.ID, importedIDPrefix) {
+			continue
+		}
+		o, ok := listed[v.ID]
+		if !ok {
+			r, checked := found[v.ID]
+			if !checked {
+				continue // lookup failed; leave the entry as it was
+			}
+			if r == nil {
+				states[v.ID] = remoteDeleted
+				continue
+			}
+			o = *r
+		}
+		states[v.ID] = ""
+		if o.ExpiresAt > 0 && time.Unix(o.ExpiresAt, 0).Before(now) {
+			states[v.ID] = remoteExpired
+		}
+	}
+	var imports []videoHistoryEntry
+	if !noImport {
+		for _, o := range remote {
+			switch strings.ToLower(o.Status) {
+			case "completed", "succeeded":
+				if !known[o.ID] {
+					imports = append(imports, remoteHistoryEntry(o.statusResponse(), "", session))
+				}
+			}
+		}
+	}
+
+	apply := func(h *history) syncReport {
+		r := syncReport{Changed: []syncChange{}, Imported: []string{}, OnlyCopy: []string{}, Lost: []string{}, DryRun: dryRun}
+		for i := range h.Videos {
+			e := &h.Videos[i]
+			if state, ok := states[e.ID]; ok && state != e.Remote {
+				e.Remote = state
+				r.Changed = append(r.Changed, syncChange{ID: e.ID, Remote: state})
+			}
+			if e.Remote == "" {
+				continue
+			}
+			if status, _ := entryStatus(*e); status == "saved" {
+				r.OnlyCopy = append(r.OnlyCopy, e.ID)
+			} else {
+				r.Lost = append(r.Lost, e.ID)
+			}
+		}
+		for _, e := range imports {
+			r.Imported = append(r.Imported, e.ID)
+		}
+		h.Videos = append(imports, h.Videos...)
+		return r
+	}
+
+	var report syncReport
+	if dryRun {
+		report = apply(h)
+	} else {
+		err = editHistory(func(h *history) bool {
+			report = apply(h)
+			return len(report.Changed) > 0 || len(report.Imported) > 0
+		})
+		if err != nil {
+			fail("", "failed to update history", err)
+		}
+	}
+
+	if jsonOutput {
+		printJSON(report)
+		return
+	}
+	printSyncReport(report)
+}
+
+// statusResponse converts a listed video to the shape fetchVideoStatus
+// returns, for remoteHistoryEntry
+func (o videoObject) statusResponse() *videoStatusResponse {
+	return &videoStatusResponse{
+		ID:                 o.ID,
+		Status:             o.Status,
+		Error:              o.Error,
+		Progress:           o.Progress,
+		Model:              o.Model,
+		Size:               o.Size,
+		Seconds:            o.Seconds,
+		Prompt:             o.Prompt,
+		Seed:               o.Seed,
+		RemixedFromVideoID: o.RemixedFromVideoID,
+		CreatedAt:          o.CreatedAt,
+		ExpiresAt:          o.ExpiresAt,
+	}
+}
+
+// lookupVideos fetches each video in parallel. The result maps an ID to its
+// video, or to nil if the API doesn't have it; IDs whose lookup failed for
+// another reason are left out after a warning.
+func lookupVideos(ctx context.Context, c *http.Client, baseURL, apiKey string, ids []string) map[string]*videoObject {
+	found := make(map[string]*videoObject, len(ids))
+	var mu sync.Mutex
+	queue := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < min(syncConcurrency, len(ids)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range queue {
+				st, err := fetchVideoStatus(ctx, c, baseURL, apiKey, id)
+				var se *statusError
+				switch {
+				case errors.As(err, &se) && se.StatusCode == http.StatusNotFound:
+					mu.Lock()
+					found[id] = nil
+					mu.Unlock()
+				case err != nil:
+					if ctx.Err() == nil {
+						warnf("Warning: checking %s: %v\n", id, err)
+					}
+				default:
+					mu.Lock()
+					found[id] = &videoObject{
+						ID:                 st.ID,
+						Status:             st.Status,
+						Model:              st.Model,
+						Prompt:             st.Prompt,
+						Size:               st.Size,
+						Seconds:            st.Seconds,
+						Seed:               st.Seed,
+						CreatedAt:          st.CreatedAt,
+						CompletedAt:        st.CompletedAt,
+						ExpiresAt:          st.ExpiresAt,
+						RemixedFromVideoID: st.RemixedFromVideoID,
+						Error:              st.Error,
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			break
+		}
+		queue <- id
+	}
+	close(queue)
+	wg.Wait()
+	return found
+}
+
+// printSyncReport summarizes what sync changed and which entries now have
+// no remote copy
+func printSyncReport(r syncReport) {
+	verb := "Marked"
+	if r.DryRun {
+		verb = "Would mark"
+	}
+	for _, c := range r.Changed {
+		state := c.Remote
+		if state == "" {
+			state = "available"
+		}
+		fmt.Printf("%s %s %s\n", verb, c.ID, state)
+	}
+	if len(r.Imported) > 0 {
+		verb := "Imported"
+		if r.DryRun {
+			verb = "Would import"
+		}
+		fmt.Printf("%s %d remote video(s): %s\n", verb, len(r.Imported), strings.Join(r.Imported, ", "))
+	}
+	if len(r.OnlyCopy) > 0 {
+		fmt.Printf("Only local copy left (keep these files): %s\n", strings.Join(r.OnlyCopy, ", "))
+	}
+	if len(r.Lost) > 0 {
+		fmt.Printf("Lost (no local file and no remote copy): %s\n", strings.Join(r.Lost, ", "))
+	}
+	if len(r.Changed) == 0 && len(r.Imported) == 0 {
+		infof("History is in sync with the remote account\n")
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// favoriteMark is shown in list's TAGS column for favorites
+const favoriteMark = "★"
+
+// tagRe matches valid tags: letters, digits, and . _ : / - without spaces,
+// so they can be typed unquoted and listed comma-separated
+var tagRe = regexp.MustCompile(`^[\pL\pN][\pL\pN._:/-]*$`)
+
+// parseTag normalizes a tag to lower case and validates it
+func parseTag(s string) (string, error) {
+	t := strings.ToLower(strings.TrimSpace(s))
+	if !tagRe.MatchString(t) {
+		return "", fmt.Errorf("invalid tag %q (use letters, digits, and . _ : / -)", s)
+	}
+	return t, nil
+}
+
+// hasTags reports whether the entry has every one of tags
+func hasTags(v videoHistoryEntry, tags []string) bool {
+	for _, t := range tags {
+		if !slices.Contains(v.Tags, t) {
+			return false
+		}
+	}
+	return true
+}
+
+// tagLabel is an entry's favorite mark and tags, as list shows them
+func tagLabel(v videoHistoryEntry) string {
+	parts := slices.Clone(v.Tags)
+	if v.Favorite {
+		parts = append([]string{favoriteMark}, parts...)
+	}
+	return strings.Join(parts, " ")
+}
+
+// runTag implements `sora-cli tag <ref> [tag]...`: label a history entry,
+// e.g. by client, so list can filter on it; with no tags, print its tags
+func runTag(args []string) {
+	fs := newFlagSet("tag", "<@last|@N|video_id> [tag]... [flags]")
+	var remove, favorite, unfavorite bool
+	fs.BoolVar(&remove, "remove", false, "Remove the given tags instead of adding them")
+	fs.BoolVar(&favorite, "favorite", false, "Mark the entry as a favorite")
+	fs.BoolVar(&unfavorite, "unfavorite", false, "Remove the favorite mark")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 || (favorite && unfavorite) || (remove && fs.NArg() == 1) {
+		fs.Usage()
+		os.Exit(2)
+	}
+	tags := make([]string, 0, fs.NArg()-1)
+	for _, a := range fs.Args()[1:] {
+		t, err := parseTag(a)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(2)
+		}
+		tags = append(tags, t)
+	}
+	id, err := resolveVideoRef(fs.Arg(0))
+	if err != nil {
+		fail("", "failed to resolve video reference", err)
+	}
+
+	if len(tags) == 0 && !favorite && !unfavorite {
+		e := findHistoryEntry(id)
+		if e == nil {
+			fmt.Fprintf(os.Stderr, "%s is not in history\n", id)
+			os.Exit(1)
+		}
+		if jsonOutput {
+			printJSON(map[string]any{"id": id, "tags": nonNilTags(e.Tags), "favorite": e.Favorite})
+		} else if label := tagLabel(*e); label != "" {
+			fmt.Println(label)
+		}
+		return
+	}
+
+	var updated videoHistoryEntry
+	found, err := updateHistoryEntry(id, func(e *videoHistoryEntry) {
+		for _, t := range tags {
+			switch i := slices.Index(e.Tags, t); {
+			case remove && i >= 0:
+				e.Tags = slices.Delete(e.Tags, i, i+1)
+			case !remove && i < 0:
+				e.Tags = append(e.Tags, t)
+			}
+		}
+		if favorite || unfavorite {
+			e.Favorite = favorite
+		}
+		updated = *e
+	})
+	if err != nil {
+		fail("", "failed to update history", err)
+	}
+	if !found {
+		fmt.Fprintf(os.Stderr, "%s is not in history\n", id)
+		os.Exit(1)
+	}
+	if jsonOutput {
+		printJSON(map[string]any{"id": id, "tags": nonNilTags(updated.Tags), "favorite": updated.Favorite})
+		return
+	}
+	label := tagLabel(updated)
+	if label == "" {
+		label = "(no tags)"
+	}
+	infof("%s: %s\n", id, label)
+}
+
+// nonNilTags returns tags, or an empty slice so JSON shows [] rather than null
+func nonNilTags(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
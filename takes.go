@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// maxTakes limits --count; every take is billed as a separate video
+const maxTakes = 8
+
+// groupIDPrefix starts the IDs that tie the takes of a --count run together
+const groupIDPrefix = "grp_"
+
+// newGroupID returns an ID for the takes of one --count run
+func newGroupID() string {
+	b := make([]byte, 6)
+	_, _ = rand.Read(b)
+	return groupIDPrefix + hex.EncodeToString(b)
+}
+
+// runTakes renders count takes of the same request, at most concurrency at
+// a time, and records them in history as one group. Outputs are numbered
+// like --explore variations: clip.mp4 -> clip-v1.mp4, clip-v2.mp4, ... It
+// returns false if any take failed.
+func runTakes(ctx context.Context, c *http.Client, baseURL, apiKey string, base batchRow, count, concurrency int, tonemap, pad bool, post *postOptions, opts jobOptions) bool {
+	rows := make([]batchRow, count)
+	for i := range rows {
+		rows[i] = base
+		if base.Output != "" {
+			rows[i].Output = variantPath(base.Output, i+1)
+		}
+	}
+	return runGroup(ctx, c, baseURL, apiKey, rows, fmt.Sprintf("%d takes", count), nil, concurrency, tonemap, pad, post, opts)
+}
+
+// runGroup renders rows, at most concurrency at a time, labeled v1, v2, ...
+// and records them in history as one group; what describes them, e.g. "3
+// takes". It returns false if any row failed.
+func runGroup(ctx context.Context, c *http.Client, baseURL, apiKey string, rows []batchRow, what string, seed *int64, concurrency int, tonemap, pad bool, post *postOptions, opts jobOptions) bool {
+	policy, err := opts.existingPolicy()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	numbered := make([]numberedRow, len(rows))
+	for i, row := range rows {
+		numbered[i] = numberedRow{i + 1, row}
+	}
+	jobs, err := prepareBatchJobs(numbered, policy, tonemap, pad)
+	if err != nil {
+		fail("", "Error", err)
+	}
+	group := newGroupID()
+	for i, j := range jobs {
+		j.label = fmt.Sprintf("v%d", i+1)
+		j.group = group
+		j.seed = seed
+	}
+
+	infof("Rendering %s (group %s)...\n", what, group)
+	runJobPool(ctx, c, baseURL, apiKey, jobs, opts, concurrency)
+	ok := finishVariants(ctx, jobs, post)
+	infof("List them with: sora-cli list --group %s\n", group)
+	return ok
+}
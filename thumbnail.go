@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/chai2010/webp"
+	"github.com/disintegration/imaging"
+)
+
+// defaultThumbnailAt is where --thumbnail grabs the poster frame
+const defaultThumbnailAt = time.Second
+
+// thumbnailPath returns where the poster frame of video is saved: next to
+// it, with a .jpg extension
+func thumbnailPath(video string) string {
+	return strings.TrimSuffix(video, filepath.Ext(video)) + ".jpg"
+}
+
+// saveThumbnail writes the poster frame of a saved video next to it and
+// returns its path. With ffmpeg the frame is taken at offset at (or the
+// middle of shorter videos); without it, the API's own thumbnail is used.
+func saveThumbnail(ctx context.Context, c *http.Client, baseURL, apiKey, id, video string, at time.Duration) (string, error) {
+	out := thumbnailPath(video)
+	if isFFmpegAvailable() {
+		if d, err := getVideoDuration(video); err == nil && at >= d {
+			at = d / 2
+		}
+		if err := extractThumbnail(ctx, video, out, at, 0); err != nil {
+			return "", err
+		}
+		return out, nil
+	}
+	if err := downloadThumbnail(ctx, c, baseURL, apiKey, id, out); err != nil {
+		return "", fmt.Errorf("ffmpeg not found, and fetching the API thumbnail failed: %w", err)
+	}
+	return out, nil
+}
+
+// downloadThumbnail fetches the thumbnail variant of a video's content,
+// which the API renders itself, and writes it to out as a JPEG
+func downloadThumbnail(ctx context.Context, c *http.Client, baseURL, apiKey, id, out string) error {
+	url := strings.TrimRight(baseURL, "/") + "/videos/" + id + "/content?variant=thumbnail"
+	resp, err := openDownload(ctx, c, apiKey, url)
+	if err != nil {
+		return err
+	}
+	defer closeBody(resp)
+
+	var img image.Image
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "image/webp") {
+		img, err = webp.Decode(resp.Body)
+	} else {
+		img, _, err = image.Decode(resp.Body)
+	}
+	if err != nil {
+		return fmt.Errorf("decoding thumbnail: %w", err)
+	}
+
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	if err := imaging.Encode(f, img, imaging.JPEG, imaging.JPEGQuality(90)); err != nil {
+		f.Close()
+		os.Remove(out)
+		return err
+	}
+	return f.Close()
+}
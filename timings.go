@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// phaseTimings records how long each phase of a generation took
+type phaseTimings struct {
+	names     []string
+	durations map[string]time.Duration
+}
+
+func newPhaseTimings() *phaseTimings {
+	return &phaseTimings{durations: make(map[string]time.Duration)}
+}
+
+// add records d against phase, accumulating if the phase repeats
+func (t *phaseTimings) add(phase string, d time.Duration) {
+	if _, ok := t.durations[phase]; !ok {
+		t.names = append(t.names, phase)
+	}
+	t.durations[phase] += d
+}
+
+// start begins timing phase; call the returned function to stop
+func (t *phaseTimings) start(phase string) func() {
+	begin := time.Now()
+	return func() { t.add(phase, time.Since(begin)) }
+}
+
+// total is the sum of all recorded phases
+func (t *phaseTimings) total() time.Duration {
+	var sum time.Duration
+	for _, d := range t.durations {
+		sum += d
+	}
+	return sum
+}
+
+// seconds returns each phase's duration in seconds, for --json
+func (t *phaseTimings) seconds() map[string]float64 {
+	m := make(map[string]float64, len(t.durations))
+	for name, d := range t.durations {
+		m[name] = d.Seconds()
+	}
+	return m
+}
+
+// String renders one indented line per phase, in the order they were recorded
+func (t *phaseTimings) String() string {
+	width := 0
+	for _, name := range t.names {
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+	var sb strings.Builder
+	for _, name := range t.names {
+		fmt.Fprintf(&sb, "  %-*s  %s\n", width, name, formatPhaseDuration(t.durations[name]))
+	}
+	return sb.String()
+}
+
+// formatPhaseDuration is formatDuration with sub-second precision for short phases
+func formatPhaseDuration(d time.Duration) string {
+	if d < 10*time.Second {
+		return fmt.Sprintf("%.1fs", d.Seconds())
+	}
+	return formatDuration(d)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+// Limits for transition lengths; an overlap eats into both clips, and
+// generations are at most 12 seconds
+const (
+	defaultTransitionDuration = 500 * time.Millisecond
+	maxTransitionDuration     = 3 * time.Second
+)
+
+// transitionKinds maps --transition names to ffmpeg xfade transitions; a
+// cut needs none
+var transitionKinds = map[string]string{
+	"cut":       "",
+	"crossfade": "fade",
+	"fadeblack": "fadeblack",
+	"fadewhite": "fadewhite",
+}
+
+// transition is how one clip gives way to the next when clips are joined
+type transition struct {
+	kind     string        // a key of transitionKinds
+	duration time.Duration // how long the two clips overlap; 0 for a cut
+}
+
+// addTransitionFlags registers --transition and --transition-duration
+func addTransitionFlags(fs *flag.FlagSet, kind *string, d *time.Duration) {
+	fs.StringVar(kind, "transition", "cut", "How each clip gives way to the next: "+strings.Join(transitionNames(), ", "))
+	fs.DurationVar(d, "transition-duration", defaultTransitionDuration, fmt.Sprintf("Length of each --transition, up to %s", maxTransitionDuration))
+}
+
+func transitionNames() []string {
+	names := make([]string, 0, len(transitionKinds))
+	for name := range transitionKinds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newTransition checks a transition name and length. A cut has no length.
+func newTransition(kind string, d time.Duration) (transition, error) {
+	kind = strings.ToLower(strings.TrimSpace(kind))
+	if _, ok := transitionKinds[kind]; !ok {
+		return transition{}, fmt.Errorf("unknown transition %q (available: %s)", kind, strings.Join(transitionNames(), ", "))
+	}
+	if kind == "cut" {
+		return transition{kind: kind}, nil
+	}
+	if d <= 0 || d > maxTransitionDuration {
+		return transition{}, fmt.Errorf("transition length must be more than 0 and at most %s, got %s", maxTransitionDuration, d)
+	}
+	return transition{kind: kind, duration: d}, nil
+}
+
+// cut reports whether t is a plain cut
+func (t transition) cut() bool {
+	return t.duration == 0
+}
+
+// String returns e.g. "crossfade 500ms", or "cut"
+func (t transition) String() string {
+	if t.cut() {
+		return "cut"
+	}
+	return fmt.Sprintf("%s %s", t.kind, t.duration)
+}
+
+// allCuts reports whether every joint is a plain cut
+func allCuts(joints []transition) bool {
+	for _, t := range joints {
+		if !t.cut() {
+			return false
+		}
+	}
+	return true
+}
+
+// checkTransitions checks that ffmpeg can render joints
+func checkTransitions(joints []transition) error {
+	if allCuts(joints) || ffmpegHasFilter("xfade") {
+		return nil
+	}
+	return errors.New("transitions need ffmpeg 4.3 or later (this one doesn't have the xfade filter); use --transition cut")
+}
+
+// uniformJoints returns the joints between n clips, all t
+func uniformJoints(n int, t transition) []transition {
+	joints := make([]transition, max(n-1, 0))
+	for i := range joints {
+		joints[i] = t
+	}
+	return joints
+}
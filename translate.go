@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// defaultTranslateModel is the chat model that translates prompts
+const defaultTranslateModel = "gpt-4o-mini"
+
+// translateInstructions is the system prompt for --translate-prompt
+const translateInstructions = `You translate prompts for a text-to-video model.
+Translate the user's prompt into the language with the code %q. Keep every
+detail: subjects, actions, camera directions, style, and any names or quoted text.
+Don't add, explain, or soften anything. Respond with a JSON object of the form
+{"language": "<code of the prompt's original language>", "translation": "<the translated prompt>"}`
+
+// languageCodeRe matches language codes such as en, ja, or pt-BR
+var languageCodeRe = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// translateOptions configure --translate-prompt
+type translateOptions struct {
+	lang  string // target language code; "" disables translation
+	model string
+}
+
+// addTranslateFlags registers the prompt translation flags
+func addTranslateFlags(fs *flag.FlagSet, t *translateOptions) {
+	fs.StringVar(&t.lang, "translate-prompt", "", "Translate the prompt into this language (e.g. en) before submitting; both versions are kept in history")
+	fs.StringVar(&t.model, "translate-model", defaultTranslateModel, "Chat model that translates the prompt")
+}
+
+// validate checks the translation flags
+func (t *translateOptions) validate() error {
+	if t.lang == "" {
+		return nil
+	}
+	if !languageCodeRe.MatchString(t.lang) {
+		return fmt.Errorf("invalid --translate-prompt %q (use a language code such as en)", t.lang)
+	}
+	if t.model == "" {
+		return errors.New("--translate-model cannot be empty")
+	}
+	return nil
+}
+
+// translatePrompt translates prompt into lang with a chat model. It returns
+// prompt unchanged, and false, if the prompt is already in lang.
+func translatePrompt(ctx context.Context, c *http.Client, baseURL, apiKey, model, prompt, lang string) (string, bool, error) {
+	body := chatRequest{
+		Model: model,
+		Messages: []chatMessage{
+			{Role: "system", Content: fmt.Sprintf(translateInstructions, lang)},
+			{Role: "user", Content: prompt},
+		},
+		ResponseFormat: map[string]string{"type": "json_object"},
+	}
+	content, err := chatCompletion(ctx, c, baseURL, apiKey, body)
+	if err != nil {
+		return "", false, err
+	}
+	var parsed struct {
+		Language    string `json:"language"`
+		Translation string `json:"translation"`
+	}
+	if err := json.Unmarshal([]byte(content), &parsed); err != nil {
+		return "", false, fmt.Errorf("parsing translation: %w", err)
+	}
+	if sameLanguage(parsed.Language, lang) {
+		return prompt, false, nil
+	}
+	translation := strings.TrimSpace(parsed.Translation)
+	if translation == "" {
+		return "", false, errors.New("chat model returned an empty translation")
+	}
+	return translation, translation != prompt, nil
+}
+
+// sameLanguage compares language codes by their primary subtag, so en-US
+// matches en
+func sameLanguage(a, b string) bool {
+	a, _, _ = strings.Cut(strings.ToLower(a), "-")
+	b, _, _ = strings.Cut(strings.ToLower(b), "-")
+	return a != "" && a == b
+}
+
+// mustTranslate applies --translate-prompt to prompt, exiting on failure.
+// It returns the prompt to submit and the original, which is "" when no
+// translation was needed.
+func (t *translateOptions) mustTranslate(common *commonOptions, apiKey, prompt string) (string, string) {
+	if t.lang == "" {
+		return prompt, ""
+	}
+	ctx, cancel := commandContext()
+	defer cancel()
+	translated, changed, err := translatePrompt(ctx, mustHTTPClient(common.net), common.baseURL, apiKey, t.model, prompt, t.lang)
+	if err != nil {
+		fail("", "translating prompt", err)
+	}
+	if !changed {
+		return prompt, ""
+	}
+	infof("Translated prompt (%s): %s\n", t.lang, translated)
+	return translated, prompt
+}
+
+// exitIfInvalid is validate for command entry points
+func (t *translateOptions) exitIfInvalid() {
+	if err := t.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,754 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// dashMode is what the dashboard's keys do at the moment
+type dashMode int
+
+const (
+	dashBrowse  dashMode = iota // moving through the list
+	dashInput                   // typing a remix prompt
+	dashConfirm                 // answering a y/N question
+)
+
+// dashRow is one video on the dashboard: the remote job, and its history
+// entry if this machine has one
+type dashRow struct {
+	video videoObject
+	entry *videoHistoryEntry
+}
+
+// active reports whether the video is still queued or rendering
+func (r dashRow) active() bool {
+	s := strings.ToLower(r.video.Status)
+	return s != "completed" && s != "succeeded" && !slices.Contains(endedStatuses, s)
+}
+
+// completed reports whether the video finished with content to download
+func (r dashRow) completed() bool {
+	s := strings.ToLower(r.video.Status)
+	return s == "completed" || s == "succeeded"
+}
+
+// localFile returns the saved copy of the video, or "" if there is none
+func (r dashRow) localFile() string {
+	if r.entry == nil || r.entry.OutputFile == "" || r.entry.OutputFile == "-" {
+		return ""
+	}
+	if _, err := os.Stat(r.entry.OutputFile); err != nil {
+		return ""
+	}
+	return r.entry.OutputFile
+}
+
+// dashboard is the state of `sora-cli tui`. Everything below mu is guarded
+// by it; the list refresh, key handling, and background actions all redraw
+// while holding it.
+type dashboard struct {
+	ctx      context.Context
+	c        *http.Client
+	baseURL  string
+	apiKey   string
+	session  string
+	limit    int
+	readOnly bool
+	out      *os.File
+	refresh  chan struct{} // asks for the list to be reloaded now
+
+	mu        sync.Mutex
+	rows      []dashRow
+	sel       int
+	top       int // first row on screen
+	loaded    bool
+	refreshed time.Time
+	busy      map[string]string // video ID -> what is being done to it
+	message   string
+	mode      dashMode
+	input     []rune
+	question  string
+	onYes     func()
+	width     int
+	height    int
+	closed    bool // the screen has been handed back to the shell
+}
+
+// runTUI implements `sora-cli tui`: a full-screen dashboard of recent
+// videos that follows renders as they progress, with keys to remix,
+// download, open, or cancel the selected one
+func runTUI(args []string) {
+	fs := newFlagSet("tui", "[flags]")
+	var (
+		limit    int
+		interval time.Duration
+		session  string
+		common   commonOptions
+	)
+	fs.IntVarP(&limit, "limit", "n", 50, "Show this many of the most recent videos")
+	fs.DurationVar(&interval, "refresh", 2*time.Second, "How often to reload the list")
+	addSessionFlag(fs, &session)
+	addCommonFlags(fs, &common)
+	fs.Parse(args)
+
+	if fs.NArg() > 0 || limit < 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if interval < time.Second {
+		fmt.Fprintf(os.Stderr, "--refresh must be at least 1s, got %s\n", interval)
+		os.Exit(2)
+	}
+	if jsonOutput {
+		fmt.Fprintln(os.Stderr, "Cannot use --json with tui")
+		os.Exit(2)
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stderr.Fd())) {
+		fmt.Fprintln(os.Stderr, "tui needs a terminal; use 'sora-cli remote list' in scripts")
+		os.Exit(2)
+	}
+
+	apiKey := common.mustAPIKey()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d := &dashboard{
+		ctx:      ctx,
+		c:        mustHTTPClient(common.net),
+		baseURL:  common.baseURL,
+		apiKey:   apiKey,
+		session:  session,
+		limit:    limit,
+		readOnly: common.isReadOnly(),
+		out:      os.Stderr,
+		refresh:  make(chan struct{}, 1),
+		busy:     map[string]string{},
+	}
+
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		fail("", "failed to start the dashboard", err)
+	}
+	// Draw on the alternate screen, so the shell's scrollback comes back
+	// untouched on exit
+	fmt.Fprint(d.out, "\x1b[?1049h\x1b[?25l")
+	defer func() {
+		fmt.Fprint(d.out, "\x1b[?25h\x1b[?1049l")
+		term.Restore(fd, state)
+	}()
+
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			d.reload()
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			case <-d.refresh:
+			}
+		}
+	}()
+
+	keys := make(chan string)
+	go readKeys(os.Stdin, keys)
+	// Redraw soon after the terminal is resized; there is no portable
+	// resize signal
+	resize := time.NewTicker(250 * time.Millisecond)
+	defer resize.Stop()
+	for {
+		select {
+		case k, ok := <-keys:
+			if !ok {
+				d.mu.Lock()
+				d.closed = true
+				d.mu.Unlock()
+				return
+			}
+			d.mu.Lock()
+			quit := d.key(k)
+			d.closed = quit
+			d.draw()
+			d.mu.Unlock()
+			if quit {
+				return
+			}
+		case <-resize.C:
+			d.mu.Lock()
+			if w, h := d.size(); w != d.width || h != d.height {
+				d.draw()
+			}
+			d.mu.Unlock()
+		}
+	}
+}
+
+// readKeys sends each key read from f to keys, named like "up" or "enter"
+// for special keys and as the character otherwise. It closes keys when f
+// can't be read. A read holds one key, or several when text is pasted, so
+// a lone ESC is the Escape key rather than the start of a sequence.
+func readKeys(f *os.File, keys chan<- string) {
+	defer close(keys)
+	buf := make([]byte, 256)
+	for {
+		n, err := f.Read(buf)
+		if err != nil {
+			return
+		}
+		for _, k := range parseKeys(buf[:n]) {
+			keys <- k
+		}
+	}
+}
+
+// escapeKeys names the escape sequences the dashboard understands
+var escapeKeys = map[string]string{
+	"[A": "up", "OA": "up", "[B": "down", "OB": "down",
+	"[5~": "pgup", "[6~": "pgdn",
+	"[H": "home", "OH": "home", "[1~": "home", "[7~": "home",
+	"[F": "end", "OF": "end", "[4~": "end", "[8~": "end",
+}
+
+// parseKeys splits one read from the terminal into keys
+func parseKeys(b []byte) []string {
+	var keys []string
+	for len(b) > 0 {
+		switch b[0] {
+		case 27:
+			if len(b) == 1 {
+				return append(keys, "esc")
+			}
+			// A sequence ends at its first letter or '~' after the introducer
+			end := 2
+			if b[1] == '[' || b[1] == 'O' {
+				for end < len(b) && end < 8 {
+					c := b[end]
+					end++
+					if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c == '~' {
+						break
+					}
+				}
+			}
+			if k := escapeKeys[string(b[1:end])]; k != "" {
+				keys = append(keys, k)
+			}
+			b = b[end:]
+			continue
+		case '\r', '\n':
+			keys = append(keys, "enter")
+		case 127, 8:
+			keys = append(keys, "backspace")
+		case 3:
+			keys = append(keys, "ctrl-c")
+		default:
+			r, size := utf8.DecodeRune(b)
+			if unicode.IsPrint(r) {
+				keys = append(keys, string(r))
+			}
+			b = b[size:]
+			continue
+		}
+		b = b[1:]
+	}
+	return keys
+}
+
+// reload fetches the recent videos and history and redraws. Rendering
+// videos are listed first, then the rest newest first.
+func (d *dashboard) reload() {
+	videos, err := listRecentVideos(d.ctx, d.c, d.baseURL, d.apiKey, d.limit)
+	h, herr := loadHistory()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	defer d.draw()
+	if err != nil {
+		if d.ctx.Err() == nil {
+			d.message = fmt.Sprintf("Refresh failed: %v", err)
+		}
+		return
+	}
+	if herr != nil {
+		d.message = fmt.Sprintf("Failed to load history: %v", herr)
+	}
+	local := map[string]*videoHistoryEntry{}
+	if h != nil {
+		// History is newest first; keep the newest entry for an ID
+		for i := range h.Videos {
+			if _, ok := local[h.Videos[i].ID]; !ok {
+				local[h.Videos[i].ID] = &h.Videos[i]
+			}
+		}
+	}
+	rows := make([]dashRow, 0, len(videos))
+	for _, v := range videos {
+		rows = append(rows, dashRow{video: v, entry: local[v.ID]})
+	}
+	slices.SortStableFunc(rows, func(a, b dashRow) int {
+		switch {
+		case a.active() == b.active():
+			return 0
+		case a.active():
+			return -1
+		}
+		return 1
+	})
+
+	// Keep the same video selected as rows move
+	if sel := d.selected(); sel != nil {
+		for i, r := range rows {
+			if r.video.ID == sel.video.ID {
+				d.sel = i
+				break
+			}
+		}
+	}
+	d.rows, d.loaded, d.refreshed = rows, true, time.Now()
+	d.sel = max(0, min(d.sel, len(d.rows)-1))
+}
+
+// selected returns the selected row, or nil if the list is empty
+func (d *dashboard) selected() *dashRow {
+	if d.sel < 0 || d.sel >= len(d.rows) {
+		return nil
+	}
+	return &d.rows[d.sel]
+}
+
+// reloadSoon asks the refresh loop to reload now
+func (d *dashboard) reloadSoon() {
+	select {
+	case d.refresh <- struct{}{}:
+	default:
+	}
+}
+
+// key handles one key press. It reports whether the dashboard should close.
+func (d *dashboard) key(k string) bool {
+	switch d.mode {
+	case dashInput:
+		switch k {
+		case "enter":
+			d.mode = dashBrowse
+			d.submitRemix(strings.TrimSpace(string(d.input)))
+		case "esc", "ctrl-c":
+			d.mode, d.message = dashBrowse, "Remix canceled"
+		case "backspace":
+			if len(d.input) > 0 {
+				d.input = d.input[:len(d.input)-1]
+			}
+		default:
+			if utf8.RuneCountInString(k) == 1 {
+				d.input = append(d.input, []rune(k)...)
+			}
+		}
+		return false
+	case dashConfirm:
+		d.mode = dashBrowse
+		if k == "y" || k == "Y" {
+			d.onYes()
+		} else {
+			d.message = "Canceled"
+		}
+		return false
+	}
+
+	page := max(1, d.listHeight()-1)
+	switch k {
+	case "q", "ctrl-c":
+		return true
+	case "up", "k":
+		d.sel--
+	case "down", "j":
+		d.sel++
+	case "pgup":
+		d.sel -= page
+	case "pgdn":
+		d.sel += page
+	case "home", "g":
+		d.sel = 0
+	case "end", "G":
+		d.sel = len(d.rows) - 1
+	case "r":
+		d.startRemix()
+	case "d":
+		d.download()
+	case "o":
+		d.open()
+	case "c":
+		d.cancel()
+	case "?":
+		d.message = "r remix · d download · o open in the player · c cancel a render · q quit"
+	}
+	d.sel = max(0, min(d.sel, len(d.rows)-1))
+	return false
+}
+
+// startRemix asks for the prompt to remix the selected video with
+func (d *dashboard) startRemix() {
+	r := d.selected()
+	switch {
+	case r == nil:
+	case d.readOnly:
+		d.message = "Read-only mode is on, so videos can't be remixed here"
+	case !r.completed():
+		d.message = fmt.Sprintf("%s hasn't finished, so it can't be remixed yet", r.video.ID)
+	default:
+		d.mode, d.input = dashInput, nil
+	}
+}
+
+// submitRemix screens prompt, confirms the cost if it is above
+// confirm_above, and submits the remix in the background. The new job is
+// recorded in history as pending, like --no-wait, so 'd' or attach can
+// fetch it once it finishes.
+func (d *dashboard) submitRemix(prompt string) {
+	r := d.selected()
+	if r == nil || prompt == "" {
+		d.message = "Remix canceled"
+		return
+	}
+	if err := screenText("prompt", prompt); err != nil {
+		d.message = fmt.Sprintf("Error: %v", err)
+		return
+	}
+	source := r.video
+	submit := func() {
+		d.message = fmt.Sprintf("Submitting remix of %s...", source.ID)
+		go func() {
+			id, reqID, err := remixVideo(d.ctx, d.c, d.baseURL, d.apiKey, source.ID, remixVideoRequest{Prompt: prompt}, "")
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			defer d.draw()
+			if err != nil {
+				d.message = fmt.Sprintf("Remix of %s failed: %v", source.ID, err)
+				return
+			}
+			entry := videoHistoryEntry{
+				ID:          id,
+				Prompt:      prompt,
+				CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+				Model:       source.Model,
+				Session:     d.session,
+				RequestID:   reqID,
+				RemixedFrom: &source.ID,
+				Pending:     true,
+			}
+			if err := addToHistory(entry); err != nil {
+				d.message = fmt.Sprintf("Submitted %s, but failed to save it to history: %v", id, err)
+			} else {
+				d.message = fmt.Sprintf("Submitted %s, remixing %s", id, source.ID)
+			}
+			d.reloadSoon()
+		}()
+	}
+
+	cost, ok := videoCost(source.Model, source.Seconds)
+	if limit := cfg.confirmAbove(); ok && limit >= 0 && cost > limit {
+		d.ask(fmt.Sprintf("The remix will cost about $%.2f, more than $%.2f. Submit? [y/N]", cost, limit), submit)
+		return
+	}
+	submit()
+}
+
+// download saves the selected video in the background, where download
+// would, and points its history entry at the file
+func (d *dashboard) download() {
+	r := d.selected()
+	switch {
+	case r == nil:
+		return
+	case d.busy[r.video.ID] != "":
+		d.message = fmt.Sprintf("%s is already %s", r.video.ID, d.busy[r.video.ID])
+		return
+	case !r.completed():
+		d.message = fmt.Sprintf("%s hasn't finished, so there is nothing to download yet", r.video.ID)
+		return
+	}
+	v := r.video
+	d.busy[v.ID] = "downloading"
+	go func() {
+		err := checkDownloadable(d.ctx, d.c, d.baseURL, d.apiKey, v.ID)
+		var output string
+		if err == nil {
+			output, err = saveJobOutput(d.ctx, d.c, d.baseURL, d.apiKey, v.ID, jobOptions{quiet: true}, newPhaseTimings())
+		}
+		if err == nil {
+			var found bool
+			found, err = updateHistoryEntry(v.ID, func(e *videoHistoryEntry) {
+				e.OutputFile = output
+				e.Pending = false
+			})
+			if err == nil && !found {
+				err = addToHistory(remoteHistoryEntry(v.statusResponse(), output, d.session))
+			}
+			if err != nil {
+				err = fmt.Errorf("saved to %s, but failed to update history: %w", output, err)
+			}
+		}
+
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		defer d.draw()
+		delete(d.busy, v.ID)
+		if err != nil {
+			d.message = fmt.Sprintf("Download of %s failed: %v", v.ID, err)
+			return
+		}
+		d.message = fmt.Sprintf("Saved %s to %s", v.ID, output)
+		d.reloadSoon()
+	}()
+}
+
+// open plays the selected video's saved copy
+func (d *dashboard) open() {
+	r := d.selected()
+	if r == nil {
+		return
+	}
+	path := r.localFile()
+	if path == "" {
+		d.message = fmt.Sprintf("%s isn't saved on this machine; press d to download it", r.video.ID)
+		return
+	}
+	cmd, err := playerCommand(path)
+	if err == nil {
+		err = cmd.Start()
+	}
+	if err != nil {
+		d.message = fmt.Sprintf("Could not open %s: %v", path, err)
+		return
+	}
+	cmd.Process.Release()
+	d.message = "Opened " + path
+}
+
+// cancel stops the selected render after asking. The API has no separate
+// cancel, so the job is deleted.
+func (d *dashboard) cancel() {
+	r := d.selected()
+	switch {
+	case r == nil:
+		return
+	case d.readOnly:
+		d.message = "Read-only mode is on, so renders can't be canceled here"
+		return
+	case !r.active():
+		d.message = fmt.Sprintf("%s isn't rendering; use 'sora-cli delete' to remove finished videos", r.video.ID)
+		return
+	}
+	id := r.video.ID
+	d.ask(fmt.Sprintf("Cancel %s? It is deleted from your API account. [y/N]", id), func() {
+		d.busy[id] = "canceling"
+		go func() {
+			err := deleteVideo(d.ctx, d.c, d.baseURL, d.apiKey, id)
+			if err == nil {
+				_, err = updateHistoryEntry(id, func(e *videoHistoryEntry) {
+					e.Pending = false
+					e.Remote = remoteDeleted
+				})
+				if err != nil {
+					err = fmt.Errorf("canceled, but failed to update history: %w", err)
+				}
+			}
+
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			defer d.draw()
+			delete(d.busy, id)
+			if err != nil {
+				d.message = fmt.Sprintf("Cancel of %s failed: %v", id, err)
+				return
+			}
+			d.message = "Canceled " + id
+			d.reloadSoon()
+		}()
+	})
+}
+
+// ask shows question and runs onYes if it is answered y
+func (d *dashboard) ask(question string, onYes func()) {
+	d.mode, d.question, d.onYes = dashConfirm, question, onYes
+}
+
+// size returns the terminal's size, or 80x24 if it is unknown
+func (d *dashboard) size() (int, int) {
+	w, h, err := term.GetSize(int(d.out.Fd()))
+	if err != nil || w <= 0 || h <= 0 {
+		return 80, 24
+	}
+	return w, h
+}
+
+// listHeight is how many rows of videos fit between the header and footer
+func (d *dashboard) listHeight() int {
+	_, h := d.size()
+	return max(1, h-4)
+}
+
+// draw repaints the whole screen: a summary line, the column headers, the
+// videos, a message line, and the keys
+func (d *dashboard) draw() {
+	if d.closed {
+		return
+	}
+	d.width, d.height = d.size()
+	w, rows := d.width, d.listHeight()
+
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	line := func(s string) {
+		b.WriteString(s)
+		b.WriteString("\x1b[K\r\n")
+	}
+
+	var rendering, queued int
+	for _, r := range d.rows {
+		switch {
+		case !r.active():
+		case isQueuedStatus(r.video.Status):
+			queued++
+		default:
+			rendering++
+		}
+	}
+	title := "sora-cli"
+	if workspace != "" {
+		title += " · " + workspace
+	}
+	summary := fmt.Sprintf("%s · %d rendering, %d queued, %d recent", title, rendering, queued, len(d.rows))
+	updated := "loading..."
+	if d.loaded {
+		updated = "updated " + d.refreshed.Format("15:04:05")
+	}
+	pad := max(1, w-utf8.RuneCountInString(summary)-utf8.RuneCountInString(updated))
+	line(colorBold + truncate(summary, w) + colorReset + strings.Repeat(" ", pad) + colorDim + updated + colorReset)
+
+	idWidth := 8
+	for _, r := range d.rows {
+		idWidth = max(idWidth, len(r.video.ID))
+	}
+	idWidth = min(idWidth, 30)
+	const statusWidth, progressWidth, modelWidth = 11, 16, 11
+	promptWidth := max(10, w-idWidth-statusWidth-progressWidth-modelWidth-6)
+	cols := func(id, status, progress, model, prompt string) string {
+		return fmt.Sprintf(" %-*s %-*s %-*s %-*s %s", idWidth, truncate(id, idWidth), statusWidth, truncate(status, statusWidth),
+			progressWidth, truncate(progress, progressWidth), modelWidth, truncate(model, modelWidth), truncate(prompt, promptWidth))
+	}
+	line(colorDim + truncate(cols("ID", "STATUS", "PROGRESS", "MODEL", "PROMPT"), w) + colorReset)
+
+	if d.sel < d.top {
+		d.top = d.sel
+	} else if d.sel >= d.top+rows {
+		d.top = d.sel - rows + 1
+	}
+	d.top = max(0, min(d.top, len(d.rows)-rows))
+	for i := 0; i < rows; i++ {
+		n := d.top + i
+		if n >= len(d.rows) {
+			if n == 0 && d.loaded {
+				line(colorDim + " No videos on this API account yet" + colorReset)
+			} else {
+				line("")
+			}
+			continue
+		}
+		r := d.rows[n]
+		status, progress, color := d.describe(r)
+		prompt := singleLine(cmp.Or(r.video.Prompt, entryPrompt(r.entry)))
+		text := truncate(cols(r.video.ID, status, progress, r.video.Model, prompt), w)
+		switch {
+		case n == d.sel:
+			line("\x1b[7m" + text + strings.Repeat(" ", max(0, w-utf8.RuneCountInString(text))) + colorReset)
+		case color != "":
+			line(color + text + colorReset)
+		default:
+			line(text)
+		}
+	}
+
+	switch d.mode {
+	case dashInput:
+		id := ""
+		if r := d.selected(); r != nil {
+			id = r.video.ID
+		}
+		// Keep the end of a long prompt, where the typing is, in view
+		prefix := fmt.Sprintf("Remix %s: ", id)
+		text := string(d.input)
+		if avail := w - utf8.RuneCountInString(prefix) - 1; utf8.RuneCountInString(text) > avail && avail > 1 {
+			rs := []rune(text)
+			text = "…" + string(rs[len(rs)-avail+1:])
+		}
+		line(colorBold + prefix + colorReset + text + "\x1b[7m \x1b[0m")
+		line(colorDim + truncate("Enter submits · Esc cancels", w) + colorReset)
+	case dashConfirm:
+		line(colorYellow + truncate(d.question, w) + colorReset)
+		line(colorDim + truncate("y confirms · any other key cancels", w) + colorReset)
+	default:
+		line(truncate(d.message, w))
+		help := "↑↓ select  r remix  d download  o open  c cancel  q quit"
+		if d.readOnly {
+			help = "↑↓ select  d download  o open  q quit  (read-only)"
+		}
+		b.WriteString(colorDim + truncate(help, w) + colorReset + "\x1b[K")
+	}
+	b.WriteString("\x1b[J")
+	fmt.Fprint(d.out, b.String())
+}
+
+// describe returns a row's status and progress columns and its color
+func (d *dashboard) describe(r dashRow) (status, progress, color string) {
+	v := r.video
+	if busy := d.busy[v.ID]; busy != "" {
+		return busy + "...", "", colorCyan
+	}
+	switch {
+	case r.active() && isQueuedStatus(v.Status):
+		return "queued", "", colorCyan
+	case r.active():
+		return "rendering", progressBar(v.Progress, 10), colorCyan
+	case r.completed():
+		if path := r.localFile(); path != "" {
+			return "saved", filepath.Base(path), colorGreen
+		}
+		when, _ := expiresIn(v.ExpiresAt, time.Now())
+		if when == "-" {
+			return "ready", "", ""
+		}
+		if when == "expired" {
+			return "ready", "expired", colorDim
+		}
+		return "ready", "expires " + when, ""
+	}
+	return strings.ToLower(v.Status), "", colorRed
+}
+
+// progressBar draws pct as a bar width cells wide, followed by the number
+func progressBar(pct, width int) string {
+	pct = max(0, min(pct, 100))
+	filled := pct * width / 100
+	return strings.Repeat("█", filled) + strings.Repeat("░", width-filled) + fmt.Sprintf(" %d%%", pct)
+}
+
+// entryPrompt returns e's prompt, or "" for nil
+func entryPrompt(e *videoHistoryEntry) string {
+	if e == nil {
+		return ""
+	}
+	return e.Prompt
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+// version, commit, and date identify the build. Release builds set them
+// with -ldflags:
+//
+//	go build -ldflags "-X main.version=1.4.0 -X main.commit=$(git rev-parse HEAD) -X main.date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Unset values fall back to the module version and VCS details the Go
+// toolchain embeds (go install, or go build in a git checkout).
+var (
+	version string
+	commit  string
+	date    string
+)
+
+// buildInfo describes the build of the running binary
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	Date      string `json:"date,omitempty"`
+	Modified  bool   `json:"modified,omitempty"` // built from a checkout with uncommitted changes
+	GoVersion string `json:"go_version"`
+}
+
+// currentBuild returns the build details, computed once
+var currentBuild = sync.OnceValue(func() buildInfo {
+	b := buildInfo{Version: version, Commit: commit, Date: date, GoVersion: runtime.Version()}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if b.Version == "" && info.Main.Version != "(devel)" {
+			b.Version = info.Main.Version
+		}
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if b.Commit == "" {
+					b.Commit = s.Value
+				}
+			case "vcs.time":
+				if b.Date == "" {
+					b.Date = s.Value
+				}
+			case "vcs.modified":
+				// An ldflags commit describes the source, not this checkout
+				b.Modified = s.Value == "true" && commit == ""
+			}
+		}
+	}
+	if b.Version == "" {
+		b.Version = "dev"
+	}
+	return b
+})
+
+// String is the one-line form printed by --version
+func (b buildInfo) String() string {
+	var details []string
+	if b.Commit != "" {
+		c := shortCommit(b.Commit)
+		if b.Modified {
+			c += "-dirty"
+		}
+		details = append(details, "commit "+c)
+	}
+	if b.Date != "" {
+		details = append(details, "built "+b.Date)
+	}
+	details = append(details, b.GoVersion)
+	return fmt.Sprintf("sora-cli %s (%s)", b.Version, strings.Join(details, ", "))
+}
+
+// tag is the compact form recorded in history, e.g. "1.4.0+3f2a9c1"
+func (b buildInfo) tag() string {
+	// Pseudo-versions from go build already name the commit
+	if b.Commit == "" || strings.Contains(b.Version, shortCommit(b.Commit)) {
+		return b.Version
+	}
+	t := b.Version + "+" + shortCommit(b.Commit)
+	if b.Modified {
+		t += "-dirty"
+	}
+	return t
+}
+
+// userAgent is sent with every API request
+func userAgent() string {
+	b := currentBuild()
+	return fmt.Sprintf("sora-cli/%s (%s/%s; %s)", b.tag(), runtime.GOOS, runtime.GOARCH, b.GoVersion)
+}
+
+// shortCommit abbreviates a commit hash as git does
+func shortCommit(c string) string {
+	if len(c) > 7 {
+		return c[:7]
+	}
+	return c
+}
+
+// runVersion implements `sora-cli version` and --version
+func runVersion(args []string) {
+	fs := newFlagSet("version", "[flags]")
+	fs.Parse(args)
+	if jsonOutput {
+		printJSON(currentBuild())
+		return
+	}
+	fmt.Println(currentBuild())
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+// workspace is the active workspace, from --workspace or SORA_WORKSPACE.
+// Its directory under ~/.sora-cli/workspaces takes the place of
+// ~/.sora-cli, so it has its own config, history, and prompt history.
+var workspace string
+
+// workspaceNamePattern limits names to ones that are safe as a directory
+var workspaceNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+var workspaceCommands = []command{
+	{"list", "List workspaces", runWorkspaceList},
+	{"create", "Create a workspace with its own config and history", runWorkspaceCreate},
+}
+
+// runWorkspace implements `sora-cli workspace <command>`
+func runWorkspace(args []string) {
+	runSubcommand("workspace", workspaceCommands, args)
+}
+
+// workspacesDir returns the directory holding every workspace
+func workspacesDir() (string, error) {
+	dir, err := baseDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "workspaces"), nil
+}
+
+// workspaceArgs takes --workspace out of the command line args, falling
+// back to SORA_WORKSPACE, and makes it the active workspace. When
+// completing, the word being completed is left alone, and so is a
+// --workspace still waiting for its value.
+func workspaceArgs(args []string) ([]string, error) {
+	last := len(args)
+	if last > 0 && args[0] == "__complete" {
+		last--
+	}
+	rest, name, err := takeWorkspaceFlag(args[:last])
+	if err != nil {
+		if last == len(args) {
+			return nil, err
+		}
+		rest, name = args[:last], ""
+	}
+	rest = append(rest, args[last:]...)
+	if name == "" {
+		name = os.Getenv("SORA_WORKSPACE")
+	}
+	// `workspace create` has to work before the workspace exists
+	mustExist := len(rest) == 0 || rest[0] != "workspace"
+	return rest, useWorkspace(name, mustExist)
+}
+
+// takeWorkspaceFlag removes --workspace NAME (or --workspace=NAME) from
+// args and returns the name, or "" if it isn't given. main reads it before
+// anything else, since the workspace decides which config is loaded.
+func takeWorkspaceFlag(args []string) ([]string, string, error) {
+	var rest []string
+	name := ""
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "--":
+			return append(rest, args[i:]...), name, nil
+		case a == "--workspace":
+			if i+1 == len(args) {
+				return nil, "", errors.New("--workspace needs a workspace name")
+			}
+			name = args[i+1]
+			i++
+		case strings.HasPrefix(a, "--workspace="):
+			name = strings.TrimPrefix(a, "--workspace=")
+		default:
+			rest = append(rest, a)
+		}
+	}
+	return rest, name, nil
+}
+
+// useWorkspace makes name the active workspace. Unless mustExist is false
+// it has to have been created first, so a misspelled name doesn't quietly
+// start an empty history.
+func useWorkspace(name string, mustExist bool) error {
+	if name == "" {
+		return nil
+	}
+	if !workspaceNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid workspace name %q (use letters, digits, '.', '_', and '-')", name)
+	}
+	workspace = name
+	if !mustExist {
+		return nil
+	}
+	dir, err := soraDir()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("workspace %q doesn't exist; create it with 'sora-cli workspace create %s'", name, name)
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// loadWorkspaceEnv loads the active workspace's .env, if it has one. Its
+// values win over the environment, so a workspace's API key is never
+// mixed up with another client's exported in the shell.
+func loadWorkspaceEnv() {
+	if workspace == "" {
+		return
+	}
+	dir, err := soraDir()
+	if err != nil {
+		return
+	}
+	path := filepath.Join(dir, ".env")
+	if err := godotenv.Overload(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		infof("Warning: reading %s: %v\n", path, err)
+	}
+}
+
+// workspaceInfo describes a workspace for `workspace list --json`
+type workspaceInfo struct {
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	Active bool   `json:"active"`
+}
+
+// runWorkspaceList implements `sora-cli workspace list`
+func runWorkspaceList(args []string) {
+	fs := newFlagSet("workspace list", "[flags]")
+	fs.Parse(args)
+
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	list, err := listWorkspaces()
+	if err != nil {
+		fail("", "failed to list workspaces", err)
+	}
+	if jsonOutput {
+		if list == nil {
+			list = []workspaceInfo{}
+		}
+		printJSON(list)
+		return
+	}
+	if len(list) == 0 {
+		fmt.Fprintln(os.Stderr, "No workspaces yet; create one with 'sora-cli workspace create <name>'")
+		return
+	}
+	for _, w := range list {
+		mark := " "
+		if w.Active {
+			mark = "*"
+		}
+		fmt.Printf("%s %s\t%s\n", mark, w.Name, w.Path)
+	}
+}
+
+// listWorkspaces returns the workspaces that have been created, by name
+func listWorkspaces() ([]workspaceInfo, error) {
+	dir, err := workspacesDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var list []workspaceInfo
+	for _, e := range entries {
+		if e.IsDir() && workspaceNamePattern.MatchString(e.Name()) {
+			list = append(list, workspaceInfo{Name: e.Name(), Path: filepath.Join(dir, e.Name()), Active: e.Name() == workspace})
+		}
+	}
+	return list, nil
+}
+
+// runWorkspaceCreate implements `sora-cli workspace create <name>`
+func runWorkspaceCreate(args []string) {
+	fs := newFlagSet("workspace create", "<name> [flags]")
+	var copyConfig bool
+	fs.BoolVar(&copyConfig, "copy-config", false, "Start from a copy of the current config file instead of the built-in defaults")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	// A new workspace starts without the current config's read_only
+	(&commonOptions{profile: cfg.Profile}).requireWritable("create workspaces")
+
+	name := fs.Arg(0)
+	if !workspaceNamePattern.MatchString(name) {
+		fmt.Fprintf(os.Stderr, "Invalid workspace name %q (use letters, digits, '.', '_', and '-')\n", name)
+		os.Exit(2)
+	}
+
+	// Read the current config before the new workspace becomes current
+	var config []byte
+	if copyConfig {
+		path, err := getConfigPath()
+		if err == nil {
+			config, err = os.ReadFile(path)
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			fail("", "failed to read the config file", err)
+		}
+	}
+
+	parent, err := workspacesDir()
+	if err != nil {
+		fail("", "failed to create workspace", err)
+	}
+	dir := filepath.Join(parent, name)
+	if err := os.MkdirAll(parent, 0o700); err != nil {
+		fail("", "failed to create workspace", err)
+	}
+	if err := os.Mkdir(dir, 0o700); errors.Is(err, os.ErrExist) {
+		fmt.Fprintf(os.Stderr, "Workspace %q already exists at %s\n", name, dir)
+		os.Exit(1)
+	} else if err != nil {
+		fail("", "failed to create workspace", err)
+	}
+	if config != nil {
+		if err := os.WriteFile(filepath.Join(dir, "config.toml"), config, 0o600); err != nil {
+			fail("", "failed to copy the config file", err)
+		}
+	}
+	infof("Created workspace %s at %s\n", name, dir)
+	infof("Use it with --workspace %s, or export SORA_WORKSPACE=%s\n", name, name)
+}